@@ -0,0 +1,520 @@
+// region: packages
+
+package fabric
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// endregion: packages
+// region: types
+
+// CA is a client of the REST API of a Fabric CA, over TLS verified against TLSCertPath (or
+// TLSCertPEM) if URL is https.
+type CA struct {
+	CAName      string        `json:"CAName"`
+	TLSCertPath string        `json:"TLSCertPath"`
+	Timeout     time.Duration `json:"Timeout"`
+	URL         string        `json:"URL"`
+
+	TLSCertPEM []byte       `json:"-"`
+	client     *http.Client `json:"-"`
+}
+
+// EnrollRequest enrolls ID with Secret, Hosts are the subject alternative names of the
+// certificate and Profile is the signing profile of the CA, eg. "tls".
+type EnrollRequest struct {
+	Hosts   []string
+	ID      string
+	Profile string
+	Secret  string
+}
+
+// Enrollment is a certificate issued by the CA and its private key, generated locally.
+type Enrollment struct {
+	CAChain     []byte
+	Certificate []byte
+	PrivateKey  []byte
+}
+
+// Registration is a new identity, an empty Secret is generated by the CA.
+type Registration struct {
+	Affiliation    string        `json:"affiliation"`
+	Attributes     []CAAttribute `json:"attrs,omitempty"`
+	CAName         string        `json:"caname,omitempty"`
+	ID             string        `json:"id"`
+	MaxEnrollments int           `json:"max_enrollments,omitempty"`
+	Secret         string        `json:"secret,omitempty"`
+	Type           string        `json:"type,omitempty"`
+}
+
+type CAAttribute struct {
+	ECert bool   `json:"ecert,omitempty"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type caResponse struct {
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+	Success bool            `json:"success"`
+}
+
+type caEnrollResult struct {
+	Cert       string `json:"Cert"`
+	ServerInfo struct {
+		CAChain string `json:"CAChain"`
+		CAName  string `json:"CAName"`
+	} `json:"ServerInfo"`
+}
+
+const (
+	CAPathEnroll   string        = "/api/v1/enroll"
+	CAPathReenroll string        = "/api/v1/reenroll"
+	CAPathRegister string        = "/api/v1/register"
+	CATimeout      time.Duration = 30 * time.Second
+)
+
+// endregion: types
+// region: init
+
+func (ca *CA) Init() error {
+	u, err := url.Parse(ca.URL)
+	if err != nil || len(u.Host) == 0 {
+		return fmt.Errorf("invalid CA url '%s'", ca.URL)
+	}
+	if ca.Timeout == 0 {
+		ca.Timeout = CATimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if u.Scheme == "https" {
+		rootPEM := ca.TLSCertPEM
+		if len(rootPEM) == 0 {
+			if len(ca.TLSCertPath) == 0 {
+				return errors.New("https CA needs a TLS root certificate")
+			}
+			rootPEM, err = os.ReadFile(ca.TLSCertPath)
+			if err != nil {
+				return fmt.Errorf("failed to read CA TLS root certificate: %w", err)
+			}
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(rootPEM) {
+			return fmt.Errorf("no certificate in %s", ca.TLSCertPath)
+		}
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+	}
+	ca.client = &http.Client{Timeout: ca.Timeout, Transport: transport}
+	return nil
+}
+
+// endregion: init
+// region: api
+
+// Enroll obtains the first certificate of an identity registered before.
+func (ca *CA) Enroll(r EnrollRequest) (*Enrollment, error) {
+	key, csr, err := newCSR(r.ID, r.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]interface{}{"caname": ca.CAName, "certificate_request": string(csr), "profile": r.Profile})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := ca.request(CAPathEnroll, body)
+	if err != nil {
+		return nil, err
+	}
+	request.SetBasicAuth(r.ID, r.Secret)
+	return ca.enrollment(request, key)
+}
+
+// Reenroll renews the certificate of an identity with a new private key, the subject and the
+// hosts of the current certificate are kept. The request is signed with the current key, so the
+// current certificate must not be expired or revoked.
+func (ca *CA) Reenroll(certificatePEM, keyPEM []byte) (*Enrollment, error) {
+	certificate, err := parseCertificate(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	hosts := append([]string{}, certificate.DNSNames...)
+	for _, ip := range certificate.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	key, csr, err := newCSR(certificate.Subject.CommonName, hosts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]interface{}{"caname": ca.CAName, "certificate_request": string(csr)})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := ca.request(CAPathReenroll, body)
+	if err != nil {
+		return nil, err
+	}
+	err = signRequest(request, body, certificatePEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return ca.enrollment(request, key)
+}
+
+// Register creates a new identity as the registrar identified by certificatePEM and keyPEM, and
+// returns its enrollment secret.
+func (ca *CA) Register(certificatePEM, keyPEM []byte, r *Registration) (string, error) {
+	if len(r.CAName) == 0 {
+		r.CAName = ca.CAName
+	}
+	body, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := ca.request(CAPathRegister, body)
+	if err != nil {
+		return "", err
+	}
+	err = signRequest(request, body, certificatePEM, keyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	result := struct {
+		Secret string `json:"secret"`
+	}{}
+	err = ca.do(request, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.Secret, nil
+}
+
+// endregion: api
+// region: credentials
+
+// CertificateExpiry returns the end of the validity of the first certificate in certificatePEM.
+func CertificateExpiry(certificatePEM []byte) (time.Time, error) {
+	certificate, err := parseCertificate(certificatePEM)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certificate.NotAfter, nil
+}
+
+// ReadCredentials reads the certificate at certPath and the private key at keyPath, a keystore
+// directory, whose file holding the key of the certificate is read, or a key file.
+func ReadCredentials(certPath, keyPath string) (certificatePEM, keyPEM []byte, err error) {
+	certificatePEM, err = os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	keyPEM, err = readKey(keyPath, certificatePEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certificatePEM, keyPEM, nil
+}
+
+// WriteCredentials replaces the certificate at certPath and the private key at keyPath, a
+// keystore directory or a key file. The old key is kept until the certificate has been
+// replaced: in a keystore directory the new key is added next to it, named after its digest, and
+// the key of the replaced certificate is removed last, so a reader always finds the key of the
+// certificate it reads. A key file is replaced before the certificate and restored if the
+// certificate can not be written, a reader in between sees a pair not matching, which
+// Client.Reload rejects, rather than a partial file.
+func WriteCredentials(certPath, keyPath string, certificatePEM, keyPEM []byte) error {
+	replaced, _ := os.ReadFile(certPath)
+	oldKeyFile, err := keyFile(keyPath, replaced)
+	if err != nil {
+		return err
+	}
+
+	// region: key file
+
+	dir, err := isKeystore(keyPath)
+	if err != nil {
+		return err
+	}
+	if !dir {
+		previous, readErr := os.ReadFile(oldKeyFile)
+		err = writeFileAtomic(oldKeyFile, keyPEM, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to write private key: %w", err)
+		}
+		err = writeFileAtomic(certPath, certificatePEM, 0644)
+		if err != nil {
+			if readErr == nil {
+				writeFileAtomic(oldKeyFile, previous, 0600)
+			}
+			return fmt.Errorf("failed to write certificate: %w", err)
+		}
+		return nil
+	}
+
+	// endregion: key file
+	// region: keystore
+
+	newKeyFile := filepath.Join(keyPath, fmt.Sprintf("%x_sk", sha256.Sum256(keyPEM)))
+	err = writeFileAtomic(newKeyFile, keyPEM, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	err = writeFileAtomic(certPath, certificatePEM, 0644)
+	if err != nil {
+		if newKeyFile != oldKeyFile {
+			os.Remove(newKeyFile)
+		}
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if newKeyFile != oldKeyFile {
+		err = os.Remove(oldKeyFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove replaced private key: %w", err)
+		}
+	}
+	return nil
+
+	// endregion: keystore
+
+}
+
+// Credentials returns the certificate and the private key c currently signs with.
+func (c *Client) Credentials() (certificatePEM, keyPEM []byte, err error) {
+	if c.material == nil {
+		return nil, nil, errors.New("client has no credentials of its own, fabric.Client.Init() first")
+	}
+	c.material.mutex.RLock()
+	defer c.material.mutex.RUnlock()
+	return c.material.certificate, c.material.key, nil
+}
+
+// TLSRoot returns the TLS root c currently verifies the gateway peer against.
+func (c *Client) TLSRoot() ([]byte, error) {
+	if c.material == nil {
+		return nil, errors.New("client has no credentials of its own, fabric.Client.Init() first")
+	}
+	c.material.mutex.RLock()
+	defer c.material.mutex.RUnlock()
+	return c.material.tlsRoot, nil
+}
+
+// TLSRoot returns the TLS root certificate of the CA, TLSCertPEM or the content of TLSCertPath.
+func (ca *CA) TLSRoot() ([]byte, error) {
+	if len(ca.TLSCertPEM) > 0 || len(ca.TLSCertPath) == 0 {
+		return ca.TLSCertPEM, nil
+	}
+	rootPEM, err := os.ReadFile(ca.TLSCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA TLS root certificate: %w", err)
+	}
+	return rootPEM, nil
+}
+
+// WriteCredentials stores the certificate and the private key where they were read from, at
+// CertPath and KeyPath, see WriteCredentials, or in Wallet, and starts using them.
+func (c *Client) WriteCredentials(certificatePEM, keyPEM []byte) error {
+	if c.material == nil {
+		return errors.New("client has no credentials of its own, fabric.Client.Init() first")
+	}
+
+	var err error
+	switch {
+	case c.Wallet != nil && len(c.Label) > 0:
+		err = c.Wallet.Update(c.Label, certificatePEM, keyPEM)
+	case len(c.CertPEM) > 0 || len(c.KeyPEM) > 0:
+		return errors.New("credentials given as PEM, eg. inline in a connection profile, cannot be written")
+	case c.Wallet != nil && len(c.KeyPath) == 0:
+		var id *WalletIdentity
+		id, err = c.Wallet.Match(c.material.certificate)
+		if err == nil {
+			err = c.Wallet.Update(id.Label, certificatePEM, keyPEM)
+		}
+		if err == nil {
+			err = writeFileAtomic(c.CertPath, certificatePEM, 0644)
+		}
+	default:
+		err = WriteCredentials(c.CertPath, c.KeyPath, certificatePEM, keyPEM)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.Reload()
+	return err
+}
+
+// endregion: credentials
+// region: helpers
+
+func (ca *CA) request(path string, body []byte) (*http.Request, error) {
+	if ca.client == nil {
+		return nil, errors.New("fabric.CA.Init() first")
+	}
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(ca.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return request, nil
+}
+
+func (ca *CA) do(request *http.Request, result interface{}) error {
+	response, err := ca.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("CA request %s failed: %w", request.URL.Path, err)
+	}
+	defer response.Body.Close()
+	raw, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	r := &caResponse{}
+	err = json.Unmarshal(raw, r)
+	if err != nil {
+		return fmt.Errorf("CA request %s failed with status %d: %s", request.URL.Path, response.StatusCode, bytes.TrimSpace(raw))
+	}
+	if !r.Success || response.StatusCode != http.StatusOK {
+		messages := make([]string, 0, len(r.Errors))
+		for _, e := range r.Errors {
+			messages = append(messages, fmt.Sprintf("%s (code %d)", e.Message, e.Code))
+		}
+		return fmt.Errorf("CA request %s failed with status %d: %s", request.URL.Path, response.StatusCode, strings.Join(messages, ", "))
+	}
+	return json.Unmarshal(r.Result, result)
+}
+
+func (ca *CA) enrollment(request *http.Request, key *ecdsa.PrivateKey) (*Enrollment, error) {
+	result := &caEnrollResult{}
+	err := ca.do(request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Enrollment{}
+	e.Certificate, err = base64.StdEncoding.DecodeString(result.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate from CA: %w", err)
+	}
+	e.CAChain, err = base64.StdEncoding.DecodeString(result.ServerInfo.CAChain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA chain from CA: %w", err)
+	}
+	certificate, err := parseCertificate(e.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate from CA: %w", err)
+	}
+	if !key.PublicKey.Equal(certificate.PublicKey) {
+		return nil, errors.New("certificate from CA does not match the certificate request")
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	e.PrivateKey = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	return e, nil
+}
+
+// newCSR generates a P-256 key and a certificate request for it, hosts are DNS names or IPs.
+func newCSR(commonName string, hosts []string) (*ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if len(host) > 0 {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// signRequest sets the token the CA authenticates enrolled identities with: the base64 of the
+// certificate and the signature of method.b64(uri).b64(body).b64(certificate) with the private
+// key, a low-S ECDSA signature over its SHA-256.
+func signRequest(request *http.Request, body, certificatePEM, keyPEM []byte) error {
+	privateKey, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return err
+	}
+	key, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return errors.New("only ECDSA keys are supported by the CA token")
+	}
+
+	b64Certificate := base64.StdEncoding.EncodeToString(certificatePEM)
+	payload := request.Method + "." + base64.StdEncoding.EncodeToString([]byte(request.URL.RequestURI())) + "." + base64.StdEncoding.EncodeToString(body) + "." + b64Certificate
+	digest := sha256.Sum256([]byte(payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return err
+	}
+	half := new(big.Int).Rsh(key.Params().N, 1)
+	if s.Cmp(half) > 0 {
+		s.Sub(key.Params().N, s)
+	}
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", b64Certificate+"."+base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+func parseCertificate(certificatePEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parsePrivateKey(keyPEM []byte) (interface{}, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// endregion: helpers
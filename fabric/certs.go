@@ -0,0 +1,110 @@
+// region: packages
+
+package fabric
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// endregion: packages
+// region: types
+
+// CertificateInfo is what expiry reports show of a certificate, File is where it was found if
+// it was read from a file.
+type CertificateInfo struct {
+	File      string    `json:"file,omitempty"`
+	Issuer    string    `json:"issuer"`
+	NotAfter  time.Time `json:"not_after"`
+	NotBefore time.Time `json:"not_before"`
+	Serial    string    `json:"serial"`
+	Subject   string    `json:"subject"`
+}
+
+// endregion: types
+// region: parse
+
+// DaysLeft returns the days until the certificate expires at now, negative if it has expired.
+func (i *CertificateInfo) DaysLeft(now time.Time) float64 {
+	return i.NotAfter.Sub(now).Hours() / 24
+}
+
+// ParseCertificates returns every certificate of a PEM bundle, other blocks are skipped, it is
+// an error if there is none.
+func ParseCertificates(bundle []byte) ([]CertificateInfo, error) {
+	infos := make([]CertificateInfo, 0, 1)
+	for rest := bundle; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		infos = append(infos, CertificateInfo{
+			Issuer:    certificate.Issuer.String(),
+			NotAfter:  certificate.NotAfter,
+			NotBefore: certificate.NotBefore,
+			Serial:    fmt.Sprintf("%x", certificate.SerialNumber),
+			Subject:   certificate.Subject.String(),
+		})
+	}
+	if len(infos) == 0 {
+		return nil, errors.New("no certificate in PEM")
+	}
+	return infos, nil
+}
+
+// ScanCertificates walks the crypto material tree under root, eg. the peers/*/msp and
+// users/*/msp directories of an organization, and returns the certificates of every PEM file
+// in it ordered by expiry. Keystores are not read, files that hold no certificate are skipped.
+func ScanCertificates(root string) ([]CertificateInfo, error) {
+	infos := make([]CertificateInfo, 0)
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == "keystore" {
+			return filepath.SkipDir
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(raw, []byte("-----BEGIN CERTIFICATE-----")) {
+			return nil
+		}
+		found, err := ParseCertificates(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, info := range found {
+			info.File = file
+			infos = append(infos, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].NotAfter.Before(infos[j].NotAfter) })
+	return infos, nil
+}
+
+// endregion: parse
@@ -0,0 +1,178 @@
+// region: packages
+
+package fabric
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+)
+
+// endregion: packages
+// region: globals
+
+var (
+	EvaluateTimeout     time.Duration = 5 * time.Second
+	EndorseTimeout      time.Duration = 15 * time.Second
+	SubmitTimeout       time.Duration = 5 * time.Second
+	CommitStatusTimeout time.Duration = 1 * time.Minute
+)
+
+// endregion: globals
+// region: init client
+
+func (c *Client) Init() (err error) {
+
+	c.material, err = c.loadMaterial()
+	if err != nil {
+		return err
+	}
+	c.connection, err = c.newGrpcConnection()
+	if err != nil {
+		return err
+	}
+
+	id := &reloadableIdentity{material: c.material, mspid: c.MSPID}
+	c.Gateway, err = c.connect(id, c.material.signer)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WithIdentity returns a client that transacts as the wallet identity, over the gRPC
+// connection of c. Closing it leaves the connection open.
+func (c *Client) WithIdentity(wid *WalletIdentity) (*Client, error) {
+	certificate, err := identity.CertificateFromPEM([]byte(wid.Credentials.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate of identity %s: %w", wid.Label, err)
+	}
+	id, err := identity.NewX509Identity(wid.MSPID, certificate)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := newSignFromPEM([]byte(wid.Credentials.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key of identity %s: %w", wid.Label, err)
+	}
+
+	derived := &Client{
+		GatewayPeer:  c.GatewayPeer,
+		MSPID:        wid.MSPID,
+		PeerEndpoint: c.PeerEndpoint,
+		TLSCertPath:  c.TLSCertPath,
+		Timeouts:     c.Timeouts,
+		connection:   c.connection,
+		derived:      true,
+	}
+	derived.Gateway, err = derived.connect(id, sign)
+	if err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
+
+// ForPeer returns a client with the identity and timeouts of c that connects to another gateway
+// peer, verified against the TLS root of c unless it is replaced, not initialized yet.
+func (c *Client) ForPeer(endpoint, gatewayPeer string) *Client {
+	return &Client{
+		CertPath:     c.CertPath,
+		CertPEM:      c.CertPEM,
+		GatewayPeer:  gatewayPeer,
+		KeyPath:      c.KeyPath,
+		KeyPEM:       c.KeyPEM,
+		Label:        c.Label,
+		MSPID:        c.MSPID,
+		PeerEndpoint: endpoint,
+		TLSCertPath:  c.TLSCertPath,
+		TLSCertPEM:   c.TLSCertPEM,
+		Timeouts:     c.Timeouts,
+		Wallet:       c.Wallet,
+	}
+}
+
+// connect opens the gateway with the timeouts of c, they apply to the calls made without a
+// context, Request carries its own.
+func (c *Client) connect(id identity.Identity, sign identity.Sign) (*client.Gateway, error) {
+	timeouts := DefaultTimeouts().Merge(c.Timeouts)
+	return client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithClientConnection(c.connection),
+		client.WithEvaluateTimeout(timeouts.Evaluate),
+		client.WithEndorseTimeout(timeouts.Endorse),
+		client.WithSubmitTimeout(timeouts.Submit),
+		client.WithCommitStatusTimeout(timeouts.CommitStatus),
+	)
+}
+
+// endregion: init client
+// region: close
+
+func (c *Client) Close() {
+	if c.Gateway != nil {
+		c.Gateway.Close()
+	}
+	if c.connection != nil && !c.derived {
+		c.connection.Close()
+	}
+}
+
+// endregion: close
+// region: network, contract
+
+func (c *Client) Network(channel string) *client.Network {
+	return c.Gateway.GetNetwork(channel)
+}
+
+func (c *Client) Contract(channel, chaincode string) *client.Contract {
+	return c.Network(channel).GetContract(chaincode)
+}
+
+// endregion: network, contract
+// region: state
+
+// State returns the connectivity state of the gRPC connection to the gateway peer, eg. READY or
+// TRANSIENT_FAILURE, without initiating a connection.
+func (c *Client) State() string {
+	if c.connection == nil {
+		return "SHUTDOWN"
+	}
+	return c.connection.GetState().String()
+}
+
+// endregion: state
+// region: helpers
+
+// newGrpcConnection creates a gRPC connection to the Gateway server, verified against the TLS
+// root of the material of c.
+func (c *Client) newGrpcConnection() (*grpc.ClientConn, error) {
+	transportCredentials := c.material.transportCredentials(c.GatewayPeer)
+
+	connection, err := grpc.Dial(c.PeerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+
+	return connection, nil
+}
+
+func newSignFromPEM(privateKeyPEM []byte) (identity.Sign, error) {
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return sign, nil
+}
+
+// endregion: helpers
@@ -0,0 +1,67 @@
+package fabric
+
+import (
+	"context"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"google.golang.org/protobuf/proto"
+)
+
+// Commit rebuilds the commit status request of a transaction from its id, so that the status of
+// transactions submitted by another process (or before a restart) can be obtained.
+func (c *Client) Commit(channel, txid string) (*client.Commit, error) {
+
+	// region: creator
+
+	id := c.Gateway.Identity()
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   id.MspID(),
+		IdBytes: id.Credentials(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// endregion: creator
+	// region: request
+
+	request, err := proto.Marshal(&gateway.CommitStatusRequest{
+		ChannelId:     channel,
+		Identity:      creator,
+		TransactionId: txid,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signed, err := proto.Marshal(&gateway.SignedCommitStatusRequest{Request: request})
+	if err != nil {
+		return nil, err
+	}
+
+	// endregion: request
+
+	return c.Gateway.NewCommit(signed)
+
+}
+
+// CommitStatus waits for the transaction to be committed and returns its status, an invalidated
+// transaction is not an error here, check Status.Successful.
+func (c *Client) CommitStatus(ctx context.Context, channel, txid string) (*client.Status, *ResponseError) {
+	commit, err := c.Commit(channel, txid)
+	if err != nil {
+		return nil, Error(err)
+	}
+	status, err := commit.StatusWithContext(ctx)
+	if err != nil {
+		return nil, Error(err)
+	}
+	return status, nil
+}
+
+// SignedTransaction rebuilds an endorsed transaction from the bytes of Transaction.Bytes(),
+// submitting it again is safe, the peers dedupe on the transaction id, which is part of it.
+func (c *Client) SignedTransaction(raw []byte) (*client.Transaction, error) {
+	return c.Gateway.NewTransaction(raw)
+}
@@ -0,0 +1,385 @@
+// region: packages
+
+package fabric
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/status"
+)
+
+// endregion: packages
+// region: types
+
+// ConsistencyPeer is a peer a consistency check compares, Client connects to its gateway and
+// MSPID, if set, restricts evaluation to the peers of its org, so that the gateway does not
+// hand the evaluation over to another org. The gateway may still evaluate on another peer of the
+// org, it does so if that one is ahead of its own, so the world state of peers sharing an org is
+// compared per org rather than per peer, see ConsistencyReport.SharedOrgs. Their chains are
+// compared per peer, qscc is always evaluated on the peer of the gateway.
+type ConsistencyPeer struct {
+	Client *Client `json:"-"`
+	MSPID  string  `json:"msp_id"`
+	Name   string  `json:"name"`
+}
+
+// ConsistencyCheck compares the chain of each channel across the peers and, if a chaincode is
+// given, its world state: GetFunction is evaluated with each of Keys, RangeFunction with
+// RangeStart and RangeEnd, whose result is a JSON array of objects carrying their key in
+// KeyField, eg. BundleGetRange of te-food-bundles with bundle_id, which is required then.
+type ConsistencyCheck struct {
+	Chaincode     string            `json:"chaincode"`
+	Channels      []string          `json:"channels"`
+	Context       context.Context   `json:"-"`
+	GetFunction   string            `json:"get_function"`
+	KeyField      string            `json:"key_field"`
+	Keys          []string          `json:"keys"`
+	Peers         []ConsistencyPeer `json:"peers"`
+	RangeEnd      string            `json:"range_end"`
+	RangeFunction string            `json:"range_function"`
+	RangeStart    string            `json:"range_start"`
+}
+
+// ConsistencyReport is the outcome of a check, it is consistent if every peer answered, none is
+// lagging behind and the peers agree on blocks and keys. SharedOrgs lists the peers of the orgs
+// with more than one peer in the check by MSP id, their keys are not compared per peer.
+type ConsistencyReport struct {
+	Channels   []ChannelConsistency `json:"channels"`
+	Consistent bool                 `json:"consistent"`
+	Peers      []string             `json:"peers"`
+	SharedOrgs map[string][]string  `json:"shared_orgs,omitempty"`
+}
+
+// ChannelConsistency compares the peers on a channel. Heights and errors are by peer name,
+// CommonHeight is the lowest height among the peers and Hashes the hash of the block below it,
+// on which the peers have to agree whatever their lag. Keys counts the keys compared, keys of
+// the range present on some peers only are divergent as well.
+type ChannelConsistency struct {
+	Channel       string            `json:"channel"`
+	CommonHeight  uint64            `json:"common_height"`
+	DivergentKeys []DivergentKey    `json:"divergent_keys"`
+	Errors        map[string]string `json:"errors,omitempty"`
+	HashMismatch  bool              `json:"hash_mismatch"`
+	Hashes        map[string]string `json:"hashes"`
+	Heights       map[string]uint64 `json:"heights"`
+	Keys          int               `json:"keys"`
+	Lagging       []string          `json:"lagging"`
+}
+
+// DivergentKey is a key the peers disagree on, Hashes are the SHA-256 of its value, or the gRPC
+// status and the chaincode message of the error GetFunction returned for it, by peer name, peers
+// whose range lacks the key are Missing.
+type DivergentKey struct {
+	Hashes  map[string]string `json:"hashes"`
+	Key     string            `json:"key"`
+	Missing []string          `json:"missing,omitempty"`
+}
+
+// endregion: types
+// region: peers
+
+// ConsistencyPeers resolves the peers to compare, see ResolvePeers, a comparison needs at least
+// two of them.
+func ConsistencyPeers(list []string, profile *Profile, base *Client) ([]ConsistencyPeer, error) {
+	peers, err := ResolvePeers(list, profile, base)
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) < 2 {
+		return nil, fmt.Errorf("a consistency check needs at least two peers, got %d", len(peers))
+	}
+	return peers, nil
+}
+
+// ResolvePeers resolves a list of peers, a name is a peer of the profile, connected with the
+// identity of base, name=host:port is a gateway peer of that name at the endpoint, verified
+// against the TLS root of base. An empty list means every peer of the profile. The clients are
+// not initialized yet.
+func ResolvePeers(list []string, profile *Profile, base *Client) ([]ConsistencyPeer, error) {
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		if profile == nil {
+			return nil, errors.New("no peers given and no connection profile to list them from")
+		}
+		items = profile.PeerNames()
+	}
+
+	peers := make([]ConsistencyPeer, 0, len(items))
+	for _, item := range items {
+		if name, endpoint, ok := strings.Cut(item, "="); ok {
+			peers = append(peers, ConsistencyPeer{Client: base.ForPeer(endpoint, name), MSPID: base.MSPID, Name: name})
+			continue
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("peer %s needs a connection profile or an endpoint as %s=host:port", item, item)
+		}
+		client, mspid, err := profile.PeerClient(item, base)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, ConsistencyPeer{Client: client, MSPID: mspid, Name: item})
+	}
+	return peers, nil
+}
+
+// endregion: peers
+// region: run
+
+// Run compares the peers channel by channel, a peer that fails to report its chain is left out
+// of the comparisons of the channel and makes the report inconsistent.
+func (check *ConsistencyCheck) Run() *ConsistencyReport {
+	report := &ConsistencyReport{
+		Channels:   make([]ChannelConsistency, 0, len(check.Channels)),
+		Consistent: true,
+		Peers:      make([]string, 0, len(check.Peers)),
+	}
+	orgs := make(map[string][]string)
+	for _, p := range check.Peers {
+		report.Peers = append(report.Peers, p.Name)
+		if len(p.MSPID) > 0 {
+			orgs[p.MSPID] = append(orgs[p.MSPID], p.Name)
+		}
+	}
+	if len(check.Chaincode) > 0 {
+		for mspid, peers := range orgs {
+			if len(peers) > 1 {
+				if report.SharedOrgs == nil {
+					report.SharedOrgs = make(map[string][]string)
+				}
+				report.SharedOrgs[mspid] = peers
+			}
+		}
+	}
+
+	for _, channel := range check.Channels {
+		result := check.channel(channel)
+		if len(result.Errors) > 0 || len(result.Lagging) > 0 || result.HashMismatch || len(result.DivergentKeys) > 0 {
+			report.Consistent = false
+		}
+		report.Channels = append(report.Channels, result)
+	}
+	return report
+}
+
+func (check *ConsistencyCheck) channel(channel string) ChannelConsistency {
+	result := ChannelConsistency{
+		Channel:       channel,
+		DivergentKeys: make([]DivergentKey, 0),
+		Errors:        make(map[string]string),
+		Hashes:        make(map[string]string),
+		Heights:       make(map[string]uint64),
+		Lagging:       make([]string, 0),
+	}
+
+	// region: heights
+
+	infos := make(map[string]*ChainInfo, len(check.Peers))
+	answered := make([]ConsistencyPeer, 0, len(check.Peers))
+	var highest uint64
+	for _, p := range check.Peers {
+		info, responseErr := p.Client.ChainInfo(check.Context, p.Client.Timeouts, channel)
+		if responseErr != nil {
+			result.Errors[p.Name] = fmt.Sprintf("chain info: %s", responseErr.Message)
+			continue
+		}
+		infos[p.Name] = info
+		answered = append(answered, p)
+		result.Heights[p.Name] = info.Height
+		if info.Height > highest {
+			highest = info.Height
+		}
+		if result.CommonHeight == 0 || info.Height < result.CommonHeight {
+			result.CommonHeight = info.Height
+		}
+	}
+	for _, p := range answered {
+		if infos[p.Name].Height < highest {
+			result.Lagging = append(result.Lagging, p.Name)
+		}
+	}
+
+	// endregion: heights
+	// region: hashes
+
+	if result.CommonHeight > 0 {
+		for _, p := range answered {
+			hash := infos[p.Name].CurrentHash
+			if infos[p.Name].Height > result.CommonHeight {
+				block, responseErr := p.Client.Block(check.Context, p.Client.Timeouts, channel, result.CommonHeight-1)
+				if responseErr != nil {
+					result.Errors[p.Name] = fmt.Sprintf("block %d: %s", result.CommonHeight-1, responseErr.Message)
+					continue
+				}
+				hash = block.Hash
+			}
+			result.Hashes[p.Name] = hash
+		}
+		for _, hash := range result.Hashes {
+			for _, other := range result.Hashes {
+				if hash != other {
+					result.HashMismatch = true
+				}
+			}
+		}
+	}
+
+	// endregion: hashes
+	// region: keys
+
+	if len(check.Chaincode) > 0 && len(answered) > 1 {
+		values := make(map[string]map[string]string, len(answered))
+		for _, p := range answered {
+			peerValues, err := check.values(channel, p)
+			if err != nil {
+				result.Errors[p.Name] = err.Error()
+				continue
+			}
+			values[p.Name] = peerValues
+		}
+		result.Keys, result.DivergentKeys = divergentKeys(answered, values)
+	}
+
+	// endregion: keys
+
+	return result
+}
+
+// values returns the SHA-256 of the value of each key the peer has, by key, evaluated on the
+// peer through its own gateway.
+func (check *ConsistencyCheck) values(channel string, p ConsistencyPeer) (map[string]string, error) {
+	values := make(map[string]string, len(check.Keys))
+	request := func(function string, args ...string) ([]byte, *ResponseError) {
+		r := &Request{
+			Args:     args,
+			Context:  check.Context,
+			Contract: p.Client.Contract(channel, check.Chaincode),
+			Function: function,
+		}
+		if len(p.MSPID) > 0 {
+			r.EndorsingOrgs = []string{p.MSPID}
+		}
+		response, responseErr := r.Query()
+		if responseErr != nil {
+			return nil, responseErr
+		}
+		return response.Result, nil
+	}
+
+	if len(check.GetFunction) > 0 {
+		for _, key := range check.Keys {
+			result, responseErr := request(check.GetFunction, key)
+			if responseErr != nil {
+				// a missing key is an error of most chaincodes, the peers agreeing on it is fine
+				values[key] = errorValue(responseErr)
+				continue
+			}
+			values[key] = valueHash(result)
+		}
+	}
+
+	if len(check.RangeFunction) > 0 {
+		field := check.KeyField
+		if len(field) == 0 {
+			return nil, fmt.Errorf("%s: no key field to compare the objects by", check.RangeFunction)
+		}
+		result, responseErr := request(check.RangeFunction, check.RangeStart, check.RangeEnd)
+		if responseErr != nil {
+			return nil, fmt.Errorf("%s: %s", check.RangeFunction, responseErr.Message)
+		}
+		var objects []map[string]json.RawMessage
+		if len(bytes.TrimSpace(result)) > 0 {
+			if err := json.Unmarshal(result, &objects); err != nil {
+				return nil, fmt.Errorf("%s: result is not an array of objects: %w", check.RangeFunction, err)
+			}
+		}
+		for i, object := range objects {
+			var key string
+			if err := json.Unmarshal(object[field], &key); err != nil || len(key) == 0 {
+				return nil, fmt.Errorf("%s: object %d has no %s", check.RangeFunction, i, field)
+			}
+			raw, _ := json.Marshal(object)
+			values[key] = valueHash(raw)
+		}
+	}
+
+	return values, nil
+}
+
+// divergentKeys compares the values of the peers key by key, peers without values, ie. whose
+// evaluation failed, are left out.
+func divergentKeys(peers []ConsistencyPeer, values map[string]map[string]string) (int, []DivergentKey) {
+	keys := make(map[string]bool)
+	for _, peerValues := range values {
+		for key := range peerValues {
+			keys[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	divergent := make([]DivergentKey, 0)
+	for _, key := range sorted {
+		d := DivergentKey{Hashes: make(map[string]string), Key: key}
+		agree := true
+		first := ""
+		for _, p := range peers {
+			peerValues, ok := values[p.Name]
+			if !ok {
+				continue
+			}
+			value, ok := peerValues[key]
+			if !ok {
+				d.Missing = append(d.Missing, p.Name)
+				agree = false
+				continue
+			}
+			d.Hashes[p.Name] = value
+			if len(first) == 0 {
+				first = value
+			} else if value != first {
+				agree = false
+			}
+		}
+		if !agree {
+			divergent = append(divergent, d)
+		}
+	}
+	return len(sorted), divergent
+}
+
+// errorValue stands for the value of a key whose evaluation failed, by the gRPC status and the
+// messages of the chaincode rather than the message of the error, which names the peer.
+func errorValue(responseErr *ResponseError) string {
+	messages := make([]string, 0, len(responseErr.Details))
+	for _, detail := range responseErr.Details {
+		messages = append(messages, detail["message"])
+	}
+	if len(messages) == 0 && responseErr.Err != nil {
+		messages = append(messages, status.Convert(responseErr.Err).Message())
+	}
+	sort.Strings(messages)
+	return fmt.Sprintf("error: %s: %s", responseErr.Status, strings.Join(messages, "; "))
+}
+
+func valueHash(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// endregion: run
@@ -12,6 +12,7 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// Error classifies err into a ResponseError, error details reported by the gateway are preserved.
 func Error(err error) *ResponseError {
 
 	// region: new response
@@ -25,6 +26,8 @@ func Error(err error) *ResponseError {
 	// region: error types
 
 	switch err := err.(type) {
+	case *ResponseError:
+		return err
 	case *client.EndorseError:
 		r.Txid = err.TransactionID
 		r.Status = status.Code(err)
@@ -35,20 +38,24 @@ func Error(err error) *ResponseError {
 		r.Message = fmt.Sprintf("submit error for transaction %s with gRPC status %v: %s", r.Txid, r.Status, err)
 	case *client.CommitStatusError:
 		r.Txid = err.TransactionID
+		r.Status = status.Code(err)
 		if errors.Is(err, context.DeadlineExceeded) {
-			r.Status = codes.Code(err.GRPCStatus().Code()) //??
-			r.Message = fmt.Sprintf("timeout waiting for transaction %s with gRPC status %v: %s", r.Txid, r.Status, err)
+			r.Status = codes.DeadlineExceeded
+			r.Message = fmt.Sprintf("timeout waiting for transaction %s commit status: %s", r.Txid, err)
 		} else {
-			r.Status = status.Code(err)
-			r.Message = fmt.Sprintf("error obtaining commit status for transaction %s commit status %s: %s", r.Txid, r.Status, err)
+			r.Message = fmt.Sprintf("error obtaining commit status for transaction %s with gRPC status %v: %s", r.Txid, r.Status, err)
 		}
 	case *client.CommitError:
 		r.Txid = err.TransactionID
-		r.Status = codes.Code(err.Code) // ???
-		r.Message = fmt.Sprintf("transaction %s failed to commit with status %d: %s", r.Txid, r.Status, err)
+		r.Status = codes.Aborted
+		r.Validation = err.Code.String()
+		r.Message = fmt.Sprintf("transaction %s failed to commit with status %d (%s): %s", r.Txid, int32(err.Code), r.Validation, err)
 	default:
 		r.Status = status.Code(err)
 		r.Message = fmt.Sprintf("unexpected error type %T: %s", err, err)
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			r.Status = status.FromContextError(err).Code()
+		}
 	}
 
 	// endregion: error types
@@ -72,6 +79,20 @@ func Error(err error) *ResponseError {
 
 }
 
+// commitError reports a transaction that made it into a block but was invalidated.
+func commitError(s *client.Status) *ResponseError {
+	r := &ResponseError{
+		Details:    make([]map[string]string, 0),
+		Status:     codes.Aborted,
+		Txid:       s.TransactionID,
+		Type:       fmt.Sprintf("%T", &client.CommitError{}),
+		Validation: s.Code.String(),
+	}
+	r.Message = fmt.Sprintf("transaction %s failed to commit in block %d with status %d (%s)", r.Txid, s.BlockNumber, int32(s.Code), r.Validation)
+	r.Err = errors.New(r.Message)
+	return r
+}
+
 func (r *ResponseError) Error() string {
 	raw, err := json.Marshal(r)
 	if err != nil {
@@ -79,3 +100,7 @@ func (r *ResponseError) Error() string {
 	}
 	return string(raw)
 }
+
+func (r *ResponseError) Unwrap() error {
+	return r.Err
+}
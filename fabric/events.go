@@ -0,0 +1,66 @@
+package fabric
+
+import (
+	"context"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+)
+
+// region: checkpointer
+
+// NewCheckpointer opens a file checkpointer at path, or at a temporary file, which
+// is removed on Close, if path is empty.
+func NewCheckpointer(path string) (*Checkpointer, error) {
+	if len(path) > 0 {
+		checkpointer, err := client.NewFileCheckpointer(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Checkpointer{FileCheckpointer: checkpointer}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "tmp_fabric_file_checkpointer_")
+	if err != nil {
+		return nil, err
+	}
+	checkpointer, err := client.NewFileCheckpointer(tmp.Name())
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &Checkpointer{FileCheckpointer: checkpointer, file: tmp}, nil
+}
+
+func (cp *Checkpointer) Close() error {
+	cp.FileCheckpointer.Sync()
+	err := cp.FileCheckpointer.Close()
+	if cp.file != nil {
+		cp.file.Close()
+		os.Remove(cp.file.Name())
+	}
+	return err
+}
+
+// endregion: checkpointer
+// region: events
+
+// BlockEvents subscribes to the blocks of the channel, resuming from the checkpoint if cp is not nil.
+func (c *Client) BlockEvents(ctx context.Context, channel string, cp *Checkpointer, options ...client.BlockEventsOption) (<-chan *common.Block, error) {
+	if cp != nil {
+		options = append(options, client.WithCheckpoint(cp))
+	}
+	return c.Network(channel).BlockEvents(ctx, options...)
+}
+
+// ChaincodeEvents subscribes to the events emitted by the chaincode, resuming from the checkpoint if cp is not nil.
+func (c *Client) ChaincodeEvents(ctx context.Context, channel, chaincode string, cp *Checkpointer, options ...client.ChaincodeEventsOption) (<-chan *client.ChaincodeEvent, error) {
+	if cp != nil {
+		options = append(options, client.WithCheckpoint(cp))
+	}
+	return c.Network(channel).ChaincodeEvents(ctx, chaincode, options...)
+}
+
+// endregion: events
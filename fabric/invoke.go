@@ -0,0 +1,108 @@
+package fabric
+
+import (
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Invoke endorses and submits the transaction, then waits for its commit status. Every phase is
+// bound by Request.Context and by its own timeout.
+func Invoke(r *Request) (*Response, *ResponseError) {
+
+	// region: submit
+
+	response, responseErr := SubmitAsync(r)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+
+	// endregion: submit
+
+	return Commit(r, response)
+
+}
+
+// Commit waits for the transaction of a submitted response to be committed.
+func Commit(r *Request, response *Response) (*Response, *ResponseError) {
+	ctx, cancel := r.context(phaseCommitStatus)
+	defer cancel()
+	status, err := response.Commit.StatusWithContext(ctx)
+	if err != nil {
+		return nil, Error(err)
+	}
+	if !status.Successful {
+		return nil, commitError(status)
+	}
+	return response, nil
+}
+
+// SubmitAsync endorses and submits the transaction without waiting for it to be committed,
+// the commit status is available through Response.Commit.
+func SubmitAsync(r *Request) (*Response, *ResponseError) {
+	transaction, responseErr := Endorse(r)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+	return Submit(r, transaction)
+}
+
+// Endorse builds the proposal and collects its endorsements, the transaction id is known from
+// here on, before anything is sent to the orderer.
+func Endorse(r *Request) (*client.Transaction, *ResponseError) {
+
+	// region: proposal
+
+	proposal, err := r.Contract.NewProposal(r.Function, client.WithArguments(r.Args...))
+	if err != nil {
+		return nil, Error(err)
+	}
+
+	// endregion: proposal
+	// region: endorse
+
+	ctx, cancel := r.context(phaseEndorse)
+	defer cancel()
+	transaction, err := proposal.EndorseWithContext(ctx)
+	if err != nil {
+		return nil, Error(err)
+	}
+
+	// endregion: endorse
+
+	return transaction, nil
+
+}
+
+// Submit sends the endorsed transaction to the orderer without waiting for it to be committed.
+func Submit(r *Request, transaction *client.Transaction) (*Response, *ResponseError) {
+
+	// region: commit
+
+	ctx, cancel := r.context(phaseSubmit)
+	defer cancel()
+	commit, err := transaction.SubmitWithContext(ctx)
+	if err != nil {
+		return nil, Error(err)
+	}
+
+	// endregion: commit
+	// region: response
+
+	response := &Response{
+		Commit: commit,
+		Result: transaction.Result(),
+		Txid:   commit.TransactionID(),
+	}
+
+	return response, nil
+
+	// endregion: response
+
+}
+
+func (r *Request) Invoke() (*Response, *ResponseError) {
+	return Invoke(r)
+}
+
+func (r *Request) SubmitAsync() (*Response, *ResponseError) {
+	return SubmitAsync(r)
+}
@@ -4,33 +4,29 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"os/exec"
 	"strconv"
-	"time"
+	"syscall"
 
 	"github.com/valyala/fasthttp"
 )
 
+// Init picks the backend: configtxlator's rest api if both Bind and Which are set (on a
+// random free port if Port is 0), the configtxlator binary if only Which is set, or a
+// base64 dump of the protobuf otherwise.
 func (l *Lator) Init() error {
 
 	// region: rest api
 
 	if len(l.Bind) != 0 && len(l.Which) != 0 {
 		if l.Port == 0 {
-			rand.Seed(time.Now().UnixNano())
-			min := 1024
-			max := 65534
-			for {
-				l.Port = rand.Intn(max-min+1) + min
-				conn, err := net.Dial("tcp", "localhost:"+strconv.Itoa(l.Port))
-				if err != nil {
-					// port is likely not in use
-					break
-				}
-				conn.Close()
+			ln, err := net.Listen("tcp", net.JoinHostPort(l.Bind, "0"))
+			if err != nil {
+				return err
 			}
+			l.Port = ln.Addr().(*net.TCPAddr).Port
+			ln.Close()
 		}
 
 		bin := l.Which
@@ -71,6 +67,24 @@ func (l *Lator) Init() error {
 
 }
 
+// Status tells which backend is in use and whether the configtxlator process of the rest api
+// is still alive.
+func (l *Lator) Status() LatorStatus {
+	status := LatorStatus{Mode: "dump", Which: l.Which}
+	switch {
+	case l.cmd != nil:
+		status.Address = net.JoinHostPort(l.Bind, strconv.Itoa(l.Port))
+		status.Alive = l.cmd.Process.Signal(syscall.Signal(0)) == nil
+		status.Mode = "rest"
+	case len(l.Which) != 0:
+		status.Alive = true
+		status.Mode = "cmd"
+	default:
+		status.Alive = l.Exe != nil
+	}
+	return status
+}
+
 func (l *Lator) Close() {
 	if l.cmd != nil {
 		defer l.cmd.Process.Kill()
@@ -100,7 +114,7 @@ func (l *Lator) exeRest(pb []byte, typ string) ([]byte, error) {
 		return nil, fmt.Errorf("%s", resp.Body())
 	}
 
-	return resp.Body(), nil
+	return append([]byte(nil), resp.Body()...), nil
 }
 
 func (l *Lator) exeCmd(pb []byte, typ string) ([]byte, error) {
@@ -0,0 +1,360 @@
+package fabric
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: qscc
+
+// ChainInfo asks qscc for the height and the hashes at the top of the channel's chain.
+func (c *Client) ChainInfo(ctx context.Context, timeouts Timeouts, channel string) (*ChainInfo, *ResponseError) {
+	result, responseErr := c.qscc(ctx, timeouts, channel, "GetChainInfo", channel)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+
+	info := &common.BlockchainInfo{}
+	err := proto.Unmarshal(result, info)
+	if err != nil {
+		return nil, Error(fmt.Errorf("failed to deserialize blockchain info: %w", err))
+	}
+
+	return &ChainInfo{
+		Channel:      channel,
+		CurrentHash:  hex.EncodeToString(info.GetCurrentBlockHash()),
+		Height:       info.GetHeight(),
+		PreviousHash: hex.EncodeToString(info.GetPreviousBlockHash()),
+	}, nil
+}
+
+// Block fetches and decodes the block with the given number.
+func (c *Client) Block(ctx context.Context, timeouts Timeouts, channel string, number uint64) (*Block, *ResponseError) {
+	result, responseErr := c.qscc(ctx, timeouts, channel, "GetBlockByNumber", channel, strconv.FormatUint(number, 10))
+	if responseErr != nil {
+		return nil, responseErr
+	}
+
+	block := &common.Block{}
+	err := proto.Unmarshal(result, block)
+	if err != nil {
+		return nil, Error(fmt.Errorf("failed to deserialize block %d: %w", number, err))
+	}
+	decoded, err := DecodeBlock(block)
+	if err != nil {
+		return nil, Error(err)
+	}
+	return decoded, nil
+}
+
+// Blocks returns the summaries of the blocks between from and to, both inclusive, each block is
+// fetched within the evaluate timeout and all of them within ctx.
+func (c *Client) Blocks(ctx context.Context, timeouts Timeouts, channel string, from, to uint64) ([]BlockSummary, *ResponseError) {
+	if from > to {
+		return nil, &ResponseError{
+			Details: make([]map[string]string, 0),
+			Message: fmt.Sprintf("invalid block range %d-%d", from, to),
+			Status:  codes.InvalidArgument,
+		}
+	}
+
+	summaries := make([]BlockSummary, 0, to-from+1)
+	for number := from; number <= to; number++ {
+		block, responseErr := c.Block(ctx, timeouts, channel, number)
+		if responseErr != nil {
+			return nil, responseErr
+		}
+		summaries = append(summaries, block.BlockSummary)
+	}
+	return summaries, nil
+}
+
+// Transaction fetches the processed transaction by its id and decodes it along with its
+// endorsements and read/write sets.
+func (c *Client) Transaction(ctx context.Context, timeouts Timeouts, channel, txid string) (*TransactionDetail, *ResponseError) {
+	result, responseErr := c.qscc(ctx, timeouts, channel, "GetTransactionByID", channel, txid)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+
+	processed := &peer.ProcessedTransaction{}
+	err := proto.Unmarshal(result, processed)
+	if err != nil {
+		return nil, Error(fmt.Errorf("failed to deserialize processed transaction %s: %w", txid, err))
+	}
+	tx, err := decodeTransactionDetail(processed.GetTransactionEnvelope())
+	if err != nil {
+		return nil, Error(err)
+	}
+	tx.ValidationCode = processed.GetValidationCode()
+	tx.Validation = peer.TxValidationCode(tx.ValidationCode).String()
+
+	return tx, nil
+}
+
+// qscc evaluates a qscc function bound by ctx and the evaluate timeout of timeouts, like Query.
+func (c *Client) qscc(ctx context.Context, timeouts Timeouts, channel, function string, args ...string) ([]byte, *ResponseError) {
+	response, responseErr := Query(&Request{
+		Args:     args,
+		Context:  ctx,
+		Contract: c.Contract(channel, "qscc"),
+		Function: function,
+		Timeouts: timeouts,
+	})
+	if responseErr != nil {
+		return nil, responseErr
+	}
+	return response.Result, nil
+}
+
+// endregion: qscc
+// region: decode
+
+// DecodeBlock summarizes the block and each transaction in it.
+func DecodeBlock(block *common.Block) (*Block, error) {
+	header := block.GetHeader()
+	envelopes := block.GetData().GetData()
+
+	decoded := &Block{
+		BlockSummary: BlockSummary{
+			DataHash:     hex.EncodeToString(header.GetDataHash()),
+			Hash:         hex.EncodeToString(BlockHash(header)),
+			Number:       header.GetNumber(),
+			PreviousHash: hex.EncodeToString(header.GetPreviousHash()),
+			TxCount:      len(envelopes),
+		},
+		Transactions: make([]Transaction, 0, len(envelopes)),
+	}
+
+	var filter []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	for i, raw := range envelopes {
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(raw, envelope); err != nil {
+			return nil, fmt.Errorf("failed to deserialize envelope %d of block %d: %w", i, decoded.Number, err)
+		}
+		tx, err := decodeTransaction(envelope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode transaction %d of block %d: %w", i, decoded.Number, err)
+		}
+		if i < len(filter) {
+			tx.Validation = peer.TxValidationCode(filter[i]).String()
+		}
+		if i == 0 {
+			decoded.Timestamp = tx.Timestamp
+		}
+		decoded.Transactions = append(decoded.Transactions, *tx)
+	}
+
+	return decoded, nil
+}
+
+// BlockHash computes the hash of the header the same way the peer does, which is the
+// previous hash of the next block.
+func BlockHash(header *common.BlockHeader) []byte {
+	raw, err := asn1.Marshal(struct {
+		Number       *big.Int
+		PreviousHash []byte
+		DataHash     []byte
+	}{
+		Number:       new(big.Int).SetUint64(header.GetNumber()),
+		PreviousHash: header.GetPreviousHash(),
+		DataHash:     header.GetDataHash(),
+	})
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(raw)
+	return sum[:]
+}
+
+// BlockWrites returns the namespaces the valid endorser transactions of the block wrote to,
+// chaincode-to-chaincode calls and private data collections included, and whether the block
+// holds a transaction of another type, eg. a config update, that may change any of them.
+func BlockWrites(block *common.Block) (map[string]bool, bool, error) {
+	var filter []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	namespaces, other := make(map[string]bool), false
+	for i, raw := range block.GetData().GetData() {
+		if i < len(filter) && peer.TxValidationCode(filter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(raw, envelope); err != nil {
+			return nil, false, fmt.Errorf("failed to deserialize envelope %d of block %d: %w", i, block.GetHeader().GetNumber(), err)
+		}
+		payload := &common.Payload{}
+		if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+			return nil, false, fmt.Errorf("failed to deserialize payload %d of block %d: %w", i, block.GetHeader().GetNumber(), err)
+		}
+		channelHeader := &common.ChannelHeader{}
+		if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+			return nil, false, fmt.Errorf("failed to deserialize channel header %d of block %d: %w", i, block.GetHeader().GetNumber(), err)
+		}
+		if common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+			other = true
+			continue
+		}
+
+		_, actions, err := chaincodeActions(envelope)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decode transaction %d of block %d: %w", i, block.GetHeader().GetNumber(), err)
+		}
+		for _, action := range actions {
+			written, err := writtenNamespaces(action.GetResults())
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to decode transaction %d of block %d: %w", i, block.GetHeader().GetNumber(), err)
+			}
+			for _, namespace := range written {
+				namespaces[namespace] = true
+			}
+		}
+	}
+
+	return namespaces, other, nil
+}
+
+// decodeTransaction reads the headers of the envelope and, for endorser transactions, the
+// invoked chaincode, function and emitted events.
+func decodeTransaction(envelope *common.Envelope) (*Transaction, error) {
+	tx, err := decodeTransactionDetail(envelope)
+	if err != nil {
+		return nil, err
+	}
+	return &tx.Transaction, nil
+}
+
+// decodeTransactionDetail is decodeTransaction plus arguments, chaincode version, endorsers
+// and read/write sets.
+func decodeTransactionDetail(envelope *common.Envelope) (*TransactionDetail, error) {
+
+	// region: headers
+
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+		return nil, fmt.Errorf("failed to deserialize payload: %w", err)
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+		return nil, fmt.Errorf("failed to deserialize channel header: %w", err)
+	}
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetSignatureHeader(), signatureHeader); err != nil {
+		return nil, fmt.Errorf("failed to deserialize signature header: %w", err)
+	}
+
+	tx := &TransactionDetail{
+		Transaction: Transaction{
+			Events:    make([]Event, 0),
+			Timestamp: channelHeader.GetTimestamp().AsTime(),
+			Txid:      channelHeader.GetTxId(),
+			Type:      common.HeaderType(channelHeader.GetType()).String(),
+		},
+		Args:      make([]string, 0),
+		Endorsers: make([]Endorser, 0),
+		RWSet:     make([]NsRWSet, 0),
+	}
+	if len(signatureHeader.GetCreator()) > 0 {
+		creator, err := decodeEndorser(signatureHeader.GetCreator())
+		if err != nil {
+			return nil, err
+		}
+		tx.Creator = *creator
+	}
+
+	if common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+		return tx, nil
+	}
+
+	// endregion: headers
+	// region: actions
+
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(payload.GetData(), transaction); err != nil {
+		return nil, fmt.Errorf("failed to deserialize transaction: %w", err)
+	}
+	for _, transactionAction := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(transactionAction.GetPayload(), actionPayload); err != nil {
+			return nil, fmt.Errorf("failed to deserialize chaincode action payload: %w", err)
+		}
+
+		proposalPayload := &peer.ChaincodeProposalPayload{}
+		if err := proto.Unmarshal(actionPayload.GetChaincodeProposalPayload(), proposalPayload); err != nil {
+			return nil, fmt.Errorf("failed to deserialize chaincode proposal payload: %w", err)
+		}
+		invocation := &peer.ChaincodeInvocationSpec{}
+		if err := proto.Unmarshal(proposalPayload.GetInput(), invocation); err != nil {
+			return nil, fmt.Errorf("failed to deserialize chaincode invocation spec: %w", err)
+		}
+		if len(tx.Chaincode) == 0 {
+			tx.Chaincode = invocation.GetChaincodeSpec().GetChaincodeId().GetName()
+			if args := invocation.GetChaincodeSpec().GetInput().GetArgs(); len(args) > 0 {
+				tx.Function = string(args[0])
+				for _, arg := range args[1:] {
+					tx.Args = append(tx.Args, string(arg))
+				}
+			}
+		}
+
+		for _, endorsement := range actionPayload.GetAction().GetEndorsements() {
+			endorser, err := decodeEndorser(endorsement.GetEndorser())
+			if err != nil {
+				return nil, err
+			}
+			tx.Endorsers = append(tx.Endorsers, *endorser)
+		}
+
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, fmt.Errorf("failed to deserialize proposal response payload: %w", err)
+		}
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction); err != nil {
+			return nil, fmt.Errorf("failed to deserialize chaincode action: %w", err)
+		}
+		if len(tx.ChaincodeVersion) == 0 {
+			tx.ChaincodeVersion = chaincodeAction.GetChaincodeId().GetVersion()
+		}
+		rwsets, err := decodeRWSet(chaincodeAction.GetResults())
+		if err != nil {
+			return nil, err
+		}
+		tx.RWSet = append(tx.RWSet, rwsets...)
+
+		if len(chaincodeAction.GetEvents()) > 0 {
+			event := &peer.ChaincodeEvent{}
+			if err := proto.Unmarshal(chaincodeAction.GetEvents(), event); err != nil {
+				return nil, fmt.Errorf("failed to deserialize chaincode event: %w", err)
+			}
+			tx.Events = append(tx.Events, Event{
+				Chaincode: event.GetChaincodeId(),
+				Name:      event.GetEventName(),
+				Payload:   rawOrString(event.GetPayload()),
+			})
+		}
+	}
+
+	// endregion: actions
+
+	return tx, nil
+
+}
+
+// endregion: decode
@@ -0,0 +1,293 @@
+package fabric
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// envelope returns a serialized transaction of the header type, endorser transactions read a key
+// of each namespace in sets and, if it is mapped to "write" or "private", write it to the public
+// state or to a private data collection.
+func envelope(t *testing.T, headerType common.HeaderType, sets map[string]string) []byte {
+	t.Helper()
+	marshal := func(m proto.Message) []byte {
+		t.Helper()
+		raw, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	var data []byte
+	if headerType == common.HeaderType_ENDORSER_TRANSACTION {
+		results := &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV}
+		for namespace, access := range sets {
+			set := &kvrwset.KVRWSet{Reads: []*kvrwset.KVRead{{Key: "k"}}}
+			ns := &rwset.NsReadWriteSet{Namespace: namespace}
+			switch access {
+			case "write":
+				set.Writes = []*kvrwset.KVWrite{{Key: "k", Value: []byte("v")}}
+			case "private":
+				hashed := &kvrwset.HashedRWSet{HashedWrites: []*kvrwset.KVWriteHash{{KeyHash: []byte("k"), ValueHash: []byte("v")}}}
+				ns.CollectionHashedRwset = []*rwset.CollectionHashedReadWriteSet{{CollectionName: "secrets", HashedRwset: marshal(hashed)}}
+			}
+			ns.Rwset = marshal(set)
+			results.NsRwset = append(results.NsRwset, ns)
+		}
+		action := marshal(&peer.ChaincodeAction{Results: marshal(results)})
+		payload := marshal(&peer.ChaincodeActionPayload{
+			Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: marshal(&peer.ProposalResponsePayload{Extension: action})},
+		})
+		data = marshal(&peer.Transaction{Actions: []*peer.TransactionAction{{Payload: payload}}})
+	}
+
+	header := &common.Header{ChannelHeader: marshal(&common.ChannelHeader{Type: int32(headerType)})}
+	return marshal(&common.Envelope{Payload: marshal(&common.Payload{Data: data, Header: header})})
+}
+
+// block returns a block of the envelopes with the validation codes of filter, chained to
+// previous unless it is nil.
+func block(previous *common.BlockHeader, number uint64, filter []peer.TxValidationCode, envelopes ...[]byte) *common.Block {
+	flags := make([]byte, 0, len(filter))
+	for _, code := range filter {
+		flags = append(flags, byte(code))
+	}
+	metadata := make([][]byte, common.BlockMetadataIndex_TRANSACTIONS_FILTER+1)
+	metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
+	data := sha256.Sum256(bytes.Join(envelopes, nil))
+	header := &common.BlockHeader{DataHash: data[:], Number: number}
+	if previous != nil {
+		header.PreviousHash = BlockHash(previous)
+	}
+	return &common.Block{Data: &common.BlockData{Data: envelopes}, Header: header, Metadata: &common.BlockMetadata{Metadata: metadata}}
+}
+
+func TestBlockWrites(t *testing.T) {
+	endorser := common.HeaderType_ENDORSER_TRANSACTION
+	valid, invalid := peer.TxValidationCode_VALID, peer.TxValidationCode_MVCC_READ_CONFLICT
+
+	// the invoked chaincode and the one it called both write, the third one is only read, the
+	// fourth one writes private data only, the writes of the invalid transaction are not applied
+	writes, other, err := BlockWrites(block(nil, 7,
+		[]peer.TxValidationCode{valid, invalid, valid},
+		envelope(t, endorser, map[string]string{"cc1": "write", "cc2": "write", "cc3": "read"}),
+		envelope(t, endorser, map[string]string{"cc4": "write"}),
+		envelope(t, endorser, map[string]string{"cc5": "private"}),
+	))
+	if err != nil || other || len(writes) != 3 || !writes["cc1"] || !writes["cc2"] || !writes["cc5"] {
+		t.Errorf("got %v, %t, %v, want cc1, cc2 and cc5", writes, other, err)
+	}
+
+	writes, other, err = BlockWrites(block(nil, 7,
+		[]peer.TxValidationCode{valid},
+		envelope(t, common.HeaderType_CONFIG, nil),
+	))
+	if err != nil || !other || len(writes) != 0 {
+		t.Errorf("config block: got %v, %t, %v", writes, other, err)
+	}
+
+	if _, _, err := BlockWrites(block(nil, 7, nil, []byte("not an envelope"))); err == nil {
+		t.Error("broken envelope is decoded")
+	}
+}
+
+func TestBlockHash(t *testing.T) {
+	header := &common.BlockHeader{Number: 1, PreviousHash: bytes.Repeat([]byte{0xaa}, 32), DataHash: bytes.Repeat([]byte{0xbb}, 32)}
+
+	// the DER sequence of the number and the two hashes the peer hashes
+	der := append([]byte{0x30, 0x47, 0x02, 0x01, 0x01, 0x04, 0x20}, header.PreviousHash...)
+	der = append(append(der, 0x04, 0x20), header.DataHash...)
+	want := sha256.Sum256(der)
+	if got := BlockHash(header); !bytes.Equal(got, want[:]) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	for _, changed := range []*common.BlockHeader{
+		{Number: 2, PreviousHash: header.PreviousHash, DataHash: header.DataHash},
+		{Number: 1, PreviousHash: header.DataHash, DataHash: header.DataHash},
+		{Number: 1, PreviousHash: header.PreviousHash, DataHash: header.PreviousHash},
+	} {
+		if bytes.Equal(BlockHash(changed), want[:]) {
+			t.Errorf("%+v hashes the same", changed)
+		}
+	}
+}
+
+func TestDecodeBlock(t *testing.T) {
+	endorser := common.HeaderType_ENDORSER_TRANSACTION
+	valid, invalid := peer.TxValidationCode_VALID, peer.TxValidationCode_MVCC_READ_CONFLICT
+
+	genesis := block(nil, 0, []peer.TxValidationCode{valid}, envelope(t, common.HeaderType_CONFIG, nil))
+	decoded, err := DecodeBlock(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Number != 0 || decoded.TxCount != 1 || len(decoded.PreviousHash) != 0 || decoded.Hash != hex.EncodeToString(BlockHash(genesis.Header)) {
+		t.Errorf("config block: %+v", decoded.BlockSummary)
+	}
+	if len(decoded.Transactions) != 1 || decoded.Transactions[0].Type != "CONFIG" || decoded.Transactions[0].Validation != "VALID" || len(decoded.Transactions[0].Chaincode) != 0 {
+		t.Errorf("config transaction: %+v", decoded.Transactions)
+	}
+
+	next := block(genesis.Header, 1, []peer.TxValidationCode{valid, invalid},
+		envelope(t, endorser, map[string]string{"cc1": "write"}),
+		envelope(t, endorser, map[string]string{"cc2": "read"}),
+	)
+	decoded, err = DecodeBlock(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Number != 1 || decoded.TxCount != 2 || decoded.PreviousHash != hex.EncodeToString(BlockHash(genesis.Header)) || decoded.DataHash != hex.EncodeToString(next.Header.DataHash) {
+		t.Errorf("endorser block: %+v", decoded.BlockSummary)
+	}
+	if len(decoded.Transactions) != 2 || decoded.Transactions[0].Validation != "VALID" || decoded.Transactions[1].Validation != "MVCC_READ_CONFLICT" || decoded.Transactions[1].Type != "ENDORSER_TRANSACTION" {
+		t.Errorf("endorser transactions: %+v", decoded.Transactions)
+	}
+
+	// transactions beyond the filter have no validation code yet
+	decoded, err = DecodeBlock(block(next.Header, 2, nil, envelope(t, endorser, nil)))
+	if err != nil || len(decoded.Transactions) != 1 || len(decoded.Transactions[0].Validation) != 0 {
+		t.Errorf("block without filter: %+v, %v", decoded, err)
+	}
+
+	if _, err := DecodeBlock(block(nil, 3, nil, []byte("not an envelope"))); err == nil {
+		t.Error("broken envelope is decoded")
+	}
+}
+
+func TestBlocksRange(t *testing.T) {
+	// the range is checked before anything is asked from the peer
+	if _, responseErr := (&Client{}).Blocks(context.Background(), Timeouts{}, "trustchain", 3, 2); responseErr == nil || responseErr.Status != codes.InvalidArgument {
+		t.Errorf("reversed range: %+v", responseErr)
+	}
+}
+
+// certificate returns a self-signed PEM certificate of the common name.
+func certificate(t *testing.T, commonName string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: commonName, Organization: []string{"org1"}}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestDecodeTransactionDetail(t *testing.T) {
+	marshal := func(m proto.Message) []byte {
+		t.Helper()
+		raw, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	identity := func(mspid string, id []byte) []byte {
+		return marshal(&msp.SerializedIdentity{Mspid: mspid, IdBytes: id})
+	}
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// region: transaction
+
+	set := &kvrwset.KVRWSet{
+		Reads: []*kvrwset.KVRead{{Key: "k0", Version: &kvrwset.Version{BlockNum: 3, TxNum: 1}}},
+		Writes: []*kvrwset.KVWrite{
+			{Key: "k1", Value: []byte("v1")},
+			{Key: "k2", Value: []byte(`{"n":2}`)},
+			{Key: "k3", IsDelete: true},
+		},
+	}
+	results := &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV, NsRwset: []*rwset.NsReadWriteSet{
+		{Namespace: "basic", Rwset: marshal(set)},
+		{Namespace: "_lifecycle", Rwset: marshal(&kvrwset.KVRWSet{Reads: []*kvrwset.KVRead{{Key: "namespaces/fields/basic/Sequence"}}})},
+	}}
+	action := &peer.ChaincodeAction{
+		ChaincodeId: &peer.ChaincodeID{Name: "basic", Version: "1.0"},
+		Events:      marshal(&peer.ChaincodeEvent{ChaincodeId: "basic", EventName: "Put", Payload: []byte(`{"key":"k1"}`)}),
+		Results:     marshal(results),
+	}
+	invocation := &peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: "basic"},
+		Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte("Put"), []byte("k1"), []byte("v1")}},
+	}}
+	payload := &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{
+			Endorsements: []*peer.Endorsement{
+				{Endorser: identity("Org1MSP", certificate(t, "peer0.org1.example.com"))},
+				{Endorser: identity("Org2MSP", []byte("not a certificate"))},
+			},
+			ProposalResponsePayload: marshal(&peer.ProposalResponsePayload{Extension: marshal(action)}),
+		},
+		ChaincodeProposalPayload: marshal(&peer.ChaincodeProposalPayload{Input: marshal(invocation)}),
+	}
+	header := &common.Header{
+		ChannelHeader:   marshal(&common.ChannelHeader{Timestamp: timestamppb.New(timestamp), TxId: "tx1", Type: int32(common.HeaderType_ENDORSER_TRANSACTION)}),
+		SignatureHeader: marshal(&common.SignatureHeader{Creator: identity("Org1MSP", certificate(t, "User1@org1.example.com"))}),
+	}
+	envelope := &common.Envelope{Payload: marshal(&common.Payload{
+		Data:   marshal(&peer.Transaction{Actions: []*peer.TransactionAction{{Payload: marshal(payload)}}}),
+		Header: header,
+	})}
+
+	// endregion: transaction
+
+	tx, err := decodeTransactionDetail(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Txid != "tx1" || tx.Type != "ENDORSER_TRANSACTION" || !tx.Timestamp.Equal(timestamp) || tx.Chaincode != "basic" || tx.ChaincodeVersion != "1.0" || tx.Function != "Put" || len(tx.Args) != 2 || tx.Args[1] != "v1" {
+		t.Errorf("invocation: %+v", tx)
+	}
+	if tx.Creator.MSPID != "Org1MSP" || tx.Creator.Subject != "CN=User1@org1.example.com,O=org1" {
+		t.Errorf("creator: %+v", tx.Creator)
+	}
+	if len(tx.Endorsers) != 2 || tx.Endorsers[0].MSPID != "Org1MSP" || tx.Endorsers[0].Subject != "CN=peer0.org1.example.com,O=org1" || tx.Endorsers[1].MSPID != "Org2MSP" || len(tx.Endorsers[1].Subject) != 0 {
+		t.Errorf("endorsers: %+v", tx.Endorsers)
+	}
+	if len(tx.Events) != 1 || tx.Events[0].Name != "Put" || tx.Events[0].Chaincode != "basic" || string(tx.Events[0].Payload) != `{"key":"k1"}` {
+		t.Errorf("events: %+v", tx.Events)
+	}
+
+	if len(tx.RWSet) != 2 || tx.RWSet[0].Namespace != "basic" || tx.RWSet[1].Namespace != "_lifecycle" {
+		t.Fatalf("rwset: %+v", tx.RWSet)
+	}
+	basic := tx.RWSet[0]
+	if len(basic.Reads) != 1 || basic.Reads[0] != (KVRead{Key: "k0", BlockNum: 3, TxNum: 1}) {
+		t.Errorf("reads: %+v", basic.Reads)
+	}
+	// values that are not json are quoted, deletes have none
+	if len(basic.Writes) != 3 || string(basic.Writes[0].Value) != `"v1"` || string(basic.Writes[1].Value) != `{"n":2}` || !basic.Writes[2].IsDelete || string(basic.Writes[2].Value) != "null" {
+		t.Errorf("writes: %+v", basic.Writes)
+	}
+
+	// anything but an endorser transaction has headers only
+	config := &common.Envelope{Payload: marshal(&common.Payload{Header: &common.Header{ChannelHeader: marshal(&common.ChannelHeader{Type: int32(common.HeaderType_CONFIG)})}})}
+	if tx, err = decodeTransactionDetail(config); err != nil || tx.Type != "CONFIG" || len(tx.Chaincode) != 0 || len(tx.RWSet) != 0 {
+		t.Errorf("config transaction: %+v, %v", tx, err)
+	}
+}
@@ -0,0 +1,237 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer/lifecycle"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: _lifecycle
+
+// ChaincodeDefinitions lists the chaincode definitions committed on the channel.
+func (c *Client) ChaincodeDefinitions(ctx context.Context, timeouts Timeouts, channel string) ([]ChaincodeDefinition, *ResponseError) {
+	result := &lifecycle.QueryChaincodeDefinitionsResult{}
+	responseErr := c.lifecycle(ctx, timeouts, channel, "QueryChaincodeDefinitions", &lifecycle.QueryChaincodeDefinitionsArgs{}, result)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+
+	definitions := make([]ChaincodeDefinition, 0, len(result.GetChaincodeDefinitions()))
+	for _, d := range result.GetChaincodeDefinitions() {
+		definitions = append(definitions, ChaincodeDefinition{
+			Collections:       decodeCollections(d.GetCollections()),
+			EndorsementPlugin: d.GetEndorsementPlugin(),
+			EndorsementPolicy: decodeApplicationPolicy(d.GetValidationParameter()),
+			InitRequired:      d.GetInitRequired(),
+			Name:              d.GetName(),
+			Sequence:          d.GetSequence(),
+			ValidationPlugin:  d.GetValidationPlugin(),
+			Version:           d.GetVersion(),
+		})
+	}
+	return definitions, nil
+}
+
+// ChaincodeDefinition returns the committed definition of the chaincode along with the
+// approvals of the channel's orgs.
+func (c *Client) ChaincodeDefinition(ctx context.Context, timeouts Timeouts, channel, name string) (*ChaincodeDefinition, *ResponseError) {
+	result := &lifecycle.QueryChaincodeDefinitionResult{}
+	responseErr := c.lifecycle(ctx, timeouts, channel, "QueryChaincodeDefinition", &lifecycle.QueryChaincodeDefinitionArgs{Name: name}, result)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+
+	return &ChaincodeDefinition{
+		Approvals:         result.GetApprovals(),
+		Collections:       decodeCollections(result.GetCollections()),
+		EndorsementPlugin: result.GetEndorsementPlugin(),
+		EndorsementPolicy: decodeApplicationPolicy(result.GetValidationParameter()),
+		InitRequired:      result.GetInitRequired(),
+		Name:              name,
+		Sequence:          result.GetSequence(),
+		ValidationPlugin:  result.GetValidationPlugin(),
+		Version:           result.GetVersion(),
+	}, nil
+}
+
+// ApprovedChaincodeDefinition returns the definition approved by the org of the gateway peer,
+// the latest one if sequence is 0, and checks its commit readiness to collect the approvals
+// of the other orgs.
+func (c *Client) ApprovedChaincodeDefinition(ctx context.Context, timeouts Timeouts, channel, name string, sequence int64) (*ChaincodeDefinition, *ResponseError) {
+
+	// region: approved
+
+	approved := &lifecycle.QueryApprovedChaincodeDefinitionResult{}
+	responseErr := c.lifecycle(ctx, timeouts, channel, "QueryApprovedChaincodeDefinition", &lifecycle.QueryApprovedChaincodeDefinitionArgs{Name: name, Sequence: sequence}, approved)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+
+	definition := &ChaincodeDefinition{
+		Collections:       decodeCollections(approved.GetCollections()),
+		EndorsementPlugin: approved.GetEndorsementPlugin(),
+		EndorsementPolicy: decodeApplicationPolicy(approved.GetValidationParameter()),
+		InitRequired:      approved.GetInitRequired(),
+		Name:              name,
+		Sequence:          approved.GetSequence(),
+		Source:            "unavailable",
+		ValidationPlugin:  approved.GetValidationPlugin(),
+		Version:           approved.GetVersion(),
+	}
+	if local := approved.GetSource().GetLocalPackage(); local != nil {
+		definition.Source = local.GetPackageId()
+	}
+
+	// endregion: approved
+	// region: readiness
+
+	readiness := &lifecycle.CheckCommitReadinessResult{}
+	responseErr = c.lifecycle(ctx, timeouts, channel, "CheckCommitReadiness", &lifecycle.CheckCommitReadinessArgs{
+		Collections:         approved.GetCollections(),
+		EndorsementPlugin:   approved.GetEndorsementPlugin(),
+		InitRequired:        approved.GetInitRequired(),
+		Name:                name,
+		Sequence:            approved.GetSequence(),
+		ValidationParameter: approved.GetValidationParameter(),
+		ValidationPlugin:    approved.GetValidationPlugin(),
+		Version:             approved.GetVersion(),
+	}, readiness)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+	definition.Approvals = readiness.GetApprovals()
+
+	// endregion: readiness
+
+	return definition, nil
+
+}
+
+// lifecycle evaluates a _lifecycle function, which takes and returns a single protobuf message,
+// bound by ctx and the evaluate timeout of timeouts, like Query.
+func (c *Client) lifecycle(ctx context.Context, timeouts Timeouts, channel, function string, args, result proto.Message) *ResponseError {
+	raw, err := proto.Marshal(args)
+	if err != nil {
+		return Error(err)
+	}
+	evaluate, cancel := (&Request{Context: ctx, Timeouts: timeouts}).context(phaseEvaluate)
+	defer cancel()
+	response, err := c.Contract(channel, "_lifecycle").EvaluateWithContext(evaluate, function, client.WithBytesArguments(raw))
+	if err != nil {
+		return Error(err)
+	}
+	err = proto.Unmarshal(response, result)
+	if err != nil {
+		return Error(fmt.Errorf("failed to deserialize %s result: %w", function, err))
+	}
+	return nil
+}
+
+// endregion: _lifecycle
+// region: decode
+
+func decodeCollections(collections *peer.CollectionConfigPackage) []Collection {
+	out := make([]Collection, 0, len(collections.GetConfig()))
+	for _, config := range collections.GetConfig() {
+		static := config.GetStaticCollectionConfig()
+		if static == nil {
+			continue
+		}
+		collection := Collection{
+			BlockToLive:       static.GetBlockToLive(),
+			MaximumPeerCount:  static.GetMaximumPeerCount(),
+			MemberOnlyRead:    static.GetMemberOnlyRead(),
+			MemberOnlyWrite:   static.GetMemberOnlyWrite(),
+			MemberOrgsPolicy:  policyString(static.GetMemberOrgsPolicy().GetSignaturePolicy()),
+			Name:              static.GetName(),
+			RequiredPeerCount: static.GetRequiredPeerCount(),
+		}
+		if policy := static.GetEndorsementPolicy(); policy != nil {
+			collection.EndorsementPolicy = applicationPolicyString(policy)
+		}
+		out = append(out, collection)
+	}
+	return out
+}
+
+// decodeApplicationPolicy renders a serialized peer.ApplicationPolicy (the validation parameter
+// of the default validation plugin) in the syntax of the peer cli.
+func decodeApplicationPolicy(raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	policy := &peer.ApplicationPolicy{}
+	if err := proto.Unmarshal(raw, policy); err != nil {
+		return fmt.Sprintf("undecodable policy: %s", err)
+	}
+	return applicationPolicyString(policy)
+}
+
+func applicationPolicyString(policy *peer.ApplicationPolicy) string {
+	if reference := policy.GetChannelConfigPolicyReference(); len(reference) > 0 {
+		return reference
+	}
+	return policyString(policy.GetSignaturePolicy())
+}
+
+// policyString renders a signature policy like OR('Org1MSP.peer', 'Org2MSP.peer').
+func policyString(envelope *common.SignaturePolicyEnvelope) string {
+	if envelope == nil {
+		return ""
+	}
+
+	principals := make([]string, len(envelope.GetIdentities()))
+	for i, identity := range envelope.GetIdentities() {
+		principals[i] = principalString(identity)
+	}
+
+	var rule func(*common.SignaturePolicy) string
+	rule = func(p *common.SignaturePolicy) string {
+		if nOutOf := p.GetNOutOf(); nOutOf != nil {
+			rules := make([]string, 0, len(nOutOf.GetRules()))
+			for _, r := range nOutOf.GetRules() {
+				rules = append(rules, rule(r))
+			}
+			switch {
+			case int(nOutOf.GetN()) == len(rules):
+				return "AND(" + strings.Join(rules, ", ") + ")"
+			case nOutOf.GetN() == 1:
+				return "OR(" + strings.Join(rules, ", ") + ")"
+			default:
+				return fmt.Sprintf("OutOf(%d, %s)", nOutOf.GetN(), strings.Join(rules, ", "))
+			}
+		}
+		signedBy := int(p.GetSignedBy())
+		if signedBy < len(principals) {
+			return principals[signedBy]
+		}
+		return fmt.Sprintf("'unknown principal %d'", signedBy)
+	}
+
+	return rule(envelope.GetRule())
+}
+
+func principalString(principal *msp.MSPPrincipal) string {
+	switch principal.GetPrincipalClassification() {
+	case msp.MSPPrincipal_ROLE:
+		role := &msp.MSPRole{}
+		if err := proto.Unmarshal(principal.GetPrincipal(), role); err == nil {
+			return fmt.Sprintf("'%s.%s'", role.GetMspIdentifier(), strings.ToLower(role.GetRole().String()))
+		}
+	case msp.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &msp.OrganizationUnit{}
+		if err := proto.Unmarshal(principal.GetPrincipal(), ou); err == nil {
+			return fmt.Sprintf("'%s.OU.%s'", ou.GetMspIdentifier(), ou.GetOrganizationalUnitIdentifier())
+		}
+	}
+	return fmt.Sprintf("'%s'", principal.GetPrincipalClassification())
+}
+
+// endregion: decode
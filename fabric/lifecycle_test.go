@@ -0,0 +1,126 @@
+package fabric
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// policy returns a signature policy envelope over the principals, in the order they are given.
+func policy(rule *common.SignaturePolicy, principals ...*msp.MSPPrincipal) *common.SignaturePolicyEnvelope {
+	return &common.SignaturePolicyEnvelope{Identities: principals, Rule: rule}
+}
+
+func role(t *testing.T, mspid string, role msp.MSPRole_MSPRoleType) *msp.MSPPrincipal {
+	t.Helper()
+	raw, err := proto.Marshal(&msp.MSPRole{MspIdentifier: mspid, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &msp.MSPPrincipal{Principal: raw, PrincipalClassification: msp.MSPPrincipal_ROLE}
+}
+
+func outOf(n int32, rules ...*common.SignaturePolicy) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{N: n, Rules: rules}}}
+}
+
+func signedBy(i int32) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: i}}
+}
+
+func TestPolicyString(t *testing.T) {
+	org1, org2, org3 := role(t, "Org1MSP", msp.MSPRole_PEER), role(t, "Org2MSP", msp.MSPRole_MEMBER), role(t, "Org3MSP", msp.MSPRole_ADMIN)
+	unit, err := proto.Marshal(&msp.OrganizationUnit{MspIdentifier: "Org1MSP", OrganizationalUnitIdentifier: "auditors"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditors := &msp.MSPPrincipal{Principal: unit, PrincipalClassification: msp.MSPPrincipal_ORGANIZATION_UNIT}
+
+	for _, tc := range []struct {
+		name   string
+		policy *common.SignaturePolicyEnvelope
+		want   string
+	}{
+		{"none", nil, ""},
+		{"single", policy(signedBy(0), org1), "'Org1MSP.peer'"},
+		{"or", policy(outOf(1, signedBy(0), signedBy(1)), org1, org2), "OR('Org1MSP.peer', 'Org2MSP.member')"},
+		{"and", policy(outOf(2, signedBy(0), signedBy(1)), org1, org2), "AND('Org1MSP.peer', 'Org2MSP.member')"},
+		{"out of", policy(outOf(2, signedBy(0), signedBy(1), signedBy(2)), org1, org2, org3), "OutOf(2, 'Org1MSP.peer', 'Org2MSP.member', 'Org3MSP.admin')"},
+		{"nested", policy(outOf(1, outOf(2, signedBy(0), signedBy(1)), signedBy(2)), org1, org2, org3), "OR(AND('Org1MSP.peer', 'Org2MSP.member'), 'Org3MSP.admin')"},
+		{"organization unit", policy(signedBy(0), auditors), "'Org1MSP.OU.auditors'"},
+		{"unknown principal", policy(outOf(1, signedBy(0), signedBy(5)), org1), "OR('Org1MSP.peer', 'unknown principal 5')"},
+	} {
+		if got := policyString(tc.policy); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeApplicationPolicy(t *testing.T) {
+	marshal := func(p *peer.ApplicationPolicy) []byte {
+		raw, err := proto.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	org1 := role(t, "Org1MSP", msp.MSPRole_PEER)
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{"none", nil, ""},
+		{"reference", marshal(&peer.ApplicationPolicy{Type: &peer.ApplicationPolicy_ChannelConfigPolicyReference{ChannelConfigPolicyReference: "/Channel/Application/Endorsement"}}), "/Channel/Application/Endorsement"},
+		{"signature", marshal(&peer.ApplicationPolicy{Type: &peer.ApplicationPolicy_SignaturePolicy{SignaturePolicy: policy(signedBy(0), org1)}}), "'Org1MSP.peer'"},
+	} {
+		if got := decodeApplicationPolicy(tc.raw); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+	if got := decodeApplicationPolicy([]byte{0xff}); !strings.HasPrefix(got, "undecodable policy: ") {
+		t.Errorf("broken policy: %s", got)
+	}
+}
+
+func TestDecodeCollections(t *testing.T) {
+	org1, org2 := role(t, "Org1MSP", msp.MSPRole_MEMBER), role(t, "Org2MSP", msp.MSPRole_MEMBER)
+	members := &peer.CollectionPolicyConfig{Payload: &peer.CollectionPolicyConfig_SignaturePolicy{SignaturePolicy: policy(outOf(1, signedBy(0), signedBy(1)), org1, org2)}}
+
+	collections := decodeCollections(&peer.CollectionConfigPackage{Config: []*peer.CollectionConfig{
+		{Payload: &peer.CollectionConfig_StaticCollectionConfig{StaticCollectionConfig: &peer.StaticCollectionConfig{
+			BlockToLive:       100,
+			MaximumPeerCount:  3,
+			MemberOnlyRead:    true,
+			MemberOrgsPolicy:  members,
+			Name:              "secrets",
+			RequiredPeerCount: 1,
+		}}},
+		{Payload: &peer.CollectionConfig_StaticCollectionConfig{StaticCollectionConfig: &peer.StaticCollectionConfig{
+			EndorsementPolicy: &peer.ApplicationPolicy{Type: &peer.ApplicationPolicy_ChannelConfigPolicyReference{ChannelConfigPolicyReference: "/Channel/Application/Writers"}},
+			MemberOnlyWrite:   true,
+			MemberOrgsPolicy:  members,
+			Name:              "audit",
+		}}},
+		{},
+	}})
+
+	if len(collections) != 2 {
+		t.Fatalf("got %+v, want the two static collections", collections)
+	}
+	want := Collection{BlockToLive: 100, MaximumPeerCount: 3, MemberOnlyRead: true, MemberOrgsPolicy: "OR('Org1MSP.member', 'Org2MSP.member')", Name: "secrets", RequiredPeerCount: 1}
+	if collections[0] != want {
+		t.Errorf("got %+v, want %+v", collections[0], want)
+	}
+	if c := collections[1]; c.Name != "audit" || c.EndorsementPolicy != "/Channel/Application/Writers" || !c.MemberOnlyWrite || c.MemberOnlyRead {
+		t.Errorf("collection with endorsement policy: %+v", c)
+	}
+	if got := decodeCollections(nil); got == nil || len(got) != 0 {
+		t.Errorf("no collections: %#v", got)
+	}
+}
@@ -0,0 +1,305 @@
+// region: packages
+
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// endregion: packages
+// region: types
+
+// Monitor polls the chain info of the channels on the peers and keeps track of their heights,
+// the time of their last block, their growth rate and their lag behind the highest peer of the
+// channel. StallAlert and LagAlert are the thresholds of the STALLED and LAGGING alerts, 0
+// disables them, a peer that fails to report its chain is DOWN.
+type Monitor struct {
+	Channels   []string
+	LagAlert   uint64
+	Peers      []ConsistencyPeer
+	StallAlert time.Duration
+
+	alerts  map[string]*MonitorAlert
+	chains  func(ConsistencyPeer) chainSource
+	mutex   sync.Mutex
+	polling sync.Mutex
+	polls   uint64
+	states  map[string]*MonitorState
+}
+
+// chainSource reads the chain of a channel on a peer, it is the Client of the peer unless a test
+// replaces it.
+type chainSource interface {
+	ChainInfo(channel string) (*ChainInfo, *ResponseError)
+	Block(channel string, number uint64) (*Block, *ResponseError)
+}
+
+// clientChain is the chainSource of a peer's Client, polls are bound by the client's timeouts.
+type clientChain struct{ *Client }
+
+func (c clientChain) ChainInfo(channel string) (*ChainInfo, *ResponseError) {
+	return c.Client.ChainInfo(context.Background(), c.Timeouts, channel)
+}
+
+func (c clientChain) Block(channel string, number uint64) (*Block, *ResponseError) {
+	return c.Client.Block(context.Background(), c.Timeouts, channel, number)
+}
+
+// MonitorState is the chain of a channel on a peer as of the last poll. LastBlock is the
+// timestamp of the last block, or the time its height was first seen if the block cannot be
+// read, Rate is the growth of the height since the previous poll in blocks per minute.
+type MonitorState struct {
+	Channel   string    `json:"channel"`
+	Error     string    `json:"error,omitempty"`
+	Height    uint64    `json:"height"`
+	Lag       uint64    `json:"lag"`
+	LastBlock time.Time `json:"last_block"`
+	Peer      string    `json:"peer"`
+	Polled    time.Time `json:"polled"`
+	Rate      float64   `json:"rate"`
+	Up        bool      `json:"up"`
+}
+
+// MonitorAlert is raised when a peer crosses a threshold on a channel and resolved when it is
+// back below it.
+type MonitorAlert struct {
+	Channel  string    `json:"channel"`
+	Kind     string    `json:"kind"`
+	Message  string    `json:"message"`
+	Peer     string    `json:"peer"`
+	Resolved bool      `json:"resolved"`
+	Time     time.Time `json:"time"`
+}
+
+const (
+	MonitorAlertDown    string = "DOWN"
+	MonitorAlertLagging string = "LAGGING"
+	MonitorAlertStalled string = "STALLED"
+)
+
+// endregion: types
+// region: poll
+
+// Poll reads the chain info of every channel on every peer and returns the alerts raised or
+// resolved since the previous poll. The peers are asked without holding the mutex, so that
+// States, Alerts and Metrics are not held up by a slow peer, polls run one at a time.
+func (m *Monitor) Poll(now time.Time) []MonitorAlert {
+	m.polling.Lock()
+	defer m.polling.Unlock()
+
+	m.mutex.Lock()
+	previous := make(map[string]MonitorState, len(m.states))
+	for key, state := range m.states {
+		previous[key] = *state
+	}
+	m.mutex.Unlock()
+
+	polled := make(map[string]*MonitorState, len(m.Channels)*len(m.Peers))
+	for _, channel := range m.Channels {
+		for _, p := range m.Peers {
+			key := monitorKey(channel, p.Name)
+			polled[key] = m.poll(channel, p, previous[key], now)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.states == nil {
+		m.states = make(map[string]*MonitorState)
+		m.alerts = make(map[string]*MonitorAlert)
+	}
+	m.polls++
+
+	changes := make([]MonitorAlert, 0)
+	for _, channel := range m.Channels {
+		var highest uint64
+		for _, p := range m.Peers {
+			state := polled[monitorKey(channel, p.Name)]
+			if state.Up && state.Height > highest {
+				highest = state.Height
+			}
+		}
+		for _, p := range m.Peers {
+			state := polled[monitorKey(channel, p.Name)]
+			state.Lag = 0
+			if state.Up {
+				state.Lag = highest - state.Height
+			}
+			m.states[monitorKey(channel, p.Name)] = state
+			changes = append(changes, m.evaluate(state, now)...)
+		}
+	}
+	return changes
+}
+
+// poll returns the state of the channel on the peer following its previous one.
+func (m *Monitor) poll(channel string, p ConsistencyPeer, state MonitorState, now time.Time) *MonitorState {
+	state.Channel, state.Peer = channel, p.Name
+	var chain chainSource = clientChain{p.Client}
+	if m.chains != nil {
+		chain = m.chains(p)
+	}
+
+	info, responseErr := chain.ChainInfo(channel)
+	if responseErr != nil {
+		state.Error = fmt.Sprintf("chain info: %s", responseErr.Message)
+		state.Rate = 0
+		state.Up = false
+		return &state
+	}
+
+	if state.Polled.IsZero() || info.Height != state.Height {
+		if !state.Polled.IsZero() && info.Height > state.Height {
+			state.Rate = float64(info.Height-state.Height) / now.Sub(state.Polled).Minutes()
+		}
+		state.LastBlock = now
+		if info.Height > 0 {
+			if block, responseErr := chain.Block(channel, info.Height-1); responseErr == nil && !block.Timestamp.IsZero() {
+				state.LastBlock = block.Timestamp
+			}
+		}
+	} else {
+		state.Rate = 0
+	}
+	state.Error = ""
+	state.Height = info.Height
+	state.Polled = now
+	state.Up = true
+	return &state
+}
+
+// evaluate raises and resolves the alerts of the state.
+func (m *Monitor) evaluate(state *MonitorState, now time.Time) []MonitorAlert {
+	changes := make([]MonitorAlert, 0)
+	check := func(kind string, active bool, message string) {
+		key := kind + "|" + monitorKey(state.Channel, state.Peer)
+		alert, raised := m.alerts[key]
+		switch {
+		case active && !raised:
+			alert = &MonitorAlert{Channel: state.Channel, Kind: kind, Message: message, Peer: state.Peer, Time: now}
+			m.alerts[key] = alert
+			changes = append(changes, *alert)
+		case !active && raised:
+			delete(m.alerts, key)
+			changes = append(changes, MonitorAlert{Channel: state.Channel, Kind: kind, Message: message, Peer: state.Peer, Resolved: true, Time: now})
+		}
+	}
+
+	check(MonitorAlertDown, !state.Up, state.Error)
+	if !state.Up {
+		// a peer that is down has no fresh height to judge, its other alerts are kept as they are
+		return changes
+	}
+	since := now.Sub(state.LastBlock)
+	check(MonitorAlertStalled, m.StallAlert > 0 && since > m.StallAlert, fmt.Sprintf("no new block for %s at height %d", since.Truncate(time.Second), state.Height))
+	check(MonitorAlertLagging, m.LagAlert > 0 && state.Lag > m.LagAlert, fmt.Sprintf("%d blocks behind at height %d", state.Lag, state.Height))
+	return changes
+}
+
+// endregion: poll
+// region: report
+
+// States returns the state of every channel on every peer, by channel and peer.
+func (m *Monitor) States() []MonitorState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	states := make([]MonitorState, 0, len(m.states))
+	for _, state := range m.states {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Channel != states[j].Channel {
+			return states[i].Channel < states[j].Channel
+		}
+		return states[i].Peer < states[j].Peer
+	})
+	return states
+}
+
+// Alerts returns the alerts raised and not resolved yet.
+func (m *Monitor) Alerts() []MonitorAlert {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	alerts := make([]MonitorAlert, 0, len(m.alerts))
+	for _, alert := range m.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Kind+monitorKey(alerts[i].Channel, alerts[i].Peer) < alerts[j].Kind+monitorKey(alerts[j].Channel, alerts[j].Peer)
+	})
+	return alerts
+}
+
+// Metrics writes the states and the active alerts in the Prometheus text format, the time since
+// the last block is as of now.
+func (m *Monitor) Metrics(w io.Writer, now time.Time) {
+	states := m.States()
+	alerts := m.Alerts()
+	m.mutex.Lock()
+	polls := m.polls
+	m.mutex.Unlock()
+
+	fmt.Fprintln(w, "# HELP tc_monitor_polls_total Polls of the chain info of the peers.")
+	fmt.Fprintln(w, "# TYPE tc_monitor_polls_total counter")
+	fmt.Fprintf(w, "tc_monitor_polls_total %d\n", polls)
+
+	gauge := func(name, help string, value func(MonitorState) string) {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		for _, state := range states {
+			if v := value(state); len(v) > 0 {
+				fmt.Fprintf(w, "%s{peer=%q,channel=%q} %s\n", name, state.Peer, state.Channel, v)
+			}
+		}
+	}
+	gauge("tc_monitor_up", "Whether the peer reported its chain at the last poll.", func(s MonitorState) string {
+		if s.Up {
+			return "1"
+		}
+		return "0"
+	})
+	gauge("tc_monitor_height", "Height of the chain of the channel on the peer.", func(s MonitorState) string {
+		if s.Polled.IsZero() {
+			return ""
+		}
+		return fmt.Sprintf("%d", s.Height)
+	})
+	gauge("tc_monitor_blocks_per_minute", "Growth of the height since the previous poll.", func(s MonitorState) string {
+		if !s.Up {
+			return ""
+		}
+		return fmt.Sprintf("%g", s.Rate)
+	})
+	gauge("tc_monitor_seconds_since_last_block", "Time since the last block of the channel on the peer.", func(s MonitorState) string {
+		if s.LastBlock.IsZero() {
+			return ""
+		}
+		return fmt.Sprintf("%g", now.Sub(s.LastBlock).Seconds())
+	})
+	gauge("tc_monitor_lag_blocks", "Blocks the peer is behind the highest peer of the channel.", func(s MonitorState) string {
+		if !s.Up {
+			return ""
+		}
+		return fmt.Sprintf("%d", s.Lag)
+	})
+
+	fmt.Fprintln(w, "# HELP tc_monitor_alert Alerts raised and not resolved yet.")
+	fmt.Fprintln(w, "# TYPE tc_monitor_alert gauge")
+	for _, alert := range alerts {
+		fmt.Fprintf(w, "tc_monitor_alert{peer=%q,channel=%q,kind=%q} 1\n", alert.Peer, alert.Channel, alert.Kind)
+	}
+}
+
+// endregion: report
+// region: helpers
+
+func monitorKey(channel, peer string) string {
+	return channel + "|" + peer
+}
+
+// endregion: helpers
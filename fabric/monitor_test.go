@@ -0,0 +1,165 @@
+package fabric
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// fakeChain is the chain of a channel on a peer, its blocks are stamped with the time they were
+// added at.
+type fakeChain struct {
+	down   bool
+	height uint64
+	stamps map[uint64]time.Time
+}
+
+func (f *fakeChain) ChainInfo(channel string) (*ChainInfo, *ResponseError) {
+	if f.down {
+		return nil, &ResponseError{Message: "connection refused"}
+	}
+	return &ChainInfo{Channel: channel, Height: f.height}, nil
+}
+
+func (f *fakeChain) Block(channel string, number uint64) (*Block, *ResponseError) {
+	return &Block{BlockSummary: BlockSummary{Number: number, Timestamp: f.stamps[number]}}, nil
+}
+
+// grow adds n blocks stamped with at.
+func (f *fakeChain) grow(n uint64, at time.Time) {
+	for ; n > 0; n-- {
+		f.stamps[f.height] = at
+		f.height++
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	chains := map[string]*fakeChain{"peer0": {stamps: map[uint64]time.Time{}}, "peer1": {stamps: map[uint64]time.Time{}}}
+	for _, chain := range chains {
+		chain.grow(10, start.Add(-time.Minute))
+	}
+	m := &Monitor{
+		Channels:   []string{"ch1"},
+		LagAlert:   2,
+		Peers:      []ConsistencyPeer{{Name: "peer0"}, {Name: "peer1"}},
+		StallAlert: 5 * time.Minute,
+		chains:     func(p ConsistencyPeer) chainSource { return chains[p.Name] },
+	}
+
+	type change struct {
+		kind     string
+		peer     string
+		resolved bool
+	}
+	for _, step := range []struct {
+		name    string
+		at      time.Duration
+		update  func()
+		changes []change
+	}{
+		{"in sync", 0, func() {}, nil},
+		{"lagging", time.Minute, func() { chains["peer0"].grow(4, start.Add(time.Minute)) }, []change{{MonitorAlertLagging, "peer1", false}}},
+		{"down", 2 * time.Minute, func() { chains["peer1"].down = true }, []change{{MonitorAlertDown, "peer1", false}}},
+		{"caught up", 3 * time.Minute, func() {
+			chains["peer1"].down = false
+			chains["peer1"].grow(4, start.Add(time.Minute))
+		}, []change{{MonitorAlertDown, "peer1", true}, {MonitorAlertLagging, "peer1", true}}},
+		{"stalled", 10 * time.Minute, func() {}, []change{{MonitorAlertStalled, "peer0", false}, {MonitorAlertStalled, "peer1", false}}},
+		{"growing", 11 * time.Minute, func() { chains["peer0"].grow(1, start.Add(11*time.Minute)) }, []change{{MonitorAlertStalled, "peer0", true}}},
+	} {
+		step.update()
+		changes := m.Poll(start.Add(step.at))
+		if len(changes) != len(step.changes) {
+			t.Errorf("%s: got %+v, want %+v", step.name, changes, step.changes)
+			continue
+		}
+		for i, want := range step.changes {
+			if got := changes[i]; got.Kind != want.kind || got.Peer != want.peer || got.Resolved != want.resolved || got.Channel != "ch1" {
+				t.Errorf("%s: got %+v, want %+v", step.name, got, want)
+			}
+		}
+	}
+
+	states := m.States()
+	if len(states) != 2 || states[0].Height != 15 || states[0].Rate != 1 || states[0].Lag != 0 || states[1].Height != 14 || states[1].Lag != 1 || states[1].Rate != 0 {
+		t.Errorf("states %+v", states)
+	}
+
+	metrics := &bytes.Buffer{}
+	m.Metrics(metrics, start.Add(11*time.Minute))
+	golden := `# HELP tc_monitor_polls_total Polls of the chain info of the peers.
+# TYPE tc_monitor_polls_total counter
+tc_monitor_polls_total 6
+# HELP tc_monitor_up Whether the peer reported its chain at the last poll.
+# TYPE tc_monitor_up gauge
+tc_monitor_up{peer="peer0",channel="ch1"} 1
+tc_monitor_up{peer="peer1",channel="ch1"} 1
+# HELP tc_monitor_height Height of the chain of the channel on the peer.
+# TYPE tc_monitor_height gauge
+tc_monitor_height{peer="peer0",channel="ch1"} 15
+tc_monitor_height{peer="peer1",channel="ch1"} 14
+# HELP tc_monitor_blocks_per_minute Growth of the height since the previous poll.
+# TYPE tc_monitor_blocks_per_minute gauge
+tc_monitor_blocks_per_minute{peer="peer0",channel="ch1"} 1
+tc_monitor_blocks_per_minute{peer="peer1",channel="ch1"} 0
+# HELP tc_monitor_seconds_since_last_block Time since the last block of the channel on the peer.
+# TYPE tc_monitor_seconds_since_last_block gauge
+tc_monitor_seconds_since_last_block{peer="peer0",channel="ch1"} 0
+tc_monitor_seconds_since_last_block{peer="peer1",channel="ch1"} 600
+# HELP tc_monitor_lag_blocks Blocks the peer is behind the highest peer of the channel.
+# TYPE tc_monitor_lag_blocks gauge
+tc_monitor_lag_blocks{peer="peer0",channel="ch1"} 0
+tc_monitor_lag_blocks{peer="peer1",channel="ch1"} 1
+# HELP tc_monitor_alert Alerts raised and not resolved yet.
+# TYPE tc_monitor_alert gauge
+tc_monitor_alert{peer="peer1",channel="ch1",kind="STALLED"} 1
+`
+	if metrics.String() != golden {
+		t.Errorf("metrics:\n%s\nwant:\n%s", metrics, golden)
+	}
+}
+
+// TestMonitorPollDoesNotBlockMetrics checks that the metrics are served while a peer is slow to
+// answer a poll.
+func TestMonitorPollDoesNotBlockMetrics(t *testing.T) {
+	release := make(chan struct{})
+	slow := &slowChain{fakeChain: fakeChain{height: 1, stamps: map[uint64]time.Time{}}, release: release}
+	m := &Monitor{
+		Channels: []string{"ch1"},
+		Peers:    []ConsistencyPeer{{Name: "peer0"}},
+		chains:   func(ConsistencyPeer) chainSource { return slow },
+	}
+	done := make(chan struct{})
+	go func() {
+		m.Poll(time.Now())
+		close(done)
+	}()
+
+	served := make(chan struct{})
+	go func() {
+		m.Metrics(&bytes.Buffer{}, time.Now())
+		close(served)
+	}()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Error("metrics are blocked by a poll")
+	}
+	close(release)
+	<-done
+	if states := m.States(); len(states) != 1 || states[0].Height != 1 {
+		t.Errorf("states %+v", states)
+	}
+}
+
+// slowChain answers ChainInfo once release is closed.
+type slowChain struct {
+	fakeChain
+	release chan struct{}
+}
+
+func (s *slowChain) ChainInfo(channel string) (*ChainInfo, *ResponseError) {
+	<-s.release
+	return s.fakeChain.ChainInfo(channel)
+}
@@ -0,0 +1,334 @@
+// region: packages
+
+package fabric
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// endregion: packages
+// region: types
+
+// Profile is a Fabric connection profile, the common subset of the format read by the Fabric
+// SDKs. Organizations list their peers and certificate authorities by name and carry the client
+// identity as signedCert and adminPrivateKey, peers carry their url and TLS root. JSON profiles
+// are read the same way, as JSON is YAML.
+type Profile struct {
+	Name                   string                         `json:"name" yaml:"name"`
+	Version                string                         `json:"version" yaml:"version"`
+	Client                 ProfileClient                  `json:"client" yaml:"client"`
+	Organizations          map[string]ProfileOrganization `json:"organizations" yaml:"organizations"`
+	Peers                  map[string]ProfilePeer         `json:"peers" yaml:"peers"`
+	CertificateAuthorities map[string]ProfileCA           `json:"certificateAuthorities,omitempty" yaml:"certificateAuthorities,omitempty"`
+
+	dir string `json:"-" yaml:"-"`
+}
+
+type ProfileClient struct {
+	Organization string `json:"organization" yaml:"organization"`
+}
+
+type ProfileOrganization struct {
+	MSPID                  string     `json:"mspid" yaml:"mspid"`
+	Peers                  []string   `json:"peers" yaml:"peers"`
+	CertificateAuthorities []string   `json:"certificateAuthorities,omitempty" yaml:"certificateAuthorities,omitempty"`
+	SignedCert             ProfilePEM `json:"signedCert,omitempty" yaml:"signedCert,omitempty"`
+	AdminPrivateKey        ProfilePEM `json:"adminPrivateKey,omitempty" yaml:"adminPrivateKey,omitempty"`
+}
+
+type ProfilePeer struct {
+	URL         string                 `json:"url" yaml:"url"`
+	TLSCACerts  ProfilePEM             `json:"tlsCACerts" yaml:"tlsCACerts"`
+	GRPCOptions map[string]interface{} `json:"grpcOptions,omitempty" yaml:"grpcOptions,omitempty"`
+}
+
+type ProfileCA struct {
+	URL        string     `json:"url" yaml:"url"`
+	CAName     string     `json:"caName,omitempty" yaml:"caName,omitempty"`
+	TLSCACerts ProfilePEM `json:"tlsCACerts" yaml:"tlsCACerts"`
+}
+
+// ProfilePEM is either the path of a PEM file, relative paths are relative to the profile, or
+// the PEM itself. The path of a private key may be a keystore directory as well.
+type ProfilePEM struct {
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	PEM  string `json:"pem,omitempty" yaml:"pem,omitempty"`
+}
+
+const (
+	ProfileHostnameOverride  string = "hostnameOverride"
+	ProfileSSLTargetOverride string = "ssl-target-name-override"
+	ProfileVersion           string = "1.0.0"
+)
+
+// endregion: types
+// region: load
+
+// LoadProfile reads a connection profile in YAML or JSON.
+func LoadProfile(file string) (*Profile, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection profile: %w", err)
+	}
+	p := &Profile{}
+	err = yaml.Unmarshal(raw, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection profile %s: %w", file, err)
+	}
+	p.dir = filepath.Dir(file)
+	return p, nil
+}
+
+// Marshal returns the profile as YAML.
+func (p *Profile) Marshal() ([]byte, error) {
+	return yaml.Marshal(p)
+}
+
+// Save writes the profile as YAML, the file is replaced atomically.
+func (p *Profile) Save(file string) error {
+	raw, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, raw, 0644)
+}
+
+// endregion: load
+// region: client
+
+// NewClient returns a Client of org connecting to peer, not initialized yet.
+// An empty org means client.organization, or the only organization of the profile, an empty peer
+// the first peer of the organization. The gateway peer, the name the TLS certificate of the peer
+// is verified against, is its ssl-target-name-override or hostnameOverride grpc option if any,
+// otherwise its name in the profile.
+func (p *Profile) NewClient(org, peer string) (*Client, error) {
+	org, err := p.organization(org)
+	if err != nil {
+		return nil, err
+	}
+	o := p.Organizations[org]
+
+	if len(peer) == 0 {
+		if len(o.Peers) == 0 {
+			return nil, fmt.Errorf("organization %s has no peers in the connection profile", org)
+		}
+		peer = o.Peers[0]
+	}
+	endpoint, gatewayPeer, err := p.peer(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{GatewayPeer: gatewayPeer, MSPID: o.MSPID, PeerEndpoint: endpoint}
+	if c.CertPath, c.CertPEM, err = p.pem(o.SignedCert); err != nil {
+		return nil, fmt.Errorf("organization %s: signedCert %w", org, err)
+	}
+	if c.KeyPath, c.KeyPEM, err = p.pem(o.AdminPrivateKey); err != nil {
+		return nil, fmt.Errorf("organization %s: adminPrivateKey %w", org, err)
+	}
+	if c.TLSCertPath, c.TLSCertPEM, err = p.pem(p.Peers[peer].TLSCACerts); err != nil {
+		return nil, fmt.Errorf("peer %s: tlsCACerts %w", peer, err)
+	}
+	return c, nil
+}
+
+// PeerClient returns a client connecting to peer with the identity of base, not initialized yet,
+// eg. to evaluate on every peer of the profile as the same user. The MSP id of the organization
+// listing the peer, empty if none does, is returned along with it.
+func (p *Profile) PeerClient(peer string, base *Client) (*Client, string, error) {
+	endpoint, gatewayPeer, err := p.peer(peer)
+	if err != nil {
+		return nil, "", err
+	}
+	c := base.ForPeer(endpoint, gatewayPeer)
+	if c.TLSCertPath, c.TLSCertPEM, err = p.pem(p.Peers[peer].TLSCACerts); err != nil {
+		return nil, "", fmt.Errorf("peer %s: tlsCACerts %w", peer, err)
+	}
+
+	names := make([]string, 0, len(p.Organizations))
+	for name := range p.Organizations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, listed := range p.Organizations[name].Peers {
+			if listed == peer {
+				return c, p.Organizations[name].MSPID, nil
+			}
+		}
+	}
+	return c, "", nil
+}
+
+// PeerNames returns the names of the peers of the profile in order.
+func (p *Profile) PeerNames() []string {
+	names := make([]string, 0, len(p.Peers))
+	for name := range p.Peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewCA returns a CA of org, its first certificate authority, not initialized yet. An empty org
+// is resolved as described at NewClient.
+func (p *Profile) NewCA(org string) (*CA, error) {
+	org, err := p.organization(org)
+	if err != nil {
+		return nil, err
+	}
+	o := p.Organizations[org]
+	if len(o.CertificateAuthorities) == 0 {
+		return nil, fmt.Errorf("organization %s has no certificate authorities in the connection profile", org)
+	}
+	name := o.CertificateAuthorities[0]
+	authority, ok := p.CertificateAuthorities[name]
+	if !ok {
+		return nil, fmt.Errorf("certificate authority %s is not in the connection profile", name)
+	}
+
+	ca := &CA{CAName: authority.CAName, URL: authority.URL}
+	if len(authority.TLSCACerts.Path) > 0 || len(authority.TLSCACerts.PEM) > 0 {
+		if ca.TLSCertPath, ca.TLSCertPEM, err = p.pem(authority.TLSCACerts); err != nil {
+			return nil, fmt.Errorf("certificate authority %s: tlsCACerts %w", name, err)
+		}
+	}
+	return ca, nil
+}
+
+// organization resolves the name of org as described at NewClient.
+// peer returns the endpoint of the peer, its url without the scheme, and its gateway peer name,
+// see NewClient.
+func (p *Profile) peer(peer string) (string, string, error) {
+	pr, ok := p.Peers[peer]
+	if !ok {
+		return "", "", fmt.Errorf("peer %s is not in the connection profile", peer)
+	}
+	endpoint := pr.URL
+	for _, scheme := range []string{"grpcs://", "grpc://"} {
+		endpoint = strings.TrimPrefix(endpoint, scheme)
+	}
+	if len(endpoint) == 0 {
+		return "", "", fmt.Errorf("peer %s has no url in the connection profile", peer)
+	}
+	gatewayPeer := peer
+	for _, option := range []string{ProfileSSLTargetOverride, ProfileHostnameOverride} {
+		if override, ok := pr.GRPCOptions[option].(string); ok && len(override) > 0 {
+			gatewayPeer = override
+			break
+		}
+	}
+	return endpoint, gatewayPeer, nil
+}
+
+func (p *Profile) organization(org string) (string, error) {
+	if len(org) == 0 {
+		org = p.Client.Organization
+	}
+	if len(org) == 0 && len(p.Organizations) == 1 {
+		for name := range p.Organizations {
+			org = name
+		}
+	}
+	if len(org) == 0 {
+		return "", fmt.Errorf("connection profile has %d organizations and no client.organization, name one", len(p.Organizations))
+	}
+	if _, ok := p.Organizations[org]; !ok {
+		return "", fmt.Errorf("organization %s is not in the connection profile", org)
+	}
+	return org, nil
+}
+
+func (p *Profile) pem(source ProfilePEM) (string, []byte, error) {
+	switch {
+	case len(source.PEM) > 0:
+		return "", []byte(source.PEM), nil
+	case len(source.Path) == 0:
+		return "", nil, fmt.Errorf("has neither path nor pem")
+	case filepath.IsAbs(source.Path):
+		return source.Path, nil, nil
+	}
+	return filepath.Join(p.dir, source.Path), nil, nil
+}
+
+// endregion: client
+// region: env
+
+// ProfileFromEnv describes the TrustChain network configured by the TC_* variables of tcConf.sh
+// in a connection profile: organizations TC_ORG1, TC_ORG2... until TC_ORG<n>_STACK is unset, with
+// their peers TC_ORG<n>_P1, P2... and certificate authorities TC_ORG<n>_C1, C2..., and the client
+// identity of each organization in TC_ORG<n>_CLIENTMSP. The first peer of an organization is the
+// one its gateway connects to, client.organization is TC_ORG1.
+func ProfileFromEnv(getenv func(string) string) (*Profile, error) {
+	p := &Profile{
+		Name:                   getenv("TC_NETWORK_NAME"),
+		Version:                ProfileVersion,
+		Organizations:          make(map[string]ProfileOrganization),
+		Peers:                  make(map[string]ProfilePeer),
+		CertificateAuthorities: make(map[string]ProfileCA),
+	}
+	if len(p.Name) == 0 {
+		p.Name = "trustchain"
+	}
+
+	for i := 1; ; i++ {
+		prefix := "TC_ORG" + strconv.Itoa(i)
+		stack := getenv(prefix + "_STACK")
+		if len(stack) == 0 {
+			break
+		}
+		if len(p.Client.Organization) == 0 {
+			p.Client.Organization = stack
+		}
+		o := ProfileOrganization{MSPID: stack + "MSP", Peers: make([]string, 0)}
+		if msp := getenv(prefix + "_CLIENTMSP"); len(msp) > 0 {
+			o.SignedCert.Path = filepath.Join(msp, "signcerts", "cert.pem")
+			o.AdminPrivateKey.Path = filepath.Join(msp, "keystore")
+		}
+
+		for j := 1; ; j++ {
+			node := prefix + "_P" + strconv.Itoa(j)
+			fqdn, port := getenv(node+"_FQDN"), getenv(node+"_PORT")
+			if len(fqdn) == 0 || len(port) == 0 {
+				break
+			}
+			o.Peers = append(o.Peers, fqdn)
+			p.Peers[fqdn] = ProfilePeer{
+				URL:         "grpcs://" + fqdn + ":" + port,
+				TLSCACerts:  ProfilePEM{Path: getenv(node + "_ASSETS_TLSCERT")},
+				GRPCOptions: map[string]interface{}{ProfileSSLTargetOverride: fqdn},
+			}
+		}
+		for j := 1; ; j++ {
+			node := prefix + "_C" + strconv.Itoa(j)
+			fqdn, port := getenv(node+"_FQDN"), getenv(node+"_PORT")
+			if len(fqdn) == 0 || len(port) == 0 {
+				break
+			}
+			o.CertificateAuthorities = append(o.CertificateAuthorities, fqdn)
+			tlsCACerts := ProfilePEM{}
+			if len(o.Peers) > 0 {
+				tlsCACerts = p.Peers[o.Peers[0]].TLSCACerts
+			}
+			p.CertificateAuthorities[fqdn] = ProfileCA{URL: "https://" + fqdn + ":" + port, CAName: getenv(node + "_NAME"), TLSCACerts: tlsCACerts}
+		}
+		if len(o.Peers) == 0 {
+			return nil, fmt.Errorf("%s_STACK is set but %s_P1_FQDN or %s_P1_PORT is not", prefix, prefix, prefix)
+		}
+		p.Organizations[stack] = o
+	}
+
+	if len(p.Organizations) == 0 {
+		return nil, fmt.Errorf("TC_ORG1_STACK is unset, source tcConf.sh first")
+	}
+	return p, nil
+}
+
+// endregion: env
@@ -0,0 +1,39 @@
+package fabric
+
+import (
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Query evaluates the transaction on the gateway peer, bound by Request.Context and the
+// evaluate timeout. Request.EndorsingOrgs, if any, restricts the peers the gateway may evaluate
+// on to those of the orgs.
+func Query(r *Request) (*Response, *ResponseError) {
+
+	// region: fetch
+
+	ctx, cancel := r.context(phaseEvaluate)
+	defer cancel()
+	options := []client.ProposalOption{client.WithArguments(r.Args...)}
+	if len(r.EndorsingOrgs) > 0 {
+		options = append(options, client.WithEndorsingOrganizations(r.EndorsingOrgs...))
+	}
+	result, err := r.Contract.EvaluateWithContext(ctx, r.Function, options...)
+	if err != nil {
+		return nil, Error(err)
+	}
+
+	// endregion: fetch
+	// region: response
+
+	response := &Response{
+		Result: result,
+	}
+	return response, nil
+
+	// endregion: response
+
+}
+
+func (r *Request) Query() (*Response, *ResponseError) {
+	return Query(r)
+}
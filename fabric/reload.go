@@ -0,0 +1,354 @@
+// region: packages
+
+package fabric
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc/credentials"
+)
+
+// endregion: packages
+// region: types
+
+// material is the signing identity and the TLS root of a Client as read from CertPath, KeyPath
+// and TLSCertPath. The gateway and the gRPC connection look it up on every use, so it can be
+// replaced without reconnecting.
+type material struct {
+	certificate []byte
+	id          *identity.X509Identity
+	key         []byte
+	mutex       sync.RWMutex
+	roots       *x509.CertPool
+	sign        identity.Sign
+	tlsRoot     []byte
+}
+
+// reloadableIdentity is the identity.Identity of a Client, with the current certificate of its
+// material.
+type reloadableIdentity struct {
+	material *material
+	mspid    string
+}
+
+func (i *reloadableIdentity) MspID() string {
+	return i.mspid
+}
+
+func (i *reloadableIdentity) Credentials() []byte {
+	i.material.mutex.RLock()
+	defer i.material.mutex.RUnlock()
+	return i.material.id.Credentials()
+}
+
+// endregion: types
+// region: reload
+
+// Reload reads the certificate, the private key and the TLS root of c again and starts using
+// them if any of them changed, it reports whether they did. New handshakes with the gateway
+// peer are verified against the new TLS root, established connections are kept. A certificate
+// that does not match its key, eg. one caught in the middle of a rotation, is an error and the
+// previous identity stays in use. Clients made by WithIdentity have nothing to reload.
+func (c *Client) Reload() (bool, error) {
+	if c.material == nil {
+		return false, nil
+	}
+
+	certificatePEM, keyPEM, rootPEM, err := c.readMaterial()
+	if err != nil {
+		return false, err
+	}
+
+	c.material.mutex.RLock()
+	unchanged := bytes.Equal(certificatePEM, c.material.certificate) && bytes.Equal(keyPEM, c.material.key) && bytes.Equal(rootPEM, c.material.tlsRoot)
+	c.material.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	next, err := c.newMaterial(certificatePEM, keyPEM, rootPEM)
+	if err != nil {
+		return false, err
+	}
+
+	c.material.mutex.Lock()
+	defer c.material.mutex.Unlock()
+	c.material.certificate = next.certificate
+	c.material.id = next.id
+	c.material.key = next.key
+	c.material.roots = next.roots
+	c.material.sign = next.sign
+	c.material.tlsRoot = next.tlsRoot
+
+	return true, nil
+}
+
+// endregion: reload
+// region: helpers
+
+// loadMaterial reads and parses the files of c.
+func (c *Client) loadMaterial() (*material, error) {
+	certificatePEM, keyPEM, rootPEM, err := c.readMaterial()
+	if err != nil {
+		return nil, err
+	}
+	return c.newMaterial(certificatePEM, keyPEM, rootPEM)
+}
+
+// readMaterial reads the files of c, PEMs set on c directly, eg. from a connection profile,
+// take the place of their files. KeyPath is a keystore directory, whose key belonging to the
+// certificate is used, or the key file itself. Without KeyPath the key is looked up in Wallet
+// by the public key of the certificate, and if Label is set, both come from that identity of
+// Wallet.
+func (c *Client) readMaterial() (certificatePEM, keyPEM, rootPEM []byte, err error) {
+	if c.Wallet != nil && len(c.Label) > 0 {
+		id, err := c.Wallet.Get(c.Label)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		certificatePEM, keyPEM = []byte(id.Credentials.Certificate), []byte(id.Credentials.PrivateKey)
+	}
+	if len(certificatePEM) == 0 {
+		certificatePEM = c.CertPEM
+	}
+	if len(certificatePEM) == 0 {
+		certificatePEM, err = ioutil.ReadFile(c.CertPath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read certificate file: %w", err)
+		}
+	}
+	if len(keyPEM) == 0 {
+		keyPEM = c.KeyPEM
+	}
+	if len(keyPEM) == 0 && len(c.KeyPath) == 0 && c.Wallet != nil {
+		id, err := c.Wallet.Match(certificatePEM)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		keyPEM = []byte(id.Credentials.PrivateKey)
+	}
+	if len(keyPEM) == 0 {
+		keyPEM, err = readKey(c.KeyPath, certificatePEM)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	rootPEM = c.TLSCertPEM
+	if len(rootPEM) == 0 {
+		rootPEM, err = ioutil.ReadFile(c.TLSCertPath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read certificate file: %w", err)
+		}
+	}
+	return certificatePEM, keyPEM, rootPEM, nil
+}
+
+// readKey reads the private key at keyPath, a key file or a keystore directory, of whose files
+// the one belonging to the certificate is read, see matchKey.
+func readKey(keyPath string, certificatePEM []byte) ([]byte, error) {
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	if info.IsDir() {
+		files, err := keystore(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no private key in %s", keyPath)
+		}
+		keyPath, err = matchKey(keyPath, files, certificatePEM)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	return keyPEM, nil
+}
+
+// isKeystore tells whether keyPath is a keystore directory, an existing directory or a path
+// ending in a slash, rather than a key file.
+func isKeystore(keyPath string) (bool, error) {
+	info, err := os.Stat(keyPath)
+	if os.IsNotExist(err) {
+		return strings.HasSuffix(keyPath, "/"), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// keyFile returns the file the private key at keyPath is stored in, see WriteCredentials. In a
+// keystore directory it is the file of the key belonging to the certificate, if any does.
+func keyFile(keyPath string, certificatePEM []byte) (string, error) {
+	info, err := os.Stat(keyPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err != nil && !strings.HasSuffix(keyPath, "/") {
+		return keyPath, nil
+	}
+	if err == nil && !info.IsDir() {
+		return keyPath, nil
+	}
+	files, err := keystore(keyPath)
+	if err != nil && !os.IsNotExist(errors.Unwrap(err)) {
+		return "", err
+	}
+	if len(files) == 0 {
+		return path.Join(keyPath, "key.pem"), nil
+	}
+	if file, err := matchKey(keyPath, files, certificatePEM); err == nil {
+		return file, nil
+	}
+	return path.Join(keyPath, files[0]), nil
+}
+
+// matchKey returns the file of the keystore directory holding the private key of the
+// certificate, rather than whichever comes first. The only file of the directory is returned
+// as is, a certificate not matching it is reported where the pair is used.
+func matchKey(dir string, files []string, certificatePEM []byte) (string, error) {
+	if len(files) == 1 {
+		return path.Join(dir, files[0]), nil
+	}
+	certificate, err := parseCertificate(certificatePEM)
+	if err != nil {
+		return "", fmt.Errorf("%d private keys in %s and no certificate to choose by: %w", len(files), dir, err)
+	}
+	for _, file := range files {
+		keyPEM, err := ioutil.ReadFile(path.Join(dir, file))
+		if err == nil && keyMatches(certificate, keyPEM) {
+			return path.Join(dir, file), nil
+		}
+	}
+	return "", fmt.Errorf("none of the %d private keys in %s belongs to the certificate of %s", len(files), dir, certificate.Subject.CommonName)
+}
+
+// keyMatches tells whether keyPEM is the private key of the certificate.
+func keyMatches(certificate *x509.Certificate, keyPEM []byte) bool {
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return false
+	}
+	signer, ok := key.(crypto.Signer)
+	return ok && samePublicKey(certificate.PublicKey, signer.Public())
+}
+
+func samePublicKey(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// keystore lists the files of a keystore directory in alphabetical order, hidden files, like
+// the temporary files of writeFileAtomic, are skipped.
+func keystore(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+func (c *Client) newMaterial(certificatePEM, keyPEM, rootPEM []byte) (*material, error) {
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	id, err := identity.NewX509Identity(c.MSPID, certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type in %s", c.KeyPath)
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(certificate.PublicKey) {
+		return nil, fmt.Errorf("private key in %s does not match the certificate %s", c.KeyPath, c.CertPath)
+	}
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(rootPEM) {
+		return nil, fmt.Errorf("no certificate in %s", c.TLSCertPath)
+	}
+
+	return &material{
+		certificate: certificatePEM,
+		id:          id,
+		key:         keyPEM,
+		roots:       roots,
+		sign:        sign,
+		tlsRoot:     rootPEM,
+	}, nil
+}
+
+// signer signs with the current private key, the certificate returned by Credentials in the
+// meantime may be a newer one if a reload comes in between, the peer rejects such a proposal
+// and the call can be repeated.
+func (m *material) signer(digest []byte) ([]byte, error) {
+	m.mutex.RLock()
+	sign := m.sign
+	m.mutex.RUnlock()
+	return sign(digest)
+}
+
+// transportCredentials verifies the gateway peer against the current TLS root, instead of the
+// fixed pool credentials.NewClientTLSFromCert would keep.
+func (m *material) transportCredentials(serverName string) credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         serverName,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("gateway peer presented no certificate")
+			}
+			m.mutex.RLock()
+			roots := m.roots
+			m.mutex.RUnlock()
+
+			intermediates := x509.NewCertPool()
+			for _, certificate := range state.PeerCertificates[1:] {
+				intermediates.AddCert(certificate)
+			}
+			_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName:       serverName,
+				Intermediates: intermediates,
+				Roots:         roots,
+			})
+			return err
+		},
+	})
+}
+
+// endregion: helpers
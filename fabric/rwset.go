@@ -0,0 +1,188 @@
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: envelope
+
+// decodeEndorsedAction digs the endorsements and the read/write set out of an endorsed transaction envelope.
+func decodeEndorsedAction(envelope *common.Envelope) (*Simulation, error) {
+	payloads, actions, err := chaincodeActions(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	action := &Simulation{
+		Endorsers: make([]Endorser, 0),
+		RWSet:     make([]NsRWSet, 0),
+	}
+	for i, actionPayload := range payloads {
+		for _, endorsement := range actionPayload.GetAction().GetEndorsements() {
+			e, err := decodeEndorser(endorsement.GetEndorser())
+			if err != nil {
+				return nil, err
+			}
+			action.Endorsers = append(action.Endorsers, *e)
+		}
+
+		rwsets, err := decodeRWSet(actions[i].GetResults())
+		if err != nil {
+			return nil, err
+		}
+		action.RWSet = append(action.RWSet, rwsets...)
+	}
+
+	return action, nil
+}
+
+// chaincodeActions unpacks the endorsed action payloads of an endorser transaction envelope
+// along with the chaincode action each of them carries.
+func chaincodeActions(envelope *common.Envelope) ([]*peer.ChaincodeActionPayload, []*peer.ChaincodeAction, error) {
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+		return nil, nil, fmt.Errorf("failed to deserialize payload: %w", err)
+	}
+
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(payload.GetData(), transaction); err != nil {
+		return nil, nil, fmt.Errorf("failed to deserialize transaction: %w", err)
+	}
+
+	payloads := make([]*peer.ChaincodeActionPayload, 0, len(transaction.GetActions()))
+	actions := make([]*peer.ChaincodeAction, 0, len(transaction.GetActions()))
+	for _, transactionAction := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(transactionAction.GetPayload(), actionPayload); err != nil {
+			return nil, nil, fmt.Errorf("failed to deserialize chaincode action payload: %w", err)
+		}
+
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, nil, fmt.Errorf("failed to deserialize proposal response payload: %w", err)
+		}
+
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction); err != nil {
+			return nil, nil, fmt.Errorf("failed to deserialize chaincode action: %w", err)
+		}
+
+		payloads = append(payloads, actionPayload)
+		actions = append(actions, chaincodeAction)
+	}
+
+	return payloads, actions, nil
+}
+
+// endregion: envelope
+// region: helpers
+
+// decodeEndorser turns a serialized msp identity into MSP ID and certificate subject.
+func decodeEndorser(serialized []byte) (*Endorser, error) {
+	id := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(serialized, id); err != nil {
+		return nil, fmt.Errorf("failed to deserialize endorser identity: %w", err)
+	}
+
+	e := &Endorser{
+		MSPID: id.GetMspid(),
+	}
+	certificate, err := identity.CertificateFromPEM(id.GetIdBytes())
+	if err == nil {
+		e.Subject = certificate.Subject.String()
+	}
+
+	return e, nil
+}
+
+// decodeRWSet unpacks a serialized TxReadWriteSet into per-namespace public reads and writes.
+func decodeRWSet(results []byte) ([]NsRWSet, error) {
+	txRWSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txRWSet); err != nil {
+		return nil, fmt.Errorf("failed to deserialize read/write set: %w", err)
+	}
+
+	out := make([]NsRWSet, 0, len(txRWSet.GetNsRwset()))
+	for _, ns := range txRWSet.GetNsRwset() {
+		kv := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(ns.GetRwset(), kv); err != nil {
+			return nil, fmt.Errorf("failed to deserialize read/write set of namespace %s: %w", ns.GetNamespace(), err)
+		}
+
+		set := NsRWSet{
+			Namespace: ns.GetNamespace(),
+			Reads:     make([]KVRead, 0, len(kv.GetReads())),
+			Writes:    make([]KVWrite, 0, len(kv.GetWrites())),
+		}
+		for _, read := range kv.GetReads() {
+			set.Reads = append(set.Reads, KVRead{
+				Key:      read.GetKey(),
+				BlockNum: read.GetVersion().GetBlockNum(),
+				TxNum:    read.GetVersion().GetTxNum(),
+			})
+		}
+		for _, write := range kv.GetWrites() {
+			set.Writes = append(set.Writes, KVWrite{
+				Key:      write.GetKey(),
+				IsDelete: write.GetIsDelete(),
+				Value:    rawOrString(write.GetValue()),
+			})
+		}
+		out = append(out, set)
+	}
+
+	return out, nil
+}
+
+// writtenNamespaces returns the namespaces a serialized TxReadWriteSet writes to, either their
+// public state or the hashes of their private data collections.
+func writtenNamespaces(results []byte) ([]string, error) {
+	txRWSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txRWSet); err != nil {
+		return nil, fmt.Errorf("failed to deserialize read/write set: %w", err)
+	}
+
+	namespaces := make([]string, 0, len(txRWSet.GetNsRwset()))
+	for _, ns := range txRWSet.GetNsRwset() {
+		kv := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(ns.GetRwset(), kv); err != nil {
+			return nil, fmt.Errorf("failed to deserialize read/write set of namespace %s: %w", ns.GetNamespace(), err)
+		}
+		written := len(kv.GetWrites()) > 0
+		for _, collection := range ns.GetCollectionHashedRwset() {
+			hashed := &kvrwset.HashedRWSet{}
+			if err := proto.Unmarshal(collection.GetHashedRwset(), hashed); err != nil {
+				return nil, fmt.Errorf("failed to deserialize hashed read/write set of collection %s/%s: %w", ns.GetNamespace(), collection.GetCollectionName(), err)
+			}
+			written = written || len(hashed.GetHashedWrites()) > 0
+		}
+		if written {
+			namespaces = append(namespaces, ns.GetNamespace())
+		}
+	}
+
+	return namespaces, nil
+}
+
+// rawOrString keeps valid json as is and quotes everything else.
+func rawOrString(value []byte) json.RawMessage {
+	if len(value) == 0 {
+		return json.RawMessage("null")
+	}
+	if json.Valid(value) {
+		return json.RawMessage(value)
+	}
+	quoted, _ := json.Marshal(string(value))
+	return json.RawMessage(quoted)
+}
+
+// endregion: helpers
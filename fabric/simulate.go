@@ -0,0 +1,57 @@
+package fabric
+
+import (
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/protobuf/proto"
+)
+
+// Simulate builds and endorses the proposal like SubmitAsync does, but never submits it,
+// the endorsed transaction is decoded instead.
+func Simulate(r *Request) (*Simulation, *ResponseError) {
+
+	// region: proposal
+
+	proposal, err := r.Contract.NewProposal(r.Function, client.WithArguments(r.Args...))
+	if err != nil {
+		return nil, Error(err)
+	}
+
+	// endregion: proposal
+	// region: endorse
+
+	ctx, cancel := r.context(phaseEndorse)
+	defer cancel()
+	transaction, err := proposal.EndorseWithContext(ctx)
+	if err != nil {
+		return nil, Error(err)
+	}
+
+	// endregion: endorse
+	// region: decode
+
+	raw, err := transaction.Bytes()
+	if err != nil {
+		return nil, Error(err)
+	}
+	prepared := &gateway.PreparedTransaction{}
+	err = proto.Unmarshal(raw, prepared)
+	if err != nil {
+		return nil, Error(err)
+	}
+	simulation, err := decodeEndorsedAction(prepared.GetEnvelope())
+	if err != nil {
+		return nil, Error(err)
+	}
+
+	// endregion: decode
+
+	simulation.Result = transaction.Result()
+	simulation.Txid = transaction.TransactionID()
+	return simulation, nil
+
+}
+
+func (r *Request) Simulate() (*Simulation, *ResponseError) {
+	return Simulate(r)
+}
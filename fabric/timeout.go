@@ -0,0 +1,49 @@
+package fabric
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeouts returns the package level timeouts, which apply to every phase a Request or a
+// Client does not override.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		CommitStatus: CommitStatusTimeout,
+		Endorse:      EndorseTimeout,
+		Evaluate:     EvaluateTimeout,
+		Submit:       SubmitTimeout,
+	}
+}
+
+// Merge returns t with the non-zero timeouts of o applied on top of it.
+func (t Timeouts) Merge(o Timeouts) Timeouts {
+	if o.CommitStatus > 0 {
+		t.CommitStatus = o.CommitStatus
+	}
+	if o.Endorse > 0 {
+		t.Endorse = o.Endorse
+	}
+	if o.Evaluate > 0 {
+		t.Evaluate = o.Evaluate
+	}
+	if o.Submit > 0 {
+		t.Submit = o.Submit
+	}
+	return t
+}
+
+// context derives the context of one phase of the request from Request.Context, bounded by the
+// timeout the phase selects from Request.Timeouts, the package defaults fill in the rest.
+func (r *Request) context(phase func(Timeouts) time.Duration) (context.Context, context.CancelFunc) {
+	parent := r.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithTimeout(parent, phase(DefaultTimeouts().Merge(r.Timeouts)))
+}
+
+func phaseCommitStatus(t Timeouts) time.Duration { return t.CommitStatus }
+func phaseEndorse(t Timeouts) time.Duration      { return t.Endorse }
+func phaseEvaluate(t Timeouts) time.Duration     { return t.Evaluate }
+func phaseSubmit(t Timeouts) time.Duration       { return t.Submit }
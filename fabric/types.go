@@ -0,0 +1,192 @@
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+type Client struct {
+	CertPath     string   `json:"CertPath"`
+	GatewayPeer  string   `json:"GatewayPeer"`
+	KeyPath      string   `json:"KeyPath"`
+	MSPID        string   `json:"MSPID"`
+	PeerEndpoint string   `json:"PeerEndpoint"`
+	TLSCertPath  string   `json:"TLSCertPath"`
+	Timeouts     Timeouts `json:"Timeouts"`
+
+	CertPEM    []byte  `json:"-"`
+	KeyPEM     []byte  `json:"-"`
+	Label      string  `json:"Label"`
+	TLSCertPEM []byte  `json:"-"`
+	Wallet     *Wallet `json:"Wallet"`
+
+	connection *grpc.ClientConn `json:"-"`
+	derived    bool             `json:"-"`
+	Gateway    *client.Gateway  `json:"-"`
+	material   *material        `json:"-"`
+}
+
+type Checkpointer struct {
+	*client.FileCheckpointer
+	file *os.File
+}
+
+type LatorExe func([]byte, string) ([]byte, error)
+
+type Lator struct {
+	Bind   string           `json:"bind"`
+	Port   int              `json:"port"`
+	Which  string           `json:"which"`
+	Exe    LatorExe         `json:"-"`
+	cmd    *exec.Cmd        `json:"-"`
+	client *fasthttp.Client `json:"-"`
+}
+
+type LatorStatus struct {
+	Address string `json:"address,omitempty"`
+	Alive   bool   `json:"alive"`
+	Mode    string `json:"mode"`
+	Which   string `json:"which,omitempty"`
+}
+
+type Request struct {
+	Contract      *client.Contract `json:"-"`
+	Context       context.Context  `json:"-"`
+	EndorsingOrgs []string         `json:"-"`
+	Function      string           `json:"function"`
+	Args          []string         `json:"args"`
+	Timeouts      Timeouts         `json:"-"`
+}
+
+// Timeouts bound the phases of a transaction, zero values fall back to the package defaults.
+type Timeouts struct {
+	CommitStatus time.Duration `json:"CommitStatus"`
+	Endorse      time.Duration `json:"Endorse"`
+	Evaluate     time.Duration `json:"Evaluate"`
+	Submit       time.Duration `json:"Submit"`
+}
+
+type ResponseError struct {
+	Details    []map[string]string `json:"details"`
+	Err        error               `json:"-"`
+	Message    string              `json:"message"`
+	Status     codes.Code          `json:"status"`
+	Txid       string              `json:"tx_id"`
+	Type       string              `json:"type"`
+	Validation string              `json:"validation,omitempty"`
+}
+
+type Response struct {
+	Commit *client.Commit `json:"-"`
+	Result []byte         `json:"result"`
+	Txid   string         `json:"tx_id"`
+}
+
+type Endorser struct {
+	MSPID   string `json:"msp_id"`
+	Subject string `json:"subject"`
+}
+
+type KVRead struct {
+	Key      string `json:"key"`
+	BlockNum uint64 `json:"block_num"`
+	TxNum    uint64 `json:"tx_num"`
+}
+
+type KVWrite struct {
+	Key      string          `json:"key"`
+	IsDelete bool            `json:"is_delete"`
+	Value    json.RawMessage `json:"value"`
+}
+
+type NsRWSet struct {
+	Namespace string    `json:"namespace"`
+	Reads     []KVRead  `json:"reads"`
+	Writes    []KVWrite `json:"writes"`
+}
+
+type Simulation struct {
+	Endorsers []Endorser `json:"endorsers"`
+	Result    []byte     `json:"result"`
+	RWSet     []NsRWSet  `json:"rwset"`
+	Txid      string     `json:"tx_id"`
+}
+
+type ChainInfo struct {
+	Channel      string `json:"channel"`
+	CurrentHash  string `json:"current_hash"`
+	Height       uint64 `json:"height"`
+	PreviousHash string `json:"previous_hash"`
+}
+
+type BlockSummary struct {
+	DataHash     string    `json:"data_hash"`
+	Hash         string    `json:"hash"`
+	Number       uint64    `json:"number"`
+	PreviousHash string    `json:"previous_hash"`
+	Timestamp    time.Time `json:"timestamp"`
+	TxCount      int       `json:"tx_count"`
+}
+
+type Block struct {
+	BlockSummary
+	Transactions []Transaction `json:"transactions"`
+}
+
+type Event struct {
+	Chaincode string          `json:"chaincode"`
+	Name      string          `json:"name"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+type Transaction struct {
+	Chaincode  string    `json:"chaincode,omitempty"`
+	Creator    Endorser  `json:"creator"`
+	Events     []Event   `json:"events"`
+	Function   string    `json:"function,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	Txid       string    `json:"tx_id"`
+	Type       string    `json:"type"`
+	Validation string    `json:"validation"`
+}
+
+type TransactionDetail struct {
+	Transaction
+	Args             []string   `json:"args"`
+	ChaincodeVersion string     `json:"chaincode_version,omitempty"`
+	Endorsers        []Endorser `json:"endorsers"`
+	RWSet            []NsRWSet  `json:"rwset"`
+	ValidationCode   int32      `json:"validation_code"`
+}
+
+type Collection struct {
+	BlockToLive       uint64 `json:"block_to_live"`
+	EndorsementPolicy string `json:"endorsement_policy,omitempty"`
+	MaximumPeerCount  int32  `json:"maximum_peer_count"`
+	MemberOnlyRead    bool   `json:"member_only_read"`
+	MemberOnlyWrite   bool   `json:"member_only_write"`
+	MemberOrgsPolicy  string `json:"member_orgs_policy"`
+	Name              string `json:"name"`
+	RequiredPeerCount int32  `json:"required_peer_count"`
+}
+
+type ChaincodeDefinition struct {
+	Approvals         map[string]bool `json:"approvals,omitempty"`
+	Collections       []Collection    `json:"collections"`
+	EndorsementPlugin string          `json:"endorsement_plugin"`
+	EndorsementPolicy string          `json:"endorsement_policy"`
+	InitRequired      bool            `json:"init_required"`
+	Name              string          `json:"name"`
+	Sequence          int64           `json:"sequence"`
+	Source            string          `json:"source,omitempty"`
+	ValidationPlugin  string          `json:"validation_plugin"`
+	Version           string          `json:"version"`
+}
@@ -0,0 +1,306 @@
+package fabric
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// region: types
+
+// Wallet is a directory of identities in the format of the Fabric SDKs' file system wallet,
+// one <label>.id json file per identity. With a Passphrase, the private keys are stored
+// encrypted, see WalletCiphertext, and identities stored in plain text are still read.
+type Wallet struct {
+	Passphrase []byte `json:"-"`
+	Path       string `json:"Path"`
+
+	keys  map[string][]byte `json:"-"`
+	mutex sync.Mutex        `json:"-"`
+}
+
+// WalletCredentials are the certificate and the private key of an identity, the latter either
+// in PrivateKey or, in wallets with a passphrase, encrypted in EncryptedPrivateKey.
+type WalletCredentials struct {
+	Certificate         string            `json:"certificate"`
+	EncryptedPrivateKey *WalletCiphertext `json:"encryptedPrivateKey,omitempty"`
+	PrivateKey          string            `json:"privateKey,omitempty"`
+}
+
+// WalletCiphertext is a private key encrypted with AES-256-GCM, with the certificate as
+// additional data, so it cannot be moved under another certificate. The key is derived from
+// the passphrase of the wallet with scrypt, its parameters are stored along.
+type WalletCiphertext struct {
+	Ciphertext []byte `json:"ciphertext"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	Nonce      []byte `json:"nonce"`
+	P          int    `json:"p"`
+	R          int    `json:"r"`
+	Salt       []byte `json:"salt"`
+}
+
+type WalletIdentity struct {
+	Credentials WalletCredentials `json:"credentials"`
+	Label       string            `json:"-"`
+	MSPID       string            `json:"mspId"`
+	Type        string            `json:"type"`
+	Version     int               `json:"version"`
+}
+
+const (
+	WalletExt = ".id"
+	WalletKDF = "scrypt"
+
+	walletScryptN = 1 << 15
+	walletScryptP = 1
+	walletScryptR = 8
+)
+
+// endregion: types
+// region: wallet
+
+func (w *Wallet) path(label string) (string, error) {
+	if len(label) == 0 || strings.ContainsAny(label, `/\`) || label == "." || label == ".." {
+		return "", fmt.Errorf("invalid wallet label '%s'", label)
+	}
+	return filepath.Join(w.Path, label+WalletExt), nil
+}
+
+// Get reads the identity stored under label, its private key is decrypted if needed.
+func (w *Wallet) Get(label string) (*WalletIdentity, error) {
+	id, err := w.Peek(label)
+	if err != nil {
+		return nil, err
+	}
+	if id.Credentials.EncryptedPrivateKey != nil {
+		key, err := w.decrypt(id.Credentials.EncryptedPrivateKey, []byte(id.Credentials.Certificate))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt the private key of identity %s: %w", label, err)
+		}
+		id.Credentials = WalletCredentials{Certificate: id.Credentials.Certificate, PrivateKey: string(key)}
+	}
+	return id, nil
+}
+
+// Peek reads the identity stored under label as it is, an encrypted private key is left
+// encrypted, so it needs no passphrase.
+func (w *Wallet) Peek(label string) (*WalletIdentity, error) {
+	file, err := w.path(label)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity %s from wallet: %w", label, err)
+	}
+
+	id := &WalletIdentity{}
+	err = json.Unmarshal(raw, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity %s: %w", label, err)
+	}
+	id.Label = label
+	return id, nil
+}
+
+// Put stores the identity under its label, its private key encrypted if the wallet has a
+// passphrase, the file is replaced atomically.
+func (w *Wallet) Put(id *WalletIdentity) error {
+	file, err := w.path(id.Label)
+	if err != nil {
+		return err
+	}
+	if len(id.Type) == 0 {
+		id.Type = "X.509"
+	}
+	if id.Version == 0 {
+		id.Version = 1
+	}
+	stored := *id
+	if len(w.Passphrase) > 0 && len(id.Credentials.PrivateKey) > 0 {
+		ciphertext, err := w.encrypt([]byte(id.Credentials.PrivateKey), []byte(id.Credentials.Certificate))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt the private key of identity %s: %w", id.Label, err)
+		}
+		stored.Credentials = WalletCredentials{Certificate: id.Credentials.Certificate, EncryptedPrivateKey: ciphertext}
+	}
+	raw, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, raw, 0600)
+}
+
+// Update replaces the certificate and the private key of the identity stored under label.
+func (w *Wallet) Update(label string, certificatePEM, keyPEM []byte) error {
+	id, err := w.Peek(label)
+	if err != nil {
+		return err
+	}
+	id.Credentials = WalletCredentials{Certificate: string(certificatePEM), PrivateKey: string(keyPEM)}
+	return w.Put(id)
+}
+
+// Match returns the identity whose certificate has the public key of certificatePEM, that is,
+// the one holding the private key of the certificate.
+func (w *Wallet) Match(certificatePEM []byte) (*WalletIdentity, error) {
+	certificate, err := parseCertificate(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := w.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		id, err := w.Peek(label)
+		if err != nil {
+			continue
+		}
+		candidate, err := parseCertificate([]byte(id.Credentials.Certificate))
+		if err == nil && samePublicKey(certificate.PublicKey, candidate.PublicKey) {
+			return w.Get(label)
+		}
+	}
+	return nil, fmt.Errorf("no identity in wallet %s holds the private key of %s", w.Path, certificate.Subject.CommonName)
+}
+
+// List returns the labels in the wallet in alphabetical order.
+func (w *Wallet) List() ([]string, error) {
+	entries, err := os.ReadDir(w.Path)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), WalletExt) {
+			labels = append(labels, strings.TrimSuffix(entry.Name(), WalletExt))
+		}
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+// Remove deletes the identity stored under label.
+func (w *Wallet) Remove(label string) error {
+	file, err := w.path(label)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// endregion: wallet
+// region: encryption
+
+func (w *Wallet) encrypt(plaintext, certificatePEM []byte) (*WalletCiphertext, error) {
+	c := &WalletCiphertext{KDF: WalletKDF, N: walletScryptN, P: walletScryptP, R: walletScryptR, Salt: make([]byte, 16)}
+	_, err := rand.Read(c.Salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := w.aead(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(c.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	c.Ciphertext = aead.Seal(nil, c.Nonce, plaintext, certificatePEM)
+	return c, nil
+}
+
+func (w *Wallet) decrypt(c *WalletCiphertext, certificatePEM []byte) ([]byte, error) {
+	aead, err := w.aead(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	plaintext, err := aead.Open(nil, c.Nonce, c.Ciphertext, certificatePEM)
+	if err != nil {
+		return nil, errors.New("wrong passphrase, or the identity has been tampered with")
+	}
+	return plaintext, nil
+}
+
+// aead derives the key of the ciphertext from the passphrase, derived keys are kept, so reading
+// an identity again, eg. on every reload, does not cost another derivation.
+func (w *Wallet) aead(c *WalletCiphertext) (cipher.AEAD, error) {
+	if len(w.Passphrase) == 0 {
+		return nil, errors.New("the private key is encrypted and the wallet has no passphrase")
+	}
+	if c.KDF != WalletKDF {
+		return nil, fmt.Errorf("unsupported key derivation '%s'", c.KDF)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	id := fmt.Sprintf("%x/%d/%d/%d", c.Salt, c.N, c.R, c.P)
+	key, ok := w.keys[id]
+	if !ok {
+		var err error
+		key, err = scrypt.Key(w.Passphrase, c.Salt, c.N, c.R, c.P, 32)
+		if err != nil {
+			return nil, err
+		}
+		if w.keys == nil {
+			w.keys = make(map[string][]byte)
+		}
+		w.keys[id] = key
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// endregion: encryption
+// region: helpers
+
+// writeFileAtomic writes to a temporary file in the same directory and renames it over name,
+// so readers never see a partially written file.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// endregion: helpers
@@ -4,19 +4,30 @@ go 1.18
 
 require (
 	github.com/SandorMiskey/TEx-kit v0.0.1
+	github.com/SandorMiskey/TrustChain/fabric v0.0.0
+	github.com/SandorMiskey/TrustChain/rawapi v0.0.0
 	github.com/buger/jsonparser v1.1.1
 	github.com/hyperledger/fabric-gateway v1.3.2
-	google.golang.org/grpc v1.58.2
+	github.com/hyperledger/fabric-protos-go-apiv2 v0.2.1
+	github.com/valyala/fasthttp v1.48.0
+	google.golang.org/protobuf v1.31.0
 )
 
 require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
-	github.com/hyperledger/fabric-protos-go-apiv2 v0.2.1 // indirect
+	github.com/klauspost/compress v1.16.3 // indirect
 	github.com/miekg/pkcs11 v1.1.1 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	golang.org/x/crypto v0.12.0 // indirect
 	golang.org/x/net v0.14.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
 	golang.org/x/text v0.12.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20230815205213-6bfd019c3878 // indirect
-	google.golang.org/protobuf v1.31.0 // indirect
+	google.golang.org/grpc v1.58.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/SandorMiskey/TrustChain/fabric => ../fabric
+
+replace github.com/SandorMiskey/TrustChain/rawapi => ../rawapi
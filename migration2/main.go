@@ -6,19 +6,23 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"log/syslog"
 	"math"
+	"math/rand"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,7 +31,7 @@ import (
 
 	"github.com/SandorMiskey/TEx-kit/cfg"
 	"github.com/SandorMiskey/TEx-kit/log"
-	"github.com/SandorMiskey/TrustChain/migration2/fabric"
+	"github.com/SandorMiskey/TrustChain/fabric"
 	"github.com/buger/jsonparser"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/valyala/fasthttp"
@@ -40,6 +44,13 @@ var (
 	BlockCache      = make(map[string]*Header)
 	BlockCacheMutex = sync.RWMutex{}
 
+	Def_CaName         string        = ""
+	Def_CaTlscert      string        = ""
+	Def_CaUrl          string        = ""
+	Def_CertsPath      string        = "."
+	Def_CertsWarnDays  int           = 30
+	Def_ConsPeers      string        = ""
+	Def_ConsSample     int           = 100
 	Def_FabCert        string        = "./cert.pem"
 	Def_FabCc          string        = "te-food-bundles"
 	Def_FabCcConfirm   string        = "qscc"
@@ -51,6 +62,7 @@ var (
 	Def_FabGateway     string        = "localhost"
 	Def_FabKeystore    string        = "./keystore"
 	Def_FabMspId       string        = "Org1MSP"
+	Def_FabProfile     string        = ""
 	Def_FabTlscert     string        = "./tlscert.pem"
 	Def_HttpApikey     string        = ""
 	Def_HttpPort       int           = 5088
@@ -65,11 +77,23 @@ var (
 	Def_LatorExe       string        = "/usr/local/bin/configtxlator"
 	Def_LatorPort      int           = 0
 	Def_LatorProto     string        = "common.Block"
+	Def_MonAlertCmd    string        = ""
+	Def_MonBind        string        = ""
+	Def_MonLag         int           = 10
+	Def_MonPeers       string        = ""
+	Def_MonPort        int           = 9188
+	Def_MonStall       time.Duration = 5 * time.Minute
+	Def_MonWebhook     string        = ""
 	Def_ProcKeyname    string        = "bundle_id"
 	Def_ProcKeypos     int           = 0
 	Def_ProcKeytype    string        = "string"
 	Def_ProcTry        int           = 500
 	Def_ProcInterval   time.Duration = 10 * time.Second
+	Def_Wallet         string        = ""
+	Def_WalletPass     string        = ""
+	Def_WalletPassFile string        = ""
+
+	Env = make(map[string]string)
 
 	Lator *fabric.Lator
 
@@ -93,16 +117,23 @@ const (
 
 	LATOR_LATENCY int = 1
 
-	LOG_ERR    syslog.Priority = log.LOG_ERR
-	LOG_NOTICE syslog.Priority = log.LOG_NOTICE
-	LOG_INFO   syslog.Priority = log.LOG_INFO
-	LOG_DEBUG  syslog.Priority = log.LOG_DEBUG
-	LOG_EMERG  syslog.Priority = log.LOG_EMERG
+	LOG_ERR     syslog.Priority = log.LOG_ERR
+	LOG_WARNING syslog.Priority = log.LOG_WARNING
+	LOG_NOTICE  syslog.Priority = log.LOG_NOTICE
+	LOG_INFO    syslog.Priority = log.LOG_INFO
+	LOG_DEBUG   syslog.Priority = log.LOG_DEBUG
+	LOG_EMERG   syslog.Priority = log.LOG_EMERG
 
 	MODE_FORMAT             string = "  %-2s || %-13s    %s\n"
 	MODE_COMBINED_DESC      string = "combination of confirmBatch and submitBatch"
 	MODE_COMBINED_FULL      string = "combined"
 	MODE_COMBINED_SC        string = "c"
+	MODE_CERTS_DESC         string = "scans the crypto material trees of -" + OPT_IO_INPUT + ", eg. the peers/*/msp and users/*/msp directories of an organization, and lists every certificate as file|subject|issuer|expiry|days left|status, status is OK, EXPIRING within -" + OPT_CERTS_WARNDAYS + " or EXPIRED"
+	MODE_CERTS_FULL         string = "certs"
+	MODE_CERTS_SC           string = "ct"
+	MODE_CONSISTENCY_DESC   string = "compares the height and the block hashes of the channels of -" + OPT_FAB_CHANNEL + " across -" + OPT_CONS_PEERS + ", and the values of keys of -" + OPT_FAB_CC + " evaluated on each of them, and lists peer|channel|peer|height|block hash|status, status is OK, LAGGING, MISMATCH or the error, and key|channel|key|peer|value hash|status for divergent keys, status is DIVERGENT or MISSING"
+	MODE_CONSISTENCY_FULL   string = "consistency"
+	MODE_CONSISTENCY_SC     string = "cs"
 	MODE_CONFIRM_DESC       string = "iterates over the output of submit/resubmit and query for block number and data hash via fabric gateway against supplied chaincode and function"
 	MODE_CONFIRM_FULL       string = "confirm"
 	MODE_CONFIRM_SC         string = "cf"
@@ -112,12 +143,27 @@ const (
 	MODE_CONFIRMRAWAPI_DESC string = "iterates over the output of submit/resubmit and query for block number and data hash via rawapi/http against supplied chaincode and function"
 	MODE_CONFIRMRAWAPI_FULL string = "confirmRawapi"
 	MODE_CONFIRMRAWAPI_SC   string = "cr"
+	MODE_ENROLL_DESC        string = "enrolls an identity registered with the fabric CA and stores its certificate and new key in an msp directory and/or a wallet"
+	MODE_ENROLL_FULL        string = "enroll"
+	MODE_ENROLL_SC          string = "e"
 	MODE_HELP_DESC          string = "or, for that matter, anything not in the list produces this output"
 	MODE_HELP_FULL          string = "help"
 	MODE_HELP_SC            string = "h"
 	MODE_LISTENER_DESC      string = "listens for block events"
 	MODE_LISTENER_FULL      string = "listener"
 	MODE_LISTENER_SC        string = "l"
+	MODE_MONITOR_DESC       string = "polls the chain info of the channels of -" + OPT_FAB_CHANNEL + " on -" + OPT_CONS_PEERS + " every -" + OPT_PROC_INTERVAL + " until interrupted, serves their height, growth rate, time since the last block and lag as Prometheus metrics on -" + OPT_MON_PORT + ", and runs -" + OPT_MON_ALERT_CMD + " and/or posts to -" + OPT_MON_WEBHOOK + " when a peer is down, stalls for -" + OPT_MON_STALL + " or lags more than -" + OPT_MON_LAG + " blocks, alerts are listed as alert|time|kind|channel|peer|RAISED or RESOLVED|message"
+	MODE_MONITOR_FULL       string = "monitor"
+	MODE_MONITOR_SC         string = "m"
+	MODE_PROFILE_DESC       string = "writes a connection profile of the organizations, peers and CAs described by the TC_ORG* variables of $TC_PATH_RC"
+	MODE_PROFILE_FULL       string = "profile"
+	MODE_PROFILE_SC         string = "p"
+	MODE_REENROLL_DESC      string = "renews the certificate of an identity with the fabric CA, with a new key, and replaces them where they were read from"
+	MODE_REENROLL_FULL      string = "reenroll"
+	MODE_REENROLL_SC        string = "re"
+	MODE_REGISTER_DESC      string = "registers a new identity with the fabric CA as a registrar and writes its enrollment secret"
+	MODE_REGISTER_FULL      string = "register"
+	MODE_REGISTER_SC        string = "rg"
 	MODE_RESUBMIT_DESC      string = "iterates over the output of submit and retries unsuccessful attempts"
 	MODE_RESUBMIT_FULL      string = "resubmit"
 	MODE_RESUBMIT_SC        string = "rs"
@@ -127,7 +173,38 @@ const (
 	MODE_SUBMITBATCH_DESC   string = "iterates over list of files with bundles to be processed and submit line by line via direct fabric gateway link"
 	MODE_SUBMITBATCH_FULL   string = "submitBatch"
 	MODE_SUBMITBATCH_SC     string = "sb"
-
+	MODE_WALLETEXPORT_DESC  string = "writes the certificate and the private key of an identity of the wallet to -cert and -keystore"
+	MODE_WALLETEXPORT_FULL  string = "walletExport"
+	MODE_WALLETEXPORT_SC    string = "we"
+	MODE_WALLETIMPORT_DESC  string = "stores the certificate of -cert and its private key from -keystore in the wallet, the key encrypted if a passphrase is given"
+	MODE_WALLETIMPORT_FULL  string = "walletImport"
+	MODE_WALLETIMPORT_SC    string = "wi"
+	MODE_WALLETLIST_DESC    string = "lists the identities of the wallet as label|MSP ID|common name|expiry|encrypted, no passphrase needed"
+	MODE_WALLETLIST_FULL    string = "walletList"
+	MODE_WALLETLIST_SC      string = "wl"
+
+	OPT_CA_AFFILIATION       string = "affiliation"
+	OPT_CA_ATTRS             string = "attrs"
+	OPT_CA_HOSTS             string = "hosts"
+	OPT_CA_ID                string = "id"
+	OPT_CA_LABEL             string = "label"
+	OPT_CA_MAXENROLLMENTS    string = "maxenrollments"
+	OPT_CA_MSP               string = "msp"
+	OPT_CA_NAME              string = "ca_name"
+	OPT_CA_PROFILE           string = "ca_profile"
+	OPT_CA_SECRET            string = "secret"
+	OPT_CA_TLSCERT           string = "ca_tlscert"
+	OPT_CA_TYPE              string = "type"
+	OPT_CA_URL               string = "ca_url"
+	OPT_CA_WALLET            string = "wallet"
+	OPT_CERTS_WARNDAYS       string = "warndays"
+	OPT_CONS_END             string = "end"
+	OPT_CONS_GET             string = "get"
+	OPT_CONS_KEYS            string = "keys"
+	OPT_CONS_PEERS           string = "peers"
+	OPT_CONS_RANGE           string = "range"
+	OPT_CONS_SAMPLE          string = "sample"
+	OPT_CONS_START           string = "start"
 	OPT_FAB_CERT             string = "cert"
 	OPT_FAB_CC               string = "cc"
 	OPT_FAB_CC_CONFIRM       string = "cc_confirm"
@@ -144,6 +221,11 @@ const (
 	OPT_FAB_GATEWAY_SUBMIT   string = "gw_submit"
 	OPT_FAB_KEYSTORE         string = "keystore"
 	OPT_FAB_MSPID            string = "mspid"
+	OPT_FAB_ORG              string = "org"
+	OPT_FAB_PEER             string = "peer"
+	OPT_FAB_PEER_CONFIRM     string = "peer_confirm"
+	OPT_FAB_PEER_SUBMIT      string = "peer_submit"
+	OPT_FAB_PROFILE          string = "profile"
 	OPT_FAB_TLSCERT          string = "tlscert"
 	OPT_IO_BATCH             string = "batch"
 	OPT_IO_BRAKE             string = "brake"
@@ -162,11 +244,19 @@ const (
 	OPT_HTTP_APIKEY          string = "apikey"
 	OPT_HTTP_HOST            string = "host"
 	OPT_HTTP_QUERY           string = "query"
+	OPT_MON_ALERT_CMD        string = "alert_cmd"
+	OPT_MON_BIND             string = "metrics_bind"
+	OPT_MON_LAG              string = "lag"
+	OPT_MON_PORT             string = "metrics_port"
+	OPT_MON_STALL            string = "stall"
+	OPT_MON_WEBHOOK          string = "alert_webhook"
 	OPT_PROC_KEYNAME         string = "keyname"
 	OPT_PROC_KEYPOS          string = "keypos"
 	OPT_PROC_KEYTYPE         string = "keytype"
 	OPT_PROC_TRY             string = "try"
 	OPT_PROC_INTERVAL        string = "interval"
+	OPT_WALLET_PASS          string = "passphrase"
+	OPT_WALLET_PASS_FILE     string = "passphrase_file"
 
 	SCANNER_MAXTOKENSIZE int = 1024 * 1024 // 1MB
 
@@ -184,20 +274,36 @@ const (
 	STATUS_SUBMIT_ERROR_PREFIX  string = "SUBMIT_ERROR_"
 	STATUS_SUBMIT_ERROR_TXID    string = STATUS_SUBMIT_ERROR_PREFIX + "TXID"
 
+	TC_CA_NAME       string = "TC_MIG_CA_NAME"
+	TC_CA_TLSCERT    string = "TC_MIG_CA_TLSCERT"
+	TC_CA_URL        string = "TC_MIG_CA_URL"
+	TC_CERTS_PATH    string = "TC_MIG_CERTS_PATH"
+	TC_CERTS_WARN    string = "TC_MIG_CERTS_WARNDAYS"
+	TC_CONS_PEERS    string = "TC_MIG_CONSISTENCY_PEERS"
 	TC_FAB_CHANNEL   string = "TC_MIG_FAB_CH"
 	TC_FAB_ENDPOINT  string = "TC_MIG_FAB_ENDPOINT"
 	TC_FAB_GW        string = "TC_MIG_FAB_GW"
 	TC_FAB_MSPID     string = "TC_MIG_FAB_MSPID"
+	TC_FAB_PROFILE   string = "TC_MIG_FAB_PROFILE"
 	TC_HTTP_PORT     string = "TC_MIG_HTTP_PORT"
 	TC_HTTP_APIKEY   string = "TC_MIG_HTTP_APIKEY"
 	TC_LATOR_EXE     string = "TC_MIG_LATOR_EXE"
 	TC_LATOR_BIND    string = "TC_MIG_LATOR_BIND"
 	TC_LATOR_PORT    string = "TC_MIG_LATOR_PORT"
 	TC_LOGLEVEL      string = "TC_MIG_LOGLEVEL"
+	TC_MON_ALERT_CMD string = "TC_MIG_MONITOR_ALERT_CMD"
+	TC_MON_LAG       string = "TC_MIG_MONITOR_LAG"
+	TC_MON_PEERS     string = "TC_MIG_MONITOR_PEERS"
+	TC_MON_PORT      string = "TC_MIG_MONITOR_PORT"
+	TC_MON_STALL     string = "TC_MIG_MONITOR_STALL"
+	TC_MON_WEBHOOK   string = "TC_MIG_MONITOR_WEBHOOK"
 	TC_PATH_CERT     string = "TC_MIG_PATH_CERT"
 	TC_PATH_KEYSTORE string = "TC_MIG_PATH_KEYSTORE"
 	TC_PATH_RC       string = "TC_MIG_PATH_RC"
 	TC_PATH_TLSCERT  string = "TC_MIG_PATH_TLSCERT"
+	TC_WALLET        string = "TC_MIG_WALLET"
+	TC_WALLET_PASS   string = "TC_MIG_WALLET_PASSPHRASE"
+	TC_WALLET_PASS_F string = "TC_MIG_WALLET_PASSPHRASE_FILE"
 
 	TXID string = "^[a-fA-F0-9]{64}$"
 
@@ -207,11 +313,6 @@ const (
 // endregion: constants
 // region: types
 
-type Checkpointer struct {
-	cp   *client.FileCheckpointer
-	file *os.File
-}
-
 type Compiler func(*PSV) string
 
 type ModeFunction func(*cfg.Config)
@@ -265,7 +366,23 @@ func main() {
 					if set {
 						kv[1] = tmp
 					}
+					Env[kv[0]] = kv[1]
 					switch kv[0] {
+					case TC_CA_NAME:
+						Def_CaName = kv[1]
+					case TC_CA_TLSCERT:
+						Def_CaTlscert = kv[1]
+					case TC_CA_URL:
+						Def_CaUrl = kv[1]
+					case TC_CERTS_PATH:
+						Def_CertsPath = kv[1]
+					case TC_CERTS_WARN:
+						_, err = strconv.Atoi(kv[1])
+						if err == nil {
+							Def_CertsWarnDays, _ = strconv.Atoi(kv[1])
+						}
+					case TC_CONS_PEERS:
+						Def_ConsPeers = kv[1]
 					case TC_FAB_CHANNEL:
 						Def_FabChannel = kv[1]
 					case TC_FAB_GW:
@@ -274,6 +391,8 @@ func main() {
 						Def_FabEndpoint = kv[1]
 					case TC_FAB_MSPID:
 						Def_FabMspId = kv[1]
+					case TC_FAB_PROFILE:
+						Def_FabProfile = kv[1]
 					case TC_HTTP_APIKEY:
 						Def_HttpApikey = kv[1]
 					case TC_HTTP_PORT:
@@ -295,12 +414,39 @@ func main() {
 						if err == nil {
 							Def_IoLoglevel, _ = strconv.Atoi(kv[1])
 						}
+					case TC_MON_ALERT_CMD:
+						Def_MonAlertCmd = kv[1]
+					case TC_MON_LAG:
+						_, err = strconv.Atoi(kv[1])
+						if err == nil {
+							Def_MonLag, _ = strconv.Atoi(kv[1])
+						}
+					case TC_MON_PEERS:
+						Def_MonPeers = kv[1]
+					case TC_MON_PORT:
+						_, err = strconv.Atoi(kv[1])
+						if err == nil {
+							Def_MonPort, _ = strconv.Atoi(kv[1])
+						}
+					case TC_MON_STALL:
+						_, err = time.ParseDuration(kv[1])
+						if err == nil {
+							Def_MonStall, _ = time.ParseDuration(kv[1])
+						}
+					case TC_MON_WEBHOOK:
+						Def_MonWebhook = kv[1]
 					case TC_PATH_CERT:
 						Def_FabCert = kv[1]
 					case TC_PATH_KEYSTORE:
 						Def_FabKeystore = kv[1]
 					case TC_PATH_TLSCERT:
 						Def_FabTlscert = kv[1]
+					case TC_WALLET:
+						Def_Wallet = kv[1]
+					case TC_WALLET_PASS:
+						Def_WalletPass = kv[1]
+					case TC_WALLET_PASS_F:
+						Def_WalletPassFile = kv[1]
 					}
 				}
 			}
@@ -347,6 +493,10 @@ func main() {
 		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
 		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
 		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER_CONFIRM] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to confirm with, the first peer of the organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PEER_SUBMIT] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to invoke with, the first peer of the organization if empty", Type: "string", Def: ""}
 
 		fs.Entries[OPT_IO_BATCH] = cfg.Entry{Desc: "list of files to process, one file path per line, -" + OPT_IO_INPUT + " ignored if specified", Type: "string", Def: ""}
 		fs.Entries[OPT_IO_BRAKE] = cfg.Entry{Desc: "file path, which if appears, processing stops before opening the next file", Type: "string", Def: Def_IoBrake}
@@ -367,6 +517,36 @@ func main() {
 		fs.Entries[OPT_PROC_TRY] = cfg.Entry{Desc: "number of invoke tries", Type: "int", Def: Def_ProcTry}
 
 		modeFunc = modeCombined
+	case MODE_CERTS_FULL, MODE_CERTS_SC:
+		fs.Entries[OPT_IO_INPUT] = cfg.Entry{Desc: ", separated list of directories or files to scan, default is $" + TC_CERTS_PATH + " if set", Type: "string", Def: Def_CertsPath}
+		fs.Entries[OPT_CERTS_WARNDAYS] = cfg.Entry{Desc: "certificates expiring within this many days are reported as EXPIRING, default is $" + TC_CERTS_WARN + " if set", Type: "int", Def: Def_CertsWarnDays}
+
+		modeFunc = modeCerts
+	case MODE_CONSISTENCY_FULL, MODE_CONSISTENCY_SC:
+		fs.Entries[OPT_CONS_END] = cfg.Entry{Desc: "end key of the range of -" + OPT_FAB_CC + " scanned through -" + OPT_CONS_RANGE + ", exclusive, the range is scanned if this or -" + OPT_CONS_START + " is set", Type: "string", Def: ""}
+		fs.Entries[OPT_CONS_GET] = cfg.Entry{Desc: "function of -" + OPT_FAB_CC + " that returns the value of a key", Type: "string", Def: "BundleGet"}
+		fs.Entries[OPT_CONS_KEYS] = cfg.Entry{Desc: ", separated list of keys to compare through -" + OPT_CONS_GET, Type: "string", Def: ""}
+		fs.Entries[OPT_CONS_PEERS] = cfg.Entry{Desc: ", separated list of peers to compare, peers of -" + OPT_FAB_PROFILE + " by name or gateway peers as name=host:port verified against -" + OPT_FAB_TLSCERT + ", every peer of the profile if empty, default is $" + TC_CONS_PEERS + " if set", Type: "string", Def: Def_ConsPeers}
+		fs.Entries[OPT_CONS_RANGE] = cfg.Entry{Desc: "function of -" + OPT_FAB_CC + " that returns the values between two keys as a JSON array of objects, whose -" + OPT_PROC_KEYNAME + " field is the key", Type: "string", Def: "BundleGetRange"}
+		fs.Entries[OPT_CONS_SAMPLE] = cfg.Entry{Desc: "number of keys of -" + OPT_IO_INPUT + " sampled at random, 0 means all of them", Type: "int", Def: Def_ConsSample}
+		fs.Entries[OPT_CONS_START] = cfg.Entry{Desc: "start key of the range of -" + OPT_FAB_CC + " scanned through -" + OPT_CONS_RANGE, Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to client pem certificate, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabCert}
+		fs.Entries[OPT_FAB_CC] = cfg.Entry{Desc: "chaincode whose keys are compared, only the chains are if empty", Type: "string", Def: Def_FabCc}
+		fs.Entries[OPT_FAB_CHANNEL] = cfg.Entry{Desc: ", separated list of channels, default is $" + TC_FAB_CHANNEL + " if set", Type: "string", Def: Def_FabChannel}
+		fs.Entries[OPT_FAB_ENDPOINT] = cfg.Entry{Desc: "fabric endpoint, default is $" + TC_FAB_ENDPOINT + " if set", Type: "string", Def: Def_FabEndpoint}
+		fs.Entries[OPT_FAB_GATEWAY] = cfg.Entry{Desc: "default gateway, default is $" + TC_FAB_GW + " if set", Type: "string", Def: Def_FabGateway}
+		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
+		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
+		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
+
+		fs.Entries[OPT_IO_INPUT] = cfg.Entry{Desc: "output of submit or confirm, whose successfully submitted or confirmed keys are sampled, no keys are sampled if empty", Type: "string", Def: ""}
+
+		fs.Entries[OPT_PROC_KEYNAME] = cfg.Entry{Desc: "the field of the objects returned by -" + OPT_CONS_RANGE + " containing the key", Type: "string", Def: Def_ProcKeyname}
+
+		modeFunc = modeConsistency
 	case MODE_CONFIRM_FULL, MODE_CONFIRM_SC:
 		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to client pem certificate to populate the wallet with, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabCert}
 		fs.Entries[OPT_FAB_CC] = cfg.Entry{Desc: "chaincode to query", Type: "string", Def: Def_FabCcConfirm}
@@ -376,6 +556,9 @@ func main() {
 		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
 		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
 		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
 
 		fs.Entries[OPT_IO_INPUT] = cfg.Entry{Desc: "file, which contains the output of previous submit attempt, empty means stdin", Type: "string", Def: ""}
 		fs.Entries[OPT_IO_TICK] = cfg.Entry{Desc: "progress message at LOG_NOTICE level per this many transactions, 0 means no message", Type: "int", Def: Def_IoTick}
@@ -397,6 +580,9 @@ func main() {
 		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
 		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
 		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
 
 		fs.Entries[OPT_IO_BATCH] = cfg.Entry{Desc: "list of files to process, one file path per line, -" + OPT_IO_INPUT + " ignored if specified", Type: "string", Def: ""}
 		fs.Entries[OPT_IO_INPUT] = cfg.Entry{Desc: ", separated list of files, which contain the output of previous submit attempts, empty causes panic", Type: "string", Def: ""}
@@ -423,6 +609,23 @@ func main() {
 		fs.Entries[OPT_IO_TICK] = cfg.Entry{Desc: "progress message at LOG_NOTICE level per this many transactions, 0 means no message", Type: "int", Def: Def_IoTick}
 
 		modeFunc = modeConfirmRawapi
+	case MODE_ENROLL_FULL, MODE_ENROLL_SC:
+		fs.Entries[OPT_CA_NAME] = cfg.Entry{Desc: "name of the CA in a fabric CA server hosting more than one, default is $" + TC_CA_NAME + " if set", Type: "string", Def: Def_CaName}
+		fs.Entries[OPT_CA_TLSCERT] = cfg.Entry{Desc: "path to the TLS root certificate of the CA, default is $" + TC_CA_TLSCERT + " if set", Type: "string", Def: Def_CaTlscert}
+		fs.Entries[OPT_CA_URL] = cfg.Entry{Desc: "fabric CA url, eg. https://ca1.endorsers.example.com:8001, the first CA of the organization in -" + OPT_FAB_PROFILE + " if empty, default is $" + TC_CA_URL + " if set", Type: "string", Def: Def_CaUrl}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON) to take the CA from, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+
+		fs.Entries[OPT_CA_HOSTS] = cfg.Entry{Desc: ", separated list of host names and IPs of the certificate", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_ID] = cfg.Entry{Desc: "enrollment id", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_LABEL] = cfg.Entry{Desc: "label of the identity in -" + OPT_CA_WALLET + ", -" + OPT_CA_ID + " if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_MSP] = cfg.Entry{Desc: "msp directory to store the certificate in signcerts/cert.pem, the key in keystore/ and the CA chain in cacerts/ca.pem", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_PROFILE] = cfg.Entry{Desc: "signing profile of the CA, eg. tls", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_SECRET] = cfg.Entry{Desc: "enrollment secret", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_WALLET] = cfg.Entry{Desc: "wallet directory to store the identity in", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID of the identity in -" + OPT_CA_WALLET + ", default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
+
+		modeFunc = modeEnroll
 	case MODE_HELP_FULL, MODE_HELP_SC:
 		os.Args[1] = ""
 		msg := helperUsage(fs.FlagSet)
@@ -436,6 +639,9 @@ func main() {
 		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
 		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
 		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
 
 		fs.Entries[OPT_IO_CHECKPOINT] = cfg.Entry{Desc: "file checkpointer path and prefix (as in prefix_channel_chaincode), empty forces next block", Type: "string", Def: Def_IoCheckpoint}
 		fs.Entries[OPT_IO_BUFFER] = cfg.Entry{Desc: "maximum block cache size", Type: "int", Def: Def_IoBuffer}
@@ -444,6 +650,64 @@ func main() {
 		fs.Entries[OPT_PROC_INTERVAL] = cfg.Entry{Desc: "status appear in the log every second (at LOG_NOTICE level), 0 means none", Type: "time.Duration", Def: Def_ProcInterval}
 
 		modeFunc = modeListener
+	case MODE_MONITOR_FULL, MODE_MONITOR_SC:
+		fs.Entries[OPT_CONS_PEERS] = cfg.Entry{Desc: ", separated list of peers to monitor, peers of -" + OPT_FAB_PROFILE + " by name or gateway peers as name=host:port verified against -" + OPT_FAB_TLSCERT + ", every peer of the profile if empty, default is $" + TC_MON_PEERS + " if set", Type: "string", Def: Def_MonPeers}
+		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to client pem certificate, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabCert}
+		fs.Entries[OPT_FAB_CHANNEL] = cfg.Entry{Desc: ", separated list of channels, default is $" + TC_FAB_CHANNEL + " if set", Type: "string", Def: Def_FabChannel}
+		fs.Entries[OPT_FAB_ENDPOINT] = cfg.Entry{Desc: "fabric endpoint, default is $" + TC_FAB_ENDPOINT + " if set", Type: "string", Def: Def_FabEndpoint}
+		fs.Entries[OPT_FAB_GATEWAY] = cfg.Entry{Desc: "default gateway, default is $" + TC_FAB_GW + " if set", Type: "string", Def: Def_FabGateway}
+		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
+		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
+		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
+
+		fs.Entries[OPT_MON_ALERT_CMD] = cfg.Entry{Desc: "command run by bash on every alert raised or resolved, with the alert as JSON on its stdin and in $TC_MIG_ALERT_KIND, _CHANNEL, _PEER, _STATE and _MESSAGE, default is $" + TC_MON_ALERT_CMD + " if set", Type: "string", Def: Def_MonAlertCmd}
+		fs.Entries[OPT_MON_BIND] = cfg.Entry{Desc: "address to bind the metrics endpoint to, empty means every interface", Type: "string", Def: Def_MonBind}
+		fs.Entries[OPT_MON_LAG] = cfg.Entry{Desc: "a peer more than this many blocks behind the highest peer of the channel is LAGGING, 0 means no alert, default is $" + TC_MON_LAG + " if set", Type: "int", Def: Def_MonLag}
+		fs.Entries[OPT_MON_PORT] = cfg.Entry{Desc: "port of the metrics endpoint, served at /metrics, 0 means none, default is $" + TC_MON_PORT + " if set", Type: "int", Def: Def_MonPort}
+		fs.Entries[OPT_MON_STALL] = cfg.Entry{Desc: "a peer without a new block for this long is STALLED, 0 means no alert, default is $" + TC_MON_STALL + " if set", Type: "time.Duration", Def: Def_MonStall}
+		fs.Entries[OPT_MON_WEBHOOK] = cfg.Entry{Desc: "url every alert raised or resolved is posted to as JSON, default is $" + TC_MON_WEBHOOK + " if set", Type: "string", Def: Def_MonWebhook}
+
+		fs.Entries[OPT_PROC_INTERVAL] = cfg.Entry{Desc: "time between polls", Type: "time.Duration", Def: Def_ProcInterval}
+
+		modeFunc = modeMonitor
+	case MODE_PROFILE_FULL, MODE_PROFILE_SC:
+		modeFunc = modeProfile
+	case MODE_REENROLL_FULL, MODE_REENROLL_SC:
+		fs.Entries[OPT_CA_NAME] = cfg.Entry{Desc: "name of the CA in a fabric CA server hosting more than one, default is $" + TC_CA_NAME + " if set", Type: "string", Def: Def_CaName}
+		fs.Entries[OPT_CA_TLSCERT] = cfg.Entry{Desc: "path to the TLS root certificate of the CA, default is $" + TC_CA_TLSCERT + " if set", Type: "string", Def: Def_CaTlscert}
+		fs.Entries[OPT_CA_URL] = cfg.Entry{Desc: "fabric CA url, eg. https://ca1.endorsers.example.com:8001, the first CA of the organization in -" + OPT_FAB_PROFILE + " if empty, default is $" + TC_CA_URL + " if set", Type: "string", Def: Def_CaUrl}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON) to take the CA from, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+
+		fs.Entries[OPT_CA_LABEL] = cfg.Entry{Desc: "label of the identity in -" + OPT_CA_WALLET, Type: "string", Def: ""}
+		fs.Entries[OPT_CA_WALLET] = cfg.Entry{Desc: "wallet directory of the identity, -" + OPT_FAB_CERT + " and -" + OPT_FAB_KEYSTORE + " are used if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to the pem certificate of the identity, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabCert}
+		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to the keystore directory or key file of the identity, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
+
+		modeFunc = modeReenroll
+	case MODE_REGISTER_FULL, MODE_REGISTER_SC:
+		fs.Entries[OPT_CA_NAME] = cfg.Entry{Desc: "name of the CA in a fabric CA server hosting more than one, default is $" + TC_CA_NAME + " if set", Type: "string", Def: Def_CaName}
+		fs.Entries[OPT_CA_TLSCERT] = cfg.Entry{Desc: "path to the TLS root certificate of the CA, default is $" + TC_CA_TLSCERT + " if set", Type: "string", Def: Def_CaTlscert}
+		fs.Entries[OPT_CA_URL] = cfg.Entry{Desc: "fabric CA url, eg. https://ca1.endorsers.example.com:8001, the first CA of the organization in -" + OPT_FAB_PROFILE + " if empty, default is $" + TC_CA_URL + " if set", Type: "string", Def: Def_CaUrl}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON) to take the CA from, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+
+		fs.Entries[OPT_CA_LABEL] = cfg.Entry{Desc: "label of the identity in -" + OPT_CA_WALLET, Type: "string", Def: ""}
+		fs.Entries[OPT_CA_WALLET] = cfg.Entry{Desc: "wallet directory of the identity, -" + OPT_FAB_CERT + " and -" + OPT_FAB_KEYSTORE + " are used if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to the pem certificate of the identity, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabCert}
+		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to the keystore directory or key file of the identity, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
+
+		fs.Entries[OPT_CA_AFFILIATION] = cfg.Entry{Desc: "affiliation of the new identity", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_ATTRS] = cfg.Entry{Desc: ", separated list of name=value attributes of the new identity, name=value:ecert adds it to the enrollment certificate", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_ID] = cfg.Entry{Desc: "id of the new identity", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_MAXENROLLMENTS] = cfg.Entry{Desc: "number of times the secret can be used for enrollment, 0 means the default of the CA", Type: "int", Def: 0}
+		fs.Entries[OPT_CA_SECRET] = cfg.Entry{Desc: "enrollment secret of the new identity, generated by the CA if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_TYPE] = cfg.Entry{Desc: "type of the new identity, eg. client, peer, admin", Type: "string", Def: "client"}
+
+		modeFunc = modeRegister
 	case MODE_RESUBMIT_FULL, MODE_RESUBMIT_SC:
 		shift := strconv.Itoa(reflect.TypeOf(PSV{}).NumField())
 		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to client pem certificate to populate the wallet with, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabCert}
@@ -454,6 +718,9 @@ func main() {
 		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
 		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
 		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
 
 		fs.Entries[OPT_IO_INPUT] = cfg.Entry{Desc: "file, which contains the output of previous submit attempt, empty means stdin", Type: "string", Def: ""}
 		fs.Entries[OPT_IO_TICK] = cfg.Entry{Desc: "progress message at LOG_NOTICE level per this many transactions, 0 means no message", Type: "int", Def: Def_IoTick}
@@ -473,6 +740,9 @@ func main() {
 		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
 		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
 		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
 
 		fs.Entries[OPT_IO_INPUT] = cfg.Entry{Desc: "file, which contains the parameters of one transaction per line, separated by |, empty means stdin", Type: "string", Def: ""}
 		fs.Entries[OPT_IO_TICK] = cfg.Entry{Desc: "progress message at LOG_NOTICE level per this many transactions, 0 means no message", Type: "int", Def: Def_IoTick}
@@ -492,6 +762,9 @@ func main() {
 		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to client keystore, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
 		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
 		fs.Entries[OPT_FAB_TLSCERT] = cfg.Entry{Desc: "path to TLS cert, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabTlscert}
+		fs.Entries[OPT_FAB_ORG] = cfg.Entry{Desc: "organization of -" + OPT_FAB_PROFILE + ", its client.organization if empty", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_PROFILE] = cfg.Entry{Desc: "fabric connection profile (YAML or JSON), if set, -" + OPT_FAB_CERT + ", -" + OPT_FAB_KEYSTORE + ", -" + OPT_FAB_TLSCERT + ", the endpoint, the gateway and -" + OPT_FAB_MSPID + " are taken from it, default is $" + TC_FAB_PROFILE + " if set", Type: "string", Def: Def_FabProfile}
+		fs.Entries[OPT_FAB_PEER] = cfg.Entry{Desc: "peer of -" + OPT_FAB_PROFILE + " to connect to, the first peer of the organization if empty", Type: "string", Def: ""}
 
 		fs.Entries[OPT_IO_BATCH] = cfg.Entry{Desc: "list of files to process, one file path per line, -in ignored if specified", Type: "string", Def: ""}
 		fs.Entries[OPT_IO_BRAKE] = cfg.Entry{Desc: "file path, which if appears, processing stops before opening the next file", Type: "string", Def: Def_IoBrake}
@@ -505,6 +778,25 @@ func main() {
 		fs.Entries[OPT_PROC_TRY] = cfg.Entry{Desc: "number of invoke tries", Type: "int", Def: Def_ProcTry}
 
 		modeFunc = modeSubmitBatch
+	case strings.ToLower(MODE_WALLETEXPORT_FULL), MODE_WALLETEXPORT_SC:
+		fs.Entries[OPT_CA_LABEL] = cfg.Entry{Desc: "label of the identity to export", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_WALLET] = cfg.Entry{Desc: "wallet directory, default is $" + TC_WALLET + " if set", Type: "string", Def: Def_Wallet}
+		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to write the pem certificate to", Type: "string", Def: ""}
+		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "keystore directory, ending with /, or key file to write the private key to", Type: "string", Def: ""}
+
+		modeFunc = modeWalletExport
+	case strings.ToLower(MODE_WALLETIMPORT_FULL), MODE_WALLETIMPORT_SC:
+		fs.Entries[OPT_CA_LABEL] = cfg.Entry{Desc: "label to store the identity under", Type: "string", Def: ""}
+		fs.Entries[OPT_CA_WALLET] = cfg.Entry{Desc: "wallet directory, default is $" + TC_WALLET + " if set", Type: "string", Def: Def_Wallet}
+		fs.Entries[OPT_FAB_CERT] = cfg.Entry{Desc: "path to the pem certificate of the identity, default is $" + TC_PATH_CERT + " if set", Type: "string", Def: Def_FabCert}
+		fs.Entries[OPT_FAB_KEYSTORE] = cfg.Entry{Desc: "path to the keystore directory, of whose keys the one belonging to -" + OPT_FAB_CERT + " is imported, or key file, default is $" + TC_PATH_KEYSTORE + " if set", Type: "string", Def: Def_FabKeystore}
+		fs.Entries[OPT_FAB_MSPID] = cfg.Entry{Desc: "fabric MSPID of the identity, default is $" + TC_FAB_MSPID + " if set", Type: "string", Def: Def_FabMspId}
+
+		modeFunc = modeWalletImport
+	case strings.ToLower(MODE_WALLETLIST_FULL), MODE_WALLETLIST_SC:
+		fs.Entries[OPT_CA_WALLET] = cfg.Entry{Desc: "wallet directory, default is $" + TC_WALLET + " if set", Type: "string", Def: Def_Wallet}
+
+		modeFunc = modeWalletList
 	default:
 		mode := os.Args[1]
 		os.Args[1] = ""
@@ -514,6 +806,20 @@ func main() {
 	}
 
 	// endregion: evaluate mode
+	// region: wallet args
+
+	if _, ok := fs.Entries[OPT_FAB_KEYSTORE]; ok {
+		if _, ok := fs.Entries[OPT_CA_WALLET]; !ok {
+			fs.Entries[OPT_CA_LABEL] = cfg.Entry{Desc: "label of the client identity in -" + OPT_CA_WALLET + ", -" + OPT_FAB_CERT + " and -" + OPT_FAB_KEYSTORE + " are ignored if set", Type: "string", Def: ""}
+			fs.Entries[OPT_CA_WALLET] = cfg.Entry{Desc: "wallet directory the client identity is taken from by -" + OPT_CA_LABEL + ", or if -" + OPT_FAB_KEYSTORE + " is empty, the private key of -" + OPT_FAB_CERT + ", default is $" + TC_WALLET + " if set", Type: "string", Def: Def_Wallet}
+		}
+	}
+	if _, ok := fs.Entries[OPT_CA_WALLET]; ok {
+		fs.Entries[OPT_WALLET_PASS] = cfg.Entry{Desc: "passphrase the private keys in -" + OPT_CA_WALLET + " are encrypted with, stored in plain text if empty, default is $" + TC_WALLET_PASS + " if set", Type: "string", Def: Def_WalletPass}
+		fs.Entries[OPT_WALLET_PASS_FILE] = cfg.Entry{Desc: "file holding -" + OPT_WALLET_PASS + ", default is $" + TC_WALLET_PASS_F + " if set", Type: "string", Def: Def_WalletPassFile}
+	}
+
+	// endregion: wallet args
 	// region: parse flag set
 
 	err := fs.ParseCopy()
@@ -604,6 +910,7 @@ func modeCombined(c *cfg.Config) {
 	cfgSubmit.Entries = helperCfgDeepcopy(c.Entries)
 	cfgSubmit.Entries[OPT_FAB_ENDPOINT] = c.Entries[OPT_FAB_ENDPOINT_SUBMIT]
 	cfgSubmit.Entries[OPT_FAB_GATEWAY] = c.Entries[OPT_FAB_GATEWAY_SUBMIT]
+	cfgSubmit.Entries[OPT_FAB_PEER] = c.Entries[OPT_FAB_PEER_SUBMIT]
 	cfgSubmit.Entries[OPT_FAB_CC] = c.Entries[OPT_FAB_CC_SUBMIT]
 	cfgSubmit.Entries[OPT_FAB_FUNC] = c.Entries[OPT_FAB_FUNC_SUBMIT]
 	contractSubmit := fabricContract(&cfgSubmit)
@@ -613,6 +920,7 @@ func modeCombined(c *cfg.Config) {
 	cfgConfirm.Entries = helperCfgDeepcopy(c.Entries)
 	cfgConfirm.Entries[OPT_FAB_ENDPOINT] = c.Entries[OPT_FAB_ENDPOINT_CONFIRM]
 	cfgConfirm.Entries[OPT_FAB_GATEWAY] = c.Entries[OPT_FAB_GATEWAY_CONFIRM]
+	cfgConfirm.Entries[OPT_FAB_PEER] = c.Entries[OPT_FAB_PEER_CONFIRM]
 	cfgConfirm.Entries[OPT_FAB_CC] = c.Entries[OPT_FAB_CC_CONFIRM]
 	cfgConfirm.Entries[OPT_FAB_FUNC] = c.Entries[OPT_FAB_FUNC_CONFIRM]
 	contractConfirm := fabricContract(&cfgConfirm)
@@ -733,6 +1041,160 @@ func modeCombined(c *cfg.Config) {
 
 }
 
+func modeCerts(c *cfg.Config) {
+	warnDays := c.Entries[OPT_CERTS_WARNDAYS].Value.(int)
+	infos := make([]fabric.CertificateInfo, 0)
+	for _, root := range strings.Split(c.Entries[OPT_IO_INPUT].Value.(string), ",") {
+		found, err := fabric.ScanCertificates(strings.TrimSpace(root))
+		helperPanic(err)
+		infos = append(infos, found...)
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].NotAfter.Before(infos[j].NotAfter) })
+
+	output := ioOutputOpen(c.Entries[OPT_IO_OUTPUT].Value.(string))
+	defer output.Close()
+	now := time.Now()
+	expiring, expired := 0, 0
+	for _, info := range infos {
+		days, status := info.DaysLeft(now), "OK"
+		switch {
+		case days <= 0:
+			status = "EXPIRED"
+			expired++
+			Lout(LOG_ERR, info.File, info.Subject, "expired at", info.NotAfter.Format(time.RFC3339))
+		case days <= float64(warnDays):
+			status = "EXPIRING"
+			expiring++
+			Lout(LOG_WARNING, info.File, info.Subject, "expires at", info.NotAfter.Format(time.RFC3339))
+		}
+		_, err := fmt.Fprintf(output, "%s|%s|%s|%s|%.1f|%s\n", info.File, info.Subject, info.Issuer, info.NotAfter.Format(time.RFC3339), days, status)
+		helperPanic(err)
+	}
+	Lout(LOG_NOTICE, "certificates:", len(infos), "expiring within", warnDays, "days:", expiring, "expired:", expired)
+}
+
+func modeConsistency(c *cfg.Config) {
+
+	// region: peers
+
+	base := fabricClient(c)
+	defer base.Close()
+	var profile *fabric.Profile
+	if file := c.Entries[OPT_FAB_PROFILE].Value.(string); len(file) > 0 {
+		var err error
+		profile, err = fabric.LoadProfile(file)
+		helperPanic(err)
+	}
+	peers, err := fabric.ConsistencyPeers(strings.Split(c.Entries[OPT_CONS_PEERS].Value.(string), ","), profile, base)
+	helperPanic(err)
+	for _, peer := range peers {
+		err := peer.Client.Init()
+		helperPanic(err, "peer", peer.Name)
+		defer peer.Client.Close()
+	}
+
+	// endregion: peers
+	// region: check
+
+	check := &fabric.ConsistencyCheck{
+		Chaincode: c.Entries[OPT_FAB_CC].Value.(string),
+		KeyField:  c.Entries[OPT_PROC_KEYNAME].Value.(string),
+		Peers:     peers,
+	}
+	for _, channel := range strings.Split(c.Entries[OPT_FAB_CHANNEL].Value.(string), ",") {
+		if channel = strings.TrimSpace(channel); len(channel) > 0 {
+			check.Channels = append(check.Channels, channel)
+		}
+	}
+	for _, key := range strings.Split(c.Entries[OPT_CONS_KEYS].Value.(string), ",") {
+		if key = strings.TrimSpace(key); len(key) > 0 {
+			check.Keys = append(check.Keys, key)
+		}
+	}
+	if input := c.Entries[OPT_IO_INPUT].Value.(string); len(input) > 0 {
+		submitted := make([]string, 0)
+		for _, bundle := range *ioRead(input, procParsePSV) {
+			if bundle.Status == STATUS_SUBMIT_OK || bundle.Status == STATUS_CONFIRM_OK {
+				submitted = append(submitted, bundle.Key)
+			}
+		}
+		sample := c.Entries[OPT_CONS_SAMPLE].Value.(int)
+		if sample > 0 && sample < len(submitted) {
+			random := rand.New(rand.NewSource(time.Now().UnixNano()))
+			random.Shuffle(len(submitted), func(i, j int) { submitted[i], submitted[j] = submitted[j], submitted[i] })
+			submitted = submitted[:sample]
+		}
+		Lout(LOG_INFO, "keys sampled from", input, len(submitted))
+		check.Keys = append(check.Keys, submitted...)
+	}
+	if len(check.Keys) > 0 {
+		check.GetFunction = c.Entries[OPT_CONS_GET].Value.(string)
+	}
+	check.RangeStart, check.RangeEnd = c.Entries[OPT_CONS_START].Value.(string), c.Entries[OPT_CONS_END].Value.(string)
+	if len(check.RangeStart) > 0 || len(check.RangeEnd) > 0 {
+		check.RangeFunction = c.Entries[OPT_CONS_RANGE].Value.(string)
+	}
+	if len(check.Chaincode) == 0 {
+		check.GetFunction, check.RangeFunction = "", ""
+	}
+	report := check.Run()
+
+	// endregion: check
+	// region: report
+
+	output := ioOutputOpen(c.Entries[OPT_IO_OUTPUT].Value.(string))
+	defer output.Close()
+	for _, channel := range report.Channels {
+		for _, peer := range report.Peers {
+			status := "OK"
+			switch {
+			case len(channel.Errors[peer]) > 0:
+				status = channel.Errors[peer]
+				Lout(LOG_ERR, channel.Channel, peer, status)
+			case channel.HashMismatch:
+				status = "MISMATCH"
+				Lout(LOG_ERR, channel.Channel, peer, "block", channel.CommonHeight-1, "hash", channel.Hashes[peer])
+			}
+			for _, lagging := range channel.Lagging {
+				if lagging == peer && status == "OK" {
+					status = "LAGGING"
+					Lout(LOG_WARNING, channel.Channel, peer, "is lagging at height", channel.Heights[peer])
+				}
+			}
+			_, err := fmt.Fprintf(output, "peer|%s|%s|%d|%s|%s\n", channel.Channel, peer, channel.Heights[peer], channel.Hashes[peer], status)
+			helperPanic(err)
+		}
+		for _, key := range channel.DivergentKeys {
+			Lout(LOG_ERR, channel.Channel, "key", key.Key, "diverges")
+			for _, peer := range report.Peers {
+				hash, status := key.Hashes[peer], "DIVERGENT"
+				for _, missing := range key.Missing {
+					if missing == peer {
+						status = "MISSING"
+					}
+				}
+				if len(hash) == 0 && status != "MISSING" {
+					continue
+				}
+				_, err := fmt.Fprintf(output, "key|%s|%s|%s|%s|%s\n", channel.Channel, key.Key, peer, hash, status)
+				helperPanic(err)
+			}
+		}
+		Lout(LOG_NOTICE, channel.Channel, "common height:", channel.CommonHeight, "lagging peers:", len(channel.Lagging), "hash mismatch:", channel.HashMismatch, "keys:", channel.Keys, "divergent:", len(channel.DivergentKeys))
+	}
+	for mspid, peers := range report.SharedOrgs {
+		Lout(LOG_WARNING, "keys of", strings.Join(peers, ", "), "are compared per org, the gateways may evaluate on any peer of", mspid)
+	}
+	if report.Consistent {
+		Lout(LOG_NOTICE, "peers are consistent:", strings.Join(report.Peers, ", "))
+	} else {
+		Lout(LOG_ERR, "peers are inconsistent:", strings.Join(report.Peers, ", "))
+	}
+
+	// endregion: report
+
+}
+
 func modeConfirm(c *cfg.Config) {
 
 	// region: i/o
@@ -1005,6 +1467,53 @@ func modeConfirmRawapi(config *cfg.Config) {
 
 }
 
+func modeEnroll(c *cfg.Config) {
+	id := c.Entries[OPT_CA_ID].Value.(string)
+	msp := c.Entries[OPT_CA_MSP].Value.(string)
+	wallet := c.Entries[OPT_CA_WALLET].Value.(string)
+	if len(id) == 0 || (len(msp) == 0 && len(wallet) == 0) {
+		helperPanic(errors.New("-" + OPT_CA_ID + " and -" + OPT_CA_MSP + " or -" + OPT_CA_WALLET + " are mandatory"))
+	}
+
+	hosts := make([]string, 0)
+	for _, host := range strings.Split(c.Entries[OPT_CA_HOSTS].Value.(string), ",") {
+		if host = strings.TrimSpace(host); len(host) > 0 {
+			hosts = append(hosts, host)
+		}
+	}
+	enrollment, err := caClient(c).Enroll(fabric.EnrollRequest{
+		Hosts:   hosts,
+		ID:      id,
+		Profile: c.Entries[OPT_CA_PROFILE].Value.(string),
+		Secret:  c.Entries[OPT_CA_SECRET].Value.(string),
+	})
+	helperPanic(err, "enrollment of", id)
+
+	if len(msp) > 0 {
+		err = fabric.WriteCredentials(filepath.Join(msp, "signcerts", "cert.pem"), filepath.Join(msp, "keystore")+"/", enrollment.Certificate, enrollment.PrivateKey)
+		helperPanic(err, "msp", msp)
+		err = os.MkdirAll(filepath.Join(msp, "cacerts"), 0755)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(msp, "cacerts", "ca.pem"), enrollment.CAChain, 0644)
+		}
+		helperPanic(err, "msp", msp)
+		Lout(LOG_NOTICE, "enrolled", id, "into msp", msp)
+	}
+	if len(wallet) > 0 {
+		label := c.Entries[OPT_CA_LABEL].Value.(string)
+		if len(label) == 0 {
+			label = id
+		}
+		err = helperWallet(c).Put(&fabric.WalletIdentity{
+			Credentials: fabric.WalletCredentials{Certificate: string(enrollment.Certificate), PrivateKey: string(enrollment.PrivateKey)},
+			Label:       label,
+			MSPID:       c.Entries[OPT_FAB_MSPID].Value.(string),
+		})
+		helperPanic(err, "wallet", wallet)
+		Lout(LOG_NOTICE, "enrolled", id, "into wallet", wallet, "as", label)
+	}
+}
+
 func modeListener(c *cfg.Config) {
 
 	// region: output
@@ -1024,7 +1533,7 @@ func modeListener(c *cfg.Config) {
 	// region: checkpoint, ctx
 
 	checkpointer := fabricCheckpointer(c)
-	defer checkpointer.cp.Close()
+	defer checkpointer.Close()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -1056,7 +1565,7 @@ func modeListener(c *cfg.Config) {
 		blockEvents, err := network.BlockEvents(
 			ctx,
 			// client.WithStartBlock(3605), // ignored if the checkpointer has checkpoint state
-			client.WithCheckpoint(checkpointer.cp),
+			client.WithCheckpoint(checkpointer),
 		)
 		helperPanic(err)
 
@@ -1126,7 +1635,7 @@ func modeListener(c *cfg.Config) {
 			ctx,
 			c.Entries[OPT_FAB_CC].Value.(string),
 			// client.WithStartBlock(3605), // ignored if the checkpointer has checkpoint state
-			client.WithCheckpoint(checkpointer.cp),
+			client.WithCheckpoint(checkpointer),
 		)
 		helperPanic(err)
 
@@ -1171,7 +1680,7 @@ func modeListener(c *cfg.Config) {
 				Lout(LOG_DEBUG, "chaincode event", StatTrs, chCache[tx_id])
 				chCacheMutex.Unlock()
 				if checkpointer != nil {
-					checkpointer.cp.CheckpointChaincodeEvent(event)
+					checkpointer.CheckpointChaincodeEvent(event)
 				}
 			}
 		}
@@ -1298,12 +1807,7 @@ func modeListener(c *cfg.Config) {
 		ioOutputAppend(output, chCache[tx_id], procCompilePSV)
 	}
 	if checkpointer != nil {
-		checkpointer.cp.Sync()
-		checkpointer.cp.Close()
-	}
-	if checkpointer.file != nil {
-		checkpointer.file.Close()
-		os.Remove(checkpointer.file.Name())
+		checkpointer.Close()
 	}
 	if c.Entries[OPT_IO_TIMESTAMP].Value.(bool) {
 		output.Close()
@@ -1318,6 +1822,201 @@ func modeListener(c *cfg.Config) {
 
 }
 
+func modeMonitor(c *cfg.Config) {
+
+	// region: output
+
+	output := ioOutputOpen(c.Entries[OPT_IO_OUTPUT].Value.(string))
+	defer output.Close()
+
+	// endregion: output
+	// region: peers
+
+	base := fabricClient(c)
+	defer base.Close()
+	var profile *fabric.Profile
+	if file := c.Entries[OPT_FAB_PROFILE].Value.(string); len(file) > 0 {
+		var err error
+		profile, err = fabric.LoadProfile(file)
+		helperPanic(err)
+	}
+	peers, err := fabric.ResolvePeers(strings.Split(c.Entries[OPT_CONS_PEERS].Value.(string), ","), profile, base)
+	helperPanic(err)
+	for _, peer := range peers {
+		err := peer.Client.Init()
+		helperPanic(err, "peer", peer.Name)
+		defer peer.Client.Close()
+	}
+
+	monitor := &fabric.Monitor{
+		LagAlert:   uint64(c.Entries[OPT_MON_LAG].Value.(int)),
+		Peers:      peers,
+		StallAlert: c.Entries[OPT_MON_STALL].Value.(time.Duration),
+	}
+	for _, channel := range strings.Split(c.Entries[OPT_FAB_CHANNEL].Value.(string), ",") {
+		if channel = strings.TrimSpace(channel); len(channel) > 0 {
+			monitor.Channels = append(monitor.Channels, channel)
+		}
+	}
+	if len(monitor.Channels) == 0 {
+		helperPanic(errors.New("no channels to monitor"))
+	}
+
+	// endregion: peers
+	// region: metrics
+
+	if port := c.Entries[OPT_MON_PORT].Value.(int); port != 0 {
+		server := &fasthttp.Server{
+			Handler: func(ctx *fasthttp.RequestCtx) {
+				if string(ctx.Path()) != "/metrics" {
+					ctx.Error("not found", fasthttp.StatusNotFound)
+					return
+				}
+				ctx.SetContentType("text/plain; version=0.0.4")
+				monitor.Metrics(ctx, time.Now())
+			},
+			Name: os.Args[0],
+		}
+		address := c.Entries[OPT_MON_BIND].Value.(string) + ":" + strconv.Itoa(port)
+		go func() {
+			Lout(LOG_INFO, "serving metrics on", address)
+			err := server.ListenAndServe(address)
+			helperPanic(err, "metrics endpoint", address)
+		}()
+		defer server.Shutdown()
+	}
+
+	// endregion: metrics
+	// region: prepare for sigint
+
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+
+	// endregion: prepare for sigint
+	// region: poll
+
+	interval := c.Entries[OPT_PROC_INTERVAL].Value.(time.Duration)
+	if interval <= 0 {
+		helperPanic(errors.New("-" + OPT_PROC_INTERVAL + " must be positive"))
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// alerts are passed on in order by a goroutine of their own, so that a slow -alert_cmd or
+	// -alert_webhook does not hold up the polls, they are dropped if it falls too far behind
+	type delivery struct {
+		alert fabric.MonitorAlert
+		state string
+	}
+	deliveries := make(chan delivery, 256)
+	delivered := make(chan struct{})
+	go func() {
+		for d := range deliveries {
+			helperAlert(c, d.alert, d.state)
+		}
+		close(delivered)
+	}()
+	defer func() {
+		close(deliveries)
+		<-delivered
+	}()
+
+	Lout(LOG_NOTICE, "monitoring", strings.Join(monitor.Channels, ", "), "on", len(peers), "peers every", interval)
+	for {
+		for _, alert := range monitor.Poll(time.Now()) {
+			state, priority := "RAISED", LOG_ERR
+			if alert.Resolved {
+				state, priority = "RESOLVED", LOG_NOTICE
+			}
+			Lout(priority, alert.Kind, state, alert.Channel, alert.Peer, alert.Message)
+			_, err := fmt.Fprintf(output, "alert|%s|%s|%s|%s|%s|%s\n", alert.Time.Format(time.RFC3339), alert.Kind, alert.Channel, alert.Peer, state, alert.Message)
+			helperPanic(err)
+			select {
+			case deliveries <- delivery{alert: alert, state: state}:
+			default:
+				Lout(LOG_ERR, "alert deliveries are falling behind, not passing on", alert.Kind, state, alert.Channel, alert.Peer)
+			}
+		}
+		for _, state := range monitor.States() {
+			Lout(LOG_DEBUG, state.Channel, state.Peer, "up:", state.Up, "height:", state.Height, "lag:", state.Lag, "blocks/min:", state.Rate, "last block:", state.LastBlock.Format(time.RFC3339))
+		}
+
+		select {
+		case <-interruptCh:
+			Lout(LOG_NOTICE, "received interupt signal, monitor is closing")
+			return
+		case <-ticker.C:
+		}
+	}
+
+	// endregion: poll
+
+}
+
+func modeProfile(c *cfg.Config) {
+	profile, err := fabric.ProfileFromEnv(helperGetenv)
+	helperPanic(err)
+
+	raw, err := profile.Marshal()
+	helperPanic(err)
+
+	output := ioOutputOpen(c.Entries[OPT_IO_OUTPUT].Value.(string))
+	defer output.Close()
+	_, err = output.Write(raw)
+	helperPanic(err)
+
+	Lout(LOG_NOTICE, "connection profile written, organizations:", len(profile.Organizations), "peers:", len(profile.Peers), "CAs:", len(profile.CertificateAuthorities))
+}
+
+func modeReenroll(c *cfg.Config) {
+	certificatePEM, keyPEM, save := caIdentity(c)
+	enrollment, err := caClient(c).Reenroll(certificatePEM, keyPEM)
+	helperPanic(err, "reenrollment")
+	save(enrollment)
+
+	expiry, _ := fabric.CertificateExpiry(enrollment.Certificate)
+	Lout(LOG_NOTICE, "reenrolled, certificate valid until", expiry.Format(time.RFC3339))
+}
+
+func modeRegister(c *cfg.Config) {
+	id := c.Entries[OPT_CA_ID].Value.(string)
+	if len(id) == 0 {
+		helperPanic(errors.New("-" + OPT_CA_ID + " is mandatory"))
+	}
+	registration := &fabric.Registration{
+		Affiliation:    c.Entries[OPT_CA_AFFILIATION].Value.(string),
+		Attributes:     make([]fabric.CAAttribute, 0),
+		ID:             id,
+		MaxEnrollments: c.Entries[OPT_CA_MAXENROLLMENTS].Value.(int),
+		Secret:         c.Entries[OPT_CA_SECRET].Value.(string),
+		Type:           c.Entries[OPT_CA_TYPE].Value.(string),
+	}
+	for _, attr := range strings.Split(c.Entries[OPT_CA_ATTRS].Value.(string), ",") {
+		if len(strings.TrimSpace(attr)) == 0 {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(attr), "=", 2)
+		if len(kv) != 2 {
+			helperPanic(errors.New("invalid attribute '" + attr + "', use name=value or name=value:ecert"))
+		}
+		attribute := fabric.CAAttribute{Name: kv[0], Value: kv[1]}
+		if strings.HasSuffix(kv[1], ":ecert") {
+			attribute.ECert, attribute.Value = true, strings.TrimSuffix(kv[1], ":ecert")
+		}
+		registration.Attributes = append(registration.Attributes, attribute)
+	}
+
+	certificatePEM, keyPEM, _ := caIdentity(c)
+	secret, err := caClient(c).Register(certificatePEM, keyPEM, registration)
+	helperPanic(err, "registration of", id)
+
+	output := ioOutputOpen(c.Entries[OPT_IO_OUTPUT].Value.(string))
+	defer output.Close()
+	_, err = fmt.Fprintln(output, secret)
+	helperPanic(err)
+	Lout(LOG_NOTICE, "registered", id)
+}
+
 func modeResubmit(c *cfg.Config) {
 
 	// region: i/o
@@ -1466,38 +2165,127 @@ func modeSubmitBatch(c *cfg.Config) {
 
 }
 
+func modeWalletExport(c *cfg.Config) {
+	label, certPath, keyPath := c.Entries[OPT_CA_LABEL].Value.(string), c.Entries[OPT_FAB_CERT].Value.(string), c.Entries[OPT_FAB_KEYSTORE].Value.(string)
+	wallet := helperWallet(c)
+	if wallet == nil || len(label) == 0 || len(certPath) == 0 || len(keyPath) == 0 {
+		helperPanic(errors.New("-" + OPT_CA_WALLET + ", -" + OPT_CA_LABEL + ", -" + OPT_FAB_CERT + " and -" + OPT_FAB_KEYSTORE + " are mandatory"))
+	}
+
+	id, err := wallet.Get(label)
+	helperPanic(err)
+	err = fabric.WriteCredentials(certPath, keyPath, []byte(id.Credentials.Certificate), []byte(id.Credentials.PrivateKey))
+	helperPanic(err, certPath, keyPath)
+	Lout(LOG_NOTICE, "exported", label, "of", id.MSPID, "to", certPath, "and", keyPath)
+}
+
+func modeWalletImport(c *cfg.Config) {
+	label := c.Entries[OPT_CA_LABEL].Value.(string)
+	wallet := helperWallet(c)
+	if wallet == nil || len(label) == 0 {
+		helperPanic(errors.New("-" + OPT_CA_WALLET + " and -" + OPT_CA_LABEL + " are mandatory"))
+	}
+
+	certPath, keyPath := c.Entries[OPT_FAB_CERT].Value.(string), c.Entries[OPT_FAB_KEYSTORE].Value.(string)
+	certificatePEM, keyPEM, err := fabric.ReadCredentials(certPath, keyPath)
+	helperPanic(err)
+	err = wallet.Put(&fabric.WalletIdentity{
+		Credentials: fabric.WalletCredentials{Certificate: string(certificatePEM), PrivateKey: string(keyPEM)},
+		Label:       label,
+		MSPID:       c.Entries[OPT_FAB_MSPID].Value.(string),
+	})
+	helperPanic(err, "wallet", wallet.Path)
+	Lout(LOG_NOTICE, "imported", certPath, "into wallet", wallet.Path, "as", label, "encrypted:", len(wallet.Passphrase) > 0)
+}
+
+func modeWalletList(c *cfg.Config) {
+	wallet := helperWallet(c)
+	if wallet == nil {
+		helperPanic(errors.New("-" + OPT_CA_WALLET + " is mandatory"))
+	}
+	labels, err := wallet.List()
+	helperPanic(err, "wallet", wallet.Path)
+
+	output := ioOutputOpen(c.Entries[OPT_IO_OUTPUT].Value.(string))
+	defer output.Close()
+	for _, label := range labels {
+		id, err := wallet.Peek(label)
+		if err != nil {
+			Lout(LOG_ERR, err)
+			continue
+		}
+		var name, expiry string
+		if block, _ := pem.Decode([]byte(id.Credentials.Certificate)); block != nil {
+			if certificate, err := x509.ParseCertificate(block.Bytes); err == nil {
+				name, expiry = certificate.Subject.CommonName, certificate.NotAfter.Format(time.RFC3339)
+			}
+		}
+		_, err = fmt.Fprintf(output, "%s|%s|%s|%s|%t\n", label, id.MSPID, name, expiry, id.Credentials.EncryptedPrivateKey != nil)
+		helperPanic(err)
+	}
+	Lout(LOG_NOTICE, "identities in wallet", wallet.Path, len(labels))
+}
+
 // endregion: modes
 // region: fabric
 
-func fabricCheckpointer(c *cfg.Config) *Checkpointer {
+func fabricCheckpointer(c *cfg.Config) *fabric.Checkpointer {
+	var path string
 	if len(c.Entries[OPT_IO_CHECKPOINT].Value.(string)) > 0 {
-		path := []string{
+		path = strings.Join([]string{
 			c.Entries[OPT_IO_CHECKPOINT].Value.(string),
 			c.Entries[OPT_FAB_CHANNEL].Value.(string),
 			c.Entries[OPT_FAB_CC].Value.(string),
-		}
-		checkpointer, err := client.NewFileCheckpointer(strings.Join(path, "_"))
+		}, "_")
+	}
+	checkpointer, err := fabric.NewCheckpointer(path)
+	helperPanic(err)
+	checkpointer.Sync()
+	return checkpointer
+}
+
+// caClient returns the initialized CA of -ca_url, or the CA of the organization in -profile.
+func caClient(c *cfg.Config) *fabric.CA {
+	ca := &fabric.CA{
+		CAName:      c.Entries[OPT_CA_NAME].Value.(string),
+		TLSCertPath: c.Entries[OPT_CA_TLSCERT].Value.(string),
+		URL:         c.Entries[OPT_CA_URL].Value.(string),
+	}
+	if file := c.Entries[OPT_FAB_PROFILE].Value.(string); len(ca.URL) == 0 && len(file) > 0 {
+		profile, err := fabric.LoadProfile(file)
 		helperPanic(err)
-		checkpointer.Sync()
-		return &Checkpointer{
-			file: nil,
-			cp:   checkpointer,
+		ca, err = profile.NewCA(c.Entries[OPT_FAB_ORG].Value.(string))
+		helperPanic(err, "connection profile", file)
+	}
+	err := ca.Init()
+	helperPanic(err)
+
+	Lout(LOG_DEBUG, "fabric CA instance", ca)
+	return ca
+}
+
+// caIdentity reads the identity of -wallet/-label, or of -cert and -keystore, and returns it
+// with a function that replaces it with an enrollment.
+func caIdentity(c *cfg.Config) ([]byte, []byte, func(*fabric.Enrollment)) {
+	if wallet := helperWallet(c); wallet != nil {
+		id, err := wallet.Get(c.Entries[OPT_CA_LABEL].Value.(string))
+		helperPanic(err)
+		return []byte(id.Credentials.Certificate), []byte(id.Credentials.PrivateKey), func(enrollment *fabric.Enrollment) {
+			id.Credentials = fabric.WalletCredentials{Certificate: string(enrollment.Certificate), PrivateKey: string(enrollment.PrivateKey)}
+			helperPanic(wallet.Put(id), "wallet", wallet.Path)
 		}
 	}
 
-	// tmp, err := ioutil.TempFile("", "tmp_fabric_file_checkpointer_")
-	tmp, err := os.CreateTemp("", "tmp_fabric_file_checkpointer_")
+	certPath, keyPath := c.Entries[OPT_FAB_CERT].Value.(string), c.Entries[OPT_FAB_KEYSTORE].Value.(string)
+	certificatePEM, keyPEM, err := fabric.ReadCredentials(certPath, keyPath)
 	helperPanic(err)
-	checkpointer, err := client.NewFileCheckpointer(tmp.Name())
-	helperPanic(err)
-	return &Checkpointer{
-		file: tmp,
-		cp:   checkpointer,
+	return certificatePEM, keyPEM, func(enrollment *fabric.Enrollment) {
+		helperPanic(fabric.WriteCredentials(certPath, keyPath, enrollment.Certificate, enrollment.PrivateKey), certPath, keyPath)
 	}
 }
 
 func fabricClient(c *cfg.Config) *fabric.Client {
-	client := fabric.Client{
+	client := &fabric.Client{
 		CertPath:     c.Entries[OPT_FAB_CERT].Value.(string),
 		GatewayPeer:  c.Entries[OPT_FAB_GATEWAY].Value.(string),
 		KeyPath:      c.Entries[OPT_FAB_KEYSTORE].Value.(string),
@@ -1505,11 +2293,27 @@ func fabricClient(c *cfg.Config) *fabric.Client {
 		PeerEndpoint: c.Entries[OPT_FAB_ENDPOINT].Value.(string),
 		TLSCertPath:  c.Entries[OPT_FAB_TLSCERT].Value.(string),
 	}
+	if file := c.Entries[OPT_FAB_PROFILE].Value.(string); len(file) > 0 {
+		profile, err := fabric.LoadProfile(file)
+		helperPanic(err)
+		client, err = profile.NewClient(c.Entries[OPT_FAB_ORG].Value.(string), c.Entries[OPT_FAB_PEER].Value.(string))
+		helperPanic(err, "connection profile", file)
+		Lout(LOG_INFO, "connection profile", file, client.MSPID, client.GatewayPeer, client.PeerEndpoint)
+	}
+	if wallet := helperWallet(c); wallet != nil {
+		client.Label, client.Wallet = c.Entries[OPT_CA_LABEL].Value.(string), wallet
+	}
 	err := client.Init()
 	helperPanic(err)
+	certificatePEM, _, err := client.Credentials()
+	helperPanic(err)
+	helperExpiry("client certificate", certificatePEM)
+	rootPEM, err := client.TLSRoot()
+	helperPanic(err)
+	helperExpiry("TLS root certificate", rootPEM)
 
 	Lout(LOG_DEBUG, "fabric client instance", client)
-	return &client
+	return client
 }
 
 func fabricConfirm(c *cfg.Config, contract *client.Contract, bundle *PSV) error {
@@ -1694,7 +2498,7 @@ func fabricSubmit(c *cfg.Config, contract *client.Contract, bundle *PSV) error {
 	var responseErr *fabric.ResponseError
 
 	for cnt := 1; cnt <= try; cnt++ {
-		response, responseErr = request.Invoke()
+		response, responseErr = request.SubmitAsync()
 		if responseErr == nil {
 			break
 		}
@@ -1740,6 +2544,14 @@ func helperCfgDeepcopy(src map[string]cfg.Entry) map[string]cfg.Entry {
 	return dst
 }
 
+// helperGetenv looks name up in the environment, then among the variables of $TC_PATH_RC.
+func helperGetenv(name string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return Env[name]
+}
+
 func helperPanic(err error, s ...string) {
 	if err != nil {
 		s = append([]string{err.Error()}, s...)
@@ -1799,14 +2611,24 @@ func helperUsage(fs *flag.FlagSet) func() {
 			fmt.Println("")
 			fmt.Println("modes:")
 			fmt.Printf(MODE_FORMAT, MODE_COMBINED_SC, MODE_COMBINED_FULL, MODE_COMBINED_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_CERTS_SC, MODE_CERTS_FULL, MODE_CERTS_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_CONSISTENCY_SC, MODE_CONSISTENCY_FULL, MODE_CONSISTENCY_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_CONFIRM_SC, MODE_CONFIRM_FULL, MODE_CONFIRM_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_CONFIRMBATCH_SC, MODE_CONFIRMBATCH_FULL, MODE_CONFIRMBATCH_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_CONFIRMRAWAPI_SC, MODE_CONFIRMRAWAPI_FULL, MODE_CONFIRMRAWAPI_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_ENROLL_SC, MODE_ENROLL_FULL, MODE_ENROLL_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_HELP_SC, MODE_HELP_FULL, MODE_HELP_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_LISTENER_SC, MODE_LISTENER_FULL, MODE_LISTENER_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_MONITOR_SC, MODE_MONITOR_FULL, MODE_MONITOR_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_PROFILE_SC, MODE_PROFILE_FULL, MODE_PROFILE_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_REENROLL_SC, MODE_REENROLL_FULL, MODE_REENROLL_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_REGISTER_SC, MODE_REGISTER_FULL, MODE_REGISTER_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_RESUBMIT_SC, MODE_RESUBMIT_FULL, MODE_RESUBMIT_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_SUBMIT_SC, MODE_SUBMIT_FULL, MODE_SUBMIT_DESC)
 			fmt.Printf(MODE_FORMAT, MODE_SUBMITBATCH_SC, MODE_SUBMITBATCH_FULL, MODE_SUBMITBATCH_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_WALLETEXPORT_SC, MODE_WALLETEXPORT_FULL, MODE_WALLETEXPORT_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_WALLETIMPORT_SC, MODE_WALLETIMPORT_FULL, MODE_WALLETIMPORT_DESC)
+			fmt.Printf(MODE_FORMAT, MODE_WALLETLIST_SC, MODE_WALLETLIST_FULL, MODE_WALLETLIST_DESC)
 			fmt.Println("")
 			fmt.Println("use `" + os.Args[0] + " [mode] --help` for mode specific details")
 		} else {
@@ -1829,6 +2651,81 @@ func helperUsage(fs *flag.FlagSet) func() {
 	}
 }
 
+// helperAlert passes an alert of the monitor to -alert_cmd and -alert_webhook, their failures are
+// logged only, so that the monitor keeps running.
+func helperAlert(c *cfg.Config, alert fabric.MonitorAlert, state string) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		Lout(LOG_ERR, "unable to encode alert", err)
+		return
+	}
+
+	if command := c.Entries[OPT_MON_ALERT_CMD].Value.(string); len(command) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "bash", "-c", command)
+		cmd.Env = append(os.Environ(),
+			"TC_MIG_ALERT_KIND="+alert.Kind,
+			"TC_MIG_ALERT_CHANNEL="+alert.Channel,
+			"TC_MIG_ALERT_PEER="+alert.Peer,
+			"TC_MIG_ALERT_STATE="+state,
+			"TC_MIG_ALERT_MESSAGE="+alert.Message,
+		)
+		cmd.Stdin = bytes.NewReader(payload)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			Lout(LOG_ERR, "alert command failed", err, string(out))
+		} else {
+			Lout(LOG_DEBUG, "alert command", string(out))
+		}
+	}
+
+	if url := c.Entries[OPT_MON_WEBHOOK].Value.(string); len(url) > 0 {
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		req.Header.SetMethod("POST")
+		req.Header.SetContentType("application/json")
+		req.SetRequestURI(url)
+		req.SetBody(payload)
+		err := fasthttp.DoTimeout(req, resp, 10*time.Second)
+		switch {
+		case err != nil:
+			Lout(LOG_ERR, "alert webhook failed", url, err)
+		case resp.StatusCode() >= 300:
+			Lout(LOG_ERR, "alert webhook failed", url, resp.StatusCode(), string(resp.Body()))
+		}
+	}
+}
+
+// helperExpiry warns if the first certificate of certificatePEM expires within $TC_MIG_CERTS_WARNDAYS.
+func helperExpiry(name string, certificatePEM []byte) {
+	infos, err := fabric.ParseCertificates(certificatePEM)
+	if err != nil {
+		Lout(LOG_ERR, name, err)
+		return
+	}
+	switch days := infos[0].DaysLeft(time.Now()); {
+	case days <= 0:
+		Lout(LOG_ERR, name, infos[0].Subject, "expired at", infos[0].NotAfter.Format(time.RFC3339))
+	case days <= float64(Def_CertsWarnDays):
+		Lout(LOG_WARNING, name, infos[0].Subject, "expires in", int(days), "days at", infos[0].NotAfter.Format(time.RFC3339))
+	}
+}
+
+// helperWallet returns the wallet of -wallet with -passphrase, nil if the mode has none.
+func helperWallet(c *cfg.Config) *fabric.Wallet {
+	entry, ok := c.Entries[OPT_CA_WALLET]
+	if !ok || entry.Value == nil || len(entry.Value.(string)) == 0 {
+		return nil
+	}
+	return &fabric.Wallet{
+		Passphrase: []byte(c.Entries[OPT_WALLET_PASS].Value.(string)),
+		Path:       entry.Value.(string),
+	}
+}
+
 // endregion: generic
 // region: io
 
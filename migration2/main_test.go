@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/fabric/fabrictest"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: harness
+
+const (
+	testChaincode = "basic"
+	testChannel   = "testchannel"
+)
+
+// testMain is set in the environment of the test binary when it is started as migration2.
+const testMain = "TC_MIG_TEST_MAIN"
+
+// TestMain runs main instead of the tests when the test binary is started by command, so that
+// the modes are tested the way they are used: by their flags, output and exit status.
+func TestMain(m *testing.M) {
+	if os.Getenv(testMain) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// command returns the test binary started as migration2 with args. The environment is cleared,
+// flags can be set by variables of their name, and output goes to the buffers.
+func command(args ...string) (*exec.Cmd, *bytes.Buffer, *bytes.Buffer) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = []string{testMain + "=1", "PATH=" + os.Getenv("PATH")}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return cmd, stdout, stderr
+}
+
+// run runs migration2 with args and returns its exit status and what it wrote to stderr.
+func run(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	cmd, stdout, stderr := command(args...)
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		t.Fatal(err)
+	}
+	if testing.Verbose() {
+		t.Logf("%s\n%s%s", strings.Join(args, " "), stdout, stderr)
+	}
+	return cmd.ProcessState.ExitCode(), stderr.String()
+}
+
+// certificate parses the PEM certificate of the file.
+func certificate(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		t.Fatalf("%s: no PEM certificate", path)
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// writeCertificate writes a self-signed certificate of cn, expiring at notAfter, to path.
+func writeCertificate(t *testing.T, path, cn string, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		NotAfter:     notAfter,
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// network starts fake gateways as the peers of Org1 in a connection profile, peer0.org1 to
+// peerN.org1, with the identity of the first one, and returns them with the profile file.
+func network(t *testing.T, peers int) ([]*fabrictest.Gateway, string) {
+	t.Helper()
+	gws := make([]*fabrictest.Gateway, peers)
+	profile := &fabric.Profile{
+		Client:        fabric.ProfileClient{Organization: "Org1"},
+		Organizations: map[string]fabric.ProfileOrganization{"Org1": {MSPID: "Org1MSP"}},
+		Peers:         make(map[string]fabric.ProfilePeer),
+		Version:       fabric.ProfileVersion,
+	}
+	org := profile.Organizations["Org1"]
+	for i := range gws {
+		gws[i] = fabrictest.New(t)
+		name := fmt.Sprintf("peer%d.org1", i)
+		org.Peers = append(org.Peers, name)
+		profile.Peers[name] = fabric.ProfilePeer{
+			GRPCOptions: map[string]interface{}{fabric.ProfileSSLTargetOverride: gws[i].GatewayPeer},
+			TLSCACerts:  fabric.ProfilePEM{Path: gws[i].TLSCertPath},
+			URL:         "grpcs://" + gws[i].PeerEndpoint,
+		}
+	}
+	org.AdminPrivateKey, org.SignedCert = fabric.ProfilePEM{Path: gws[0].KeyPath}, fabric.ProfilePEM{Path: gws[0].CertPath}
+	profile.Organizations["Org1"] = org
+
+	file := filepath.Join(t.TempDir(), "connection.yaml")
+	if err := profile.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	return gws, file
+}
+
+// chain scripts qscc of the gateway with a chain of height blocks, the blocks from fork on
+// differ from those of every other chain, and returns the hash of its current block in hex.
+func chain(gw *fabrictest.Gateway, height, fork uint64) string {
+	headers := make([]*common.BlockHeader, height)
+	for n := range headers {
+		data := sha256.Sum256([]byte(fmt.Sprintf("block %d", n)))
+		if uint64(n) >= fork {
+			data = sha256.Sum256([]byte(fmt.Sprintf("block %d of %s", n, gw.PeerEndpoint)))
+		}
+		headers[n] = &common.BlockHeader{DataHash: data[:], Number: uint64(n)}
+		if n > 0 {
+			headers[n].PreviousHash = fabric.BlockHash(headers[n-1])
+		}
+	}
+	gw.Register("qscc", "GetChainInfo", func(stub *fabrictest.Stub) ([]byte, error) {
+		return proto.Marshal(&common.BlockchainInfo{
+			CurrentBlockHash:  fabric.BlockHash(headers[height-1]),
+			Height:            height,
+			PreviousBlockHash: headers[height-1].PreviousHash,
+		})
+	})
+	gw.Register("qscc", "GetBlockByNumber", func(stub *fabrictest.Stub) ([]byte, error) {
+		n, err := strconv.ParseUint(stub.Args[1], 10, 64)
+		if err != nil || n >= height {
+			return nil, fmt.Errorf("block %s not found", stub.Args[1])
+		}
+		return proto.Marshal(&common.Block{Data: &common.BlockData{}, Header: headers[n], Metadata: &common.BlockMetadata{}})
+	})
+	return fmt.Sprintf("%x", fabric.BlockHash(headers[height-1]))
+}
+
+// eventually polls condition until it holds or timeout passes.
+func eventually(t *testing.T, timeout time.Duration, condition func() bool) bool {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
+
+// endregion: harness
+// region: ca
+
+func TestCAModes(t *testing.T) {
+	ca := fabrictest.NewCA(t)
+	dir := t.TempDir()
+	wallet := filepath.Join(dir, "wallet")
+	flags := []string{"-loglevel", "7", "-" + OPT_CA_URL, ca.URL, "-" + OPT_CA_TLSCERT, ca.TLSCertPath}
+
+	// region: flag validation
+
+	for _, invalid := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{MODE_ENROLL_FULL, "-" + OPT_CA_SECRET, "adminpw", "-" + OPT_CA_MSP, dir}, "-id and -msp or -wallet are mandatory"},
+		{[]string{MODE_ENROLL_FULL, "-" + OPT_CA_ID, "admin", "-" + OPT_CA_SECRET, "adminpw"}, "-id and -msp or -wallet are mandatory"},
+		{[]string{MODE_ENROLL_FULL, "-" + OPT_CA_ID, "admin", "-" + OPT_CA_SECRET, "wrong", "-" + OPT_CA_MSP, dir}, "enrollment of -> admin"},
+		{[]string{MODE_REGISTER_FULL, "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "admin"}, "-id is mandatory"},
+		{[]string{MODE_REGISTER_FULL, "-" + OPT_CA_ID, "gw1", "-" + OPT_CA_ATTRS, "role", "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "admin"}, "invalid attribute 'role'"},
+		{[]string{MODE_REENROLL_FULL, "-" + OPT_FAB_CERT, filepath.Join(dir, "none.pem")}, "failed to read certificate file"},
+	} {
+		code, stderr := run(t, append(invalid.args, flags...)...)
+		if code != 1 || !strings.Contains(stderr, invalid.want) {
+			t.Errorf("%s: exit status %d, %q, want 1 and %q", strings.Join(invalid.args, " "), code, stderr, invalid.want)
+		}
+	}
+	if code, stderr := run(t, MODE_ENROLL_FULL, "-"+OPT_CA_MAXENROLLMENTS, "1"); code != 2 || !strings.Contains(stderr, "flag provided but not defined") {
+		t.Errorf("flag of another mode: exit status %d, %q", code, stderr)
+	}
+
+	// endregion: flag validation
+	// region: enroll
+
+	admin := filepath.Join(dir, "admin", "msp")
+	code, stderr := run(t, append([]string{MODE_ENROLL_FULL, "-" + OPT_CA_ID, "admin", "-" + OPT_CA_SECRET, "adminpw", "-" + OPT_CA_MSP, admin, "-" + OPT_CA_WALLET, wallet, "-" + OPT_WALLET_PASS, "secret"}, flags...)...)
+	if code != 0 {
+		t.Fatalf("enroll: exit status %d, %s", code, stderr)
+	}
+	if cert := certificate(t, filepath.Join(admin, "signcerts", "cert.pem")); cert.Subject.CommonName != "admin" {
+		t.Errorf("enrolled certificate of %s", cert.Subject.CommonName)
+	}
+	if _, _, err := fabric.ReadCredentials(filepath.Join(admin, "signcerts", "cert.pem"), filepath.Join(admin, "keystore")); err != nil {
+		t.Errorf("enrolled msp: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(admin, "cacerts", "ca.pem")); err != nil {
+		t.Errorf("enrolled msp: %s", err)
+	}
+	id, err := (&fabric.Wallet{Path: wallet}).Peek("admin")
+	if err != nil || id.MSPID != Def_FabMspId || id.Credentials.EncryptedPrivateKey == nil || len(id.Credentials.PrivateKey) > 0 {
+		t.Errorf("enrolled wallet identity: %+v, %v", id, err)
+	}
+
+	// endregion: enroll
+	// region: register
+
+	secret := filepath.Join(dir, "secret")
+	code, stderr = run(t, append([]string{MODE_REGISTER_FULL, "-" + OPT_CA_ID, "gw1", "-" + OPT_CA_ATTRS, "role=gateway:ecert", "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "admin", "-" + OPT_WALLET_PASS, "secret", "-" + OPT_IO_OUTPUT, secret}, flags...)...)
+	if code != 0 {
+		t.Fatalf("register: exit status %d, %s", code, stderr)
+	}
+	raw, err := os.ReadFile(secret)
+	if err != nil || len(strings.TrimSpace(string(raw))) == 0 {
+		t.Fatalf("registration secret: %q, %v", raw, err)
+	}
+	if code, stderr = run(t, append([]string{MODE_REGISTER_FULL, "-" + OPT_CA_ID, "gw2", "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "admin", "-" + OPT_WALLET_PASS, "wrong"}, flags...)...); code != 1 {
+		t.Errorf("register with a wrong passphrase: exit status %d, %s", code, stderr)
+	}
+
+	// endregion: register
+	// region: reenroll
+
+	gw1 := filepath.Join(dir, "gw1", "msp")
+	if code, stderr = run(t, append([]string{MODE_ENROLL_FULL, "-" + OPT_CA_ID, "gw1", "-" + OPT_CA_SECRET, strings.TrimSpace(string(raw)), "-" + OPT_CA_MSP, gw1}, flags...)...); code != 0 {
+		t.Fatalf("enroll registered identity: exit status %d, %s", code, stderr)
+	}
+	certPath, keystore := filepath.Join(gw1, "signcerts", "cert.pem"), filepath.Join(gw1, "keystore")
+	enrolled := certificate(t, certPath)
+
+	if code, stderr = run(t, append([]string{MODE_REENROLL_FULL, "-" + OPT_FAB_CERT, certPath, "-" + OPT_FAB_KEYSTORE, keystore}, flags...)...); code != 0 {
+		t.Fatalf("reenroll: exit status %d, %s", code, stderr)
+	}
+	renewed := certificate(t, certPath)
+	if renewed.Subject.CommonName != "gw1" || renewed.SerialNumber.Cmp(enrolled.SerialNumber) == 0 || ca.Calls("/api/v1/reenroll") != 1 {
+		t.Errorf("reenrolled certificate %s, serial %s, was %s", renewed.Subject.CommonName, renewed.SerialNumber, enrolled.SerialNumber)
+	}
+	if keys, _ := os.ReadDir(keystore); len(keys) != 1 {
+		t.Errorf("keystore after reenrollment: %d keys", len(keys))
+	}
+	if _, _, err := fabric.ReadCredentials(certPath, keystore); err != nil {
+		t.Errorf("reenrolled msp: %s", err)
+	}
+
+	// endregion: reenroll
+
+}
+
+// endregion: ca
+// region: certs
+
+func TestCertsMode(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	org1, org2 := filepath.Join(dir, "org1"), filepath.Join(dir, "org2")
+	certificates := []struct {
+		path   string
+		cn     string
+		expiry time.Time
+		status string
+	}{
+		{filepath.Join(org1, "users", "Admin@org1", "msp", "signcerts", "cert.pem"), "Admin@org1", now.Add(-24 * time.Hour), "EXPIRED"},
+		{filepath.Join(org1, "users", "User1@org1", "msp", "signcerts", "cert.pem"), "User1@org1", now.Add(10 * 24 * time.Hour), "EXPIRING"},
+		{filepath.Join(org2, "tls", "ca.crt"), "tlsca.org2", now.Add(100 * 24 * time.Hour), "OK"},
+		{filepath.Join(org1, "peers", "peer0.org1", "msp", "signcerts", "cert.pem"), "peer0.org1", now.Add(365 * 24 * time.Hour), "OK"},
+	}
+	for _, c := range certificates {
+		writeCertificate(t, c.path, c.cn, c.expiry)
+	}
+	// keystores and files without certificates are skipped
+	writeCertificate(t, filepath.Join(org1, "peers", "peer0.org1", "msp", "keystore", "priv_sk"), "key", now)
+	if err := os.WriteFile(filepath.Join(org1, "peers", "peer0.org1", "msp", "config.yaml"), []byte("NodeOUs:\n  Enable: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// region: flag validation
+
+	broken := filepath.Join(dir, "broken.pem")
+	if err := os.WriteFile(broken, []byte("-----BEGIN CERTIFICATE-----\nnot a certificate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"-" + OPT_IO_INPUT, filepath.Join(dir, "none")}, 1, "no such file or directory"},
+		{[]string{"-" + OPT_IO_INPUT, broken}, 1, broken},
+		{[]string{"-" + OPT_IO_INPUT, org1, "-" + OPT_CERTS_WARNDAYS, "soon"}, 2, "invalid value"},
+	} {
+		code, stderr := run(t, append([]string{MODE_CERTS_FULL}, invalid.args...)...)
+		if code != invalid.code || !strings.Contains(stderr, invalid.want) {
+			t.Errorf("%s: exit status %d, %q, want %d and %q", strings.Join(invalid.args, " "), code, stderr, invalid.code, invalid.want)
+		}
+	}
+
+	// endregion: flag validation
+	// region: report
+
+	// expired and expiring certificates are reported, not failed on
+	out := filepath.Join(dir, "certs")
+	if code, stderr := run(t, MODE_CERTS_SC, "-"+OPT_IO_INPUT, org1+", "+org2, "-"+OPT_CERTS_WARNDAYS, "30", "-"+OPT_IO_OUTPUT, out); code != 0 {
+		t.Fatalf("certs: exit status %d, %s", code, stderr)
+	}
+	raw, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	if len(lines) != len(certificates) {
+		t.Fatalf("certs: got\n%s", raw)
+	}
+	for i, c := range certificates {
+		fields := strings.Split(lines[i], "|")
+		if len(fields) != 6 || fields[0] != c.path || fields[1] != "CN="+c.cn || fields[2] != "CN="+c.cn || fields[3] != c.expiry.UTC().Format(time.RFC3339) || fields[5] != c.status {
+			t.Errorf("certificate %d: got %s, want %s of %s %s", i, lines[i], c.status, c.path, c.expiry.UTC().Format(time.RFC3339))
+		}
+	}
+
+	// endregion: report
+
+}
+
+// endregion: certs
+// region: consistency
+
+func TestConsistencyMode(t *testing.T) {
+	gws, profile := network(t, 2)
+	var hash string
+	ranges := []string{`[{"ID":"a","v":1},{"ID":"c","v":3}]`, `[{"ID":"a","v":1}]`}
+	for i, gw := range gws {
+		hash = chain(gw, 5, 5)
+		gw.SetState(testChannel, testChaincode, "a", []byte("1"))
+		gw.SetState(testChannel, testChaincode, "b", []byte(fmt.Sprint(i)))
+		gw.Register(testChaincode, "Get", func(stub *fabrictest.Stub) ([]byte, error) {
+			if value := stub.GetState(stub.Args[0]); value != nil {
+				return value, nil
+			}
+			return nil, fmt.Errorf("key %s not found", stub.Args[0])
+		})
+		result := []byte(ranges[i])
+		gw.Register(testChaincode, "GetRange", func(stub *fabrictest.Stub) ([]byte, error) {
+			return result, nil
+		})
+	}
+	dir := t.TempDir()
+	flags := []string{"-" + OPT_FAB_PROFILE, profile, "-" + OPT_FAB_CHANNEL, testChannel}
+
+	// region: flag validation
+
+	for _, invalid := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-" + OPT_CONS_PEERS, "peer0.org1"}, "a consistency check needs at least two peers, got 1"},
+		{[]string{"-" + OPT_CONS_PEERS, "peer0.org1,peer9.org1"}, "peer9.org1 is not in the connection profile"},
+		{[]string{"-" + OPT_FAB_ORG, "Org9"}, "Org9"},
+		{[]string{"-" + OPT_IO_INPUT, filepath.Join(dir, "none")}, "no such file or directory"},
+	} {
+		code, stderr := run(t, append(append([]string{MODE_CONSISTENCY_FULL}, flags...), invalid.args...)...)
+		if code != 1 || !strings.Contains(stderr, invalid.want) {
+			t.Errorf("%s: exit status %d, %q, want 1 and %q", strings.Join(invalid.args, " "), code, stderr, invalid.want)
+		}
+	}
+
+	// endregion: flag validation
+	// region: report
+
+	// report runs the mode and returns the lines of its report, inconsistencies are reported,
+	// not failed on
+	report := func(name string, args ...string) []string {
+		t.Helper()
+		out := filepath.Join(dir, name)
+		code, stderr := run(t, append(append([]string{MODE_CONSISTENCY_SC, "-" + OPT_FAB_CC, "", "-" + OPT_IO_OUTPUT, out}, flags...), args...)...)
+		if code != 0 {
+			t.Fatalf("%s: exit status %d, %s", name, code, stderr)
+		}
+		raw, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	}
+	// status returns the last field of the report lines starting with prefix, in order.
+	status := func(lines []string, prefix string) string {
+		statuses := make([]string, 0)
+		for _, line := range lines {
+			if strings.HasPrefix(line, prefix) {
+				statuses = append(statuses, line[strings.LastIndex(line, "|")+1:])
+			}
+		}
+		return strings.Join(statuses, ",")
+	}
+
+	lines := report("in sync")
+	if len(lines) != 2 || lines[0] != "peer|"+testChannel+"|peer0.org1|5|"+hash+"|OK" || lines[1] != "peer|"+testChannel+"|peer1.org1|5|"+hash+"|OK" {
+		t.Errorf("in sync: %q", lines)
+	}
+
+	chain(gws[1], 4, 4)
+	if lines = report("lagging"); status(lines, "peer|"+testChannel+"|peer1.org1|4|") != "LAGGING" || status(lines, "peer|"+testChannel+"|peer0.org1|5|") != "OK" {
+		t.Errorf("lagging: %q", lines)
+	}
+
+	chain(gws[1], 5, 2)
+	if lines = report("forked"); status(lines, "peer|") != "MISMATCH,MISMATCH" {
+		t.Errorf("forked: %q", lines)
+	}
+
+	// keys are compared from -keys, the submitted bundles of -in and the range of -start and -end
+	chain(gws[1], 5, 5)
+	submitted := filepath.Join(dir, "submitted")
+	bundles := STATUS_SUBMIT_OK + "|b|txid|response|payload\n" + STATUS_SUBMIT_ERROR_INVOKE + "|x|-|error|payload\n"
+	if err := os.WriteFile(submitted, []byte(bundles), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines = report("keys", "-"+OPT_FAB_CC, testChaincode, "-"+OPT_CONS_GET, "Get", "-"+OPT_CONS_KEYS, "a", "-"+OPT_IO_INPUT, submitted, "-"+OPT_CONS_SAMPLE, "0", "-"+OPT_CONS_RANGE, "GetRange", "-"+OPT_CONS_START, "a", "-"+OPT_PROC_KEYNAME, "ID")
+	if status(lines, "peer|") != "OK,OK" || status(lines, "key|"+testChannel+"|b|") != "DIVERGENT,DIVERGENT" || status(lines, "key|"+testChannel+"|c|") != "DIVERGENT,MISSING" || status(lines, "key|"+testChannel+"|a|") != "" || len(lines) != 6 {
+		t.Errorf("keys: %q", lines)
+	}
+
+	// endregion: report
+
+}
+
+// endregion: consistency
+// region: monitor
+
+func TestMonitorMode(t *testing.T) {
+	gws, profile := network(t, 2)
+	chain(gws[0], 10, 10)
+	chain(gws[1], 5, 5)
+	dir := t.TempDir()
+	flags := []string{"-" + OPT_FAB_PROFILE, profile, "-" + OPT_FAB_CHANNEL, testChannel, "-" + OPT_PROC_INTERVAL, "100ms"}
+
+	// region: flag validation
+
+	for _, invalid := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"-" + OPT_CONS_PEERS, "peer9.org1"}, 1, "peer9.org1 is not in the connection profile"},
+		{[]string{"-" + OPT_FAB_CHANNEL, " , "}, 1, "no channels to monitor"},
+		{[]string{"-" + OPT_PROC_INTERVAL, "0s"}, 1, "-interval must be positive"},
+		{[]string{"-" + OPT_MON_STALL, "soon"}, 2, "invalid value"},
+	} {
+		code, stderr := run(t, append(append([]string{MODE_MONITOR_FULL, "-" + OPT_MON_PORT, "0"}, flags...), invalid.args...)...)
+		if code != invalid.code || !strings.Contains(stderr, invalid.want) {
+			t.Errorf("%s: exit status %d, %q, want %d and %q", strings.Join(invalid.args, " "), code, stderr, invalid.code, invalid.want)
+		}
+	}
+
+	// endregion: flag validation
+	// region: start
+
+	var mutex sync.Mutex
+	posted := make([]fabric.MonitorAlert, 0)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alert := fabric.MonitorAlert{}
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("webhook: %s", err)
+		}
+		mutex.Lock()
+		posted = append(posted, alert)
+		mutex.Unlock()
+	}))
+	defer webhook.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	out, alerts := filepath.Join(dir, "out"), filepath.Join(dir, "alerts")
+	args := append([]string{
+		MODE_MONITOR_SC,
+		"-" + OPT_MON_ALERT_CMD, `echo "$TC_MIG_ALERT_KIND|$TC_MIG_ALERT_STATE|$TC_MIG_ALERT_PEER|$(cat)" >> ` + alerts,
+		"-" + OPT_MON_BIND, "127.0.0.1",
+		"-" + OPT_MON_LAG, "2",
+		"-" + OPT_MON_PORT, strconv.Itoa(port),
+		"-" + OPT_MON_WEBHOOK, webhook.URL,
+		"-" + OPT_IO_OUTPUT, out,
+	}, flags...)
+	cmd, stdout, stderr := command(args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill() })
+
+	// endregion: start
+	// region: metrics
+
+	metrics := func() string {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return string(raw)
+	}
+	lines := func(path string) []string {
+		raw, _ := os.ReadFile(path)
+		if len(raw) == 0 {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	}
+	want := []string{
+		`tc_monitor_up{peer="peer0.org1",channel="` + testChannel + `"} 1`,
+		`tc_monitor_height{peer="peer0.org1",channel="` + testChannel + `"} 10`,
+		`tc_monitor_height{peer="peer1.org1",channel="` + testChannel + `"} 5`,
+		`tc_monitor_alert{peer="peer1.org1",channel="` + testChannel + `",kind="` + fabric.MonitorAlertLagging + `"} 1`,
+	}
+	if !eventually(t, 10*time.Second, func() bool {
+		m := metrics()
+		for _, line := range want {
+			if !strings.Contains(m, line) {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Fatalf("metrics: got\n%s\nwant\n%s\n%s%s", metrics(), strings.Join(want, "\n"), stdout, stderr)
+	}
+
+	// endregion: metrics
+	// region: alerts
+
+	// the lag is raised and resolved once, and passed on to -alert_cmd and -alert_webhook
+	chain(gws[1], 10, 10)
+	if !eventually(t, 10*time.Second, func() bool { return len(lines(out)) == 2 && len(lines(alerts)) == 2 }) {
+		t.Fatalf("alerts: %q %q\n%s%s", lines(out), lines(alerts), stdout, stderr)
+	}
+	for i, state := range []string{"RAISED", "RESOLVED"} {
+		fields := strings.Split(lines(out)[i], "|")
+		if len(fields) != 7 || fields[0] != "alert" || fields[2] != fabric.MonitorAlertLagging || fields[3] != testChannel || fields[4] != "peer1.org1" || fields[5] != state {
+			t.Errorf("alert %d: %s", i, lines(out)[i])
+		}
+		if line := lines(alerts)[i]; !strings.HasPrefix(line, fabric.MonitorAlertLagging+"|"+state+"|peer1.org1|{") {
+			t.Errorf("alert command %d: %s", i, line)
+		}
+	}
+	if !eventually(t, 5*time.Second, func() bool { mutex.Lock(); defer mutex.Unlock(); return len(posted) == 2 }) {
+		t.Fatalf("webhook: %+v", posted)
+	}
+	mutex.Lock()
+	if posted[0].Kind != fabric.MonitorAlertLagging || posted[0].Resolved || !posted[1].Resolved || posted[1].Peer != "peer1.org1" {
+		t.Errorf("webhook: %+v", posted)
+	}
+	mutex.Unlock()
+
+	// endregion: alerts
+	// region: stop
+
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil || cmd.ProcessState.ExitCode() != 0 {
+		t.Errorf("interrupted monitor: %v\n%s%s", err, stdout, stderr)
+	}
+
+	// endregion: stop
+
+}
+
+// endregion: monitor
+// region: wallet
+
+func TestWalletModes(t *testing.T) {
+	gw := fabrictest.New(t)
+	dir := t.TempDir()
+	wallet := filepath.Join(dir, "wallet")
+	passphrase := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(passphrase, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	certificatePEM, keyPEM, err := fabric.ReadCredentials(gw.CertPath, gw.KeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// region: flag validation
+
+	for _, invalid := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{MODE_WALLETLIST_FULL}, "-wallet is mandatory"},
+		{[]string{MODE_WALLETIMPORT_FULL, "-" + OPT_CA_WALLET, wallet}, "-wallet and -label are mandatory"},
+		{[]string{MODE_WALLETIMPORT_FULL, "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "user", "-" + OPT_FAB_CERT, filepath.Join(dir, "none.pem")}, "failed to read certificate file"},
+		{[]string{MODE_WALLETEXPORT_FULL, "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "user", "-" + OPT_FAB_CERT, filepath.Join(dir, "cert.pem")}, "-wallet, -label, -cert and -keystore are mandatory"},
+		{[]string{MODE_WALLETEXPORT_FULL, "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "none", "-" + OPT_FAB_CERT, filepath.Join(dir, "cert.pem"), "-" + OPT_FAB_KEYSTORE, filepath.Join(dir, "key.pem")}, "none"},
+	} {
+		code, stderr := run(t, invalid.args...)
+		if code != 1 || !strings.Contains(stderr, invalid.want) {
+			t.Errorf("%s: exit status %d, %q, want 1 and %q", strings.Join(invalid.args, " "), code, stderr, invalid.want)
+		}
+	}
+
+	// endregion: flag validation
+	// region: import
+
+	for label, args := range map[string][]string{
+		"encrypted": {"-" + OPT_WALLET_PASS_FILE, passphrase},
+		"plain":     {},
+	} {
+		args = append([]string{MODE_WALLETIMPORT_FULL, "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, label, "-" + OPT_FAB_CERT, gw.CertPath, "-" + OPT_FAB_KEYSTORE, gw.KeyPath, "-" + OPT_FAB_MSPID, "Org2MSP"}, args...)
+		if code, stderr := run(t, args...); code != 0 {
+			t.Fatalf("import %s: exit status %d, %s", label, code, stderr)
+		}
+	}
+	if id, err := (&fabric.Wallet{Path: wallet}).Peek("encrypted"); err != nil || id.Credentials.EncryptedPrivateKey == nil || len(id.Credentials.PrivateKey) > 0 {
+		t.Errorf("identity imported with a passphrase: %+v, %v", id, err)
+	}
+
+	// endregion: import
+	// region: list
+
+	list := filepath.Join(dir, "list")
+	if code, stderr := run(t, MODE_WALLETLIST_SC, "-"+OPT_CA_WALLET, wallet, "-"+OPT_IO_OUTPUT, list); code != 0 {
+		t.Fatalf("list: exit status %d, %s", code, stderr)
+	}
+	raw, err := os.ReadFile(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := certificate(t, gw.CertPath).NotAfter.Format(time.RFC3339)
+	want := "encrypted|Org2MSP|User1@org1.example.com|" + expiry + "|true\n" + "plain|Org2MSP|User1@org1.example.com|" + expiry + "|false\n"
+	if string(raw) != want {
+		t.Errorf("list: got\n%swant\n%s", raw, want)
+	}
+
+	// endregion: list
+	// region: export
+
+	certPath, keyPath := filepath.Join(dir, "export", "cert.pem"), filepath.Join(dir, "export", "key.pem")
+	export := []string{MODE_WALLETEXPORT_FULL, "-" + OPT_CA_WALLET, wallet, "-" + OPT_CA_LABEL, "encrypted", "-" + OPT_FAB_CERT, certPath, "-" + OPT_FAB_KEYSTORE, keyPath}
+	if code, stderr := run(t, append(export, "-"+OPT_WALLET_PASS, "wrong")...); code != 1 {
+		t.Errorf("export with a wrong passphrase: exit status %d, %s", code, stderr)
+	}
+	if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+		t.Errorf("key exported with a wrong passphrase: %v", err)
+	}
+	if code, stderr := run(t, append(export, "-"+OPT_WALLET_PASS, "secret")...); code != 0 {
+		t.Fatalf("export: exit status %d, %s", code, stderr)
+	}
+	exportedCertificate, exportedKey, err := fabric.ReadCredentials(certPath, keyPath)
+	if err != nil || !bytes.Equal(exportedCertificate, certificatePEM) || !bytes.Equal(exportedKey, keyPEM) {
+		t.Errorf("exported credentials do not match the imported ones: %v", err)
+	}
+
+	// endregion: export
+
+}
+
+// endregion: wallet
@@ -0,0 +1,286 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+)
+
+// region: types
+
+// Log is an append-only audit trail in JSON lines, the current file is rotated once it
+// grows over MaxSize bytes, rotated files are never touched again unless MaxFiles is set.
+type Log struct {
+	Dir      string      `json:"Dir"`
+	Logger   *log.Logger `json:"-"`
+	MaxFiles int         `json:"MaxFiles"`
+	MaxSize  int64       `json:"MaxSize"`
+
+	file  *os.File   `json:"-"`
+	mutex sync.Mutex `json:"-"`
+	size  int64      `json:"-"`
+}
+
+type Entry struct {
+	ArgsHash   string    `json:"args_sha256,omitempty"`
+	Caller     string    `json:"caller"`
+	CallerType string    `json:"caller_type"`
+	Chaincode  string    `json:"chaincode,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+	Function   string    `json:"function,omitempty"`
+	Latency    float64   `json:"latency_ms"`
+	Org        string    `json:"org,omitempty"`
+	Outcome    string    `json:"outcome"`
+	RemoteAddr string    `json:"remote_addr"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	Time       time.Time `json:"ts"`
+	Txid       string    `json:"tx_id,omitempty"`
+}
+
+type Query struct {
+	Caller string
+	From   time.Time
+	Limit  int
+	To     time.Time
+	Txid   string
+}
+
+const (
+	OutcomeOK     = "ok"
+	OutcomeError  = "error"
+	OutcomeDenied = "denied"
+
+	current = "audit.jsonl"
+	prefix  = "audit-"
+	suffix  = ".jsonl"
+)
+
+// endregion: types
+// region: init, close
+
+func (l *Log) Init() (*Log, error) {
+	if l.Logger == nil {
+		return l, errors.New("audit.Log.Init() needs a logger")
+	}
+	if len(l.Dir) == 0 {
+		return l, errors.New("audit.Log.Init() needs a directory")
+	}
+	err := os.MkdirAll(l.Dir, 0700)
+	if err != nil {
+		return l, err
+	}
+	err = l.open()
+	if err != nil {
+		return l, err
+	}
+	l.Logger.Out(log.LOG_INFO, "audit log opened", filepath.Join(l.Dir, current))
+	return l, nil
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(filepath.Join(l.Dir, current), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+func (l *Log) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// endregion: init, close
+// region: write
+
+// Write appends the entry, l may be nil in which case auditing is disabled.
+func (l *Log) Write(e *Entry) {
+	if l == nil || e == nil {
+		return
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		l.Logger.Out(log.LOG_ERR, "audit entry", err)
+		return
+	}
+	raw = append(raw, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.MaxSize > 0 && l.size > 0 && l.size+int64(len(raw)) > l.MaxSize {
+		err = l.rotate()
+		if err != nil {
+			l.Logger.Out(log.LOG_ERR, "audit log rotation failed, keep appending to the current file", err)
+		}
+	}
+	n, err := l.file.Write(raw)
+	l.size += int64(n)
+	if err != nil {
+		l.Logger.Out(log.LOG_CRIT, "unable to write audit log", err, string(raw))
+	}
+}
+
+// rotate expects l.mutex to be held.
+func (l *Log) rotate() error {
+	err := l.file.Close()
+	if err != nil {
+		return err
+	}
+	rotated := filepath.Join(l.Dir, prefix+time.Now().UTC().Format("20060102T150405.000000000")+suffix)
+	err = os.Rename(filepath.Join(l.Dir, current), rotated)
+	if err != nil {
+		l.open()
+		return err
+	}
+	l.Logger.Out(log.LOG_INFO, "audit log rotated to", rotated)
+
+	if l.MaxFiles > 0 {
+		files, _ := l.rotated()
+		for len(files) > l.MaxFiles {
+			os.Remove(files[0])
+			files = files[1:]
+		}
+	}
+	return l.open()
+}
+
+// rotated lists the rotated files, oldest first.
+func (l *Log) rotated() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(l.Dir, prefix+"*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// endregion: write
+// region: search
+
+// Search scans the rotated and the current file, newest entries first, and returns at most
+// q.Limit entries matching every non-zero field of q.
+func (l *Log) Search(q Query) ([]Entry, error) {
+	if l == nil {
+		return nil, errors.New("audit log is disabled")
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+
+	files, err := l.rotated()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, filepath.Join(l.Dir, current))
+
+	found := make([]Entry, 0)
+	for i := len(files) - 1; i >= 0 && len(found) < q.Limit; i-- {
+		entries, err := l.scan(files[i], q)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(entries) - 1; j >= 0 && len(found) < q.Limit; j-- {
+			found = append(found, entries[j])
+		}
+	}
+	return found, nil
+}
+
+func (l *Log) scan(name string, q Query) ([]Entry, error) {
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if q.match(&e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (q *Query) match(e *Entry) bool {
+	switch {
+	case len(q.Txid) > 0 && e.Txid != q.Txid:
+		return false
+	case len(q.Caller) > 0 && e.Caller != q.Caller:
+		return false
+	case !q.From.IsZero() && e.Time.Before(q.From):
+		return false
+	case !q.To.IsZero() && e.Time.After(q.To):
+		return false
+	}
+	return true
+}
+
+// endregion: search
+// region: helpers
+
+// HashArgs returns the hex sha256 of the json encoded argument list, so that the log proves
+// what was sent without storing payloads.
+func HashArgs(args []string) string {
+	if args == nil {
+		args = []string{}
+	}
+	raw, _ := json.Marshal(args)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Outcome classifies an http status code.
+func Outcome(status int) string {
+	switch {
+	case status == 401 || status == 403:
+		return OutcomeDenied
+	case status >= 400:
+		return OutcomeError
+	}
+	return OutcomeOK
+}
+
+// Latency converts a duration into milliseconds.
+func Latency(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// IsAdminRoute tells whether the path is under /admin, admin calls are always audited.
+func IsAdminRoute(path string) bool {
+	return path == "/admin" || strings.HasPrefix(path, "/admin/")
+}
+
+// endregion: helpers
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+)
+
+func newLog(t *testing.T, maxSize int64, maxFiles int) *Log {
+	t.Helper()
+	logger := log.NewLogger()
+	t.Cleanup(func() { logger.Close() })
+
+	l := &Log{Dir: t.TempDir(), Logger: logger, MaxFiles: maxFiles, MaxSize: maxSize}
+	if _, err := l.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// entry is the i-th entry of a test, a minute after the previous one, callers and tx ids take
+// turns.
+func entry(i int) *Entry {
+	return &Entry{
+		Caller:  []string{"erp", "ops"}[i%2],
+		Outcome: OutcomeOK,
+		Route:   "POST /invoke",
+		Status:  200,
+		Time:    start.Add(time.Duration(i) * time.Minute),
+		Txid:    fmt.Sprintf("tx%d", i),
+	}
+}
+
+func TestRotation(t *testing.T) {
+	l := newLog(t, 400, 2)
+	for i := 0; i < 20; i++ {
+		l.Write(entry(i))
+	}
+
+	files, err := l.rotated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d rotated files are kept, want 2: %v", len(files), files)
+	}
+	for _, name := range append(files, filepath.Join(l.Dir, current)) {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > l.MaxSize {
+			t.Errorf("%s is %d bytes, over %d", name, info.Size(), l.MaxSize)
+		}
+	}
+
+	// the pruned files are not searched, the newest entry is in the current file
+	entries, err := l.Search(Query{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) >= 20 || entries[0].Txid != "tx19" {
+		t.Errorf("%d entries after pruning, newest %+v", len(entries), entries)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	l := newLog(t, 400, 0)
+	for i := 0; i < 20; i++ {
+		l.Write(entry(i))
+	}
+	if files, _ := l.rotated(); len(files) < 3 {
+		t.Fatalf("the entries are not spread across rotated files: %v", files)
+	}
+
+	txids := func(entries []Entry) []string {
+		ids := make([]string, 0, len(entries))
+		for _, e := range entries {
+			ids = append(ids, e.Txid)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"everything, newest first", Query{Limit: 3}, []string{"tx19", "tx18", "tx17"}},
+		{"tx id in a rotated file", Query{Txid: "tx1"}, []string{"tx1"}},
+		{"caller", Query{Caller: "ops", Limit: 4}, []string{"tx19", "tx17", "tx15", "tx13"}},
+		{"time range across files", Query{From: start.Add(2 * time.Minute), To: start.Add(5 * time.Minute)}, []string{"tx5", "tx4", "tx3", "tx2"}},
+		{"caller and time range", Query{Caller: "erp", From: start.Add(2 * time.Minute), To: start.Add(5 * time.Minute)}, []string{"tx4", "tx2"}},
+		{"nothing", Query{Txid: "tx20"}, []string{}},
+	} {
+		entries, err := l.Search(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := txids(entries); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	var disabled *Log
+	disabled.Write(entry(0))
+	if _, err := disabled.Search(Query{}); err == nil {
+		t.Error("search of a disabled audit log")
+	}
+}
+
+func TestHashArgs(t *testing.T) {
+	// sha256 of ["k1","v1"] and of []
+	if got := HashArgs([]string{"k1", "v1"}); got != "d58ce7d3759b45503322e95d86f3bc7c93c1bfc71a6cc93042d84d33865b66ec" {
+		t.Errorf("hash of k1, v1: %s", got)
+	}
+	if got := HashArgs(nil); got != "4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945" || got != HashArgs([]string{}) {
+		t.Errorf("hash of no arguments: %s", got)
+	}
+	if HashArgs([]string{"k1", "v1"}) == HashArgs([]string{"k1v1"}) || HashArgs([]string{"a,b"}) == HashArgs([]string{"a", "b"}) {
+		t.Error("different argument lists hash the same")
+	}
+}
@@ -0,0 +1,271 @@
+package certs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+)
+
+// region: types
+
+// Source returns the PEM of the certificates to watch by name, Certificates is called on every
+// check so that rotated certificates are picked up. A name without PEM is reported as
+// unreadable. Org labels the certificates of an org, it is empty for those of the instance.
+type Source struct {
+	Certificates func() map[string][]byte
+	Org          string
+}
+
+// Monitor parses the certificates of its sources at Init and every Check, and logs a warning
+// when one of them gets within a threshold of WarnDays of its expiry, escalating with every
+// lower threshold crossed: LOG_WARNING for the first, LOG_ERR for those in between, LOG_CRIT
+// for the last one and LOG_ALERT once it has expired. Each threshold is logged once per
+// certificate.
+type Monitor struct {
+	Check    time.Duration `json:"Check"`
+	Logger   *log.Logger   `json:"-"`
+	Sources  []Source      `json:"-"`
+	WarnDays []int         `json:"WarnDays"`
+
+	certificates []Certificate  `json:"-"`
+	checked      time.Time      `json:"-"`
+	mutex        sync.RWMutex   `json:"-"`
+	stop         chan struct{}  `json:"-"`
+	warned       map[string]int `json:"-"`
+}
+
+// Certificate is a watched certificate, a bundle has an entry for each of its certificates
+// under the same name.
+type Certificate struct {
+	tc.CertificateInfo
+	DaysLeft float64 `json:"days_left"`
+	Error    string  `json:"error,omitempty"`
+	Name     string  `json:"name"`
+	Org      string  `json:"org,omitempty"`
+}
+
+// Status is the state of the watched certificates, Expiring counts those within the highest
+// threshold, Expired those past their expiry, unreadable ones are Errors.
+type Status struct {
+	Certificates []Certificate `json:"certificates"`
+	Checked      time.Time     `json:"checked"`
+	Errors       int           `json:"errors"`
+	Expired      int           `json:"expired"`
+	Expiring     int           `json:"expiring"`
+	MinDaysLeft  *float64      `json:"min_days_left"`
+}
+
+// Summary is the Status without the certificates, for the unauthenticated health check.
+type Summary struct {
+	Checked     time.Time `json:"checked"`
+	Errors      int       `json:"errors"`
+	Expired     int       `json:"expired"`
+	Expiring    int       `json:"expiring"`
+	MinDaysLeft *float64  `json:"min_days_left"`
+}
+
+// endregion: types
+// region: init
+
+func (m *Monitor) Init() (*Monitor, error) {
+	if m.Logger == nil {
+		return m, errors.New("certs.Monitor.Init() needs a logger")
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(m.WarnDays)))
+	m.warned = make(map[string]int)
+	m.Refresh()
+
+	if m.Check > 0 {
+		stop := make(chan struct{})
+		m.stop = stop
+		go func() {
+			ticker := time.NewTicker(m.Check)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					m.Refresh()
+				}
+			}
+		}()
+	}
+	return m, nil
+}
+
+// Close stops the periodic checks.
+func (m *Monitor) Close() {
+	if m != nil && m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// ParseWarnDays parses a , separated list of thresholds in days, eg. 30,14,7,1.
+func ParseWarnDays(raw string) ([]int, error) {
+	days := make([]int, 0)
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid threshold '%s', must be a positive number of days", field)
+		}
+		days = append(days, n)
+	}
+	return days, nil
+}
+
+// endregion: init
+// region: check
+
+// Refresh parses the certificates of the sources again and logs the thresholds crossed since
+// the previous check.
+func (m *Monitor) Refresh() {
+	now := time.Now()
+	certificates := make([]Certificate, 0)
+	for _, source := range m.Sources {
+		for name, bundle := range source.Certificates() {
+			infos, err := tc.ParseCertificates(bundle)
+			if err != nil {
+				m.Logger.Out(log.LOG_ERR, fmt.Sprintf("certificate %s is unreadable: %s", name, err))
+				certificates = append(certificates, Certificate{Error: err.Error(), Name: name, Org: source.Org})
+				continue
+			}
+			for _, info := range infos {
+				certificates = append(certificates, Certificate{CertificateInfo: info, Name: name, Org: source.Org})
+			}
+		}
+	}
+	sort.SliceStable(certificates, func(i, j int) bool {
+		if certificates[i].Name != certificates[j].Name {
+			return certificates[i].Name < certificates[j].Name
+		}
+		return certificates[i].NotAfter.Before(certificates[j].NotAfter)
+	})
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.certificates = certificates
+	m.checked = now
+	for _, c := range certificates {
+		if len(c.Error) == 0 {
+			m.warn(c, now)
+		}
+	}
+}
+
+// warn logs c if it crossed a threshold it has not been logged for yet, the mutex is held.
+func (m *Monitor) warn(c Certificate, now time.Time) {
+	days := c.CertificateInfo.DaysLeft(now)
+	level := -1
+	for i, threshold := range m.WarnDays {
+		if days <= float64(threshold) {
+			level = i
+		}
+	}
+	if days <= 0 {
+		level = len(m.WarnDays)
+	}
+	key := c.Name + "/" + c.Serial
+	if previous, ok := m.warned[key]; level < 0 || (ok && previous >= level) {
+		return
+	}
+	m.warned[key] = level
+
+	var severity syslog.Priority
+	switch {
+	case level == len(m.WarnDays):
+		m.Logger.Out(log.LOG_ALERT, fmt.Sprintf("certificate %s (%s) expired at %s", c.Name, c.Subject, c.NotAfter.Format(time.RFC3339)))
+		return
+	case level == len(m.WarnDays)-1 && level > 0:
+		severity = log.LOG_CRIT
+	case level > 0:
+		severity = log.LOG_ERR
+	default:
+		severity = log.LOG_WARNING
+	}
+	m.Logger.Out(severity, fmt.Sprintf("certificate %s (%s) expires in %.1f days at %s, within %d days", c.Name, c.Subject, days, c.NotAfter.Format(time.RFC3339), m.WarnDays[level]))
+}
+
+// endregion: check
+// region: report
+
+// Status returns the certificates of the last check with their days to expiry as of now.
+func (m *Monitor) Status() Status {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now()
+	status := Status{Certificates: make([]Certificate, 0, len(m.certificates)), Checked: m.checked}
+	for _, c := range m.certificates {
+		if len(c.Error) > 0 {
+			status.Errors++
+			status.Certificates = append(status.Certificates, c)
+			continue
+		}
+		c.DaysLeft = c.CertificateInfo.DaysLeft(now)
+		switch {
+		case c.DaysLeft <= 0:
+			status.Expired++
+		case len(m.WarnDays) > 0 && c.DaysLeft <= float64(m.WarnDays[0]):
+			status.Expiring++
+		}
+		if status.MinDaysLeft == nil || c.DaysLeft < *status.MinDaysLeft {
+			days := c.DaysLeft
+			status.MinDaysLeft = &days
+		}
+		status.Certificates = append(status.Certificates, c)
+	}
+	return status
+}
+
+// Ready returns the summary of the Status and whether none of the certificates has expired, see
+// http.AdminSetup.Ready.
+func (m *Monitor) Ready() (interface{}, bool) {
+	status := m.Status()
+	summary := Summary{Checked: status.Checked, Errors: status.Errors, Expired: status.Expired, Expiring: status.Expiring, MinDaysLeft: status.MinDaysLeft}
+	return summary, status.Expired == 0
+}
+
+// Metrics writes the days to expiry of the certificates in the Prometheus text format.
+func (m *Monitor) Metrics(w io.Writer) {
+	status := m.Status()
+
+	fmt.Fprintln(w, "# HELP tc_rawapi_certificate_expiry_days Days until the certificate expires, negative once it has expired.")
+	fmt.Fprintln(w, "# TYPE tc_rawapi_certificate_expiry_days gauge")
+	for _, c := range status.Certificates {
+		if len(c.Error) == 0 {
+			fmt.Fprintf(w, "tc_rawapi_certificate_expiry_days{org=%s,name=%s,subject=%s,issuer=%s,serial=%s} %.3f\n", quote(c.Org), quote(c.Name), quote(c.Subject), quote(c.Issuer), quote(c.Serial), c.DaysLeft)
+		}
+	}
+	fmt.Fprintln(w, "# HELP tc_rawapi_certificate_not_after_seconds Expiry of the certificate as a unix timestamp.")
+	fmt.Fprintln(w, "# TYPE tc_rawapi_certificate_not_after_seconds gauge")
+	for _, c := range status.Certificates {
+		if len(c.Error) == 0 {
+			fmt.Fprintf(w, "tc_rawapi_certificate_not_after_seconds{org=%s,name=%s,subject=%s,issuer=%s,serial=%s} %d\n", quote(c.Org), quote(c.Name), quote(c.Subject), quote(c.Issuer), quote(c.Serial), c.NotAfter.Unix())
+		}
+	}
+	fmt.Fprintln(w, "# HELP tc_rawapi_certificate_errors Configured certificates that could not be read or parsed.")
+	fmt.Fprintln(w, "# TYPE tc_rawapi_certificate_errors gauge")
+	fmt.Fprintf(w, "tc_rawapi_certificate_errors %d\n", status.Errors)
+}
+
+// quote returns value as a Prometheus label value.
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// endregion: report
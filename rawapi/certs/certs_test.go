@@ -0,0 +1,150 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+)
+
+// certificate returns the PEM of a self-signed certificate of cn expiring after validity.
+func certificate(t *testing.T, cn string, serial int64, validity time.Duration) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		NotAfter:     time.Now().Add(validity),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestMonitor(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "rawapi.log")
+	logger := log.NewLogger()
+	if _, err := logger.NewCh(log.ChConfig{File: logFile}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	logged := func(name string) []string {
+		t.Helper()
+		raw, err := os.ReadFile(logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := make([]string, 0)
+		for _, line := range strings.Split(string(raw), "\n") {
+			if strings.Contains(line, "certificate "+name+" (") {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+
+	var mutex sync.Mutex
+	identity := certificate(t, "alice", 1, 20*24*time.Hour)
+	bundle := append(certificate(t, "root", 2, 365*24*time.Hour), certificate(t, "intermediate", 3, 12*time.Hour)...)
+	source := func() map[string][]byte {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return map[string][]byte{
+			"identity": identity,
+			"bundle":   bundle,
+			"broken":   []byte("-----BEGIN CERTIFICATE-----\n"),
+		}
+	}
+	rotate := func(serial int64, validity time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		identity = certificate(t, "alice", serial, validity)
+	}
+
+	monitor := &Monitor{Logger: logger, Sources: []Source{{Certificates: source, Org: "org1"}}, WarnDays: []int{7, 30, 14}}
+	if _, err := monitor.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer monitor.Close()
+
+	status := monitor.Status()
+	if status.Expiring != 2 || status.Expired != 0 || status.Errors != 1 || len(status.Certificates) != 4 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if status.MinDaysLeft == nil || *status.MinDaysLeft > 0.5 || *status.MinDaysLeft < 0.4 {
+		t.Errorf("%v days left of the first certificate to expire, want about half a day", status.MinDaysLeft)
+	}
+	if lines := logged("bundle"); len(lines) != 1 || !strings.Contains(lines[0], "__CRIT__") || !strings.Contains(lines[0], "CN=intermediate") {
+		t.Errorf("intermediate of the bundle is logged as %q, want once critical", lines)
+	}
+
+	// every threshold is logged once, with the severity escalating as the expiry gets closer
+	for i, step := range []struct {
+		validity time.Duration
+		severity string
+		message  string
+	}{
+		{20 * 24 * time.Hour, "__WARNING__", "within 30 days"},
+		{10 * 24 * time.Hour, "__ERR__", "within 14 days"},
+		{3 * 24 * time.Hour, "__CRIT__", "within 7 days"},
+		{-time.Minute, "__ALERT__", "expired at"},
+	} {
+		if i > 0 {
+			rotate(int64(10+i), step.validity)
+		}
+		monitor.Refresh()
+		monitor.Refresh()
+		lines := logged("identity")
+		if last := lines[len(lines)-1]; !strings.Contains(last, step.severity) || !strings.Contains(last, step.message) {
+			t.Errorf("certificate valid for %s is logged as %q, want %s %s", step.validity, last, step.severity, step.message)
+		}
+	}
+	if lines := logged("identity"); len(lines) != 4 {
+		t.Errorf("thresholds are logged more than once: %q", lines)
+	}
+	if status := monitor.Status(); status.Expired != 1 {
+		t.Errorf("expired certificate is not counted: %+v", status)
+	}
+
+	metrics := &bytes.Buffer{}
+	monitor.Metrics(metrics)
+	for _, metric := range []string{
+		`tc_rawapi_certificate_expiry_days{org="org1",name="bundle",subject="CN=root",issuer="CN=root",serial="2"} 36`,
+		`tc_rawapi_certificate_expiry_days{org="org1",name="identity",subject="CN=alice",issuer="CN=alice",serial="d"} -0.0`,
+		`tc_rawapi_certificate_not_after_seconds{org="org1",name="bundle",subject="CN=intermediate",issuer="CN=intermediate",serial="3"} `,
+		"tc_rawapi_certificate_errors 1",
+	} {
+		if !strings.Contains(metrics.String(), metric) {
+			t.Errorf("%s is not in the metrics:\n%s", metric, metrics)
+		}
+	}
+}
+
+func TestParseWarnDays(t *testing.T) {
+	if days, err := ParseWarnDays(" 30, 14,,7 "); err != nil || len(days) != 3 || days[0] != 30 || days[2] != 7 {
+		t.Errorf("got %v, %v", days, err)
+	}
+	for _, raw := range []string{"30,x", "0", "-1"} {
+		if _, err := ParseWarnDays(raw); err == nil {
+			t.Errorf("%q is accepted", raw)
+		}
+	}
+}
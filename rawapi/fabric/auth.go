@@ -0,0 +1,96 @@
+// region: packages
+
+package fabric
+
+import (
+	"fmt"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/audit"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"google.golang.org/grpc/codes"
+)
+
+// endregion: packages
+// region: authorize
+
+// authorize checks the permissions of the caller against the channel, chaincode and function of
+// the request and picks the client to transact with, it responds with 403 and returns false if
+// the caller is not allowed or its identity is not available.
+func (setup *OrgSetup) authorize(request *request) bool {
+	ctx := request.response.CTX
+	caller := http.CallerOf(ctx)
+
+	entry := http.AuditOf(ctx)
+	entry.ArgsHash = audit.HashArgs(request.form.Args)
+	entry.Chaincode = request.form.Chaincode
+	entry.Channel = request.form.Channel
+	entry.Function = request.form.Function
+
+	if !caller.Permissions.Allow(request.form.Channel, request.form.Chaincode, request.form.Function) {
+		setup.Logger.Out(log.LOG_WARNING, ctx.ID(), fmt.Sprintf("%s caller %s is not allowed to call %s:%s:%s", caller.Type, caller.Name, request.form.Channel, request.form.Chaincode, request.form.Function))
+		request.error(&tc.ResponseError{
+			Details: make([]map[string]string, 0),
+			Message: fmt.Sprintf("%s is not allowed to call %s on %s/%s", caller.Name, request.form.Function, request.form.Channel, request.form.Chaincode),
+			Status:  codes.PermissionDenied,
+			Type:    "auth",
+		})
+		return false
+	}
+
+	client, err := setup.clientFor(caller.Identity)
+	if err != nil {
+		setup.Logger.Out(log.LOG_ERR, ctx.ID(), fmt.Sprintf("identity %s of caller %s: %s", caller.Identity, caller.Name, err))
+		request.error(&tc.ResponseError{
+			Details: make([]map[string]string, 0),
+			Message: fmt.Sprintf("identity of %s is not available", caller.Name),
+			Status:  codes.PermissionDenied,
+			Type:    "auth",
+		})
+		return false
+	}
+	request.client = client
+	request.form.identity = caller.Identity
+	request.timeouts = setup.Timeouts.For(request.form.Chaincode, request.form.Function)
+
+	return true
+}
+
+// endregion: authorize
+// region: identities
+
+// clientFor returns the client of the wallet identity, the default one if label is empty, clients
+// are created on first use and share the gRPC connection of the default client.
+func (setup *OrgSetup) clientFor(label string) (*tc.Client, error) {
+	if len(label) == 0 {
+		return setup.client, nil
+	}
+	if setup.Wallet == nil {
+		return nil, fmt.Errorf("no wallet configured for identity %s", label)
+	}
+
+	setup.identitiesMutex.Lock()
+	defer setup.identitiesMutex.Unlock()
+
+	if client, ok := setup.identities[label]; ok {
+		return client, nil
+	}
+	id, err := setup.Wallet.Get(label)
+	if err != nil {
+		return nil, err
+	}
+	client, err := setup.client.WithIdentity(id)
+	if err != nil {
+		return nil, err
+	}
+	if setup.identities == nil {
+		setup.identities = make(map[string]*tc.Client)
+	}
+	setup.identities[label] = client
+	setup.Logger.Out(log.LOG_INFO, fmt.Sprintf("gateway opened for wallet identity %s of %s", label, id.MSPID))
+
+	return client, nil
+}
+
+// endregion: identities
@@ -0,0 +1,277 @@
+// region: packages
+
+package fabric
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+)
+
+// endregion: packages
+// region: types
+
+type Cache struct {
+	Functions  string        `json:"Functions"`
+	Invalidate bool          `json:"Invalidate"`
+	Logger     *log.Logger   `json:"-"`
+	Size       int           `json:"Size"`
+	TTL        time.Duration `json:"TTL"`
+
+	allow     map[string]time.Duration      `json:"-"`
+	blocks    map[string]uint64             `json:"-"`
+	items     map[string]*list.Element      `json:"-"`
+	listeners map[string]context.CancelFunc `json:"-"`
+	lru       *list.List                    `json:"-"`
+	mutex     sync.Mutex                    `json:"-"`
+}
+
+type cacheEntry struct {
+	body      []byte
+	chaincode string
+	channel   string
+	etag      string
+	expires   time.Time
+	key       string
+}
+
+// endregion: types
+// region: init
+
+// Init parses the allowlist, which is a comma separated list of chaincode:function
+// pairs with an optional =ttl suffix, eg. "te-food-bundles:BundleGet=30s,qscc:GetChainInfo".
+func (c *Cache) Init() (*Cache, error) {
+	if c.Logger == nil {
+		return c, fmt.Errorf("Cache.Init() needs a logger")
+	}
+	if c.Size <= 0 {
+		return c, fmt.Errorf("cache size must be positive, got %d", c.Size)
+	}
+
+	c.allow = make(map[string]time.Duration)
+	for _, item := range strings.Split(c.Functions, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		ttl := c.TTL
+		if kv := strings.SplitN(item, "=", 2); len(kv) == 2 {
+			d, err := time.ParseDuration(kv[1])
+			if err != nil {
+				return c, fmt.Errorf("invalid ttl in cache allowlist entry '%s': %w", item, err)
+			}
+			item, ttl = kv[0], d
+		}
+		if strings.Count(item, ":") != 1 {
+			return c, fmt.Errorf("cache allowlist entry '%s' must be in chaincode:function format", item)
+		}
+		c.allow[item] = ttl
+	}
+
+	c.blocks = make(map[string]uint64)
+	c.items = make(map[string]*list.Element)
+	c.listeners = make(map[string]context.CancelFunc)
+	c.lru = list.New()
+
+	return c, nil
+}
+
+// endregion: init
+// region: get, set
+
+// ttl returns whether chaincode:function is allowlisted and for how long its responses live.
+func (c *Cache) ttl(chaincode, function string) (time.Duration, bool) {
+	if c == nil || c.allow == nil {
+		return 0, false
+	}
+	ttl, ok := c.allow[chaincode+":"+function]
+	return ttl, ok
+}
+
+func (c *Cache) key(f *form) string {
+	return strings.Join(append([]string{f.identity, f.Channel, f.Chaincode, f.Function, f.ProtoDecode}, f.Args...), "\x00")
+}
+
+func (c *Cache) get(f *form) (*cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.items[c.key(f)]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+// set caches the body unless a block arrived on the channel after listen returned seen, as the
+// body may predate it, the entry is returned for its ETag either way.
+func (c *Cache) set(f *form, ttl time.Duration, body []byte, seen uint64) *cacheEntry {
+	sum := sha256.Sum256(body)
+	entry := &cacheEntry{
+		body:      body,
+		chaincode: f.Chaincode,
+		channel:   f.Channel,
+		etag:      `"` + hex.EncodeToString(sum[:16]) + `"`,
+		expires:   time.Now().Add(ttl),
+		key:       c.key(f),
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.blocks[f.Channel] != seen {
+		return entry
+	}
+	if element, ok := c.items[entry.key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return entry
+	}
+	c.items[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.Size {
+		c.remove(c.lru.Back())
+	}
+	return entry
+}
+
+// remove expects c.mutex to be held.
+func (c *Cache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	delete(c.items, entry.key)
+	c.lru.Remove(element)
+}
+
+// Purge drops the cached responses of the chaincodes on the channel, or every cached response of
+// the channel if no chaincode is given.
+func (c *Cache) Purge(channel string, chaincodes ...string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	purged := 0
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		if entry := element.Value.(*cacheEntry); entry.channel == channel && (len(chaincodes) == 0 || contains(chaincodes, entry.chaincode)) {
+			c.remove(element)
+			purged++
+		}
+		element = next
+	}
+	return purged
+}
+
+// endregion: get, set
+// region: etag
+
+func (e *cacheEntry) match(ifNoneMatch string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == e.etag {
+			return true
+		}
+	}
+	return false
+}
+
+// endregion: etag
+// region: invalidation
+
+// listen starts a block event listener on the channel, unless there is one already or
+// invalidation is disabled. Every new block purges the qscc entries of the channel, which
+// describe its chain, and those of the chaincodes the block wrote to, public state or private
+// data, the rest live until their ttl. A block that upgrades a chaincode, updates the channel
+// config or can't be decoded purges every entry of the channel. It returns the number of blocks
+// seen on the channel so far, for set to tell whether a result is still current.
+func (c *Cache) listen(client *tc.Client, channel string) uint64 {
+	if !c.Invalidate {
+		return 0
+	}
+
+	c.mutex.Lock()
+	if _, ok := c.listeners[channel]; ok {
+		seen := c.blocks[channel]
+		c.mutex.Unlock()
+		return seen
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.listeners[channel] = cancel
+	seen := c.blocks[channel]
+	c.mutex.Unlock()
+
+	logger := c.Logger.Out
+	events, err := client.BlockEvents(ctx, channel, nil)
+	if err != nil {
+		logger(log.LOG_ERR, fmt.Sprintf("unable to listen for block events on %s, cache invalidation falls back to ttl: %s", channel, err))
+		c.unlisten(channel)
+		return seen
+	}
+
+	go func() {
+		defer c.unlisten(channel)
+		logger(log.LOG_INFO, "cache invalidation listener started", channel)
+		for block := range events {
+			c.mutex.Lock()
+			c.blocks[channel]++
+			c.mutex.Unlock()
+
+			writes, other, err := tc.BlockWrites(block)
+			if err != nil {
+				logger(log.LOG_WARNING, fmt.Sprintf("unable to decode block %d on %s, purging every cached response of the channel: %s", block.GetHeader().GetNumber(), channel, err))
+			}
+			chaincodes := []string{"qscc"}
+			for namespace := range writes {
+				chaincodes = append(chaincodes, namespace)
+			}
+
+			purged := 0
+			if err != nil || other || writes["_lifecycle"] {
+				purged = c.Purge(channel)
+			} else {
+				purged = c.Purge(channel, chaincodes...)
+			}
+			logger(log.LOG_DEBUG, fmt.Sprintf("block %d on %s purged %d cached responses", block.GetHeader().GetNumber(), channel, purged))
+		}
+		logger(log.LOG_NOTICE, "cache invalidation listener closed", channel)
+		c.mutex.Lock()
+		c.blocks[channel]++
+		c.mutex.Unlock()
+		c.Purge(channel)
+	}()
+
+	return seen
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cache) unlisten(channel string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if cancel, ok := c.listeners[channel]; ok {
+		cancel()
+		delete(c.listeners, channel)
+	}
+}
+
+// endregion: invalidation
@@ -0,0 +1,143 @@
+// region: packages
+
+package fabric
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/valyala/fasthttp"
+)
+
+// endregion: packages
+// region: types
+
+const (
+	ConsistencyGetFunction   string = "BundleGet"
+	ConsistencyKeyField      string = "bundle_id"
+	ConsistencyRangeFunction string = "BundleGetRange"
+)
+
+// endregion: types
+// region: handler
+
+//
+// Consistency handles GET /admin/consistency?channels=&peers=&chaincode=&keys=&get=&range=&start=
+// &end=&key_field= which compares the height and the block hashes of the , separated channels
+// across the peers, ConsistencyPeers if peers is empty, and, if a chaincode is given, the values
+// of keys through get (ConsistencyGetFunction) and of the keys between start and end through
+// range (ConsistencyRangeFunction), whose objects are keyed by key_field (ConsistencyKeyField).
+// Every peer is evaluated on through its own gateway with the identity of the org, peers of the
+// same org are listed under shared_orgs of the report, as their keys are compared per org only.
+//
+
+func (setup *OrgSetup) Consistency(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	if err := setup.validate(response); err != nil {
+		response.Status = fasthttp.StatusServiceUnavailable
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+
+	// region: check
+
+	args := ctx.QueryArgs()
+	check := &tc.ConsistencyCheck{
+		Chaincode:   string(args.Peek("chaincode")),
+		Channels:    splitList(string(args.Peek("channels"))),
+		Context:     http.ContextOf(ctx),
+		GetFunction: string(args.Peek("get")),
+		KeyField:    string(args.Peek("key_field")),
+		Keys:        splitList(string(args.Peek("keys"))),
+		RangeEnd:    string(args.Peek("end")),
+		RangeStart:  string(args.Peek("start")),
+	}
+	if len(check.Keys) > 0 && len(check.GetFunction) == 0 {
+		check.GetFunction = ConsistencyGetFunction
+	}
+	if args.Has("range") || args.Has("start") || args.Has("end") {
+		check.RangeFunction = string(args.Peek("range"))
+		if len(check.RangeFunction) == 0 {
+			check.RangeFunction = ConsistencyRangeFunction
+		}
+		if len(check.KeyField) == 0 {
+			check.KeyField = ConsistencyKeyField
+		}
+	}
+	if len(check.Chaincode) == 0 && (len(check.Keys) > 0 || len(check.RangeFunction) > 0) {
+		response.Status = fasthttp.StatusBadRequest
+		response.Message = errors.New("comparing keys needs a chaincode")
+		response.Send(nil)
+		return
+	}
+	if len(check.Channels) == 0 {
+		response.Status = fasthttp.StatusBadRequest
+		response.Message = errors.New("missing channels")
+		response.Send(nil)
+		return
+	}
+
+	peers := splitList(setup.ConsistencyPeers)
+	if args.Has("peers") {
+		peers = splitList(string(args.Peek("peers")))
+	}
+	var err error
+	check.Peers, err = setup.consistencyPeers(peers)
+	if err != nil {
+		response.Status = fasthttp.StatusBadRequest
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+	for _, p := range check.Peers {
+		defer p.Client.Close()
+		if err := p.Client.Init(); err != nil {
+			response.Status = fasthttp.StatusBadGateway
+			response.Message = fmt.Errorf("peer %s: %w", p.Name, err)
+			response.Send(nil)
+			return
+		}
+	}
+
+	// endregion: check
+	// region: report
+
+	report := check.Run()
+	status := "OK"
+	if !report.Consistent {
+		status = "INCONSISTENT"
+		setup.Logger.Out(log.LOG_WARNING, ctx.ID(), fmt.Sprintf("peers %s are inconsistent on %s", strings.Join(report.Peers, ", "), strings.Join(check.Channels, ", ")))
+	}
+
+	response.Message = message{ID: "-", Status: status, Result: report}
+	response.SendJSON(nil)
+
+	// endregion: report
+}
+
+// endregion: handler
+// region: helpers
+
+// consistencyPeers resolves the peers to compare, see tc.ConsistencyPeers, peers are looked up in
+// the connection profile of the org, if it has one.
+func (setup *OrgSetup) consistencyPeers(peers []string) ([]tc.ConsistencyPeer, error) {
+	return tc.ConsistencyPeers(peers, setup.profile, setup.client)
+}
+
+// splitList splits a , separated list, empty items are dropped.
+func splitList(raw string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// endregion: helpers
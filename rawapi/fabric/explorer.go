@@ -0,0 +1,230 @@
+// region: packages
+
+package fabric
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/grpc/codes"
+)
+
+// endregion: packages
+// region: types
+
+const (
+	ExplorerPageSize    uint64 = 10
+	ExplorerPageSizeMax uint64 = 100
+)
+
+type messageBlocks struct {
+	Blocks  []tc.BlockSummary `json:"blocks"`
+	Channel string            `json:"channel"`
+	From    uint64            `json:"from"`
+	Height  uint64            `json:"height"`
+	To      uint64            `json:"to"`
+}
+
+// endregion: types
+// region: handlers
+
+//
+// Info handles GET /channels/{channel}/info with the height and the hashes at the top of the chain.
+//
+
+func (setup *OrgSetup) Info(ctx *fasthttp.RequestCtx) {
+	request, ok := setup.explorerRequest(ctx, "qscc", "GetChainInfo")
+	if !ok {
+		return
+	}
+
+	info, responseErr := request.client.ChainInfo(http.ContextOf(ctx), request.timeouts, request.form.Channel)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+
+	request.response.Message = message{ID: "-", Status: "OK", Result: info}
+	request.response.SendJSON(nil)
+}
+
+//
+// Blocks handles GET /channels/{channel}/blocks?from=&to= with block summaries, the latest
+// ExplorerPageSize blocks by default, at most ExplorerPageSizeMax blocks at once.
+//
+
+func (setup *OrgSetup) Blocks(ctx *fasthttp.RequestCtx) {
+	request, ok := setup.explorerRequest(ctx, "qscc", "GetBlockByNumber")
+	if !ok {
+		return
+	}
+	logger := setup.Logger.Out
+
+	// region: range
+
+	info, responseErr := request.client.ChainInfo(http.ContextOf(ctx), request.timeouts, request.form.Channel)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+	if info.Height == 0 {
+		request.error(explorerError(codes.NotFound, "channel %s has no blocks", request.form.Channel))
+		return
+	}
+
+	to := info.Height - 1
+	if ctx.QueryArgs().Has("to") {
+		n, err := ctx.QueryArgs().GetUint("to")
+		if err != nil {
+			request.error(explorerError(codes.InvalidArgument, "invalid 'to' block number: %s", ctx.QueryArgs().Peek("to")))
+			return
+		}
+		if uint64(n) < to {
+			to = uint64(n)
+		}
+	}
+
+	from := uint64(0)
+	if to >= ExplorerPageSize {
+		from = to - ExplorerPageSize + 1
+	}
+	if ctx.QueryArgs().Has("from") {
+		n, err := ctx.QueryArgs().GetUint("from")
+		if err != nil {
+			request.error(explorerError(codes.InvalidArgument, "invalid 'from' block number: %s", ctx.QueryArgs().Peek("from")))
+			return
+		}
+		from = uint64(n)
+	}
+	if from > to {
+		request.error(explorerError(codes.InvalidArgument, "invalid block range %d-%d, height is %d", from, to, info.Height))
+		return
+	}
+	if to-from >= ExplorerPageSizeMax {
+		to = from + ExplorerPageSizeMax - 1
+	}
+	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("blocks %d-%d of %s", from, to, request.form.Channel))
+
+	// endregion: range
+	// region: fetch
+
+	blocks, responseErr := request.client.Blocks(http.ContextOf(ctx), request.timeouts, request.form.Channel, from, to)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+
+	// endregion: fetch
+
+	request.response.Message = message{
+		ID:     "-",
+		Status: "OK",
+		Result: messageBlocks{
+			Blocks:  blocks,
+			Channel: request.form.Channel,
+			From:    from,
+			Height:  info.Height,
+			To:      to,
+		},
+	}
+	request.response.SendJSON(nil)
+}
+
+//
+// Block handles GET /channels/{channel}/blocks/{number} with per-transaction summaries.
+//
+
+func (setup *OrgSetup) Block(ctx *fasthttp.RequestCtx) {
+	request, ok := setup.explorerRequest(ctx, "qscc", "GetBlockByNumber")
+	if !ok {
+		return
+	}
+
+	raw := fmt.Sprint(ctx.UserValue("number"))
+	number, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		request.error(explorerError(codes.InvalidArgument, "invalid block number: %s", raw))
+		return
+	}
+	request.form.Args = append(request.form.Args, raw)
+
+	block, responseErr := request.client.Block(http.ContextOf(ctx), request.timeouts, request.form.Channel, number)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+
+	request.response.Message = message{ID: "-", Status: "OK", Result: block}
+	request.response.SendJSON(nil)
+}
+
+//
+// Transaction handles GET /channels/{channel}/tx/{tx_id} with the decoded processed transaction,
+// its validation code, creator, endorsers, invocation, read/write sets and events.
+//
+
+func (setup *OrgSetup) Transaction(ctx *fasthttp.RequestCtx) {
+	request, ok := setup.explorerRequest(ctx, "qscc", "GetTransactionByID")
+	if !ok {
+		return
+	}
+
+	txid := fmt.Sprint(ctx.UserValue("tx_id"))
+	request.form.Args = append(request.form.Args, txid)
+	request.audit(txid)
+
+	tx, responseErr := request.client.Transaction(http.ContextOf(ctx), request.timeouts, request.form.Channel, txid)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+
+	request.response.Message = message{ID: tx.Txid, Status: tx.Validation, Result: tx}
+	request.response.SendJSON(nil)
+}
+
+// endregion: handlers
+// region: helpers
+
+// explorerRequest validates the setup and builds the request from the route parameters.
+func (setup *OrgSetup) explorerRequest(ctx *fasthttp.RequestCtx, chaincode, function string) (*request, bool) {
+	request := &request{
+		response: &http.Response{
+			CTX:    ctx,
+			Logger: setup.Logger,
+		},
+	}
+	request.err = setup.validate(request.response)
+	if request.err != nil {
+		return nil, false
+	}
+
+	channel := fmt.Sprint(ctx.UserValue("channel"))
+	request.form = &form{
+		Args:      []string{channel},
+		Chaincode: chaincode,
+		Channel:   channel,
+		Function:  function,
+	}
+	setup.Logger.Out(log.LOG_INFO, ctx.ID(), fmt.Sprintf("explorer request %s on %s", ctx.Path(), channel))
+
+	if !setup.authorize(request) {
+		return nil, false
+	}
+	return request, true
+}
+
+func explorerError(code codes.Code, format string, a ...interface{}) *tc.ResponseError {
+	return &tc.ResponseError{
+		Details: make([]map[string]string, 0),
+		Message: fmt.Sprintf(format, a...),
+		Status:  code,
+		Type:    "explorer",
+	}
+}
+
+// endregion: helpers
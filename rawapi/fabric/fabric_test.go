@@ -0,0 +1,1848 @@
+package fabric_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/audit"
+	"github.com/SandorMiskey/TrustChain/rawapi/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/fabric/fabrictest"
+	rpc "github.com/SandorMiskey/TrustChain/rawapi/grpc"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/SandorMiskey/TrustChain/rawapi/pb"
+	"github.com/SandorMiskey/TrustChain/rawapi/queue"
+	"github.com/SandorMiskey/TrustChain/rawapi/webhook"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer/lifecycle"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: harness
+
+const (
+	testChannel   = "trustchain-test"
+	testChaincode = "basic"
+	testKey       = "test-key"
+)
+
+// api is rawapi wired the way main does it, against a fake gateway, served over an in-memory
+// listener through the real router.
+type api struct {
+	client  *fasthttp.Client
+	gateway *fabrictest.Gateway
+	org     *fabric.OrgSetup
+}
+
+type reply struct {
+	Details []map[string]string `json:"Details"`
+	ID      string              `json:"tx_id"`
+	Result  json.RawMessage     `json:"result"`
+	Status  string              `json:"status"`
+}
+
+// newAPI wires the api, options are applied to the org setup before it is initialized.
+func newAPI(t *testing.T, options ...func(*fabric.OrgSetup)) *api {
+	t.Helper()
+
+	gw := fabrictest.New(t)
+	gw.Register(testChaincode, "Put", func(stub *fabrictest.Stub) ([]byte, error) {
+		if len(stub.Args) != 2 {
+			return nil, errors.New("Put needs a key and a value")
+		}
+		stub.PutState(stub.Args[0], []byte(stub.Args[1]))
+		stub.SetEvent("Put", []byte(stub.Args[0]))
+		return []byte(`{"key":"` + stub.Args[0] + `"}`), nil
+	})
+	gw.Register(testChaincode, "Get", func(stub *fabrictest.Stub) ([]byte, error) {
+		value := stub.GetState(stub.Args[0])
+		if value == nil {
+			return nil, errors.New("no such key " + stub.Args[0])
+		}
+		return value, nil
+	})
+
+	logger := log.NewLogger()
+	t.Cleanup(func() { logger.Close() })
+
+	org := &fabric.OrgSetup{
+		CertPath:     gw.CertPath,
+		GatewayPeer:  gw.GatewayPeer,
+		KeyPath:      gw.KeyPath,
+		Lator:        &tc.Lator{},
+		Logger:       logger,
+		MSPID:        gw.MSPID,
+		OrgName:      "org1",
+		PeerEndpoint: gw.PeerEndpoint,
+		TLSCertPath:  gw.TLSCertPath,
+	}
+	for _, option := range options {
+		option(org)
+	}
+	if _, err := org.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(org.Close)
+	worker, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	go org.QueueRun(worker)
+
+	router := &http.RouterSetup{Auth: &http.Authenticator{Key: testKey}, Logger: logger}
+	if _, err := router.RouterInit(); err != nil {
+		t.Fatal(err)
+	}
+	router.Routes.POST("/invoke", org.Invoke)
+	router.Routes.POST("/simulate", org.Simulate)
+	router.Routes.GET("/query", org.Query)
+	router.Routes.GET("/transactions/:tx_id/status", org.TransactionStatus)
+	router.Routes.POST("/transactions/:tx_id/resubmit", org.TransactionResubmit)
+	router.Routes.GET("/queue/:queue_id", org.QueueItem)
+	router.Routes.GET("/admin/queue", router.AdminOnly(org.QueueList))
+	router.Routes.POST("/admin/queue/:queue_id/replay", router.AdminOnly(org.QueueReplay))
+	router.Routes.DELETE("/admin/queue/:queue_id", router.AdminOnly(org.QueueDrop))
+	router.Routes.GET("/admin/consistency", router.AdminOnly(org.Consistency))
+	router.Routes.GET("/channels/:channel/info", org.Info)
+	router.Routes.GET("/channels/:channel/blocks", org.Blocks)
+	router.Routes.GET("/channels/:channel/blocks/:number", org.Block)
+	router.Routes.GET("/channels/:channel/tx/:tx_id", org.Transaction)
+	router.Routes.GET("/channels/:channel/chaincodes", org.ChaincodeDefinitions)
+	router.Routes.GET("/channels/:channel/chaincodes/:name/approved", org.ApprovedChaincodeDefinition)
+
+	return &api{
+		client:  serve(t, router),
+		gateway: gw,
+		org:     org,
+	}
+}
+
+// serve serves the router over an in-memory listener and returns a client connected to it.
+func serve(t *testing.T, router *http.RouterSetup) *fasthttp.Client {
+	t.Helper()
+
+	listener := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: router.Router.Handler}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown() })
+
+	return &fasthttp.Client{Dial: func(string) (net.Conn, error) { return listener.Dial() }}
+}
+
+// do sends the form to path, as query args for GET and as a form body for POST, as the default
+// caller unless header names another.
+func (a *api) do(t *testing.T, method, path string, form url.Values, header map[string]string) (int, *reply) {
+	t.Helper()
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(method)
+	if method == fasthttp.MethodGet {
+		req.SetRequestURI("http://rawapi" + path + "?" + form.Encode())
+	} else {
+		req.SetRequestURI("http://rawapi" + path)
+		req.Header.SetContentType("application/x-www-form-urlencoded")
+		req.SetBodyString(form.Encode())
+	}
+	req.Header.Set("X-API-Key", testKey)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	if err := a.client.DoTimeout(req, resp, 10*time.Second); err != nil {
+		t.Fatalf("%s %s: %s", method, path, err)
+	}
+	out := &reply{}
+	if err := json.Unmarshal(resp.Body(), out); err != nil {
+		t.Fatalf("%s %s: unexpected body %q: %s", method, path, resp.Body(), err)
+	}
+	return resp.StatusCode(), out
+}
+
+func withTimeouts(t *testing.T, overrides string) func(*fabric.OrgSetup) {
+	return func(org *fabric.OrgSetup) {
+		org.Timeouts = &fabric.Timeouts{Overrides: overrides}
+		if _, err := org.Timeouts.Init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func withQueue(t *testing.T) func(*fabric.OrgSetup) {
+	return func(org *fabric.OrgSetup) {
+		org.Queue = &queue.Queue{
+			Backoff:     10 * time.Millisecond,
+			BackoffMax:  50 * time.Millisecond,
+			Logger:      org.Logger,
+			MaxAttempts: 5,
+			Path:        filepath.Join(t.TempDir(), "queue.db"),
+			Poll:        10 * time.Millisecond,
+		}
+		if _, err := org.Queue.Init(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { org.Queue.Close() })
+	}
+}
+
+func withTransactions(t *testing.T) func(*fabric.OrgSetup) {
+	return func(org *fabric.OrgSetup) {
+		org.Transactions = &fabric.Transactions{Logger: org.Logger, Size: 16, TTL: time.Minute}
+		if _, err := org.Transactions.Init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func withCache(t *testing.T, functions string, invalidate bool) func(*fabric.OrgSetup) {
+	return func(org *fabric.OrgSetup) {
+		org.Cache = &fabric.Cache{Functions: functions, Invalidate: invalidate, Logger: org.Logger, Size: 16, TTL: time.Hour}
+		if _, err := org.Cache.Init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func form(function string, args ...string) url.Values {
+	return url.Values{
+		"args":      args,
+		"chaincode": {testChaincode},
+		"channel":   {testChannel},
+		"function":  {function},
+	}
+}
+
+// endregion: harness
+// region: http
+
+func TestInvokeAndQuery(t *testing.T) {
+	a := newAPI(t)
+
+	code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", `{"v":1}`), nil)
+	if code != fasthttp.StatusOK || out.Status != "OK" || len(out.ID) == 0 {
+		t.Fatalf("invoke: %d %+v", code, out)
+	}
+	if string(out.Result) != `{"key":"k1"}` {
+		t.Errorf("invoke result: %s", out.Result)
+	}
+	if got := a.gateway.State(testChannel, testChaincode, "k1"); string(got) != `{"v":1}` {
+		t.Errorf("state after invoke: %s", got)
+	}
+
+	code, out = a.do(t, fasthttp.MethodGet, "/query", form("Get", "k1"), nil)
+	if code != fasthttp.StatusOK || string(out.Result) != `{"v":1}` {
+		t.Fatalf("query: %d %+v %s", code, out, out.Result)
+	}
+}
+
+func TestSimulateDoesNotSubmit(t *testing.T) {
+	a := newAPI(t)
+
+	code, out := a.do(t, fasthttp.MethodPost, "/simulate", form("Put", "k1", "v1"), nil)
+	if code != fasthttp.StatusOK || out.Status != "SIMULATED" {
+		t.Fatalf("simulate: %d %+v", code, out)
+	}
+	if a.gateway.Calls(fabrictest.PhaseSubmit) != 0 || a.gateway.State(testChannel, testChaincode, "k1") != nil {
+		t.Error("simulated transaction was submitted")
+	}
+}
+
+func TestChaincodeError(t *testing.T) {
+	a := newAPI(t)
+
+	code, out := a.do(t, fasthttp.MethodGet, "/query", form("Get", "missing"), nil)
+	if code != fasthttp.StatusBadRequest || !strings.Contains(string(out.Result), "no such key missing") {
+		t.Fatalf("query of missing key: %d %+v %s", code, out, out.Result)
+	}
+}
+
+func TestEndorseError(t *testing.T) {
+	a := newAPI(t)
+	a.gateway.Fail(fabrictest.PhaseEndorse, a.gateway.Error(codes.Aborted, "endorsement policy not satisfied"))
+
+	code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	if code != fasthttp.StatusBadRequest || out.Status != codes.Aborted.String() {
+		t.Fatalf("invoke with endorse error: %d %+v", code, out)
+	}
+	if len(out.Details) != 1 || out.Details[0]["mspId"] != a.gateway.MSPID {
+		t.Errorf("gateway error details are lost: %+v", out.Details)
+	}
+	if a.gateway.Calls(fabrictest.PhaseSubmit) != 0 {
+		t.Error("transaction was submitted after failed endorsement")
+	}
+}
+
+func TestSubmitError(t *testing.T) {
+	a := newAPI(t)
+	a.gateway.Fail(fabrictest.PhaseSubmit, a.gateway.Error(codes.Unavailable, "no orderer"))
+
+	code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	if code != fasthttp.StatusBadRequest || out.Status != codes.Unavailable.String() || len(out.ID) < 2 {
+		t.Fatalf("invoke with submit error: %d %+v", code, out)
+	}
+	if a.gateway.State(testChannel, testChaincode, "k1") != nil {
+		t.Error("failed submit changed the state")
+	}
+}
+
+func TestRequestTimeoutHeader(t *testing.T) {
+	a := newAPI(t)
+	a.gateway.Delay(fabrictest.PhaseEvaluate, 5*time.Second)
+
+	start := time.Now()
+	code, out := a.do(t, fasthttp.MethodGet, "/query", form("Get", "k1"), map[string]string{http.TimeoutHeader: "200ms"})
+	if code != fasthttp.StatusBadRequest || out.Status != codes.DeadlineExceeded.String() {
+		t.Fatalf("delayed query: %d %+v", code, out)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("deadline of the header was not honoured, took %s", elapsed)
+	}
+}
+
+func TestTimeoutOverride(t *testing.T) {
+	a := newAPI(t, withTimeouts(t, testChaincode+":Put/endorse=200ms"))
+	a.gateway.Delay(fabrictest.PhaseEndorse, 5*time.Second)
+
+	code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	if code != fasthttp.StatusBadRequest || out.Status != codes.DeadlineExceeded.String() {
+		t.Fatalf("delayed invoke: %d %+v", code, out)
+	}
+	if a.gateway.Calls(fabrictest.PhaseSubmit) != 0 {
+		t.Error("transaction was submitted after endorsement timed out")
+	}
+}
+
+func TestExplorerTimeouts(t *testing.T) {
+	a := newAPI(t, withTimeouts(t, "qscc=200ms"))
+	a.gateway.Delay(fabrictest.PhaseEvaluate, 5*time.Second)
+	a.gateway.Delay(fabrictest.PhaseEvaluate, 5*time.Second)
+
+	// qscc calls are bound by the override, _lifecycle ones by the header
+	start := time.Now()
+	code, out := a.do(t, fasthttp.MethodGet, "/channels/"+testChannel+"/blocks", nil, nil)
+	if code != fasthttp.StatusBadRequest || out.Status != codes.DeadlineExceeded.String() {
+		t.Fatalf("delayed blocks: %d %+v", code, out)
+	}
+	code, out = a.do(t, fasthttp.MethodGet, "/channels/"+testChannel+"/chaincodes", nil, map[string]string{http.TimeoutHeader: "200ms"})
+	if code != fasthttp.StatusBadRequest || out.Status != codes.DeadlineExceeded.String() {
+		t.Fatalf("delayed chaincode definitions: %d %+v", code, out)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("timeouts were not honoured, took %s", elapsed)
+	}
+}
+
+func TestResubmitSameTransaction(t *testing.T) {
+	a := newAPI(t, withTransactions(t))
+	a.gateway.Fail(fabrictest.PhaseSubmit, a.gateway.Error(codes.Unavailable, "orderer is down"))
+
+	code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	if code != fasthttp.StatusBadRequest || len(out.ID) < 2 {
+		t.Fatalf("invoke with submit error: %d %+v", code, out)
+	}
+	txid := out.ID
+
+	code, out = a.do(t, fasthttp.MethodGet, "/transactions/"+txid+"/status", nil, map[string]string{http.TimeoutHeader: "100ms"})
+	if code != fasthttp.StatusAccepted || out.Status != "PENDING" {
+		t.Fatalf("status of a lost transaction: %d %+v", code, out)
+	}
+
+	for i := 0; i < 2; i++ {
+		code, out = a.do(t, fasthttp.MethodPost, "/transactions/"+txid+"/resubmit", nil, nil)
+		if code != fasthttp.StatusOK || out.ID != txid {
+			t.Fatalf("resubmit #%d: %d %+v", i, code, out)
+		}
+	}
+	if a.gateway.Calls(fabrictest.PhaseEndorse) != 1 || a.gateway.Height(testChannel) != 2 {
+		t.Errorf("resubmit created another transaction: %d endorsements, height %d", a.gateway.Calls(fabrictest.PhaseEndorse), a.gateway.Height(testChannel))
+	}
+
+	code, out = a.do(t, fasthttp.MethodGet, "/transactions/"+txid+"/status", nil, nil)
+	if code != fasthttp.StatusOK || out.Status != "VALID" {
+		t.Fatalf("status after resubmit: %d %+v", code, out)
+	}
+}
+
+func TestCache(t *testing.T) {
+	a := newAPI(t, withCache(t, testChaincode+":Get,"+testChaincode+":Echo=50ms", false))
+	a.gateway.Register(testChaincode, "Echo", func(stub *fabrictest.Stub) ([]byte, error) {
+		return []byte(`"` + stub.Args[0] + `"`), nil
+	})
+	if code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", `"v1"`), nil); code != fasthttp.StatusOK {
+		t.Fatalf("invoke: %d %+v", code, out)
+	}
+
+	// query expects the result of function and the number of times the gateway evaluates it
+	query := func(function, result string, evaluations int) {
+		t.Helper()
+		before := a.gateway.Calls(fabrictest.PhaseEvaluate)
+		code, out := a.do(t, fasthttp.MethodGet, "/query", form(function, "k1"), nil)
+		if code != fasthttp.StatusOK || string(out.Result) != `"`+result+`"` {
+			t.Fatalf("query %s: %d %+v", function, code, out)
+		}
+		if got := a.gateway.Calls(fabrictest.PhaseEvaluate) - before; got != evaluations {
+			t.Errorf("query %s is evaluated %d times, want %d", function, got, evaluations)
+		}
+	}
+
+	query("Get", "v1", 1)
+	query("Get", "v1", 0)
+	query("Echo", "k1", 1)
+
+	// a block of another chaincode or channel leaves the entries alone, one of the chaincode
+	// purges them
+	if purged := a.org.Cache.Purge(testChannel, "other"); purged != 0 {
+		t.Errorf("block of another chaincode purged %d entries", purged)
+	}
+	if purged := a.org.Cache.Purge("other", testChaincode); purged != 0 {
+		t.Errorf("block of another channel purged %d entries", purged)
+	}
+	query("Get", "v1", 0)
+	if code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", `"v2"`), nil); code != fasthttp.StatusOK {
+		t.Fatalf("invoke: %d %+v", code, out)
+	}
+	query("Get", "v1", 0)
+	if purged := a.org.Cache.Purge(testChannel, "other", testChaincode); purged != 2 {
+		t.Errorf("block of the chaincode purged %d entries, want 2", purged)
+	}
+	query("Get", "v2", 1)
+
+	// otherwise entries live until their ttl
+	query("Echo", "k1", 1)
+	query("Echo", "k1", 0)
+	time.Sleep(100 * time.Millisecond)
+	query("Echo", "k1", 1)
+	query("Get", "v2", 0)
+
+	if purged := a.org.Cache.Purge(testChannel); purged != 2 {
+		t.Errorf("purge of the channel dropped %d entries, want 2", purged)
+	}
+}
+
+// TestCacheInvalidation checks that a new block purges the qscc entries of the channel and those
+// of the chaincode it wrote to, and that a matching ETag is answered with 304 on a miss as well.
+func TestCacheInvalidation(t *testing.T) {
+	a := newAPI(t, withCache(t, testChaincode+":Get,qscc:GetChainInfo", true))
+	a.gateway.Register("other", "Put", func(stub *fabrictest.Stub) ([]byte, error) {
+		stub.PutState(stub.Args[0], []byte(stub.Args[1]))
+		return []byte(`{}`), nil
+	})
+	a.gateway.Register("qscc", "GetChainInfo", func(stub *fabrictest.Stub) ([]byte, error) {
+		return []byte(`"info"`), nil
+	})
+	if code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", `"v1"`), nil); code != fasthttp.StatusOK {
+		t.Fatalf("invoke: %d %+v", code, out)
+	}
+
+	// get queries chaincode:function and returns the status, the ETag and the result, after the
+	// number of times the gateway evaluated it
+	get := func(chaincode, function, ifNoneMatch string) (int, string, string, int) {
+		t.Helper()
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		query := form(function, "k1")
+		query.Set("chaincode", chaincode)
+		req.SetRequestURI("http://rawapi/query?" + query.Encode())
+		req.Header.Set("X-API-Key", testKey)
+		if len(ifNoneMatch) > 0 {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		before := a.gateway.Calls(fabrictest.PhaseEvaluate)
+		if err := a.client.DoTimeout(req, resp, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		out := &reply{}
+		if resp.StatusCode() == fasthttp.StatusOK {
+			if err := json.Unmarshal(resp.Body(), out); err != nil {
+				t.Fatalf("unexpected body %q: %s", resp.Body(), err)
+			}
+		}
+		return resp.StatusCode(), string(resp.Header.Peek("ETag")), string(out.Result), a.gateway.Calls(fabrictest.PhaseEvaluate) - before
+	}
+	// purged waits for the listener to purge the entry of chaincode:function
+	purged := func(chaincode, function string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if _, _, _, evaluated := get(chaincode, function, ""); evaluated > 0 {
+				return
+			}
+		}
+		t.Fatalf("%s:%s is not purged", chaincode, function)
+	}
+
+	_, etag, result, evaluated := get(testChaincode, "Get", "")
+	if result != `"v1"` || evaluated != 1 || len(etag) == 0 {
+		t.Fatalf("first query: %s, %d evaluations, ETag %q", result, evaluated, etag)
+	}
+	if _, _, _, evaluated := get("qscc", "GetChainInfo", ""); evaluated != 1 {
+		t.Fatalf("qscc is evaluated %d times", evaluated)
+	}
+	waitForListener(t, a.gateway, fabrictest.PhaseDeliver, 1)
+
+	// a block of another chaincode purges qscc only
+	if code, out := a.do(t, fasthttp.MethodPost, "/invoke", url.Values{"chaincode": {"other"}, "channel": {testChannel}, "function": {"Put"}, "args": {"k1", "x"}}, nil); code != fasthttp.StatusOK {
+		t.Fatalf("invoke of another chaincode: %d %+v", code, out)
+	}
+	purged("qscc", "GetChainInfo")
+	if _, _, _, evaluated := get(testChaincode, "Get", ""); evaluated != 0 {
+		t.Error("block of another chaincode purged the chaincode")
+	}
+
+	// a block of the chaincode purges it, a miss with the ETag of an unchanged result is 304
+	if code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k2", `"v2"`), nil); code != fasthttp.StatusOK {
+		t.Fatalf("invoke: %d %+v", code, out)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		code, _, _, evaluated := get(testChaincode, "Get", etag)
+		if evaluated > 0 {
+			if code != fasthttp.StatusNotModified {
+				t.Errorf("miss with a matching ETag: %d", code)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("block of the chaincode did not purge it")
+		}
+	}
+	if code, _, _, evaluated := get(testChaincode, "Get", etag); code != fasthttp.StatusNotModified || evaluated != 0 {
+		t.Errorf("hit with a matching ETag: %d, %d evaluations", code, evaluated)
+	}
+}
+
+func TestReloadCredentials(t *testing.T) {
+	a := newAPI(t)
+	var creator []byte
+	a.gateway.Register(testChaincode, "Creator", func(stub *fabrictest.Stub) ([]byte, error) {
+		creator = stub.Creator
+		return []byte(`{}`), nil
+	})
+	whoami := func() []byte {
+		t.Helper()
+		if code, out := a.do(t, fasthttp.MethodGet, "/query", form("Creator"), nil); code != fasthttp.StatusOK {
+			t.Fatalf("query: %d %+v", code, out)
+		}
+		return creator
+	}
+
+	before := whoami()
+	if err := a.gateway.RotateUser(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.org.ReloadCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	after := whoami()
+
+	rotated, err := os.ReadFile(a.gateway.CertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(before, after) || !bytes.Equal(after, rotated) {
+		t.Error("proposal is not signed with the reloaded certificate")
+	}
+	if state := a.org.GatewayStatus().State; state != "READY" {
+		t.Errorf("connection state after reload: %s", state)
+	}
+}
+
+// withProfile replaces the connection settings of the org with a connection profile, generated
+// from TrustChain env variables describing the fake gateway and a second organization, then
+// rewritten as JSON with inline PEMs if inline is set.
+func withProfile(t *testing.T, inline bool) func(*fabric.OrgSetup) {
+	return func(org *fabric.OrgSetup) {
+		host, port, _ := net.SplitHostPort(org.PeerEndpoint)
+		env := map[string]string{
+			"TC_ORG1_STACK":             "Org1",
+			"TC_ORG1_CLIENTMSP":         filepath.Dir(filepath.Dir(org.CertPath)),
+			"TC_ORG1_P1_FQDN":           host,
+			"TC_ORG1_P1_PORT":           port,
+			"TC_ORG1_P1_ASSETS_TLSCERT": org.TLSCertPath,
+			"TC_ORG2_STACK":             "Org2",
+			"TC_ORG2_CLIENTMSP":         "/nonexistent/msp",
+			"TC_ORG2_P1_FQDN":           "peer1.org2.example.com",
+			"TC_ORG2_P1_PORT":           "9101",
+		}
+		profile, err := tc.ProfileFromEnv(func(name string) string { return env[name] })
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(t.TempDir(), "connection.yaml")
+		if inline {
+			o, p := profile.Organizations["Org1"], profile.Peers[host]
+			for _, pem := range []*tc.ProfilePEM{&o.SignedCert, &o.AdminPrivateKey, &p.TLSCACerts} {
+				path := pem.Path
+				if pem == &o.AdminPrivateKey {
+					entries, _ := os.ReadDir(path)
+					path = filepath.Join(path, entries[0].Name())
+				}
+				raw, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				*pem = tc.ProfilePEM{PEM: string(raw)}
+			}
+			profile.Organizations["Org1"], profile.Peers[host] = o, p
+			raw, err := json.Marshal(profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file = filepath.Join(t.TempDir(), "connection.json")
+			err = os.WriteFile(file, raw, 0600)
+		} else {
+			err = profile.Save(file)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		*org = fabric.OrgSetup{Lator: org.Lator, Logger: org.Logger, OrgName: "te-food-endorsers", Profile: file}
+	}
+}
+
+func TestConnectionProfile(t *testing.T) {
+	for _, inline := range []bool{false, true} {
+		a := newAPI(t, withProfile(t, inline))
+		if a.org.OrgName != "Org1" || a.org.MSPID != "Org1MSP" || a.org.GatewayPeer != "127.0.0.1" {
+			t.Errorf("inline %t: org %s, MSP ID %s, gateway peer %s", inline, a.org.OrgName, a.org.MSPID, a.org.GatewayPeer)
+		}
+		if code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k", `{"v":1}`), nil); code != fasthttp.StatusOK {
+			t.Fatalf("inline %t: invoke: %d %+v", inline, code, out)
+		}
+		if code, out := a.do(t, fasthttp.MethodGet, "/query", form("Get", "k"), nil); code != fasthttp.StatusOK || string(out.Result) != `{"v":1}` {
+			t.Errorf("inline %t: query: %d %+v", inline, code, out)
+		}
+	}
+
+	profile, err := tc.LoadProfile(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil {
+		t.Fatal("missing profile is loaded")
+	}
+	profile = &tc.Profile{Organizations: map[string]tc.ProfileOrganization{"Org1": {}, "Org2": {}}}
+	if _, err := profile.NewClient("", ""); err == nil || !strings.Contains(err.Error(), "no client.organization") {
+		t.Errorf("ambiguous organization: %v", err)
+	}
+}
+
+func TestRenewCredentials(t *testing.T) {
+	authority := fabrictest.NewCA(t)
+	authority.Add("gateway", "gatewaypw")
+	authority.Add("alice", "alicepw")
+	ca := &tc.CA{TLSCertPath: authority.TLSCertPath, URL: authority.URL}
+	if err := ca.Init(); err != nil {
+		t.Fatal(err)
+	}
+	enroll := func(id, secret string) *tc.Enrollment {
+		t.Helper()
+		enrollment, err := ca.Enroll(tc.EnrollRequest{ID: id, Secret: secret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enrollment
+	}
+
+	gateway, alice := enroll("gateway", "gatewaypw"), enroll("alice", "alicepw")
+	wallet := &tc.Wallet{Path: t.TempDir()}
+	a := newAPI(t, func(org *fabric.OrgSetup) {
+		if err := tc.WriteCredentials(org.CertPath, org.KeyPath, gateway.Certificate, gateway.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		err := wallet.Put(&tc.WalletIdentity{Credentials: tc.WalletCredentials{Certificate: string(alice.Certificate), PrivateKey: string(alice.PrivateKey)}, Label: "alice", MSPID: org.MSPID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		org.CA = &tc.CA{TLSCertPath: authority.TLSCertPath, URL: authority.URL}
+		org.RenewBefore = 2 * time.Hour
+		org.Wallet = wallet
+	})
+
+	// certificates of the CA are valid for an hour, both identities are renewed by Init
+	if calls := authority.Calls(tc.CAPathReenroll); calls != 2 {
+		t.Fatalf("%d reenrollments, want 2", calls)
+	}
+	var creator []byte
+	a.gateway.Register(testChaincode, "Creator", func(stub *fabrictest.Stub) ([]byte, error) {
+		creator = stub.Creator
+		return []byte(`{}`), nil
+	})
+	if code, out := a.do(t, fasthttp.MethodGet, "/query", form("Creator"), nil); code != fasthttp.StatusOK {
+		t.Fatalf("query: %d %+v", code, out)
+	}
+	renewed, err := os.ReadFile(a.gateway.CertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(renewed, gateway.Certificate) || !bytes.Equal(creator, renewed) {
+		t.Error("proposal is not signed with the reenrolled certificate")
+	}
+	id, err := wallet.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Credentials.Certificate == string(alice.Certificate) || id.Credentials.PrivateKey == string(alice.PrivateKey) {
+		t.Error("wallet identity is not reenrolled with a new key")
+	}
+
+	a.org.RenewBefore = 30 * time.Minute
+	if err := a.org.RenewCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if calls := authority.Calls(tc.CAPathReenroll); calls != 2 {
+		t.Errorf("certificates not due are reenrolled, %d reenrollments", calls)
+	}
+}
+
+func TestEncryptedWallet(t *testing.T) {
+	wallet := &tc.Wallet{Passphrase: []byte("correct horse"), Path: t.TempDir()}
+	stray := fabrictest.New(t)
+	for _, setup := range []struct {
+		name   string
+		option func(*fabric.OrgSetup)
+	}{
+		{"keystore with a stray key", func(org *fabric.OrgSetup) {
+			_, key, err := tc.ReadCredentials(stray.CertPath, stray.KeyPath)
+			if err == nil {
+				err = os.WriteFile(filepath.Join(org.KeyPath, "0_stray_sk"), key, 0600)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"key matched in the wallet", func(org *fabric.OrgSetup) {
+			certificate, key, err := tc.ReadCredentials(org.CertPath, org.KeyPath)
+			if err == nil {
+				err = wallet.Put(&tc.WalletIdentity{Credentials: tc.WalletCredentials{Certificate: string(certificate), PrivateKey: string(key)}, Label: "matched", MSPID: org.MSPID})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			org.KeyPath, org.Wallet = "", wallet
+		}},
+		{"wallet identity", func(org *fabric.OrgSetup) {
+			certificate, key, err := tc.ReadCredentials(org.CertPath, org.KeyPath)
+			if err == nil {
+				err = wallet.Put(&tc.WalletIdentity{Credentials: tc.WalletCredentials{Certificate: string(certificate), PrivateKey: string(key)}, Label: "gateway", MSPID: org.MSPID})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			org.CertPath, org.Identity, org.KeyPath, org.Wallet = "", "gateway", "", wallet
+		}},
+	} {
+		a := newAPI(t, setup.option)
+		var creator []byte
+		a.gateway.Register(testChaincode, "Creator", func(stub *fabrictest.Stub) ([]byte, error) {
+			creator = stub.Creator
+			return []byte(`{}`), nil
+		})
+		if code, out := a.do(t, fasthttp.MethodGet, "/query", form("Creator"), nil); code != fasthttp.StatusOK {
+			t.Fatalf("%s: query: %d %+v", setup.name, code, out)
+		}
+		certificate, err := os.ReadFile(a.gateway.CertPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(creator, certificate) {
+			t.Errorf("%s: proposal is not signed by the gateway identity", setup.name)
+		}
+	}
+
+	// private keys are encrypted at rest and need the passphrase
+	raw, err := os.ReadFile(filepath.Join(wallet.Path, "gateway"+tc.WalletExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("PRIVATE KEY")) || !bytes.Contains(raw, []byte("encryptedPrivateKey")) {
+		t.Errorf("private key is stored in plain text: %s", raw)
+	}
+	for _, passphrase := range []string{"", "wrong horse"} {
+		if _, err := (&tc.Wallet{Passphrase: []byte(passphrase), Path: wallet.Path}).Get("gateway"); err == nil {
+			t.Errorf("identity is decrypted with passphrase '%s'", passphrase)
+		}
+	}
+	id, err := (&tc.Wallet{Path: wallet.Path}).Peek("gateway")
+	if err != nil || id.Credentials.EncryptedPrivateKey == nil || len(id.Credentials.Certificate) == 0 {
+		t.Errorf("peek without passphrase: %+v %v", id, err)
+	}
+
+	// the key cannot be moved under another certificate
+	other, err := wallet.Get("matched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id.Credentials.Certificate, id.Label = other.Credentials.Certificate, "moved"
+	if err := (&tc.Wallet{Path: wallet.Path}).Put(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.Get("moved"); err == nil {
+		t.Error("private key is decrypted under another certificate")
+	}
+
+	// identities stored in plain text are still read
+	plain := &tc.Wallet{Path: wallet.Path}
+	if err := plain.Put(&tc.WalletIdentity{Credentials: other.Credentials, Label: "plain", MSPID: other.MSPID}); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := wallet.Get("plain"); err != nil || id.Credentials.PrivateKey != other.Credentials.PrivateKey {
+		t.Errorf("plain text identity: %v", err)
+	}
+}
+
+func TestCARegister(t *testing.T) {
+	authority := fabrictest.NewCA(t)
+	ca := &tc.CA{TLSCertPath: authority.TLSCertPath, URL: authority.URL}
+	if err := ca.Init(); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := ca.Enroll(tc.EnrollRequest{ID: "admin", Secret: "adminpw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Enroll(tc.EnrollRequest{ID: "admin", Secret: "wrong"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("enrollment with a wrong secret: %v", err)
+	}
+
+	secret, err := ca.Register(admin.Certificate, admin.PrivateKey, &tc.Registration{ID: "gw1", Type: "client"})
+	if err != nil || len(secret) == 0 {
+		t.Fatalf("register: %q, %v", secret, err)
+	}
+	gw1, err := ca.Enroll(tc.EnrollRequest{Hosts: []string{"gw1.example.com", "127.0.0.1"}, ID: "gw1", Profile: "tls", Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Register(gw1.Certificate, gw1.PrivateKey, &tc.Registration{ID: "gw2"}); err == nil {
+		t.Error("client registered an identity")
+	}
+	if _, err := ca.Register(gw1.Certificate, admin.PrivateKey, &tc.Registration{ID: "gw2"}); err == nil {
+		t.Error("token signed with another key is accepted")
+	}
+
+	renewed, err := ca.Reenroll(gw1.Certificate, gw1.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(renewed.Certificate)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificate.Subject.CommonName != "gw1" || len(certificate.DNSNames) != 1 || len(certificate.IPAddresses) != 1 {
+		t.Errorf("reenrolled certificate of %s for %v %v", certificate.Subject.CommonName, certificate.DNSNames, certificate.IPAddresses)
+	}
+}
+
+func TestCertificates(t *testing.T) {
+	authority := fabrictest.NewCA(t)
+	authority.Add("alice", "alicepw")
+	ca := &tc.CA{TLSCertPath: authority.TLSCertPath, URL: authority.URL}
+	if err := ca.Init(); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := ca.Enroll(tc.EnrollRequest{ID: "alice", Secret: "alicepw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := &tc.Wallet{Path: t.TempDir()}
+	if err = wallet.Put(&tc.WalletIdentity{Credentials: tc.WalletCredentials{Certificate: string(alice.Certificate), PrivateKey: string(alice.PrivateKey)}, Label: "alice", MSPID: "Org1MSP"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(wallet.Path, "broken"+tc.WalletExt), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a := newAPI(t, func(org *fabric.OrgSetup) {
+		org.CA = &tc.CA{TLSCertPath: authority.TLSCertPath, URL: authority.URL}
+		org.Wallet = wallet
+	})
+
+	// the certificates of the org are watched by the certs.Monitor, see package certs
+	certificates := a.org.Certificates()
+	for name, subject := range map[string]string{
+		"org1 gateway identity":      "",
+		"org1 gateway TLS root":      "",
+		"org1 CA TLS root":           "",
+		"org1 wallet identity alice": "CN=alice,OU=client",
+	} {
+		infos, err := tc.ParseCertificates(certificates[name])
+		if err != nil || (len(subject) > 0 && infos[0].Subject != subject) {
+			t.Errorf("%s: %+v, %v", name, infos, err)
+		}
+	}
+	if pem, ok := certificates["org1 wallet identity broken"]; !ok || pem != nil || len(certificates) != 5 {
+		t.Errorf("unreadable wallet identity is not reported: %v", certificates)
+	}
+}
+
+// endregion: http
+// region: orgs
+
+// withOrg2 adds org2 with a gateway of its own next to the org of a.
+func withOrg2(t *testing.T, a *api, logger *log.Logger) (*fabric.Orgs, *fabrictest.Gateway) {
+	t.Helper()
+	gw := fabrictest.New(t)
+	gw.Register(testChaincode, "Put", func(stub *fabrictest.Stub) ([]byte, error) {
+		stub.PutState(stub.Args[0], []byte(stub.Args[1]))
+		return []byte(`{"key":"` + stub.Args[0] + `"}`), nil
+	})
+	org2 := &fabric.OrgSetup{
+		CertPath:     gw.CertPath,
+		GatewayPeer:  gw.GatewayPeer,
+		KeyPath:      gw.KeyPath,
+		Lator:        &tc.Lator{},
+		Logger:       fabric.LabelLogger(logger, "org2"),
+		MSPID:        gw.MSPID,
+		OrgName:      "org2",
+		PeerEndpoint: gw.PeerEndpoint,
+		TLSCertPath:  gw.TLSCertPath,
+	}
+	if _, err := org2.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(org2.Close)
+	orgs := &fabric.Orgs{Logger: logger, Setups: []*fabric.OrgSetup{a.org, org2}}
+	if _, err := orgs.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return orgs, gw
+}
+
+func TestMultipleOrgs(t *testing.T) {
+	a := newAPI(t)
+
+	logFile := filepath.Join(t.TempDir(), "rawapi.log")
+	logger := log.NewLogger()
+	if _, err := logger.NewCh(log.ChConfig{File: logFile}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.Close() })
+
+	orgs, gw := withOrg2(t, a, logger)
+
+	router := &http.RouterSetup{Auth: &http.Authenticator{Keys: map[string]http.APIKey{
+		"ops": {Key: "ops-key", Permissions: http.Permissions{"*"}},
+		"erp": {Key: "erp-key", Orgs: []string{"org2"}, Permissions: http.Permissions{"*"}},
+	}}, Logger: logger}
+	if _, err := router.RouterInit(); err != nil {
+		t.Fatal(err)
+	}
+	router.Routes.POST("/invoke", orgs.Route((*fabric.OrgSetup).Invoke))
+	a.client = serve(t, router)
+
+	for _, tc := range []struct {
+		path   string
+		header map[string]string
+		key    string
+		status int
+		org    *fabrictest.Gateway
+	}{
+		{"/invoke", map[string]string{"X-API-Key": "ops-key"}, "default", fasthttp.StatusOK, a.gateway},
+		{"/orgs/org2/invoke", map[string]string{"X-API-Key": "ops-key"}, "prefix", fasthttp.StatusOK, gw},
+		{"/invoke", map[string]string{"X-API-Key": "ops-key", http.OrgHeader: "org2"}, "header", fasthttp.StatusOK, gw},
+		{"/orgs/org2/invoke", map[string]string{"X-API-Key": "erp-key"}, "restricted", fasthttp.StatusOK, gw},
+		{"/invoke", map[string]string{"X-API-Key": "erp-key"}, "forbidden", fasthttp.StatusForbidden, nil},
+		{"/orgs/org3/invoke", map[string]string{"X-API-Key": "ops-key"}, "unknown", fasthttp.StatusNotFound, nil},
+		{"/orgs/org2/invoke", map[string]string{"X-API-Key": "ops-key", http.OrgHeader: "org1"}, "conflicting", fasthttp.StatusBadRequest, nil},
+	} {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.SetRequestURI("http://rawapi" + tc.path)
+		req.Header.SetContentType("application/x-www-form-urlencoded")
+		req.SetBodyString(form("Put", tc.key, "v").Encode())
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		if err := a.client.DoTimeout(req, resp, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode() != tc.status {
+			t.Errorf("%s: got %d %s, want %d", tc.key, resp.StatusCode(), resp.Body(), tc.status)
+		}
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+
+		for _, g := range []*fabrictest.Gateway{a.gateway, gw} {
+			if stored := g.State(testChannel, testChaincode, tc.key) != nil; stored != (g == tc.org) {
+				t.Errorf("%s: stored at the gateway of %s is %t", tc.key, map[bool]string{true: "org1", false: "org2"}[g == a.gateway], stored)
+			}
+		}
+	}
+
+	raw, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "__INFO__: [org2] -> ") {
+		t.Errorf("org2 is not labelled in the log:\n%s", raw)
+	}
+
+	metrics := &bytes.Buffer{}
+	orgs.Metrics(metrics)
+	for _, metric := range []string{
+		`tc_rawapi_org_requests_total{org="org1",code="200"} 1`,
+		`tc_rawapi_org_requests_total{org="org1",code="403"} 1`,
+		`tc_rawapi_org_requests_total{org="org2",code="200"} 3`,
+		`tc_rawapi_org_gateway_ready{org="org2",msp_id="` + gw.MSPID + `"}`,
+	} {
+		if !strings.Contains(metrics.String(), metric) {
+			t.Errorf("%s is not in the metrics:\n%s", metric, metrics)
+		}
+	}
+}
+
+// endregion: orgs
+// region: explorer
+
+// explore gets path and decodes the result into out.
+func (a *api) explore(t *testing.T, path string, form url.Values, out interface{}) (int, *reply) {
+	t.Helper()
+	code, reply := a.do(t, fasthttp.MethodGet, path, form, nil)
+	if code == fasthttp.StatusOK {
+		if err := json.Unmarshal(reply.Result, out); err != nil {
+			t.Fatalf("%s: unexpected result %s: %s", path, reply.Result, err)
+		}
+	}
+	return code, reply
+}
+
+func TestExplorerBlocks(t *testing.T) {
+	a := newAPI(t)
+	txids := make([]string, 0)
+	for i, key := range []string{"k1", "k2", "k3"} {
+		if i == 2 {
+			a.gateway.Invalidate(peer.TxValidationCode_MVCC_READ_CONFLICT)
+		}
+		_, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", key, "v"), nil)
+		txids = append(txids, out.ID)
+	}
+	channel := "/channels/" + testChannel
+
+	info := &tc.ChainInfo{}
+	if code, out := a.explore(t, channel+"/info", nil, info); code != fasthttp.StatusOK || info.Height != 4 {
+		t.Fatalf("chain info: %d %+v %+v", code, out, info)
+	}
+
+	// the latest blocks by default, chained by their hashes
+	type page struct {
+		Blocks []tc.BlockSummary `json:"blocks"`
+		From   uint64            `json:"from"`
+		Height uint64            `json:"height"`
+		To     uint64            `json:"to"`
+	}
+	blocks := &page{}
+	if code, out := a.explore(t, channel+"/blocks", nil, blocks); code != fasthttp.StatusOK || len(blocks.Blocks) != 4 || blocks.From != 0 || blocks.To != 3 || blocks.Height != 4 {
+		t.Fatalf("blocks: %d %+v %+v", code, out, blocks)
+	}
+	for i, block := range blocks.Blocks {
+		if block.Number != uint64(i) || (i > 0 && (block.PreviousHash != blocks.Blocks[i-1].Hash || block.TxCount != 1)) {
+			t.Errorf("block %d: %+v", i, block)
+		}
+	}
+	if info.CurrentHash != blocks.Blocks[3].Hash || info.PreviousHash != blocks.Blocks[2].Hash {
+		t.Errorf("chain info %+v does not match the top of the chain", info)
+	}
+
+	// ranges are bound by the height
+	for _, bounds := range []struct {
+		from, to string
+		code     int
+		first    uint64
+		last     uint64
+	}{
+		{"1", "2", fasthttp.StatusOK, 1, 2},
+		{"2", "", fasthttp.StatusOK, 2, 3},
+		{"", "100", fasthttp.StatusOK, 0, 3},
+		{"3", "1", fasthttp.StatusBadRequest, 0, 0},
+		{"4", "", fasthttp.StatusBadRequest, 0, 0},
+		{"x", "", fasthttp.StatusBadRequest, 0, 0},
+		{"", "-1", fasthttp.StatusBadRequest, 0, 0},
+	} {
+		query := url.Values{}
+		if len(bounds.from) > 0 {
+			query.Set("from", bounds.from)
+		}
+		if len(bounds.to) > 0 {
+			query.Set("to", bounds.to)
+		}
+		blocks := &page{}
+		code, out := a.explore(t, channel+"/blocks", query, blocks)
+		if code != bounds.code || (code == fasthttp.StatusOK && (blocks.From != bounds.first || blocks.To != bounds.last || len(blocks.Blocks) != int(bounds.last-bounds.first+1))) {
+			t.Errorf("blocks %s-%s: %d %+v %+v", bounds.from, bounds.to, code, out, blocks)
+		}
+	}
+
+	// a block with the summary of its transaction
+	for number, validation := range map[int]string{2: "VALID", 3: "MVCC_READ_CONFLICT"} {
+		block := &tc.Block{}
+		code, out := a.explore(t, fmt.Sprintf("%s/blocks/%d", channel, number), nil, block)
+		if code != fasthttp.StatusOK || block.Hash != blocks.Blocks[number].Hash || len(block.Transactions) != 1 {
+			t.Fatalf("block %d: %d %+v %+v", number, code, out, block)
+		}
+		tx := block.Transactions[0]
+		if tx.Txid != txids[number-1] || tx.Chaincode != testChaincode || tx.Function != "Put" || tx.Validation != validation || tx.Type != "ENDORSER_TRANSACTION" {
+			t.Errorf("transaction of block %d: %+v", number, tx)
+		}
+	}
+	for _, number := range []string{"4", "x"} {
+		if code, out := a.explore(t, channel+"/blocks/"+number, nil, &tc.Block{}); code != fasthttp.StatusBadRequest {
+			t.Errorf("block %s: %d %+v", number, code, out)
+		}
+	}
+}
+
+func TestExplorerTransaction(t *testing.T) {
+	a := newAPI(t)
+	a.gateway.Invalidate(peer.TxValidationCode_MVCC_READ_CONFLICT)
+	_, invalid := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	_, valid := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v2"), nil)
+
+	for _, want := range []struct {
+		txid  string
+		code  peer.TxValidationCode
+		value string
+	}{
+		{invalid.ID, peer.TxValidationCode_MVCC_READ_CONFLICT, `"v1"`},
+		{valid.ID, peer.TxValidationCode_VALID, `"v2"`},
+	} {
+		tx := &tc.TransactionDetail{}
+		code, out := a.explore(t, "/channels/"+testChannel+"/tx/"+want.txid, nil, tx)
+		if code != fasthttp.StatusOK || out.ID != want.txid || out.Status != want.code.String() {
+			t.Fatalf("transaction %s: %d %+v", want.txid, code, out)
+		}
+		if tx.ValidationCode != int32(want.code) || tx.Validation != want.code.String() || tx.Chaincode != testChaincode || tx.Function != "Put" || len(tx.Args) != 2 || tx.Creator.MSPID != a.gateway.MSPID {
+			t.Errorf("transaction %s: %+v", want.txid, tx)
+		}
+		if len(tx.RWSet) != 1 || tx.RWSet[0].Namespace != testChaincode || len(tx.RWSet[0].Writes) != 1 || string(tx.RWSet[0].Writes[0].Value) != want.value {
+			t.Errorf("rwset of %s: %+v", want.txid, tx.RWSet)
+		}
+	}
+
+	if code, out := a.explore(t, "/channels/"+testChannel+"/tx/no-such-tx", nil, &tc.TransactionDetail{}); code != fasthttp.StatusBadRequest {
+		t.Errorf("unknown transaction: %d %+v", code, out)
+	}
+}
+
+func TestExplorerApprovedDefinition(t *testing.T) {
+	a := newAPI(t)
+	member := func(mspid string) *msp.MSPPrincipal {
+		raw, _ := proto.Marshal(&msp.MSPRole{MspIdentifier: mspid, Role: msp.MSPRole_MEMBER})
+		return &msp.MSPPrincipal{Principal: raw, PrincipalClassification: msp.MSPPrincipal_ROLE}
+	}
+	signedBy := func(i int32) *common.SignaturePolicy {
+		return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: i}}
+	}
+	endorsement, _ := proto.Marshal(&peer.ApplicationPolicy{Type: &peer.ApplicationPolicy_SignaturePolicy{SignaturePolicy: &common.SignaturePolicyEnvelope{
+		Identities: []*msp.MSPPrincipal{member("Org1MSP"), member("Org2MSP"), member("Org3MSP")},
+		Rule:       &common.SignaturePolicy{Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{N: 2, Rules: []*common.SignaturePolicy{signedBy(0), signedBy(1), signedBy(2)}}}},
+	}}})
+	approved := &lifecycle.QueryApprovedChaincodeDefinitionResult{
+		Collections: &peer.CollectionConfigPackage{Config: []*peer.CollectionConfig{{Payload: &peer.CollectionConfig_StaticCollectionConfig{StaticCollectionConfig: &peer.StaticCollectionConfig{
+			BlockToLive:      10,
+			MemberOnlyRead:   true,
+			MemberOrgsPolicy: &peer.CollectionPolicyConfig{Payload: &peer.CollectionPolicyConfig_SignaturePolicy{SignaturePolicy: &common.SignaturePolicyEnvelope{Identities: []*msp.MSPPrincipal{member("Org1MSP")}, Rule: signedBy(0)}}},
+			Name:             "secrets",
+		}}}}},
+		EndorsementPlugin:   "escc",
+		Sequence:            3,
+		Source:              &lifecycle.ChaincodeSource{Type: &lifecycle.ChaincodeSource_LocalPackage{LocalPackage: &lifecycle.ChaincodeSource_Local{PackageId: testChaincode + "_1.2:abc"}}},
+		ValidationParameter: endorsement,
+		ValidationPlugin:    "vscc",
+		Version:             "1.2",
+	}
+
+	// the readiness check is asked about the very same definition that was approved
+	var requested *lifecycle.QueryApprovedChaincodeDefinitionArgs
+	a.gateway.Register("_lifecycle", "QueryApprovedChaincodeDefinition", func(stub *fabrictest.Stub) ([]byte, error) {
+		requested = &lifecycle.QueryApprovedChaincodeDefinitionArgs{}
+		if err := proto.Unmarshal([]byte(stub.Args[0]), requested); err != nil {
+			return nil, err
+		}
+		return proto.Marshal(approved)
+	})
+	a.gateway.Register("_lifecycle", "CheckCommitReadiness", func(stub *fabrictest.Stub) ([]byte, error) {
+		args := &lifecycle.CheckCommitReadinessArgs{}
+		if err := proto.Unmarshal([]byte(stub.Args[0]), args); err != nil {
+			return nil, err
+		}
+		if args.Name != testChaincode || args.Sequence != approved.Sequence || args.Version != approved.Version || !bytes.Equal(args.ValidationParameter, endorsement) || !proto.Equal(args.Collections, approved.Collections) {
+			return nil, fmt.Errorf("unexpected readiness check %v", args)
+		}
+		return proto.Marshal(&lifecycle.CheckCommitReadinessResult{Approvals: map[string]bool{"Org1MSP": true, "Org2MSP": false}})
+	})
+
+	path := "/channels/" + testChannel + "/chaincodes/" + testChaincode + "/approved"
+	definition := &tc.ChaincodeDefinition{}
+	code, out := a.explore(t, path, url.Values{"sequence": {"3"}}, definition)
+	if code != fasthttp.StatusOK {
+		t.Fatalf("approved definition: %d %+v", code, out)
+	}
+	if requested.Name != testChaincode || requested.Sequence != 3 {
+		t.Errorf("approved definition was queried with %v", requested)
+	}
+	if definition.Name != testChaincode || definition.Sequence != 3 || definition.Version != "1.2" || definition.Source != testChaincode+"_1.2:abc" || definition.EndorsementPlugin != "escc" || definition.ValidationPlugin != "vscc" {
+		t.Errorf("approved definition: %+v", definition)
+	}
+	if want := "OutOf(2, 'Org1MSP.member', 'Org2MSP.member', 'Org3MSP.member')"; definition.EndorsementPolicy != want {
+		t.Errorf("endorsement policy: got %s, want %s", definition.EndorsementPolicy, want)
+	}
+	if len(definition.Approvals) != 2 || !definition.Approvals["Org1MSP"] || definition.Approvals["Org2MSP"] {
+		t.Errorf("approvals: %v", definition.Approvals)
+	}
+	if len(definition.Collections) != 1 || definition.Collections[0].Name != "secrets" || definition.Collections[0].MemberOrgsPolicy != "'Org1MSP.member'" || definition.Collections[0].BlockToLive != 10 {
+		t.Errorf("collections: %+v", definition.Collections)
+	}
+
+	// without a sequence the latest approved one is asked for, without a source it is unavailable
+	approved.Source = nil
+	if code, out = a.explore(t, path, nil, definition); code != fasthttp.StatusOK || requested.Sequence != 0 || definition.Source != "unavailable" {
+		t.Errorf("latest approved definition: %d %+v %+v", code, out, definition)
+	}
+	if code, out = a.explore(t, path, url.Values{"sequence": {"x"}}, definition); code != fasthttp.StatusBadRequest {
+		t.Errorf("invalid sequence: %d %+v", code, out)
+	}
+}
+
+// endregion: explorer
+// region: consistency
+
+// withChain scripts qscc of the gateway with a chain of height blocks, the blocks from fork on
+// differ from those of every other chain.
+func withChain(gw *fabrictest.Gateway, height, fork uint64) {
+	headers := make([]*common.BlockHeader, height)
+	for n := range headers {
+		data := sha256.Sum256([]byte(fmt.Sprintf("block %d", n)))
+		if uint64(n) >= fork {
+			data = sha256.Sum256([]byte(fmt.Sprintf("block %d of %s", n, gw.PeerEndpoint)))
+		}
+		headers[n] = &common.BlockHeader{DataHash: data[:], Number: uint64(n)}
+		if n > 0 {
+			headers[n].PreviousHash = tc.BlockHash(headers[n-1])
+		}
+	}
+	gw.Register("qscc", "GetChainInfo", func(stub *fabrictest.Stub) ([]byte, error) {
+		return proto.Marshal(&common.BlockchainInfo{
+			CurrentBlockHash:  tc.BlockHash(headers[height-1]),
+			Height:            height,
+			PreviousBlockHash: headers[height-1].PreviousHash,
+		})
+	})
+	gw.Register("qscc", "GetBlockByNumber", func(stub *fabrictest.Stub) ([]byte, error) {
+		n, err := strconv.ParseUint(stub.Args[1], 10, 64)
+		if err != nil || n >= height {
+			return nil, fmt.Errorf("block %s not found", stub.Args[1])
+		}
+		return proto.Marshal(&common.Block{Data: &common.BlockData{}, Header: headers[n], Metadata: &common.BlockMetadata{}})
+	})
+}
+
+func TestConsistency(t *testing.T) {
+	gws := []*fabrictest.Gateway{fabrictest.New(t), fabrictest.New(t)}
+	profile := &tc.Profile{
+		Client: tc.ProfileClient{Organization: "Org1"},
+		Organizations: map[string]tc.ProfileOrganization{"Org1": {
+			AdminPrivateKey: tc.ProfilePEM{Path: gws[0].KeyPath},
+			MSPID:           gws[0].MSPID,
+			Peers:           []string{"peer0.org1.example.com", "peer1.org1.example.com"},
+			SignedCert:      tc.ProfilePEM{Path: gws[0].CertPath},
+		}},
+		Peers:   make(map[string]tc.ProfilePeer),
+		Version: tc.ProfileVersion,
+	}
+	ranges := []string{`[{"ID":"a","v":1},{"ID":"c","v":3}]`, `[{"ID":"a","v":1}]`}
+	for i, gw := range gws {
+		withChain(gw, 5, 5)
+		gw.SetState(testChannel, testChaincode, "a", []byte("1"))
+		gw.SetState(testChannel, testChaincode, "b", []byte(fmt.Sprint(i)))
+		gw.Register(testChaincode, "Get", func(stub *fabrictest.Stub) ([]byte, error) {
+			if value := stub.GetState(stub.Args[0]); value != nil {
+				return value, nil
+			}
+			return nil, fmt.Errorf("key %s not found", stub.Args[0])
+		})
+		result := []byte(ranges[i])
+		gw.Register(testChaincode, "GetRange", func(stub *fabrictest.Stub) ([]byte, error) {
+			return result, nil
+		})
+		profile.Peers[fmt.Sprintf("peer%d.org1.example.com", i)] = tc.ProfilePeer{
+			GRPCOptions: map[string]interface{}{tc.ProfileSSLTargetOverride: gw.GatewayPeer},
+			TLSCACerts:  tc.ProfilePEM{Path: gw.TLSCertPath},
+			URL:         "grpcs://" + gw.PeerEndpoint,
+		}
+	}
+	file := filepath.Join(t.TempDir(), "connection.yaml")
+	if err := profile.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	a := newAPI(t, func(org *fabric.OrgSetup) {
+		*org = fabric.OrgSetup{Lator: org.Lator, Logger: org.Logger, OrgName: "Org1", Profile: file}
+	})
+
+	check := func(name string, query url.Values) *tc.ConsistencyReport {
+		t.Helper()
+		query.Set("channels", testChannel)
+		code, out := a.do(t, fasthttp.MethodGet, "/admin/consistency", query, nil)
+		if code != fasthttp.StatusOK {
+			t.Fatalf("%s: %d %+v", name, code, out)
+		}
+		report := &tc.ConsistencyReport{}
+		if err := json.Unmarshal(out.Result, report); err != nil || len(report.Channels) != 1 {
+			t.Fatalf("%s: unexpected report %s: %v", name, out.Result, err)
+		}
+		if (out.Status == "OK") != report.Consistent {
+			t.Errorf("%s: status %s of a report consistent %t", name, out.Status, report.Consistent)
+		}
+		return report
+	}
+
+	if report := check("in sync", url.Values{}); !report.Consistent || report.Channels[0].CommonHeight != 5 || len(report.Peers) != 2 {
+		t.Errorf("in sync: %+v", report)
+	}
+
+	withChain(gws[1], 4, 4)
+	report := check("lagging", url.Values{})
+	if c := report.Channels[0]; report.Consistent || c.HashMismatch || c.CommonHeight != 4 || strings.Join(c.Lagging, ",") != "peer1.org1.example.com" {
+		t.Errorf("lagging: %+v", report)
+	}
+
+	withChain(gws[1], 5, 2)
+	report = check("forked", url.Values{})
+	if c := report.Channels[0]; report.Consistent || !c.HashMismatch || len(c.Lagging) > 0 || c.Hashes["peer0.org1.example.com"] == c.Hashes["peer1.org1.example.com"] {
+		t.Errorf("forked: %+v", report)
+	}
+
+	withChain(gws[1], 5, 5)
+	report = check("keys", url.Values{"chaincode": {testChaincode}, "get": {"Get"}, "keys": {"a,b,x"}, "range": {"GetRange"}, "key_field": {"ID"}})
+	c := report.Channels[0]
+	if report.Consistent || c.HashMismatch || c.Keys != 4 || len(c.DivergentKeys) != 2 {
+		t.Fatalf("keys: %+v", report)
+	}
+	if peers := report.SharedOrgs[gws[0].MSPID]; len(peers) != 2 {
+		t.Errorf("peers of the same org are not flagged: %+v", report.SharedOrgs)
+	}
+	if d := c.DivergentKeys[0]; d.Key != "b" || len(d.Missing) > 0 || d.Hashes["peer0.org1.example.com"] == d.Hashes["peer1.org1.example.com"] {
+		t.Errorf("divergent value: %+v", d)
+	}
+	if d := c.DivergentKeys[1]; d.Key != "c" || strings.Join(d.Missing, ",") != "peer1.org1.example.com" {
+		t.Errorf("missing key: %+v", d)
+	}
+
+	query := url.Values{"channels": {testChannel}, "peers": {"peer0.org1.example.com,peer9.org1.example.com"}}
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.SetRequestURI("http://rawapi/admin/consistency?" + query.Encode())
+	req.Header.Set("X-API-Key", testKey)
+	err := a.client.DoTimeout(req, resp, 10*time.Second)
+	if err != nil || resp.StatusCode() != fasthttp.StatusBadRequest || !strings.Contains(string(resp.Body()), "peer9.org1.example.com is not in the connection profile") {
+		t.Errorf("unknown peer: %d %s %v", resp.StatusCode(), resp.Body(), err)
+	}
+}
+
+// endregion: consistency
+// region: queue
+
+// queued polls the queue item until it leaves the states the worker is busy with.
+func (a *api) queued(t *testing.T, id string) *queue.Item {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		item, err := a.org.Queue.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.State == queue.StateCommitted || item.State == queue.StateDead {
+			return item
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("queue item %s is still pending", id)
+	return nil
+}
+
+func queueID(t *testing.T, out *reply) string {
+	t.Helper()
+	item := &queue.Item{}
+	if err := json.Unmarshal(out.Result, item); err != nil || len(item.ID) == 0 {
+		t.Fatalf("no queue item in %s", out.Result)
+	}
+	return item.ID
+}
+
+func TestQueueRetriesUntilFabricIsBack(t *testing.T) {
+	a := newAPI(t, withQueue(t))
+	a.gateway.Fail(fabrictest.PhaseEndorse, a.gateway.Error(codes.Unavailable, "no peers available"))
+	a.gateway.Fail(fabrictest.PhaseSubmit, a.gateway.Error(codes.Unavailable, "orderer is down"))
+
+	code, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	if code != fasthttp.StatusAccepted || out.Status != "QUEUED" {
+		t.Fatalf("queued invoke: %d %+v", code, out)
+	}
+
+	item := a.queued(t, queueID(t, out))
+	if item.State != queue.StateCommitted || item.Validation != "VALID" || item.Attempts != 3 || len(item.Txid) == 0 {
+		t.Fatalf("unexpected queue item %+v", item)
+	}
+	if got := a.gateway.State(testChannel, testChaincode, "k1"); string(got) != "v1" {
+		t.Errorf("state after queued invoke: %s", got)
+	}
+	if a.gateway.Calls(fabrictest.PhaseEndorse) != 2 || a.gateway.Calls(fabrictest.PhaseSubmit) != 2 {
+		t.Errorf("failed submit was endorsed again: %d endorsements, %d submits", a.gateway.Calls(fabrictest.PhaseEndorse), a.gateway.Calls(fabrictest.PhaseSubmit))
+	}
+
+	// the signed transaction is shown to admins only
+	lookup := func(key string) *queue.Item {
+		t.Helper()
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		req.SetRequestURI("http://rawapi/queue/" + item.ID)
+		req.Header.Set("X-API-Key", key)
+		if err := a.client.DoTimeout(req, resp, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		found := &queue.Item{}
+		if err := json.Unmarshal(resp.Body(), found); resp.StatusCode() != fasthttp.StatusOK || err != nil {
+			t.Fatalf("queue item lookup: %d %q", resp.StatusCode(), resp.Body())
+		}
+		return found
+	}
+	if found := lookup(testKey); len(found.Transaction) == 0 {
+		t.Errorf("admin lookup without the signed transaction: %+v", found)
+	}
+	router := &http.RouterSetup{Auth: &http.Authenticator{Keys: map[string]http.APIKey{
+		http.CallerDefault: {Key: "caller-key", Permissions: http.Permissions{"*"}},
+	}}, Logger: a.org.Logger}
+	if _, err := router.RouterInit(); err != nil {
+		t.Fatal(err)
+	}
+	router.Routes.GET("/queue/:queue_id", a.org.QueueItem)
+	a.client = serve(t, router)
+	if found := lookup("caller-key"); len(found.Transaction) != 0 || found.Txid != item.Txid {
+		t.Errorf("caller lookup: %+v", found)
+	}
+}
+
+func TestQueueDoesNotResubmitAfterCommitTimeout(t *testing.T) {
+	a := newAPI(t, withQueue(t), withTimeouts(t, testChaincode+"/commit=100ms"))
+	a.gateway.Delay(fabrictest.PhaseCommitStatus, time.Second)
+
+	_, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	item := a.queued(t, queueID(t, out))
+	if item.State != queue.StateCommitted || item.Attempts != 2 {
+		t.Fatalf("unexpected queue item %+v", item)
+	}
+	if a.gateway.Calls(fabrictest.PhaseEndorse) != 1 || a.gateway.Calls(fabrictest.PhaseSubmit) != 1 {
+		t.Errorf("transaction was submitted again: %d endorsements, %d submits", a.gateway.Calls(fabrictest.PhaseEndorse), a.gateway.Calls(fabrictest.PhaseSubmit))
+	}
+}
+
+func TestQueueDeadLetters(t *testing.T) {
+	a := newAPI(t, withQueue(t))
+
+	_, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "only-a-key"), nil)
+	item := a.queued(t, queueID(t, out))
+	if item.State != queue.StateDead || item.Attempts != 1 || !strings.Contains(item.Error, "Put needs a key and a value") {
+		t.Fatalf("chaincode error was not dead-lettered: %+v", item)
+	}
+
+	code, _ := a.do(t, fasthttp.MethodPost, "/admin/queue/"+item.ID+"/replay", nil, nil)
+	if code != fasthttp.StatusOK {
+		t.Fatalf("replay: %d", code)
+	}
+	if item = a.queued(t, item.ID); item.State != queue.StateDead {
+		t.Fatalf("replayed item %+v", item)
+	}
+
+	code, _ = a.do(t, fasthttp.MethodDelete, "/admin/queue/"+item.ID, nil, nil)
+	if code != fasthttp.StatusOK {
+		t.Fatalf("drop: %d", code)
+	}
+	if _, err := a.org.Queue.Get(item.ID); !errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("dropped item is still there: %v", err)
+	}
+}
+
+// endregion: queue
+// region: webhooks
+
+// receiver collects the webhook deliveries it accepts, it refuses the first one.
+type receiver struct {
+	mutex    sync.Mutex
+	events   []webhook.Event
+	failures int
+	refused  bool
+}
+
+func (r *receiver) ServeHTTP(w nethttp.ResponseWriter, req *nethttp.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if req.Header.Get(webhook.SignatureHeader) != webhook.Sign("s3cr3t", req.Header.Get(webhook.TimestampHeader), body) {
+		r.failures++
+		w.WriteHeader(nethttp.StatusUnauthorized)
+		return
+	}
+	if !r.refused {
+		r.refused = true
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+		return
+	}
+	event := webhook.Event{}
+	json.Unmarshal(body, &event)
+	r.events = append(r.events, event)
+}
+
+func (r *receiver) wait(t *testing.T, n int) []webhook.Event {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mutex.Lock()
+		events := append([]webhook.Event(nil), r.events...)
+		r.mutex.Unlock()
+		if len(events) >= n {
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%d webhook deliveries are missing", n-len(r.events))
+	return nil
+}
+
+func TestWebhooksResumeFromCheckpoint(t *testing.T) {
+	a := newAPI(t)
+	r := &receiver{}
+	target := httptest.NewServer(r)
+	defer target.Close()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	start := func() (*webhook.Webhooks, context.CancelFunc) {
+		hooks := &webhook.Webhooks{Backoff: 10 * time.Millisecond, Logger: a.org.Logger, Path: path}
+		if _, err := hooks.Init(); err != nil {
+			t.Fatal(err)
+		}
+		a.org.Webhooks = hooks
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			a.org.WebhooksRun(ctx)
+			close(done)
+		}()
+		return hooks, func() { cancel(); <-done }
+	}
+
+	hooks, stop := start()
+	_, err := hooks.Add(&webhook.Subscription{
+		Chaincode: testChaincode,
+		Channel:   testChannel,
+		Events:    []string{"Put"},
+		ID:        "erp",
+		Secret:    "s3cr3t",
+		URL:       target.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForListener(t, a.gateway, fabrictest.PhaseChaincodeEvents, 1)
+
+	a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k1", "v1"), nil)
+	a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k2", "v2"), nil)
+	r.wait(t, 2)
+	stop()
+
+	_, out := a.do(t, fasthttp.MethodPost, "/invoke", form("Put", "k3", "v3"), nil)
+	_, stop = start()
+	defer stop()
+
+	r.wait(t, 3)
+	time.Sleep(50 * time.Millisecond)
+	events := r.wait(t, 3)
+	if len(events) != 3 || r.failures != 0 {
+		t.Fatalf("expected 3 deliveries without signature failures, got %+v, %d failures", events, r.failures)
+	}
+	for i, key := range []string{"k1", "k2", "k3"} {
+		// the keys are not json, so they are base64 encoded
+		if events[i].Payload != base64.StdEncoding.EncodeToString([]byte(key)) {
+			t.Errorf("delivery %d: %+v", i, events[i])
+		}
+	}
+	if events[2].Txid != out.ID || events[2].Subscription != "erp" || events[2].Channel != testChannel {
+		t.Errorf("delivery after restart: %+v", events[2])
+	}
+}
+
+// waitForListener waits until n chaincode event streams have been opened.
+func waitForListener(t *testing.T, gw *fabrictest.Gateway, phase fabrictest.Phase, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for gw.Calls(phase) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s stream opened", phase)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// endregion: webhooks
+// region: grpc
+
+func TestCommitError(t *testing.T) {
+	a := newAPI(t)
+	a.gateway.Invalidate(peer.TxValidationCode_MVCC_READ_CONFLICT)
+
+	_, err := a.org.Service().Invoke(context.Background(), &pb.TransactionRequest{
+		Args:      []string{"k1", "v1"},
+		Chaincode: testChaincode,
+		Channel:   testChannel,
+		Function:  "Put",
+	})
+	if status.Code(err) != codes.Aborted || !strings.Contains(err.Error(), "MVCC_READ_CONFLICT") {
+		t.Fatalf("invoke of invalidated transaction: %v", err)
+	}
+	if a.gateway.State(testChannel, testChaincode, "k1") != nil {
+		t.Error("invalidated transaction changed the state")
+	}
+}
+
+func TestServiceQueue(t *testing.T) {
+	a := newAPI(t, withQueue(t))
+	service := a.org.Service()
+
+	for i, call := range []func(context.Context, *pb.TransactionRequest) (*pb.TransactionResponse, error){service.Invoke, service.SubmitAsync} {
+		key := fmt.Sprintf("k%d", i)
+		out, err := call(context.Background(), &pb.TransactionRequest{
+			Args:      []string{key, "v"},
+			Chaincode: testChaincode,
+			Channel:   testChannel,
+			Function:  "Put",
+		})
+		if err != nil || out.Status != "QUEUED" {
+			t.Fatalf("call %d: %+v, %v", i, out, err)
+		}
+		queued := &queue.Item{}
+		if err := json.Unmarshal(out.Result, queued); err != nil || len(queued.ID) == 0 {
+			t.Fatalf("call %d: no queue item in %s", i, out.Result)
+		}
+		if item := a.queued(t, queued.ID); item.State != queue.StateCommitted || item.Function != "Put" {
+			t.Errorf("call %d: unexpected queue item %+v", i, item)
+		}
+		if got := a.gateway.State(testChannel, testChaincode, key); string(got) != "v" {
+			t.Errorf("call %d: state after queued call: %s", i, got)
+		}
+	}
+}
+
+func TestServiceKeepsTransactions(t *testing.T) {
+	a := newAPI(t, withTransactions(t))
+
+	out, err := a.org.Service().SubmitAsync(context.Background(), &pb.TransactionRequest{
+		Args:      []string{"k1", "v1"},
+		Chaincode: testChaincode,
+		Channel:   testChannel,
+		Function:  "Put",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the transaction is there to be resubmitted as is over http
+	code, resubmitted := a.do(t, fasthttp.MethodPost, "/transactions/"+out.TxId+"/resubmit", nil, nil)
+	if code != fasthttp.StatusOK || resubmitted.ID != out.TxId {
+		t.Fatalf("resubmit of a grpc transaction: %d %+v", code, resubmitted)
+	}
+	if a.gateway.Calls(fabrictest.PhaseEndorse) != 1 {
+		t.Errorf("resubmit endorsed the transaction again: %d endorsements", a.gateway.Calls(fabrictest.PhaseEndorse))
+	}
+}
+
+func TestChaincodeEvents(t *testing.T) {
+	a := newAPI(t)
+
+	c := &tc.Client{
+		CertPath:     a.gateway.CertPath,
+		GatewayPeer:  a.gateway.GatewayPeer,
+		KeyPath:      a.gateway.KeyPath,
+		MSPID:        a.gateway.MSPID,
+		PeerEndpoint: a.gateway.PeerEndpoint,
+		TLSCertPath:  a.gateway.TLSCertPath,
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	response, responseErr := tc.Invoke(&tc.Request{
+		Args:     []string{"k1", "v1"},
+		Contract: c.Contract(testChannel, testChaincode),
+		Function: "Put",
+	})
+	if responseErr != nil {
+		t.Fatal(responseErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := c.ChaincodeEvents(ctx, testChannel, testChaincode, nil, client.WithStartBlock(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if event.EventName != "Put" || string(event.Payload) != "k1" || event.TransactionID != response.Txid {
+			t.Errorf("unexpected event %+v", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("no chaincode event")
+	}
+}
+
+func TestServiceAuth(t *testing.T) {
+	a := newAPI(t)
+	logger := log.NewLogger()
+	defer logger.Close()
+
+	auditLog := &audit.Log{Dir: t.TempDir(), Logger: logger}
+	if _, err := auditLog.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+
+	server := &rpc.ServerSetup{
+		Audit: auditLog,
+		Auth: &http.Authenticator{Keys: map[string]http.APIKey{
+			"reader": {Key: "reader-key", Permissions: http.Permissions{testChannel + ":" + testChaincode + ":Get"}},
+			"erp":    {Key: "erp-key", Orgs: []string{"org2"}, Permissions: http.Permissions{"*"}},
+		}},
+		Enabled:      true,
+		Logger:       logger,
+		NetworkProto: "tcp",
+		Service:      a.org.Service(),
+	}
+	if _, err := server.ServerLaunch(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	_, port, _ := net.SplitHostPort(server.Address())
+
+	conn, err := grpc.Dial("127.0.0.1:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	service := pb.NewTrustChainServiceClient(conn)
+
+	call := func(key, function string, args ...string) error {
+		ctx := context.Background()
+		if len(key) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, rpc.KeyHeader, key)
+		}
+		in := &pb.TransactionRequest{Args: args, Chaincode: testChaincode, Channel: testChannel, Function: function}
+		if function == "Put" {
+			_, err := service.Invoke(ctx, in)
+			return err
+		}
+		_, err := service.Query(ctx, &pb.QueryRequest{Args: in.Args, Chaincode: in.Chaincode, Channel: in.Channel, Function: in.Function})
+		return err
+	}
+
+	a.gateway.SetState(testChannel, testChaincode, "k1", []byte("v1"))
+	for _, tc := range []struct {
+		name     string
+		key      string
+		function string
+		code     codes.Code
+	}{
+		{"missing key", "", "Get", codes.PermissionDenied},
+		{"wrong key", "wrong-key", "Get", codes.PermissionDenied},
+		{"permitted function", "reader-key", "Get", codes.OK},
+		{"other function", "reader-key", "Put", codes.PermissionDenied},
+		{"other org", "erp-key", "Get", codes.PermissionDenied},
+	} {
+		if err := call(tc.key, tc.function, "k1", "v2"); status.Code(err) != tc.code {
+			t.Errorf("%s: got %v, want %s", tc.name, err, tc.code)
+		}
+	}
+	if string(a.gateway.State(testChannel, testChaincode, "k1")) != "v1" {
+		t.Error("denied invoke changed the state")
+	}
+
+	entries, err := auditLog.Search(audit.Query{Caller: "reader"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Outcome != audit.OutcomeDenied || entries[1].Outcome != audit.OutcomeOK || entries[1].CallerType != http.AuthKey {
+		t.Errorf("audit entries of reader: %+v", entries)
+	}
+}
+
+func TestServiceOrgs(t *testing.T) {
+	a := newAPI(t)
+	logger := log.NewLogger()
+	defer logger.Close()
+	orgs, gw := withOrg2(t, a, logger)
+	service := orgs.Service()
+
+	for _, tc := range []struct {
+		name   string
+		org    string
+		caller *http.Caller
+		code   codes.Code
+		stored *fabrictest.Gateway
+	}{
+		{"default", "", &http.Caller{Name: "ops", Permissions: http.Permissions{"*"}}, codes.OK, a.gateway},
+		{"org2", "org2", &http.Caller{Name: "ops", Permissions: http.Permissions{"*"}}, codes.OK, gw},
+		{"restricted", "org2", &http.Caller{Name: "erp", Orgs: []string{"org2"}, Permissions: http.Permissions{"*"}}, codes.OK, gw},
+		{"forbidden", "", &http.Caller{Name: "erp", Orgs: []string{"org2"}, Permissions: http.Permissions{"*"}}, codes.PermissionDenied, nil},
+		{"unknown", "org3", &http.Caller{Name: "ops", Permissions: http.Permissions{"*"}}, codes.NotFound, nil},
+	} {
+		ctx := http.ContextWithCaller(context.Background(), tc.caller)
+		if len(tc.org) > 0 {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(http.OrgHeader, tc.org))
+		}
+		_, err := service.Invoke(ctx, &pb.TransactionRequest{Args: []string{tc.name, "v"}, Chaincode: testChaincode, Channel: testChannel, Function: "Put"})
+		if status.Code(err) != tc.code {
+			t.Errorf("%s: got %v, want %s", tc.name, err, tc.code)
+		}
+		for _, g := range []*fabrictest.Gateway{a.gateway, gw} {
+			if stored := g.State(testChannel, testChaincode, tc.name) != nil; stored != (g == tc.stored) {
+				t.Errorf("%s: stored at the gateway of %s is %t", tc.name, map[bool]string{true: "org1", false: "org2"}[g == a.gateway], stored)
+			}
+		}
+	}
+}
+
+// endregion: grpc
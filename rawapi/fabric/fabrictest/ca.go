@@ -0,0 +1,292 @@
+package fabrictest
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// region: types
+
+// CA is a stand-in for the REST API of a Fabric CA, served over TLS on 127.0.0.1. It enrolls
+// registered identities, reenrolls and registers with the token of a certificate it issued, the
+// way fabric-ca-server checks it. The admin identity, with secret adminpw, is registered from
+// the start and may register others.
+type CA struct {
+	TLSCertPath string
+	URL         string
+	Validity    time.Duration
+
+	calls      map[string]int
+	cert       *x509.Certificate
+	certPEM    []byte
+	identities map[string]*caIdentity
+	key        *ecdsa.PrivateKey
+	mutex      sync.Mutex
+	server     *httptest.Server
+}
+
+type caIdentity struct {
+	enrollments int
+	secret      string
+	kind        string
+}
+
+// caError is the status and the message of a failed request.
+type caError struct {
+	message string
+	status  int
+}
+
+func (e *caError) Error() string {
+	return e.message
+}
+
+// endregion: types
+// region: lifecycle
+
+// NewCA starts a CA for the test, it is stopped when the test ends. Certificates are valid for
+// an hour unless Validity is changed.
+func NewCA(t testing.TB) *CA {
+	t.Helper()
+
+	root, err := newCredentials("fabrictest CA", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(root.cert)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ = pem.Decode(root.key)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &CA{
+		TLSCertPath: filepath.Join(t.TempDir(), "ca-tls.pem"),
+		Validity:    time.Hour,
+
+		calls:      make(map[string]int),
+		cert:       cert,
+		certPEM:    root.cert,
+		identities: map[string]*caIdentity{"admin": {secret: "adminpw", kind: "admin"}},
+		key:        key.(*ecdsa.PrivateKey),
+	}
+	ca.server = httptest.NewTLSServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.server.Close)
+	ca.URL = ca.server.URL
+
+	err = os.WriteFile(ca.TLSCertPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.server.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+// Add registers an identity of type client.
+func (ca *CA) Add(id, secret string) {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+	ca.identities[id] = &caIdentity{secret: secret, kind: "client"}
+}
+
+// Calls returns how many requests the path, eg. /api/v1/reenroll, has served successfully.
+func (ca *CA) Calls(path string) int {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+	return ca.calls[path]
+}
+
+// endregion: lifecycle
+// region: api
+
+func (ca *CA) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ca.reply(w, nil, err)
+		return
+	}
+	request := struct {
+		CertificateRequest string `json:"certificate_request"`
+		ID                 string `json:"id"`
+		Secret             string `json:"secret"`
+		Type               string `json:"type"`
+	}{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		ca.reply(w, nil, &caError{"invalid request body: " + err.Error(), http.StatusBadRequest})
+		return
+	}
+
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	var result interface{}
+	switch r.URL.Path {
+	case "/api/v1/enroll":
+		id, secret, ok := r.BasicAuth()
+		if identity, found := ca.identities[id]; !ok || !found || identity.secret != secret {
+			err = &caError{"authentication failure", http.StatusUnauthorized}
+			break
+		}
+		result, err = ca.issue(id, request.CertificateRequest)
+	case "/api/v1/reenroll":
+		var id string
+		if id, err = ca.authenticate(r, body); err == nil {
+			result, err = ca.issue(id, request.CertificateRequest)
+		}
+	case "/api/v1/register":
+		var id string
+		if id, err = ca.authenticate(r, body); err != nil {
+			break
+		}
+		if ca.identities[id].kind != "admin" {
+			err = &caError{id + " is not a registrar", http.StatusUnauthorized}
+			break
+		}
+		if _, exists := ca.identities[request.ID]; exists || len(request.ID) == 0 {
+			err = &caError{fmt.Sprintf("identity '%s' is already registered or invalid", request.ID), http.StatusBadRequest}
+			break
+		}
+		if len(request.Secret) == 0 {
+			request.Secret = fmt.Sprintf("%x", sha256.Sum256(append(body, ca.certPEM...)))[:16]
+		}
+		if len(request.Type) == 0 {
+			request.Type = "client"
+		}
+		ca.identities[request.ID] = &caIdentity{secret: request.Secret, kind: request.Type}
+		result = map[string]string{"secret": request.Secret}
+	default:
+		err = &caError{"not found", http.StatusNotFound}
+	}
+	if err == nil {
+		ca.calls[r.URL.Path]++
+	}
+	ca.reply(w, result, err)
+}
+
+// authenticate checks the token of a request: a certificate issued by the CA to a registered
+// identity and a low-S ECDSA signature of method.b64(uri).b64(body).b64(cert) with its key.
+func (ca *CA) authenticate(r *http.Request, body []byte) (string, error) {
+	unauthorized := func(message string) (string, error) {
+		return "", &caError{"authentication failure: " + message, http.StatusUnauthorized}
+	}
+	parts := strings.Split(r.Header.Get("Authorization"), ".")
+	if len(parts) != 2 {
+		return unauthorized("malformed token")
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return unauthorized("malformed certificate")
+	}
+	signature, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return unauthorized("malformed signature")
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return unauthorized("no certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || cert.CheckSignatureFrom(ca.cert) != nil {
+		return unauthorized("certificate is not issued by this CA")
+	}
+	if time.Now().After(cert.NotAfter) {
+		return unauthorized("certificate expired")
+	}
+	if _, ok := ca.identities[cert.Subject.CommonName]; !ok {
+		return unauthorized("unknown identity")
+	}
+
+	payload := r.Method + "." + base64.StdEncoding.EncodeToString([]byte(r.URL.RequestURI())) + "." + base64.StdEncoding.EncodeToString(body) + "." + parts[0]
+	digest := sha256.Sum256([]byte(payload))
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	sig := struct{ R, S *big.Int }{}
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil || !ok {
+		return unauthorized("malformed signature")
+	}
+	if sig.S.Cmp(new(big.Int).Rsh(key.Params().N, 1)) > 0 {
+		return unauthorized("signature is not low-S")
+	}
+	if !ecdsa.Verify(key, digest[:], sig.R, sig.S) {
+		return unauthorized("invalid signature")
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// issue signs the certificate request for id, the subject is replaced by the id.
+func (ca *CA) issue(id, csrPEM string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil {
+		return nil, &caError{"no certificate request", http.StatusBadRequest}
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		return nil, &caError{"invalid certificate request: " + err.Error(), http.StatusBadRequest}
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		NotAfter:     time.Now().Add(ca.Validity),
+		NotBefore:    time.Now().Add(-time.Minute),
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: id, OrganizationalUnit: []string{ca.identities[id].kind}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	ca.identities[id].enrollments++
+
+	result := map[string]interface{}{
+		"Cert":       base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"ServerInfo": map[string]string{"CAName": "fabrictest", "CAChain": base64.StdEncoding.EncodeToString(ca.certPEM)},
+	}
+	return result, nil
+}
+
+func (ca *CA) reply(w http.ResponseWriter, result interface{}, err error) {
+	response := map[string]interface{}{"errors": []interface{}{}, "messages": []interface{}{}, "result": result, "success": err == nil}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		var e *caError
+		if errors.As(err, &e) {
+			status = e.status
+		}
+		response["errors"] = []interface{}{map[string]interface{}{"code": status, "message": err.Error()}}
+		w.WriteHeader(status)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// endregion: api
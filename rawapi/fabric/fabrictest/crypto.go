@@ -0,0 +1,88 @@
+package fabrictest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// credentials are the self-signed certificate and key of one party, in PEM.
+type credentials struct {
+	cert []byte
+	key  []byte
+}
+
+// newCredentials creates a self-signed P-256 certificate, a server certificate valid for
+// localhost and 127.0.0.1 if server is true, a client one otherwise.
+func newCredentials(commonName string, server bool) (*credentials, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		NotBefore:             time.Now().Add(-time.Minute),
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"fabrictest"}},
+	}
+	if server {
+		template.DNSNames = []string{"localhost"}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &credentials{
+		cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	}, nil
+}
+
+func (c *credentials) tls() (tls.Certificate, error) {
+	return tls.X509KeyPair(c.cert, c.key)
+}
+
+// write puts the certificate to certPath and the key into keyDir, the way an msp directory
+// has them in signcerts and keystore.
+func (c *credentials) write(certPath, keyDir string) error {
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certPath, c.cert, 0600); err != nil {
+		return err
+	}
+	if len(keyDir) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(keyDir, "priv_sk"), c.key, 0600)
+}
@@ -0,0 +1,77 @@
+package fabrictest
+
+import (
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/orderer"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: deliver service
+
+// Deliver streams the blocks of the channel from the requested start position on, as they are
+// committed, which is what block event listeners subscribe to.
+func (g *Gateway) Deliver(stream peer.Deliver_DeliverServer) error {
+	ctx := stream.Context()
+	envelope, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	seek := &orderer.SeekInfo{}
+	if err := proto.Unmarshal(payload.GetData(), seek); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	channel := channelHeader.GetChannelId()
+
+	g.mutex.Lock()
+	next := g.blocks(channel)
+	g.mutex.Unlock()
+	switch start := seek.GetStart(); {
+	case start.GetSpecified() != nil:
+		next = start.GetSpecified().GetNumber()
+	case start.GetOldest() != nil:
+		next = 0
+	case start.GetNewest() != nil:
+		next--
+	}
+
+	// the call is counted once the stream is positioned, so that blocks cut after Calls reports
+	// it are delivered
+	if err := g.fault(ctx, PhaseDeliver); err != nil {
+		return err
+	}
+
+	for {
+		g.mutex.Lock()
+		var pending []*common.Block
+		if chain := g.chain(channel); next < uint64(len(chain)) {
+			pending = chain[next:]
+		}
+		changed := g.changed
+		g.mutex.Unlock()
+
+		for _, block := range pending {
+			if err := stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_Block{Block: block}}); err != nil {
+				return err
+			}
+			next++
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// endregion: deliver service
@@ -0,0 +1,541 @@
+// Package fabrictest runs an in-process fake of the Fabric Gateway and Deliver gRPC services, so
+// that the fabric clients of rawapi can be tested end to end without a network. Chaincode
+// behaviour is scripted per function against an in-memory world state, every submitted
+// transaction is cut into a block of its own, which qscc queries and block listeners see, and
+// faults (errors, delays, invalid commits) can be queued per gateway call. A stand-in of the
+// Fabric CA REST API covers enrollment.
+package fabrictest
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcCredentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: types
+
+// Phase is a call of the gateway service faults can be queued for.
+type Phase string
+
+const (
+	PhaseChaincodeEvents Phase = "ChaincodeEvents"
+	PhaseCommitStatus    Phase = "CommitStatus"
+	PhaseDeliver         Phase = "Deliver"
+	PhaseEndorse         Phase = "Endorse"
+	PhaseEvaluate        Phase = "Evaluate"
+	PhaseSubmit          Phase = "Submit"
+)
+
+// Gateway is a fake gateway peer listening on 127.0.0.1 with a self-signed TLS certificate. The
+// exported paths point to the credentials of a client identity and to the TLS root, ready to be
+// used by fabric.Client or rawapi's OrgSetup.
+type Gateway struct {
+	gateway.UnimplementedGatewayServer
+	peer.UnimplementedDeliverServer
+
+	CertPath     string
+	GatewayPeer  string
+	KeyPath      string
+	MSPID        string
+	PeerEndpoint string
+	TLSCertPath  string
+
+	calls     map[Phase]int
+	changed   chan struct{}
+	committed map[string]*gateway.CommitStatusResponse
+	events    map[string][]*gateway.ChaincodeEventsResponse
+	faults    map[Phase][]fault
+	functions map[string]Function
+	ledger    map[string][]*common.Block
+	invalid   []peer.TxValidationCode
+	mutex     sync.Mutex
+	peer      *credentials
+	pending   map[string]*Stub
+	server    *grpc.Server
+	state     map[string]map[string]*value
+}
+
+// fault is an error or a delay, or both, injected into the next call of a phase.
+type fault struct {
+	delay time.Duration
+	err   error
+}
+
+// endregion: types
+// region: lifecycle
+
+// New starts a gateway for the test, it is stopped and its credentials are removed when the
+// test ends.
+func New(t testing.TB) *Gateway {
+	t.Helper()
+	g, err := Start(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to start fake gateway: %s", err)
+	}
+	t.Cleanup(g.Close)
+	return g
+}
+
+// Start writes the credentials under dir and starts serving, Close stops it, dir is left to
+// the caller.
+func Start(dir string) (*Gateway, error) {
+	g := &Gateway{
+		CertPath:    filepath.Join(dir, "msp", "signcerts", "cert.pem"),
+		GatewayPeer: "localhost",
+		KeyPath:     filepath.Join(dir, "msp", "keystore"),
+		MSPID:       "Org1MSP",
+		TLSCertPath: filepath.Join(dir, "tls", "ca.crt"),
+
+		calls:     make(map[Phase]int),
+		changed:   make(chan struct{}),
+		committed: make(map[string]*gateway.CommitStatusResponse),
+		events:    make(map[string][]*gateway.ChaincodeEventsResponse),
+		faults:    make(map[Phase][]fault),
+		functions: make(map[string]Function),
+		ledger:    make(map[string][]*common.Block),
+		pending:   make(map[string]*Stub),
+		state:     make(map[string]map[string]*value),
+	}
+
+	// region: credentials
+
+	var err error
+	g.peer, err = newCredentials("peer0.org1.example.com", true)
+	if err != nil {
+		return nil, err
+	}
+	if err = g.peer.write(g.TLSCertPath, ""); err != nil {
+		return nil, err
+	}
+	user, err := newCredentials("User1@org1.example.com", false)
+	if err != nil {
+		return nil, err
+	}
+	if err = user.write(g.CertPath, g.KeyPath); err != nil {
+		return nil, err
+	}
+	certificate, err := g.peer.tls()
+	if err != nil {
+		return nil, err
+	}
+
+	// endregion: credentials
+	// region: server
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	g.PeerEndpoint = listener.Addr().String()
+
+	g.server = grpc.NewServer(grpc.Creds(grpcCredentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{certificate}})))
+	gateway.RegisterGatewayServer(g.server, g)
+	peer.RegisterDeliverServer(g.server, g)
+	go g.server.Serve(listener)
+
+	// endregion: server
+
+	return g, nil
+}
+
+// Close stops the server, pending calls and event streams are cancelled.
+func (g *Gateway) Close() {
+	g.server.Stop()
+}
+
+// RotateUser replaces the client identity at CertPath and KeyPath with a new certificate and
+// key of the same name, the way a reenrollment would.
+func (g *Gateway) RotateUser() error {
+	user, err := newCredentials("User1@org1.example.com", false)
+	if err != nil {
+		return err
+	}
+	return user.write(g.CertPath, g.KeyPath)
+}
+
+// endregion: lifecycle
+// region: scripting
+
+// Register sets the behaviour of chaincode:function on every channel.
+func (g *Gateway) Register(chaincode, function string, fn Function) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.functions[chaincode+":"+function] = fn
+}
+
+// SetState seeds the world state of the chaincode, a nil value deletes the key.
+func (g *Gateway) SetState(channel, chaincode, key string, data []byte) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.apply(channel, chaincode, map[string][]byte{key: data}, 0)
+}
+
+// State returns the committed value of key, nil if it does not exist.
+func (g *Gateway) State(channel, chaincode, key string) []byte {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if v, ok := g.namespace(channel, chaincode)[key]; ok {
+		return v.data
+	}
+	return nil
+}
+
+// Height returns the number of blocks of the channel, the genesis block included.
+func (g *Gateway) Height(channel string) uint64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.blocks(channel)
+}
+
+// Calls returns how many times phase has been called.
+func (g *Gateway) Calls(phase Phase) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.calls[phase]
+}
+
+// endregion: scripting
+// region: faults
+
+// Fail makes the next call of phase fail with err, the client wraps it into the matching
+// EndorseError, SubmitError or CommitStatusError. Use Error for an error the way the gateway
+// reports it.
+func (g *Gateway) Fail(phase Phase, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.faults[phase] = append(g.faults[phase], fault{err: err})
+}
+
+// Delay holds the next call of phase for d, or until the caller gives up, which is how
+// timeouts are tested.
+func (g *Gateway) Delay(phase Phase, d time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.faults[phase] = append(g.faults[phase], fault{delay: d})
+}
+
+// Invalidate makes the next submitted transaction get committed with code instead of VALID, so
+// that its commit status reports a CommitError.
+func (g *Gateway) Invalidate(code peer.TxValidationCode) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.invalid = append(g.invalid, code)
+}
+
+// Error returns an error with status code and an ErrorDetail of the fake peer, the way the
+// gateway reports endorsement and ordering failures.
+func (g *Gateway) Error(code codes.Code, message string) error {
+	st, err := status.New(code, message).WithDetails(&gateway.ErrorDetail{
+		Address: g.PeerEndpoint,
+		Message: message,
+		MspId:   g.MSPID,
+	})
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+// fault counts the call and plays the fault queued for it, if any.
+func (g *Gateway) fault(ctx context.Context, phase Phase) error {
+	g.mutex.Lock()
+	g.calls[phase]++
+	var f fault
+	if queue := g.faults[phase]; len(queue) > 0 {
+		f, g.faults[phase] = queue[0], queue[1:]
+	}
+	g.mutex.Unlock()
+
+	if f.delay > 0 {
+		timer := time.NewTimer(f.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return f.err
+}
+
+// endregion: faults
+// region: gateway service
+
+func (g *Gateway) Evaluate(ctx context.Context, in *gateway.EvaluateRequest) (*gateway.EvaluateResponse, error) {
+	if err := g.fault(ctx, PhaseEvaluate); err != nil {
+		return nil, err
+	}
+	p, err := parseProposal(in.GetProposedTransaction())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var result []byte
+	if _, ok := g.functions[p.chaincode+":"+p.function]; !ok && p.chaincode == "qscc" {
+		result, err = g.qscc(p)
+	} else {
+		_, result, err = g.execute(p)
+	}
+	if err != nil {
+		return nil, g.Error(codes.Unknown, fmt.Sprintf("evaluate call to endorser returned error: %s", err))
+	}
+	return &gateway.EvaluateResponse{Result: &peer.Response{Status: 200, Payload: result}}, nil
+}
+
+func (g *Gateway) Endorse(ctx context.Context, in *gateway.EndorseRequest) (*gateway.EndorseResponse, error) {
+	if err := g.fault(ctx, PhaseEndorse); err != nil {
+		return nil, err
+	}
+	p, err := parseProposal(in.GetProposedTransaction())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	stub, result, err := g.execute(p)
+	if err != nil {
+		return nil, g.Error(codes.Aborted, err.Error())
+	}
+	envelope, err := g.envelope(p, stub, result)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	g.pending[p.txid] = stub
+	return &gateway.EndorseResponse{PreparedTransaction: envelope}, nil
+}
+
+func (g *Gateway) Submit(ctx context.Context, in *gateway.SubmitRequest) (*gateway.SubmitResponse, error) {
+	if err := g.fault(ctx, PhaseSubmit); err != nil {
+		return nil, err
+	}
+	if len(in.GetPreparedTransaction().GetSignature()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "transaction is not signed")
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.committed[in.GetChannelId()+"/"+in.GetTransactionId()]; ok {
+		return &gateway.SubmitResponse{}, nil
+	}
+	stub, ok := g.pending[in.GetTransactionId()]
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "transaction %s has not been endorsed", in.GetTransactionId())
+	}
+	delete(g.pending, in.GetTransactionId())
+	g.commit(stub, in.GetPreparedTransaction())
+	return &gateway.SubmitResponse{}, nil
+}
+
+func (g *Gateway) CommitStatus(ctx context.Context, in *gateway.SignedCommitStatusRequest) (*gateway.CommitStatusResponse, error) {
+	if err := g.fault(ctx, PhaseCommitStatus); err != nil {
+		return nil, err
+	}
+	request := &gateway.CommitStatusRequest{}
+	if err := proto.Unmarshal(in.GetRequest(), request); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	for {
+		g.mutex.Lock()
+		response, ok := g.committed[request.GetChannelId()+"/"+request.GetTransactionId()]
+		changed := g.changed
+		g.mutex.Unlock()
+		if ok {
+			return response, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+func (g *Gateway) ChaincodeEvents(in *gateway.SignedChaincodeEventsRequest, stream gateway.Gateway_ChaincodeEventsServer) error {
+	ctx := stream.Context()
+	if err := g.fault(ctx, PhaseChaincodeEvents); err != nil {
+		return err
+	}
+	request := &gateway.ChaincodeEventsRequest{}
+	if err := proto.Unmarshal(in.GetRequest(), request); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	g.mutex.Lock()
+	next := g.blocks(request.GetChannelId())
+	g.mutex.Unlock()
+	switch {
+	case request.GetStartPosition().GetSpecified() != nil:
+		next = request.GetStartPosition().GetSpecified().GetNumber()
+	case request.GetStartPosition().GetOldest() != nil:
+		next = 0
+	}
+	// events of the start block up to and including the one of the checkpointed transaction are
+	// skipped, like the peer does
+	start, after := next, request.GetAfterTransactionId()
+
+	for {
+		g.mutex.Lock()
+		var pending []*gateway.ChaincodeEventsResponse
+		for _, response := range g.events[request.GetChannelId()] {
+			if response.GetBlockNumber() < next {
+				continue
+			}
+			events := make([]*peer.ChaincodeEvent, 0, len(response.GetEvents()))
+			for _, event := range response.GetEvents() {
+				if response.GetBlockNumber() == start && len(after) > 0 {
+					if event.GetTxId() == after {
+						after = ""
+					}
+					continue
+				}
+				if event.GetChaincodeId() == request.GetChaincodeId() {
+					events = append(events, event)
+				}
+			}
+			after = ""
+			if len(events) > 0 {
+				pending = append(pending, &gateway.ChaincodeEventsResponse{BlockNumber: response.GetBlockNumber(), Events: events})
+			}
+			next = response.GetBlockNumber() + 1
+		}
+		changed := g.changed
+		g.mutex.Unlock()
+
+		for _, response := range pending {
+			if err := stream.Send(response); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// endregion: gateway service
+// region: ledger
+
+// execute runs the function of the proposal against the world state, g.mutex must be held.
+func (g *Gateway) execute(p *proposal) (*Stub, []byte, error) {
+	fn, ok := g.functions[p.chaincode+":"+p.function]
+	if !ok {
+		return nil, nil, fmt.Errorf("chaincode response 500, function %s not found in chaincode %s", p.function, p.chaincode)
+	}
+	stub := newStub(p, g.namespace(p.channel, p.chaincode))
+	result, err := fn(stub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chaincode response 500, %s", err)
+	}
+	return stub, result, nil
+}
+
+// commit cuts a block with the transaction, applies its writes and events if it is valid and
+// wakes up the commit status, event and block waiters, g.mutex must be held.
+func (g *Gateway) commit(stub *Stub, envelope *common.Envelope) {
+	code := peer.TxValidationCode_VALID
+	if len(g.invalid) > 0 {
+		code, g.invalid = g.invalid[0], g.invalid[1:]
+	}
+	block := g.cut(stub.Channel, envelope, code)
+	g.committed[stub.Channel+"/"+stub.Txid] = &gateway.CommitStatusResponse{BlockNumber: block, Result: code}
+
+	if code == peer.TxValidationCode_VALID {
+		g.apply(stub.Channel, stub.Chaincode, stub.writes, block)
+		if len(stub.events) > 0 {
+			g.events[stub.Channel] = append(g.events[stub.Channel], &gateway.ChaincodeEventsResponse{
+				BlockNumber: block,
+				Events:      stub.events[len(stub.events)-1:],
+			})
+		}
+	}
+
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+func (g *Gateway) apply(channel, chaincode string, writes map[string][]byte, block uint64) {
+	ns := g.namespace(channel, chaincode)
+	for key, data := range writes {
+		if data == nil {
+			delete(ns, key)
+			continue
+		}
+		ns[key] = &value{block: block, data: data}
+	}
+}
+
+func (g *Gateway) namespace(channel, chaincode string) map[string]*value {
+	key := strings.Join([]string{channel, chaincode}, "/")
+	ns, ok := g.state[key]
+	if !ok {
+		ns = make(map[string]*value)
+		g.state[key] = ns
+	}
+	return ns
+}
+
+// blocks returns the height of the channel, which starts with a genesis block.
+func (g *Gateway) blocks(channel string) uint64 {
+	return uint64(len(g.chain(channel)))
+}
+
+// chain returns the blocks of the channel, starting it with an empty genesis block if it has
+// none yet, g.mutex must be held.
+func (g *Gateway) chain(channel string) []*common.Block {
+	if _, ok := g.ledger[channel]; !ok {
+		g.ledger[channel] = []*common.Block{newBlock(nil, 0, nil, nil)}
+	}
+	return g.ledger[channel]
+}
+
+// cut appends a block of the transaction to the chain of the channel and returns its number,
+// g.mutex must be held.
+func (g *Gateway) cut(channel string, envelope *common.Envelope, code peer.TxValidationCode) uint64 {
+	chain := g.chain(channel)
+	raw, _ := proto.Marshal(envelope)
+	number := uint64(len(chain))
+	g.ledger[channel] = append(chain, newBlock(chain[len(chain)-1].GetHeader(), number, raw, []byte{byte(code)}))
+	return number
+}
+
+// newBlock builds a block of one serialized envelope, or none, chained to previous and carrying the
+// validation codes of its transactions in the metadata, the way the peer keeps them.
+func newBlock(previous *common.BlockHeader, number uint64, envelope []byte, filter []byte) *common.Block {
+	data := &common.BlockData{}
+	if envelope != nil {
+		data.Data = [][]byte{envelope}
+	}
+	hash := sha256.Sum256(envelope)
+	header := &common.BlockHeader{DataHash: hash[:], Number: number}
+	if previous != nil {
+		header.PreviousHash = tc.BlockHash(previous)
+	}
+	metadata := make([][]byte, len(common.BlockMetadataIndex_name))
+	metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = filter
+	return &common.Block{Data: data, Header: header, Metadata: &common.BlockMetadata{Metadata: metadata}}
+}
+
+// endregion: ledger
@@ -0,0 +1,193 @@
+package fabrictest
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: proposal
+
+// proposal is a signed proposal taken apart, keeping the serialized parts the endorsed
+// transaction is built from.
+type proposal struct {
+	args      []string
+	channel   string
+	chaincode string
+	creator   []byte
+	function  string
+	header    *common.Header
+	payload   []byte
+	raw       []byte
+	txid      string
+}
+
+func parseProposal(signed *peer.SignedProposal) (*proposal, error) {
+	p := &peer.Proposal{}
+	if err := proto.Unmarshal(signed.GetProposalBytes(), p); err != nil {
+		return nil, fmt.Errorf("failed to deserialize proposal: %w", err)
+	}
+	header := &common.Header{}
+	if err := proto.Unmarshal(p.GetHeader(), header); err != nil {
+		return nil, fmt.Errorf("failed to deserialize proposal header: %w", err)
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(header.GetChannelHeader(), channelHeader); err != nil {
+		return nil, fmt.Errorf("failed to deserialize channel header: %w", err)
+	}
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(header.GetSignatureHeader(), signatureHeader); err != nil {
+		return nil, fmt.Errorf("failed to deserialize signature header: %w", err)
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.GetCreator(), creator); err != nil {
+		return nil, fmt.Errorf("failed to deserialize creator: %w", err)
+	}
+	if err := verify(creator.GetIdBytes(), signed.GetProposalBytes(), signed.GetSignature()); err != nil {
+		return nil, fmt.Errorf("proposal %s: %w", channelHeader.GetTxId(), err)
+	}
+	payload := &peer.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(p.GetPayload(), payload); err != nil {
+		return nil, fmt.Errorf("failed to deserialize proposal payload: %w", err)
+	}
+	spec := &peer.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(payload.GetInput(), spec); err != nil {
+		return nil, fmt.Errorf("failed to deserialize invocation spec: %w", err)
+	}
+
+	input := spec.GetChaincodeSpec().GetInput().GetArgs()
+	if len(input) == 0 {
+		return nil, fmt.Errorf("proposal %s has no function", channelHeader.GetTxId())
+	}
+	args := make([]string, 0, len(input)-1)
+	for _, arg := range input[1:] {
+		args = append(args, string(arg))
+	}
+
+	return &proposal{
+		args:      args,
+		channel:   channelHeader.GetChannelId(),
+		chaincode: spec.GetChaincodeSpec().GetChaincodeId().GetName(),
+		creator:   creator.GetIdBytes(),
+		function:  string(input[0]),
+		header:    header,
+		payload:   p.GetPayload(),
+		raw:       signed.GetProposalBytes(),
+		txid:      channelHeader.GetTxId(),
+	}, nil
+}
+
+// verify checks the signature of message against the ECDSA key of the PEM certificate, the way
+// an endorser checks that a proposal was signed by its creator.
+func verify(certificatePEM, message, signature []byte) error {
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil {
+		return errors.New("creator has no certificate")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid creator certificate: %w", err)
+	}
+	key, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("creator certificate has no ECDSA key")
+	}
+	digest := sha256.Sum256(message)
+	if !ecdsa.VerifyASN1(key, digest[:], signature) {
+		return errors.New("signature does not match the creator certificate")
+	}
+	return nil
+}
+
+// endregion: proposal
+// region: envelope
+
+// envelope builds the unsigned transaction envelope the gateway returns from Endorse, with the
+// result, read/write set and event of the stub, endorsed by the fake peer.
+func (g *Gateway) envelope(p *proposal, stub *Stub, result []byte) (*common.Envelope, error) {
+	results, err := proto.Marshal(&rwset.TxReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsRwset:   []*rwset.NsReadWriteSet{{Namespace: p.chaincode, Rwset: stub.rwset()}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var events []byte
+	if len(stub.events) > 0 {
+		events, err = proto.Marshal(stub.events[len(stub.events)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	action, err := proto.Marshal(&peer.ChaincodeAction{
+		ChaincodeId: &peer.ChaincodeID{Name: p.chaincode, Version: "1.0"},
+		Events:      events,
+		Response:    &peer.Response{Status: 200, Payload: result},
+		Results:     results,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(p.raw)
+	responsePayload, err := proto.Marshal(&peer.ProposalResponsePayload{Extension: action, ProposalHash: hash[:]})
+	if err != nil {
+		return nil, err
+	}
+	endorser, err := proto.Marshal(&msp.SerializedIdentity{Mspid: g.MSPID, IdBytes: g.peer.cert})
+	if err != nil {
+		return nil, err
+	}
+	actionPayload, err := proto.Marshal(&peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{
+			Endorsements:            []*peer.Endorsement{{Endorser: endorser, Signature: []byte("fabrictest")}},
+			ProposalResponsePayload: responsePayload,
+		},
+		ChaincodeProposalPayload: p.payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := proto.Marshal(&peer.Transaction{
+		Actions: []*peer.TransactionAction{{Header: p.header.GetSignatureHeader(), Payload: actionPayload}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&common.Payload{Data: transaction, Header: p.header})
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.Envelope{Payload: payload}, nil
+}
+
+// rwset serializes the reads and writes of the stub.
+func (s *Stub) rwset() []byte {
+	set := &kvrwset.KVRWSet{}
+	for _, key := range s.readOrder {
+		read := &kvrwset.KVRead{Key: key}
+		if block := s.reads[key]; block > 0 {
+			read.Version = &kvrwset.Version{BlockNum: block}
+		}
+		set.Reads = append(set.Reads, read)
+	}
+	for _, key := range s.writeOrder {
+		data := s.writes[key]
+		set.Writes = append(set.Writes, &kvrwset.KVWrite{Key: key, IsDelete: data == nil, Value: data})
+	}
+	raw, _ := proto.Marshal(set)
+	return raw
+}
+
+// endregion: envelope
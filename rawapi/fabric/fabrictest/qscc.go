@@ -0,0 +1,66 @@
+package fabrictest
+
+import (
+	"fmt"
+	"strconv"
+
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// region: qscc
+
+// qscc answers the ledger queries of the qscc system chaincode from the blocks of the channel,
+// unless a test registered functions of its own, g.mutex must be held.
+func (g *Gateway) qscc(p *proposal) ([]byte, error) {
+	if len(p.args) == 0 {
+		return nil, fmt.Errorf("chaincode response 500, incorrect number of arguments, %d", len(p.args))
+	}
+	chain := g.chain(p.args[0])
+
+	switch p.function {
+	case "GetChainInfo":
+		top := chain[len(chain)-1].GetHeader()
+		return proto.Marshal(&common.BlockchainInfo{
+			CurrentBlockHash:  tc.BlockHash(top),
+			Height:            uint64(len(chain)),
+			PreviousBlockHash: top.GetPreviousHash(),
+		})
+	case "GetBlockByNumber":
+		if len(p.args) < 2 {
+			return nil, fmt.Errorf("chaincode response 500, incorrect number of arguments, %d", len(p.args))
+		}
+		number, err := strconv.ParseUint(p.args[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chaincode response 500, failed to parse block number with error %s", err)
+		}
+		if number >= uint64(len(chain)) {
+			return nil, fmt.Errorf("chaincode response 500, failed to get block number %d, error entry not found in index", number)
+		}
+		return proto.Marshal(chain[number])
+	case "GetTransactionByID":
+		if len(p.args) < 2 {
+			return nil, fmt.Errorf("chaincode response 500, incorrect number of arguments, %d", len(p.args))
+		}
+		for _, block := range chain {
+			filter := block.GetMetadata().GetMetadata()[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+			for i, raw := range block.GetData().GetData() {
+				envelope := &common.Envelope{}
+				payload := &common.Payload{}
+				channelHeader := &common.ChannelHeader{}
+				if proto.Unmarshal(raw, envelope) != nil || proto.Unmarshal(envelope.GetPayload(), payload) != nil || proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader) != nil {
+					continue
+				}
+				if channelHeader.GetTxId() == p.args[1] {
+					return proto.Marshal(&peer.ProcessedTransaction{TransactionEnvelope: envelope, ValidationCode: int32(filter[i])})
+				}
+			}
+		}
+		return nil, fmt.Errorf("chaincode response 500, failed to get transaction with id %s, error entry not found in index", p.args[1])
+	}
+	return nil, fmt.Errorf("chaincode response 500, requested function %s not found", p.function)
+}
+
+// endregion: qscc
@@ -0,0 +1,91 @@
+package fabrictest
+
+import (
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+// Function is the scripted behaviour of a chaincode function, the result is returned to the
+// client as is, an error is reported the way a chaincode error response would be.
+type Function func(stub *Stub) ([]byte, error)
+
+// Stub is what a Function sees of the ledger: the invocation, the PEM certificate of the
+// client that signed it and the world state of its chaincode,
+// reads and writes are recorded in the read/write set of the transaction, writes are applied
+// when the transaction is committed as valid. Functions run under the lock of the gateway and
+// must not call its methods.
+type Stub struct {
+	Args      []string
+	Channel   string
+	Chaincode string
+	Creator   []byte
+	Function  string
+	Txid      string
+
+	events     []*peer.ChaincodeEvent
+	readOrder  []string
+	reads      map[string]uint64
+	state      map[string]*value
+	writeOrder []string
+	writes     map[string][]byte
+}
+
+// value is a key of the world state with the block it was last written in.
+type value struct {
+	block uint64
+	data  []byte
+}
+
+func newStub(p *proposal, state map[string]*value) *Stub {
+	return &Stub{
+		Args:      p.args,
+		Channel:   p.channel,
+		Chaincode: p.chaincode,
+		Creator:   p.creator,
+		Function:  p.function,
+		Txid:      p.txid,
+		reads:     make(map[string]uint64),
+		state:     state,
+		writes:    make(map[string][]byte),
+	}
+}
+
+// GetState returns the value of key, or nil if it does not exist, writes of the same
+// transaction are visible.
+func (s *Stub) GetState(key string) []byte {
+	if data, ok := s.writes[key]; ok {
+		return data
+	}
+	if _, ok := s.reads[key]; !ok {
+		s.readOrder = append(s.readOrder, key)
+	}
+	v, ok := s.state[key]
+	if !ok {
+		s.reads[key] = 0
+		return nil
+	}
+	s.reads[key] = v.block
+	return v.data
+}
+
+// PutState writes key, a nil value deletes it.
+func (s *Stub) PutState(key string, data []byte) {
+	if _, ok := s.writes[key]; !ok {
+		s.writeOrder = append(s.writeOrder, key)
+	}
+	s.writes[key] = data
+}
+
+func (s *Stub) DelState(key string) {
+	s.PutState(key, nil)
+}
+
+// SetEvent sets the chaincode event of the transaction, like in Fabric only the last one
+// is kept.
+func (s *Stub) SetEvent(name string, payload []byte) {
+	s.events = append(s.events, &peer.ChaincodeEvent{
+		ChaincodeId: s.Chaincode,
+		EventName:   name,
+		Payload:     payload,
+		TxId:        s.Txid,
+	})
+}
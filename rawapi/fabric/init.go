@@ -1,34 +1,49 @@
 package fabric
 
 import (
-	"crypto/x509"
 	"errors"
 	"fmt"
-	"path"
+	"sort"
+	"sync"
 	"time"
 
-	"io/ioutil"
-
 	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
 	"github.com/SandorMiskey/TrustChain/rawapi/http"
-	"github.com/hyperledger/fabric-gateway/pkg/client"
-	"github.com/hyperledger/fabric-gateway/pkg/identity"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	"github.com/SandorMiskey/TrustChain/rawapi/queue"
+	"github.com/SandorMiskey/TrustChain/rawapi/webhook"
 )
 
 type OrgSetup struct {
-	CertPath     string      `json:"CertPath"`
-	GatewayPeer  string      `json:"GatewayPeer"`
-	KeyPath      string      `json:"KeyPath"`
-	Lator        *Lator      `json:"Lator"`
-	Logger       *log.Logger `json:"-"`
-	MSPID        string      `json:"MSPID"`
-	OrgName      string      `json:"OrgName"`
-	PeerEndpoint string      `json:"PeerEndpoint"`
-	TLSCertPath  string      `json:"TLSCertPath"`
-
-	gateway *client.Gateway `json:"-"`
+	CA               *tc.CA            `json:"CA"`
+	Cache            *Cache            `json:"Cache"`
+	CertPath         string            `json:"CertPath"`
+	ConsistencyPeers string            `json:"ConsistencyPeers"`
+	GatewayPeer      string            `json:"GatewayPeer"`
+	Identity         string            `json:"Identity"`
+	KeyPath          string            `json:"KeyPath"`
+	Lator            *tc.Lator         `json:"Lator"`
+	Logger           *log.Logger       `json:"-"`
+	MSPID            string            `json:"MSPID"`
+	OrgName          string            `json:"OrgName"`
+	Peer             string            `json:"Peer"`
+	PeerEndpoint     string            `json:"PeerEndpoint"`
+	Profile          string            `json:"Profile"`
+	Queue            *queue.Queue      `json:"Queue"`
+	Reload           time.Duration     `json:"Reload"`
+	RenewBefore      time.Duration     `json:"RenewBefore"`
+	RenewCheck       time.Duration     `json:"RenewCheck"`
+	TLSCertPath      string            `json:"TLSCertPath"`
+	Timeouts         *Timeouts         `json:"Timeouts"`
+	Transactions     *Transactions     `json:"Transactions"`
+	Wallet           *tc.Wallet        `json:"Wallet"`
+	Webhooks         *webhook.Webhooks `json:"Webhooks"`
+
+	client          *tc.Client            `json:"-"`
+	identities      map[string]*tc.Client `json:"-"`
+	identitiesMutex sync.Mutex            `json:"-"`
+	profile         *tc.Profile           `json:"-"`
+	stop            chan struct{}         `json:"-"`
 }
 
 // Initialize the setup for the organization.
@@ -54,34 +69,64 @@ func (s *OrgSetup) Init() (*OrgSetup, error) {
 	// endregion: configtxlator
 	// region: connection and gateway
 
-	clientConnection, err := s.newGrpcConnection()
-	if err != nil {
-		return s, err
+	client := &tc.Client{
+		CertPath:     s.CertPath,
+		GatewayPeer:  s.GatewayPeer,
+		KeyPath:      s.KeyPath,
+		MSPID:        s.MSPID,
+		PeerEndpoint: s.PeerEndpoint,
+		TLSCertPath:  s.TLSCertPath,
 	}
-	id, err := s.newIdentity()
-	if err != nil {
-		return s, err
+	if len(s.Profile) > 0 {
+		var err error
+		client, err = s.profileClient()
+		if err != nil {
+			return s, err
+		}
+		logger(log.LOG_INFO, fmt.Sprintf("connection profile %s: %s (%s) via %s at %s", s.Profile, s.OrgName, s.MSPID, s.GatewayPeer, s.PeerEndpoint))
 	}
-	sign, err := s.newSign()
-	if err != nil {
-		return s, err
+	if s.Wallet != nil && (len(s.Identity) > 0 || len(s.KeyPath) == 0) {
+		client.Label = s.Identity
+		client.Wallet = s.Wallet
 	}
-
-	gateway, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
+	client.Timeouts = s.Timeouts.For("", "")
+	err := client.Init()
 	if err != nil {
 		return s, err
 	}
-	s.gateway = gateway
+	s.client = client
+
+	stop := make(chan struct{})
+	s.stop = stop
+	if s.Reload > 0 {
+		go every(stop, s.Reload, func() {
+			if err := s.ReloadCredentials(); err != nil {
+				logger(log.LOG_ERR, "error while reloading fabric credentials, keeping the previous ones", err)
+			}
+		})
+	}
 
 	// endregion: connection and gateway
+	// region: reenrollment
+
+	if s.CA != nil {
+		err = s.CA.Init()
+		if err != nil {
+			return s, fmt.Errorf("CA for reenrollment: %w", err)
+		}
+		if err := s.RenewCredentials(); err != nil {
+			logger(log.LOG_ERR, "error while renewing fabric credentials", err)
+		}
+		if s.RenewCheck > 0 {
+			go every(stop, s.RenewCheck, func() {
+				if err := s.RenewCredentials(); err != nil {
+					logger(log.LOG_ERR, "error while renewing fabric credentials", err)
+				}
+			})
+		}
+	}
+
+	// endregion: reenrollment
 	// region: out
 
 	logger(log.LOG_INFO, "initialization complete")
@@ -91,81 +136,159 @@ func (s *OrgSetup) Init() (*OrgSetup, error) {
 
 }
 
-func (setup *OrgSetup) validate(response *http.Response) error {
-	if setup.Logger == nil || setup.gateway == nil {
-		return errors.New("fabric.OrgSetup.Invoke() needs a logger and a gateway, fabric.OrgSetup.Init() first")
+// every calls fn every d until stop is closed.
+func every(stop <-chan struct{}, d time.Duration, fn func()) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
 
-		// response.Status = 500
-		// response.Message = "fabric.OrgSetup.Invoke() needs a logger and a gateway, fabric.OrgSetup.Init() first"
-		// response.Send(nil)
-		// return errors.New(response.Message.(string))
+// Close stops the reload and the renewal of the credentials.
+func (s *OrgSetup) Close() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
 	}
-	return nil
 }
 
-// newGrpcConnection creates a gRPC connection to the Gateway server.
-func (setup *OrgSetup) newGrpcConnection() (*grpc.ClientConn, error) {
-	certificate, err := loadCertificate(setup.TLSCertPath)
+// profileClient describes the connection of the organization in the connection profile, OrgName
+// if the profile has such an organization, client.organization otherwise, through Peer or the
+// first peer of the organization. The connection settings of the setup are overwritten with
+// those of the profile, so is a CA without URL with the first CA of the organization, if it has
+// none, reenrollment is disabled. The profile is kept to look the peers of Consistency up in.
+func (s *OrgSetup) profileClient() (*tc.Client, error) {
+	profile, err := tc.LoadProfile(s.Profile)
 	if err != nil {
 		return nil, err
 	}
-
-	certPool := x509.NewCertPool()
-	certPool.AddCert(certificate)
-	transportCredentials := credentials.NewClientTLSFromCert(certPool, setup.GatewayPeer)
-
-	connection, err := grpc.Dial(setup.PeerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	s.profile = profile
+	org := s.OrgName
+	if _, ok := profile.Organizations[org]; !ok {
+		org = profile.Client.Organization
+	}
+	client, err := profile.NewClient(org, s.Peer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+		return nil, fmt.Errorf("connection profile %s: %w", s.Profile, err)
 	}
-
-	return connection, nil
+	if len(org) > 0 {
+		s.OrgName = org
+	}
+	if s.CA != nil && len(s.CA.URL) == 0 {
+		ca, err := profile.NewCA(org)
+		if err == nil {
+			ca.Timeout = s.CA.Timeout
+		}
+		s.CA = ca
+	}
+	s.CertPath = client.CertPath
+	s.GatewayPeer = client.GatewayPeer
+	s.KeyPath = client.KeyPath
+	s.MSPID = client.MSPID
+	s.PeerEndpoint = client.PeerEndpoint
+	s.TLSCertPath = client.TLSCertPath
+	return client, nil
 }
 
-// newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
-func (setup *OrgSetup) newIdentity() (*identity.X509Identity, error) {
-	certificate, err := loadCertificate(setup.CertPath)
-	if err != nil {
-		return nil, err
+// ReloadCredentials picks up the certificate, private key and TLS root of the gateway identity
+// if they changed on disk, eg. after a reenrollment, without dropping the connection to the
+// gateway peer, or in the wallet if it is a wallet identity. Other wallet identities are not
+// affected.
+func (setup *OrgSetup) ReloadCredentials() error {
+	if setup.client == nil {
+		return errors.New("fabric.OrgSetup needs a gateway, fabric.OrgSetup.Init() first")
 	}
-
-	id, err := identity.NewX509Identity(setup.MSPID, certificate)
+	changed, err := setup.client.Reload()
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	return id, nil
+	if changed && len(setup.client.Label) > 0 {
+		setup.Logger.Out(log.LOG_NOTICE, fmt.Sprintf("reloaded fabric credentials of %s from wallet identity %s and %s", setup.OrgName, setup.Identity, setup.TLSCertPath))
+	} else if changed {
+		setup.Logger.Out(log.LOG_NOTICE, fmt.Sprintf("reloaded fabric credentials of %s from %s, %s and %s", setup.OrgName, setup.CertPath, setup.KeyPath, setup.TLSCertPath))
+	}
+	return nil
 }
 
-// newSign creates a function that generates a digital signature from a message digest using a private key.
-func (setup *OrgSetup) newSign() (identity.Sign, error) {
-	files, err := ioutil.ReadDir(setup.KeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+func (setup *OrgSetup) validate(response *http.Response) error {
+	if setup.Logger == nil || setup.client == nil {
+		return errors.New("fabric.OrgSetup needs a logger and a gateway, fabric.OrgSetup.Init() first")
 	}
-	privateKeyPEM, err := ioutil.ReadFile(path.Join(setup.KeyPath, files[0].Name()))
+	return nil
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %w", err)
-	}
+// GatewayStatus is the state of the connection to the gateway peer and of the identities
+// opened over it.
+type GatewayStatus struct {
+	GatewayPeer  string   `json:"gateway_peer"`
+	Identities   []string `json:"identities"`
+	MSPID        string   `json:"msp_id"`
+	PeerEndpoint string   `json:"peer_endpoint"`
+	State        string   `json:"state"`
+}
 
-	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
-	if err != nil {
-		return nil, err
+func (setup *OrgSetup) GatewayStatus() GatewayStatus {
+	status := GatewayStatus{
+		GatewayPeer:  setup.GatewayPeer,
+		Identities:   make([]string, 0),
+		MSPID:        setup.MSPID,
+		PeerEndpoint: setup.PeerEndpoint,
+		State:        "SHUTDOWN",
+	}
+	if setup.client != nil {
+		status.State = setup.client.State()
 	}
 
-	sign, err := identity.NewPrivateKeySign(privateKey)
-	if err != nil {
-		return nil, err
+	setup.identitiesMutex.Lock()
+	defer setup.identitiesMutex.Unlock()
+	for label := range setup.identities {
+		status.Identities = append(status.Identities, label)
 	}
+	sort.Strings(status.Identities)
 
-	return sign, nil
+	return status
 }
 
-func loadCertificate(filename string) (*x509.Certificate, error) {
-	certificatePEM, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+// Certificates returns the certificates of the organization to watch for expiry, those of the
+// gateway identity and of the wallet identities of the organization, the TLS root of the
+// gateway peer and that of the CA, unreadable ones without PEM, see certs.Source.
+func (setup *OrgSetup) Certificates() map[string][]byte {
+	certificates := make(map[string][]byte)
+	prefix := setup.OrgName + " "
+	if setup.client != nil {
+		certificates[prefix+"gateway identity"], _, _ = setup.client.Credentials()
+		certificates[prefix+"gateway TLS root"], _ = setup.client.TLSRoot()
+	}
+	if setup.CA != nil {
+		rootPEM, err := setup.CA.TLSRoot()
+		if err != nil {
+			setup.Logger.Out(log.LOG_ERR, err)
+		}
+		if err != nil || len(rootPEM) > 0 {
+			certificates[prefix+"CA TLS root"] = rootPEM
+		}
+	}
+	if setup.Wallet != nil {
+		labels, err := setup.Wallet.List()
+		if err != nil {
+			setup.Logger.Out(log.LOG_ERR, "wallet", err)
+		}
+		for _, label := range labels {
+			id, err := setup.Wallet.Peek(label)
+			switch {
+			case err != nil:
+				setup.Logger.Out(log.LOG_ERR, "wallet", err)
+				certificates[prefix+"wallet identity "+label] = nil
+			case id.MSPID == setup.MSPID:
+				certificates[prefix+"wallet identity "+label] = []byte(id.Credentials.Certificate)
+			}
+		}
 	}
-	return identity.CertificateFromPEM(certificatePEM)
+	return certificates
 }
@@ -7,8 +7,8 @@ import (
 	"fmt"
 
 	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
 	"github.com/SandorMiskey/TrustChain/rawapi/http"
-	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/valyala/fasthttp"
 )
 
@@ -22,18 +22,17 @@ func (setup *OrgSetup) Invoke(ctx *fasthttp.RequestCtx) {
 
 	// region: request and response
 
-	response := &http.Response{
-		CTX:    ctx,
-		Logger: setup.Logger,
-	}
 	request := &request{
-		response: response,
+		response: &http.Response{
+			CTX:    ctx,
+			Logger: setup.Logger,
+		},
 	}
 
 	// endregion: request and response
 	// region: check for gateway and logger
 
-	request.err = setup.validate(response)
+	request.err = setup.validate(request.response)
 	if request.err != nil {
 		return
 	}
@@ -60,54 +59,54 @@ func (setup *OrgSetup) Invoke(ctx *fasthttp.RequestCtx) {
 	// TODO: validate values
 
 	// endregion: form values
-	// region: proposal
+	// region: authorize
 
-	request.network = setup.gateway.GetNetwork(request.form.Channel)
-	request.contract = request.network.GetContract(request.form.Chaincode)
-	request.proposal, request.err = request.contract.NewProposal(request.form.Function, client.WithArguments(request.form.Args...))
-	if request.err != nil {
-		request.error(nil)
+	if !setup.authorize(request) {
 		return
 	}
-	logger(log.LOG_INFO, ctx.ID(), "invoke request proposal succeeded")
-	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("invoke request details: request -> %#v", request))
 
-	// endregion: proposal
-	// region: endorse
+	// endregion: authorize
+	// region: queue
 
-	request.transaction, request.err = request.proposal.Endorse()
-	if request.err != nil {
-		request.error(nil)
+	if setup.Queue != nil {
+		setup.enqueue(request)
 		return
 	}
-	logger(log.LOG_INFO, ctx.ID(), "invoke request proposal endorsed")
-	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("endorsed: request -> %#v", request))
 
-	// endregion: endorse
-	// region: commit
+	// endregion: queue
+	// region: submit
 
-	request.commit, request.err = request.transaction.Submit()
-	if request.err != nil {
-		request.error(nil)
+	fabricRequest := request.fabricRequest(request.client)
+	transaction, responseErr := tc.Endorse(fabricRequest)
+	if responseErr != nil {
+		request.error(responseErr)
 		return
 	}
-	logger(log.LOG_INFO, ctx.ID(), fmt.Sprintf("invoke request committed, transaction ID: %s, response: %s", request.commit.TransactionID(), request.transaction.Result()))
-	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("committed: request -> %#v", request))
+	response, responseErr := tc.Submit(fabricRequest, transaction)
+	setup.Transactions.keep(ctx.ID(), http.CallerOf(ctx).Name, request.form, transaction)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+	logger(log.LOG_INFO, ctx.ID(), fmt.Sprintf("invoke request submitted, transaction ID: %s, response: %s", response.Txid, response.Result))
+	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("submitted: request -> %#v", request))
 
-	// endregion: commit
+	// endregion: submit
 	// region: closing
 
+	request.audit(response.Txid)
+
 	out := message{
-		ID:     request.commit.TransactionID(),
+		ID:     response.Txid,
 		Form:   request.form,
 		Status: "OK",
-		// Result: request.transaction.Result(),
+		// Result: response.Result,
 	}
 
 	var rawData json.RawMessage
-	request.err = json.Unmarshal([]byte(request.transaction.Result()), &rawData)
+	request.err = json.Unmarshal([]byte(response.Result), &rawData)
 	if request.err != nil {
-		logger(log.LOG_ERR, fmt.Sprintf("error processing json.RawMessage in Invoke() request -> %s -> %s", request.transaction.Result(), request.err))
+		logger(log.LOG_ERR, fmt.Sprintf("error processing json.RawMessage in Invoke() request -> %s -> %s", response.Result, request.err))
 		out.Result = nil
 		// request.error(err)
 		// return
@@ -116,8 +115,8 @@ func (setup *OrgSetup) Invoke(ctx *fasthttp.RequestCtx) {
 	}
 	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("result -> %s", rawData))
 
-	response.Message = out
-	response.SendJSON(nil)
+	request.response.Message = out
+	request.response.SendJSON(nil)
 
 	// endregion: closing
 
@@ -0,0 +1,93 @@
+// region: packages
+
+package fabric
+
+import (
+	"fmt"
+
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/grpc/codes"
+)
+
+// endregion: packages
+// region: handlers
+
+//
+// ChaincodeDefinitions handles GET /channels/{channel}/chaincodes with the committed chaincode definitions.
+//
+
+func (setup *OrgSetup) ChaincodeDefinitions(ctx *fasthttp.RequestCtx) {
+	request, ok := setup.explorerRequest(ctx, "_lifecycle", "QueryChaincodeDefinitions")
+	if !ok {
+		return
+	}
+
+	definitions, responseErr := request.client.ChaincodeDefinitions(http.ContextOf(ctx), request.timeouts, request.form.Channel)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+
+	request.response.Message = message{ID: "-", Status: "OK", Result: definitions}
+	request.response.SendJSON(nil)
+}
+
+//
+// ChaincodeDefinition handles GET /channels/{channel}/chaincodes/{name} with the committed
+// definition and the approvals of each org.
+//
+
+func (setup *OrgSetup) ChaincodeDefinition(ctx *fasthttp.RequestCtx) {
+	request, ok := setup.explorerRequest(ctx, "_lifecycle", "QueryChaincodeDefinition")
+	if !ok {
+		return
+	}
+	name := fmt.Sprint(ctx.UserValue("name"))
+	request.form.Args = append(request.form.Args, name)
+
+	definition, responseErr := request.client.ChaincodeDefinition(http.ContextOf(ctx), request.timeouts, request.form.Channel, name)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+
+	request.response.Message = message{ID: "-", Status: "OK", Result: definition}
+	request.response.SendJSON(nil)
+}
+
+//
+// ApprovedChaincodeDefinition handles GET /channels/{channel}/chaincodes/{name}/approved?sequence=
+// with the definition approved by our org (the latest one without sequence) and the commit
+// readiness of it, that is which orgs approved the very same definition.
+//
+
+func (setup *OrgSetup) ApprovedChaincodeDefinition(ctx *fasthttp.RequestCtx) {
+	request, ok := setup.explorerRequest(ctx, "_lifecycle", "QueryApprovedChaincodeDefinition")
+	if !ok {
+		return
+	}
+	name := fmt.Sprint(ctx.UserValue("name"))
+	request.form.Args = append(request.form.Args, name)
+
+	sequence := 0
+	if ctx.QueryArgs().Has("sequence") {
+		var err error
+		sequence, err = ctx.QueryArgs().GetUint("sequence")
+		if err != nil {
+			request.error(explorerError(codes.InvalidArgument, "invalid sequence: %s", ctx.QueryArgs().Peek("sequence")))
+			return
+		}
+	}
+
+	definition, responseErr := request.client.ApprovedChaincodeDefinition(http.ContextOf(ctx), request.timeouts, request.form.Channel, name, int64(sequence))
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+
+	request.response.Message = message{ID: "-", Status: "OK", Result: definition}
+	request.response.SendJSON(nil)
+}
+
+// endregion: handlers
@@ -0,0 +1,162 @@
+// region: packages
+
+package fabric
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/valyala/fasthttp"
+)
+
+// endregion: packages
+// region: types
+
+// Orgs are the organizations an instance serves, requests are routed to the one they name by the
+// /orgs/{org} prefix of their path or http.OrgHeader, and to the first one if they name none.
+// Callers restricted to orgs may only reach theirs.
+type Orgs struct {
+	Logger *log.Logger `json:"-"`
+	Setups []*OrgSetup `json:"Setups"`
+
+	byName   map[string]*OrgSetup      `json:"-"`
+	mutex    sync.Mutex                `json:"-"`
+	requests map[string]map[int]uint64 `json:"-"`
+}
+
+// endregion: types
+// region: init
+
+// Init indexes the setups by name, they have to be initialized beforehand, since the name of an
+// org may come from its connection profile.
+func (orgs *Orgs) Init() (*Orgs, error) {
+	if orgs.Logger == nil {
+		return orgs, errors.New("fabric.Orgs.Init() needs a logger")
+	}
+	if len(orgs.Setups) == 0 {
+		return orgs, errors.New("fabric.Orgs.Init() needs at least one org")
+	}
+	orgs.byName = make(map[string]*OrgSetup, len(orgs.Setups))
+	orgs.requests = make(map[string]map[int]uint64, len(orgs.Setups))
+	for _, setup := range orgs.Setups {
+		if _, ok := orgs.byName[setup.OrgName]; ok {
+			return orgs, fmt.Errorf("org %s is configured more than once", setup.OrgName)
+		}
+		orgs.byName[setup.OrgName] = setup
+		orgs.requests[setup.OrgName] = make(map[int]uint64)
+	}
+	return orgs, nil
+}
+
+// Default returns the setup of the org requests not naming one are routed to.
+func (orgs *Orgs) Default() *OrgSetup {
+	return orgs.Setups[0]
+}
+
+// LabelLogger returns a logger writing to the channels of logger with every line labelled with
+// the org, eg. "__INFO__: [org2] -> ...", the severity of the channels is shared.
+func LabelLogger(logger *log.Logger, org string) *log.Logger {
+	label := "[" + org + "]"
+	labelled := log.NewLogger()
+	for _, ch := range logger.Ch {
+		encoder := *ch.Encoder
+		var labelling log.Encoder = func(c *log.Ch, n ...interface{}) (string, error) {
+			if _, ok := n[0].(syslog.Priority); ok {
+				n = append([]interface{}{n[0], label}, n[1:]...)
+			} else {
+				n = append([]interface{}{label}, n...)
+			}
+			return encoder(c, n...)
+		}
+		copied := *ch
+		copied.Encoder = &labelling
+		labelled.Ch = append(labelled.Ch, &copied)
+	}
+	return labelled
+}
+
+// endregion: init
+// region: route
+
+// Route returns a handler calling handler with the setup of the org of the request, eg.
+// orgs.Route((*OrgSetup).Invoke), requests of unknown orgs are not found, those of orgs the
+// caller is not allowed to are forbidden.
+func (orgs *Orgs) Route(handler func(*OrgSetup, *fasthttp.RequestCtx)) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		name := http.OrgOf(ctx)
+		if len(name) == 0 {
+			name = orgs.Default().OrgName
+		}
+		setup, ok := orgs.byName[name]
+		if !ok {
+			orgs.Logger.Out(log.LOG_INFO, ctx.ID(), fmt.Sprintf("unknown org %s", name))
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			ctx.SetBodyString(fmt.Sprintf("Unknown org %s", name))
+			return
+		}
+		http.AuditOf(ctx).Org = name
+
+		caller := http.CallerOf(ctx)
+		if !caller.AllowOrg(name) {
+			setup.Logger.Out(log.LOG_WARNING, ctx.ID(), fmt.Sprintf("%s caller %s is not allowed to org %s", caller.Type, caller.Name, name))
+			ctx.SetStatusCode(fasthttp.StatusForbidden)
+			ctx.SetBodyString("Access denied!")
+		} else {
+			handler(setup, ctx)
+		}
+
+		orgs.mutex.Lock()
+		orgs.requests[name][ctx.Response.StatusCode()]++
+		orgs.mutex.Unlock()
+	}
+}
+
+// endregion: route
+// region: report
+
+// Status returns the state of the gateway of each org by name.
+func (orgs *Orgs) Status() map[string]GatewayStatus {
+	status := make(map[string]GatewayStatus, len(orgs.Setups))
+	for _, setup := range orgs.Setups {
+		status[setup.OrgName] = setup.GatewayStatus()
+	}
+	return status
+}
+
+// Metrics writes the requests routed to each org by status code and the state of their gateways
+// in the Prometheus text format.
+func (orgs *Orgs) Metrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP tc_rawapi_org_requests_total Requests routed to the org by status code.")
+	fmt.Fprintln(w, "# TYPE tc_rawapi_org_requests_total counter")
+	orgs.mutex.Lock()
+	for _, setup := range orgs.Setups {
+		codes := make([]int, 0, len(orgs.requests[setup.OrgName]))
+		for code := range orgs.requests[setup.OrgName] {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "tc_rawapi_org_requests_total{org=%q,code=\"%d\"} %d\n", setup.OrgName, code, orgs.requests[setup.OrgName][code])
+		}
+	}
+	orgs.mutex.Unlock()
+
+	fmt.Fprintln(w, "# HELP tc_rawapi_org_gateway_ready Whether the connection of the org to its gateway peer is ready.")
+	fmt.Fprintln(w, "# TYPE tc_rawapi_org_gateway_ready gauge")
+	for _, setup := range orgs.Setups {
+		ready := 0
+		if strings.EqualFold(setup.GatewayStatus().State, "READY") {
+			ready = 1
+		}
+		fmt.Fprintf(w, "tc_rawapi_org_gateway_ready{org=%q,msp_id=%q} %d\n", setup.OrgName, setup.MSPID, ready)
+	}
+}
+
+// endregion: report
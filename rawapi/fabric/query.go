@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
 	"github.com/SandorMiskey/TrustChain/rawapi/http"
 	"github.com/valyala/fasthttp"
 )
@@ -60,16 +61,43 @@ func (setup *OrgSetup) Query(ctx *fasthttp.RequestCtx) {
 	// TODO: validate values
 
 	// endregion: form values
-	// region: fetch result
+	// region: authorize
 
-	request.network = setup.gateway.GetNetwork(request.form.Channel)
-	request.contract = request.network.GetContract(request.form.Chaincode)
+	if !setup.authorize(request) {
+		return
+	}
 
-	resultByte, err := request.contract.EvaluateTransaction(request.form.Function, request.form.Args...)
-	if err != nil {
-		request.error(err)
+	// endregion: authorize
+	// region: cache
+
+	// the listener runs before the result is fetched, so that a result a block committed
+	// meanwhile may have changed is not cached
+	var seen uint64
+	ttl, cacheable := setup.Cache.ttl(request.form.Chaincode, request.form.Function)
+	if cacheable {
+		seen = setup.Cache.listen(setup.client, request.form.Channel)
+		if entry, ok := setup.Cache.get(request.form); ok {
+			logger(log.LOG_INFO, ctx.ID(), "query served from cache")
+			ctx.Response.Header.Set("ETag", entry.etag)
+			if entry.match(string(ctx.Request.Header.Peek("If-None-Match"))) {
+				ctx.SetStatusCode(fasthttp.StatusNotModified)
+				return
+			}
+			response.ContentType = "application/json"
+			response.Send(entry.body)
+			return
+		}
+	}
+
+	// endregion: cache
+	// region: fetch result
+
+	result, responseErr := tc.Query(request.fabricRequest(request.client))
+	if responseErr != nil {
+		request.error(responseErr)
 		return
 	}
+	resultByte := result.Result
 	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("result type -> %T", []byte(resultByte)))
 
 	// endregion: fetch result
@@ -94,7 +122,7 @@ func (setup *OrgSetup) Query(ctx *fasthttp.RequestCtx) {
 		// request.error(err)
 		// return
 
-		res, err := setup.Lator.Exe(resultByte, request.form.ProtoDecode)
+		res, err := setup.protoDecode(resultByte, request.form.ProtoDecode)
 
 		if err != nil {
 			logger(log.LOG_ERR, response.CTX.ID(), err)
@@ -111,7 +139,7 @@ func (setup *OrgSetup) Query(ctx *fasthttp.RequestCtx) {
 
 	var rawData json.RawMessage
 
-	err = json.Unmarshal([]byte(resultByte), &rawData)
+	err := json.Unmarshal([]byte(resultByte), &rawData)
 	if err != nil {
 		// logger(log.LOG_WARNING, ctx.ID(), fmt.Sprintf("error processing result into even json.RawMessage -> %s -> %s", resultByte, err))
 		logger(log.LOG_WARNING, response.CTX.ID(), fmt.Sprintf("error processing result into even json.RawMessage -> %s", err))
@@ -126,9 +154,36 @@ func (setup *OrgSetup) Query(ctx *fasthttp.RequestCtx) {
 	// endregion: deconstruct
 	// region: closing
 
+	if cacheable {
+		body, err := json.Marshal(resultMsg)
+		if err != nil {
+			request.error(err)
+			return
+		}
+		entry := setup.Cache.set(request.form, ttl, body, seen)
+		ctx.Response.Header.Set("ETag", entry.etag)
+		if entry.match(string(ctx.Request.Header.Peek("If-None-Match"))) {
+			ctx.SetStatusCode(fasthttp.StatusNotModified)
+			return
+		}
+		response.ContentType = "application/json"
+		response.Send(body)
+		return
+	}
+
 	response.Message = resultMsg
 	response.SendJSON(nil)
 
 	// endregion: closing
 
 }
+
+// protoDecode decodes the result with the lator, a base64 dump of it is quoted into a json
+// string as the responses carry it.
+func (setup *OrgSetup) protoDecode(result []byte, typ string) ([]byte, error) {
+	decoded, err := setup.Lator.Exe(result, typ)
+	if err != nil || setup.Lator.Status().Mode != "dump" {
+		return decoded, err
+	}
+	return append([]byte{'"'}, append(decoded, '"')...), nil
+}
@@ -0,0 +1,321 @@
+// region: packages
+
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/SandorMiskey/TrustChain/rawapi/queue"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/grpc/codes"
+)
+
+// endregion: packages
+// region: worker
+
+// QueueRun works off the durable queue until ctx is done, it is a no-op without a queue.
+func (setup *OrgSetup) QueueRun(ctx context.Context) {
+	if setup.Queue == nil {
+		return
+	}
+	setup.Queue.Run(ctx, setup.process)
+}
+
+// process endorses, submits and waits for the commit of a queued invocation. The signed
+// transaction is checkpointed before it is handed to the orderer, a transaction whose submit was
+// interrupted or failed is submitted again as is, which can not commit it twice, and one whose
+// commit status is unknown is looked up by its tx id. It is endorsed again only if it turned out
+// to be invalidated by a read conflict, since the gateway can not tell a transaction it never
+// received from one still on its way to a block.
+func (setup *OrgSetup) process(ctx context.Context, item *queue.Item, checkpoint func() error) error {
+	logger := setup.Logger.Out
+
+	// region: client
+
+	c, err := setup.clientFor(item.Identity)
+	if err != nil {
+		return queue.Permanent(err)
+	}
+	timeouts := setup.Timeouts.For(item.Chaincode, item.Function)
+	r := &tc.Request{
+		Args:     item.Args,
+		Contract: c.Contract(item.Channel, item.Chaincode),
+		Context:  ctx,
+		Function: item.Function,
+		Timeouts: timeouts,
+	}
+
+	// endregion: client
+	// region: resume
+
+	var transaction *client.Transaction
+	switch {
+	case len(item.Txid) == 0:
+	case item.State == queue.StateSubmitting && len(item.Transaction) > 0:
+		transaction, err = c.SignedTransaction(item.Transaction)
+		if err != nil {
+			return queue.Permanent(err)
+		}
+		logger(log.LOG_NOTICE, fmt.Sprintf("queue item %s: submitting transaction %s again", item.ID, item.Txid))
+	case item.State == queue.StateSubmitting || item.State == queue.StateSubmitted:
+		lookup, cancel := context.WithTimeout(ctx, timeouts.CommitStatus)
+		status, responseErr := c.CommitStatus(lookup, item.Channel, item.Txid)
+		cancel()
+		if responseErr != nil {
+			return queueError(responseErr)
+		}
+		return setup.committed(item, status)
+	}
+
+	// endregion: resume
+	// region: endorse
+
+	if transaction == nil {
+		var responseErr *tc.ResponseError
+		transaction, responseErr = tc.Endorse(r)
+		if responseErr != nil {
+			return queueError(responseErr)
+		}
+		item.Transaction, err = transaction.Bytes()
+		if err != nil {
+			return queue.Permanent(err)
+		}
+		item.State, item.Txid = queue.StateSubmitting, transaction.TransactionID()
+		if err = checkpoint(); err != nil {
+			return err
+		}
+	}
+
+	// endregion: endorse
+	// region: submit
+
+	// a failed submit leaves the item submitting, the orderer may have got the transaction anyway
+	response, responseErr := tc.Submit(r, transaction)
+	if responseErr != nil {
+		return queueError(responseErr)
+	}
+	item.State = queue.StateSubmitted
+	if json.Valid(response.Result) {
+		item.Result = response.Result
+	}
+	if err = checkpoint(); err != nil {
+		return err
+	}
+
+	// endregion: submit
+	// region: commit
+
+	wait, cancel := context.WithTimeout(ctx, timeouts.CommitStatus)
+	defer cancel()
+	status, err := response.Commit.StatusWithContext(wait)
+	if err != nil {
+		return queueError(tc.Error(err))
+	}
+	return setup.committed(item, status)
+
+	// endregion: commit
+
+}
+
+// committed records the commit status, read conflicts are retried with a new transaction,
+// other validation failures are final.
+func (setup *OrgSetup) committed(item *queue.Item, status *client.Status) error {
+	item.BlockNumber = status.BlockNumber
+	item.Validation = status.Code.String()
+	if status.Successful {
+		item.State = queue.StateCommitted
+		return nil
+	}
+
+	err := fmt.Errorf("transaction %s failed to commit in block %d with status %s", item.Txid, status.BlockNumber, item.Validation)
+	switch status.Code {
+	case peer.TxValidationCode_MVCC_READ_CONFLICT, peer.TxValidationCode_PHANTOM_READ_CONFLICT:
+		item.State, item.Transaction, item.Txid, item.Validation = queue.StateQueued, nil, "", ""
+		return err
+	}
+	return queue.Permanent(err)
+}
+
+// retryable tells the errors of an unreachable or overloaded network apart from the ones
+// retrying does not help with, like chaincode errors or denied endorsements.
+func retryable(err *tc.ResponseError) bool {
+	switch err.Status {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Canceled:
+		return true
+	}
+	return false
+}
+
+func queueError(err *tc.ResponseError) error {
+	if retryable(err) {
+		return err
+	}
+	return queue.Permanent(err)
+}
+
+// endregion: worker
+// region: handlers
+
+// enqueue accepts the invocation of the request to the queue and responds with 202 and the
+// queue item.
+func (setup *OrgSetup) enqueue(request *request) {
+	ctx := request.response.CTX
+	item, err := setup.queued(http.CallerOf(ctx).Name, request.form)
+	if err != nil {
+		setup.Logger.Out(log.LOG_ERR, ctx.ID(), "error while queueing invoke request", err)
+		request.response.Status = fasthttp.StatusServiceUnavailable
+		request.response.Message = err
+		request.response.Send(nil)
+		return
+	}
+	setup.Logger.Out(log.LOG_INFO, ctx.ID(), fmt.Sprintf("invoke request queued as %s", item.ID))
+
+	request.response.Status = fasthttp.StatusAccepted
+	request.response.Message = message{ID: "-", Status: "QUEUED", Result: item}
+	request.response.SendJSON(nil)
+}
+
+// queued stores the invocation the caller asked for with form in the queue.
+func (setup *OrgSetup) queued(caller string, form *form) (*queue.Item, error) {
+	return setup.Queue.Enqueue(&queue.Item{
+		Args:      form.Args,
+		Caller:    caller,
+		Chaincode: form.Chaincode,
+		Channel:   form.Channel,
+		Function:  form.Function,
+		Identity:  form.identity,
+	})
+}
+
+//
+// QueueItem handles GET /queue/{queue_id} with the state, tx id and final status of a queued
+// invocation, callers see their own items, admins see every item along with its signed
+// transaction.
+//
+
+func (setup *OrgSetup) QueueItem(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	item, ok := setup.queueItem(response)
+	if !ok {
+		return
+	}
+	caller := http.CallerOf(ctx)
+	if item.Caller != caller.Name && !caller.Permissions.Admin() {
+		response.Status = fasthttp.StatusNotFound
+		response.Message = queue.ErrNotFound
+		response.Send(nil)
+		return
+	}
+	if !caller.Permissions.Admin() {
+		item.Transaction = nil
+	}
+	response.Message = item
+	response.SendJSON(nil)
+}
+
+//
+// QueueList handles GET /admin/queue?state=&limit= with the queue items, oldest first, use
+// state=dead for the dead letters.
+//
+
+func (setup *OrgSetup) QueueList(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	if !setup.queueEnabled(response) {
+		return
+	}
+	items, err := setup.Queue.List(string(ctx.QueryArgs().Peek("state")), ctx.QueryArgs().GetUintOrZero("limit"))
+	if err != nil {
+		response.Status = fasthttp.StatusInternalServerError
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+	response.Message = items
+	response.SendJSON(nil)
+}
+
+//
+// QueueReplay handles POST /admin/queue/{queue_id}/replay, which puts a dead letter back to the
+// queue.
+//
+
+func (setup *OrgSetup) QueueReplay(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	if !setup.queueEnabled(response) {
+		return
+	}
+	item, err := setup.Queue.Replay(fmt.Sprint(ctx.UserValue("queue_id")))
+	if err != nil {
+		response.Status = fasthttp.StatusConflict
+		if errors.Is(err, queue.ErrNotFound) {
+			response.Status = fasthttp.StatusNotFound
+		}
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+	setup.Logger.Out(log.LOG_NOTICE, ctx.ID(), fmt.Sprintf("queue item %s replayed by %s", item.ID, http.CallerOf(ctx).Name))
+	response.Message = item
+	response.SendJSON(nil)
+}
+
+//
+// QueueDrop handles DELETE /admin/queue/{queue_id}, which removes the item for good.
+//
+
+func (setup *OrgSetup) QueueDrop(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	item, ok := setup.queueItem(response)
+	if !ok {
+		return
+	}
+	if err := setup.Queue.Delete(item.ID); err != nil {
+		response.Status = fasthttp.StatusInternalServerError
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+	setup.Logger.Out(log.LOG_NOTICE, ctx.ID(), fmt.Sprintf("queue item %s in state %s dropped by %s", item.ID, item.State, http.CallerOf(ctx).Name))
+	response.Message = item
+	response.SendJSON(nil)
+}
+
+// endregion: handlers
+// region: helpers
+
+func (setup *OrgSetup) queueEnabled(response *http.Response) bool {
+	if setup.Queue != nil {
+		return true
+	}
+	response.Status = fasthttp.StatusNotFound
+	response.Message = errors.New("the queue is not enabled")
+	response.Send(nil)
+	return false
+}
+
+func (setup *OrgSetup) queueItem(response *http.Response) (*queue.Item, bool) {
+	if !setup.queueEnabled(response) {
+		return nil, false
+	}
+	item, err := setup.Queue.Get(fmt.Sprint(response.CTX.UserValue("queue_id")))
+	if err != nil {
+		response.Status = fasthttp.StatusInternalServerError
+		if errors.Is(err, queue.ErrNotFound) {
+			response.Status = fasthttp.StatusNotFound
+		}
+		response.Message = err
+		response.Send(nil)
+		return nil, false
+	}
+	return item, true
+}
+
+// endregion: helpers
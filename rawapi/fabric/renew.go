@@ -0,0 +1,115 @@
+// region: packages
+
+package fabric
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+)
+
+// endregion: packages
+// region: renew
+
+// RenewCredentials reenrolls the gateway identity and the wallet identities of the organization
+// with the CA, those whose certificate expires within RenewBefore. The new certificate and key of
+// the gateway identity replace the files at CertPath and KeyPath and are used right away, those
+// of a wallet identity replace it in the wallet and the next request opens a new gateway for it.
+// Every identity is tried, failures are reported together.
+func (setup *OrgSetup) RenewCredentials() error {
+	if setup.client == nil || setup.CA == nil {
+		return errors.New("fabric.OrgSetup needs a gateway and a CA, fabric.OrgSetup.Init() first")
+	}
+	problems := make([]string, 0)
+
+	// region: gateway identity
+
+	certificatePEM, keyPEM, err := setup.client.Credentials()
+	if err == nil {
+		var enrollment *tc.Enrollment
+		enrollment, err = setup.renew("gateway identity", certificatePEM, keyPEM)
+		if err == nil && enrollment != nil {
+			err = setup.client.WriteCredentials(enrollment.Certificate, enrollment.PrivateKey)
+		}
+	}
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("gateway identity: %s", err))
+	}
+
+	// endregion: gateway identity
+	// region: wallet identities
+
+	if setup.Wallet != nil {
+		labels, err := setup.Wallet.List()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("wallet: %s", err))
+		}
+		for _, label := range labels {
+			err := setup.renewWalletIdentity(label)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("wallet identity %s: %s", label, err))
+			}
+		}
+	}
+
+	// endregion: wallet identities
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (setup *OrgSetup) renewWalletIdentity(label string) error {
+	id, err := setup.Wallet.Get(label)
+	if err != nil {
+		return err
+	}
+	if id.MSPID != setup.MSPID {
+		return nil
+	}
+	enrollment, err := setup.renew("wallet identity "+label, []byte(id.Credentials.Certificate), []byte(id.Credentials.PrivateKey))
+	if err != nil || enrollment == nil {
+		return err
+	}
+
+	id.Credentials = tc.WalletCredentials{Certificate: string(enrollment.Certificate), PrivateKey: string(enrollment.PrivateKey)}
+	err = setup.Wallet.Put(id)
+	if err != nil {
+		return err
+	}
+
+	setup.identitiesMutex.Lock()
+	defer setup.identitiesMutex.Unlock()
+	if client, ok := setup.identities[label]; ok {
+		client.Close()
+		delete(setup.identities, label)
+	}
+	return nil
+}
+
+// renew reenrolls the identity if its certificate expires within RenewBefore, it returns nil
+// if it is not due yet.
+func (setup *OrgSetup) renew(name string, certificatePEM, keyPEM []byte) (*tc.Enrollment, error) {
+	expiry, err := tc.CertificateExpiry(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	if time.Until(expiry) > setup.RenewBefore {
+		return nil, nil
+	}
+
+	enrollment, err := setup.CA.Reenroll(certificatePEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("certificate expiring at %s, reenrollment failed: %w", expiry.Format(time.RFC3339), err)
+	}
+	renewed, _ := tc.CertificateExpiry(enrollment.Certificate)
+	setup.Logger.Out(log.LOG_NOTICE, fmt.Sprintf("reenrolled %s of %s, certificate expiring at %s replaced by one valid until %s", name, setup.OrgName, expiry.Format(time.RFC3339), renewed.Format(time.RFC3339)))
+	return enrollment, nil
+}
+
+// endregion: renew
@@ -3,17 +3,13 @@
 package fabric
 
 import (
-	"context"
-	"errors"
 	"fmt"
 
 	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
 	"github.com/SandorMiskey/TrustChain/rawapi/http"
-	"github.com/hyperledger/fabric-gateway/pkg/client"
-
-	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
 	"github.com/valyala/fasthttp"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/codes"
 )
 
 // endregion: packages
@@ -24,18 +20,17 @@ type form struct {
 	Channel     string         `json:"channel"`
 	Function    string         `json:"function"`
 	ProtoDecode string         `json:"proto_decode"`
+	identity    string         `json:"-"`
 	raw         *fasthttp.Args `json:"-"`
 }
 
 type request struct {
-	err         error
-	contract    *client.Contract
-	proposal    *client.Proposal
-	transaction *client.Transaction
-	commit      *client.Commit
-	network     *client.Network
-	form        *form
-	response    *http.Response
+	client   *tc.Client
+	err      error
+	fabric   *tc.Request
+	form     *form
+	response *http.Response
+	timeouts tc.Timeouts
 }
 
 type message struct {
@@ -52,7 +47,24 @@ type messageError struct {
 	Type    string              `json:"Type"`
 }
 
-// func (r *request) error(err interface{}, contract *client.Contract, proposal *client.Proposal, network *client.Network) {
+// fabricRequest turns the form into a request against the shared fabric client, bound by the
+// context of the http request and the timeouts of the chaincode function.
+func (r *request) fabricRequest(client *tc.Client) *tc.Request {
+	r.fabric = &tc.Request{
+		Contract: client.Contract(r.form.Channel, r.form.Chaincode),
+		Context:  http.ContextOf(r.response.CTX),
+		Function: r.form.Function,
+		Args:     r.form.Args,
+		Timeouts: r.timeouts,
+	}
+	return r.fabric
+}
+
+// audit records the transaction id in the audit entry of the request.
+func (r *request) audit(txid string) {
+	http.AuditOf(r.response.CTX).Txid = txid
+}
+
 func (r *request) error(err error) {
 
 	// region: set r.err
@@ -68,71 +80,41 @@ func (r *request) error(err error) {
 	logger(log.LOG_DEBUG, r.response.CTX.ID(), fmt.Sprintf("error in fabric request: %s", r.err))
 
 	// endregion: logger
-	// region: new msg
+	// region: classify
+
+	classified := tc.Error(r.err)
 
 	msg := messageError{
 		message: message{
-			Form: r.form,
+			ID:     classified.Txid,
+			Form:   r.form,
+			Result: fmt.Sprintf("%v: %s", r.response.CTX.ID(), classified.Message),
+			Status: classified.Status.String(),
 		},
+		Details: classified.Details,
+		Type:    classified.Type,
 	}
-
-	// endregion: msg
-	// region: error types
-
-	switch err := r.err.(type) {
-	case *client.EndorseError:
-		msg.message.ID = err.TransactionID
-		msg.message.Status = fmt.Sprintf("%v", status.Code(err))
-		msg.message.Result = fmt.Sprintf("%v: endorse error for transaction %s with gRPC status %v: %s", r.response.CTX.ID(), msg.message.ID, msg.message.Status, err)
-	case *client.SubmitError:
-		msg.message.ID = err.TransactionID
-		// msg.message.Status = fmt.Sprintf("%s", status.Code(r.err))
-		msg.message.Status = status.Code(r.err).String()
-		msg.message.Result = fmt.Sprintf("%v: submit error for transaction %s with gRPC status %v: %s", r.response.CTX.ID(), msg.message.ID, msg.message.Status, err)
-	case *client.CommitStatusError:
-		msg.message.ID = err.TransactionID
-		if errors.Is(err, context.DeadlineExceeded) {
-			msg.message.Status = fmt.Sprintf("%s", err)
-			msg.message.Result = fmt.Sprintf("%v: timeout waiting for transaction %s commit status: %s", r.response.CTX.ID(), msg.message.ID, err)
-		} else {
-			msg.message.Status = status.Code(err).String()
-			msg.message.Result = fmt.Sprintf("%v: error obtaining commit status for transaction %s commit status %s: %s", r.response.CTX.ID(), msg.message.ID, msg.message.Status, err)
-		}
-	case *client.CommitError:
-		msg.message.ID = err.TransactionID
-		msg.message.Status = fmt.Sprintf("%v", int32(err.Code))
-		msg.message.Result = fmt.Sprintf("%v: transaction %s failed to commit with status %d: %s", r.response.CTX.ID(), err.TransactionID, int32(err.Code), err)
-	default:
+	if len(msg.message.ID) == 0 {
 		msg.message.ID = "-"
-		msg.message.Status = status.Code(r.err).String()
-		msg.message.Result = fmt.Sprintf("%v: unexpected error type %T: %s", r.response.CTX.ID(), err, err)
+	} else {
+		r.audit(msg.message.ID)
 	}
-
-	// endregion: error types
-	// region: error details
-
-	statusErr := status.Convert(r.err)
-	details := statusErr.Details()
-	msg.Details = make([]map[string]string, 0)
-	if len(details) > 0 {
-		for _, detail := range details {
-			switch detail := detail.(type) {
-			case *gateway.ErrorDetail:
-				msg.Details = append(msg.Details, map[string]string{"address": detail.Address, "mspId": detail.MspId, "message": detail.Message})
-			}
-		}
+	if len(classified.Validation) > 0 {
+		msg.message.Status = classified.Validation
 	}
 
-	// endregion: error details
+	// endregion: classify
 	// region: closing
 
-	msg.Type = fmt.Sprintf("%T", r.err)
 	r.response.Message = msg
 
 	logger(log.LOG_ERR, msg.message.Result)
 	logger(log.LOG_DEBUG, r.response.CTX.ID(), fmt.Sprintf("%#v", r))
 
 	r.response.Status = 400
+	if classified.Status == codes.PermissionDenied {
+		r.response.Status = 403
+	}
 	r.response.SendJSON(nil)
 
 	// endregion: closing
@@ -0,0 +1,409 @@
+// region: packages
+
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/SandorMiskey/TrustChain/rawapi/pb"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// endregion: packages
+// region: types
+
+// Service implements pb.TrustChainServiceServer on top of the same gateway the http handlers use.
+type Service struct {
+	pb.UnimplementedTrustChainServiceServer
+
+	setup *OrgSetup
+}
+
+// OrgsService implements pb.TrustChainServiceServer by passing each call to the Service of the
+// org it names.
+type OrgsService struct {
+	pb.UnimplementedTrustChainServiceServer
+
+	orgs *Orgs
+}
+
+// endregion: types
+// region: constructor
+
+func (setup *OrgSetup) Service() *Service {
+	return &Service{setup: setup}
+}
+
+// Service serves the grpc api of every org, calls are routed to the one they name by the
+// http.OrgHeader metadata, in lower case as grpc has it, and to the first one if they name none.
+func (orgs *Orgs) Service() *OrgsService {
+	return &OrgsService{orgs: orgs}
+}
+
+// endregion: constructor
+// region: transactions
+
+func (s *Service) Invoke(ctx context.Context, in *pb.TransactionRequest) (*pb.TransactionResponse, error) {
+	logger, err := s.logger(ctx, "invoke", in.Channel, in.Chaincode, in.Function, in.Args)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.authorize(ctx, in.Channel, in.Chaincode, in.Function)
+	if err != nil {
+		return nil, err
+	}
+	if s.setup.Queue != nil {
+		return s.enqueue(ctx, logger, in)
+	}
+
+	r := s.request(ctx, client, in.Channel, in.Chaincode, in.Function, in.Args)
+	response, responseErr := s.submit(ctx, r, in)
+	if responseErr == nil {
+		response, responseErr = tc.Commit(r, response)
+	}
+	if responseErr != nil {
+		return nil, s.error(ctx, responseErr)
+	}
+	logger(log.LOG_INFO, fmt.Sprintf("grpc invoke committed, transaction ID: %s", response.Txid))
+
+	return &pb.TransactionResponse{
+		Result: response.Result,
+		Status: "VALID",
+		TxId:   response.Txid,
+	}, nil
+}
+
+func (s *Service) SubmitAsync(ctx context.Context, in *pb.TransactionRequest) (*pb.TransactionResponse, error) {
+	logger, err := s.logger(ctx, "submit", in.Channel, in.Chaincode, in.Function, in.Args)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.authorize(ctx, in.Channel, in.Chaincode, in.Function)
+	if err != nil {
+		return nil, err
+	}
+	if s.setup.Queue != nil {
+		return s.enqueue(ctx, logger, in)
+	}
+
+	response, responseErr := s.submit(ctx, s.request(ctx, client, in.Channel, in.Chaincode, in.Function, in.Args), in)
+	if responseErr != nil {
+		return nil, s.error(ctx, responseErr)
+	}
+	logger(log.LOG_INFO, fmt.Sprintf("grpc submit accepted, transaction ID: %s", response.Txid))
+
+	return &pb.TransactionResponse{
+		Result: response.Result,
+		Status: "OK",
+		TxId:   response.Txid,
+	}, nil
+}
+
+func (s *Service) Query(ctx context.Context, in *pb.QueryRequest) (*pb.QueryResponse, error) {
+	logger, err := s.logger(ctx, "query", in.Channel, in.Chaincode, in.Function, in.Args)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.authorize(ctx, in.Channel, in.Chaincode, in.Function)
+	if err != nil {
+		return nil, err
+	}
+
+	response, responseErr := tc.Query(s.request(ctx, client, in.Channel, in.Chaincode, in.Function, in.Args))
+	if responseErr != nil {
+		return nil, s.error(ctx, responseErr)
+	}
+	result := response.Result
+
+	if len(in.ProtoDecode) > 0 {
+		result, err = s.setup.protoDecode(result, in.ProtoDecode)
+		if err != nil {
+			logger(log.LOG_ERR, "grpc query proto decode", err)
+			return nil, s.error(ctx, err)
+		}
+	}
+
+	return &pb.QueryResponse{Result: result}, nil
+}
+
+// endregion: transactions
+// region: commit status
+
+func (s *Service) CommitStatus(ctx context.Context, in *pb.CommitStatusRequest) (*pb.CommitStatusResponse, error) {
+	logger, err := s.logger(ctx, "commit status", in.Channel, "-", "-", []string{in.TxId})
+	if err != nil {
+		return nil, err
+	}
+	// the same permission the http explorer asks for a transaction by id
+	client, err := s.authorize(ctx, in.Channel, "qscc", "GetTransactionByID")
+	if err != nil {
+		return nil, err
+	}
+
+	wait, cancel := context.WithTimeout(ctx, s.setup.Timeouts.For("", "").CommitStatus)
+	defer cancel()
+	commit, responseErr := client.CommitStatus(wait, in.Channel, in.TxId)
+	if responseErr != nil {
+		return nil, s.error(ctx, responseErr)
+	}
+	logger(log.LOG_INFO, fmt.Sprintf("grpc commit status of %s: %s in block %d", in.TxId, commit.Code, commit.BlockNumber))
+
+	return &pb.CommitStatusResponse{
+		BlockNumber: commit.BlockNumber,
+		Successful:  commit.Successful,
+		TxId:        commit.TransactionID,
+		Validation:  commit.Code.String(),
+	}, nil
+}
+
+// endregion: commit status
+// region: events
+
+func (s *Service) ChaincodeEvents(in *pb.ChaincodeEventsRequest, stream pb.TrustChainService_ChaincodeEventsServer) error {
+	ctx := stream.Context()
+	logger, err := s.logger(ctx, "chaincode events", in.Channel, in.Chaincode, "-", nil)
+	if err != nil {
+		return err
+	}
+	// events are not bound to a function, the caller needs the whole chaincode
+	gw, err := s.authorize(ctx, in.Channel, in.Chaincode, "")
+	if err != nil {
+		return err
+	}
+
+	options := []client.ChaincodeEventsOption{}
+	if in.StartBlock > 0 {
+		options = append(options, client.WithStartBlock(in.StartBlock))
+	}
+	events, err := gw.ChaincodeEvents(ctx, in.Channel, in.Chaincode, nil, options...)
+	if err != nil {
+		return s.error(ctx, err)
+	}
+	logger(log.LOG_INFO, "grpc chaincode event stream opened")
+
+	for event := range events {
+		err = stream.Send(&pb.ChaincodeEvent{
+			BlockNumber: event.BlockNumber,
+			Chaincode:   event.ChaincodeName,
+			EventName:   event.EventName,
+			Payload:     event.Payload,
+			TxId:        event.TransactionID,
+		})
+		if err != nil {
+			logger(log.LOG_NOTICE, "grpc chaincode event stream send", err)
+			return err
+		}
+	}
+
+	logger(log.LOG_INFO, "grpc chaincode event stream closed")
+	return ctx.Err()
+}
+
+// endregion: events
+// region: orgs
+
+func (s *OrgsService) Invoke(ctx context.Context, in *pb.TransactionRequest) (*pb.TransactionResponse, error) {
+	service, err := s.service(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return service.Invoke(ctx, in)
+}
+
+func (s *OrgsService) SubmitAsync(ctx context.Context, in *pb.TransactionRequest) (*pb.TransactionResponse, error) {
+	service, err := s.service(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return service.SubmitAsync(ctx, in)
+}
+
+func (s *OrgsService) Query(ctx context.Context, in *pb.QueryRequest) (*pb.QueryResponse, error) {
+	service, err := s.service(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return service.Query(ctx, in)
+}
+
+func (s *OrgsService) CommitStatus(ctx context.Context, in *pb.CommitStatusRequest) (*pb.CommitStatusResponse, error) {
+	service, err := s.service(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return service.CommitStatus(ctx, in)
+}
+
+func (s *OrgsService) ChaincodeEvents(in *pb.ChaincodeEventsRequest, stream pb.TrustChainService_ChaincodeEventsServer) error {
+	service, err := s.service(stream.Context())
+	if err != nil {
+		return err
+	}
+	return service.ChaincodeEvents(in, stream)
+}
+
+// service returns the Service of the org the call names.
+func (s *OrgsService) service(ctx context.Context) (*Service, error) {
+	name := s.orgs.Default().OrgName
+	md, _ := metadata.FromIncomingContext(ctx)
+	if org := md.Get(http.OrgHeader); len(org) > 0 && len(org[0]) > 0 {
+		name = org[0]
+	}
+	setup, ok := s.orgs.byName[name]
+	if !ok {
+		s.orgs.Logger.Out(log.LOG_INFO, "grpc", fmt.Sprintf("unknown org %s", name))
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Unknown org %s", name))
+	}
+	return setup.Service(), nil
+}
+
+// endregion: orgs
+// region: helpers
+
+// authorize checks the org and the permissions of the caller the interceptors of the grpc server
+// authenticated, the same way the http handlers do, and returns the gateway of its identity.
+func (s *Service) authorize(ctx context.Context, channel, chaincode, function string) (*tc.Client, error) {
+	caller := http.CallerOfContext(ctx)
+	if !caller.AllowOrg(s.setup.OrgName) {
+		s.setup.Logger.Out(log.LOG_WARNING, "grpc", fmt.Sprintf("%s caller %s is not allowed to org %s", caller.Type, caller.Name, s.setup.OrgName))
+		return nil, status.Error(codes.PermissionDenied, "Access denied!")
+	}
+	if !caller.Permissions.Allow(channel, chaincode, function) {
+		s.setup.Logger.Out(log.LOG_WARNING, "grpc", fmt.Sprintf("%s caller %s is not allowed to call %s:%s:%s", caller.Type, caller.Name, channel, chaincode, function))
+		return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("%s is not allowed to call %s on %s/%s", caller.Name, function, channel, chaincode))
+	}
+
+	client, err := s.setup.clientFor(caller.Identity)
+	if err != nil {
+		s.setup.Logger.Out(log.LOG_ERR, "grpc", fmt.Sprintf("identity %s of caller %s: %s", caller.Identity, caller.Name, err))
+		return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("identity of %s is not available", caller.Name))
+	}
+	return client, nil
+}
+
+// submit endorses and submits the transaction of the call, and keeps it for resubmission the way
+// the http invoke does.
+func (s *Service) submit(ctx context.Context, r *tc.Request, in *pb.TransactionRequest) (*tc.Response, *tc.ResponseError) {
+	transaction, responseErr := tc.Endorse(r)
+	if responseErr != nil {
+		return nil, responseErr
+	}
+	response, responseErr := tc.Submit(r, transaction)
+	s.setup.Transactions.keep("grpc", http.CallerOfContext(ctx).Name, s.form(ctx, in), transaction)
+	return response, responseErr
+}
+
+// enqueue queues the call the way the http invoke does if the org has a queue, the item is
+// returned as json in the result, its progress is at /queue/{queue_id} of the http api.
+func (s *Service) enqueue(ctx context.Context, logger func(...interface{}), in *pb.TransactionRequest) (*pb.TransactionResponse, error) {
+	item, err := s.setup.queued(http.CallerOfContext(ctx).Name, s.form(ctx, in))
+	if err != nil {
+		logger(log.LOG_ERR, "error while queueing grpc request", err)
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	logger(log.LOG_INFO, fmt.Sprintf("grpc request queued as %s", item.ID))
+
+	result, err := json.Marshal(item)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return &pb.TransactionResponse{
+		Result: result,
+		Status: "QUEUED",
+		TxId:   "-",
+	}, nil
+}
+
+// form is the call as the http handlers see their form values, along with the identity of the
+// caller.
+func (s *Service) form(ctx context.Context, in *pb.TransactionRequest) *form {
+	return &form{
+		Args:      in.Args,
+		Chaincode: in.Chaincode,
+		Channel:   in.Channel,
+		Function:  in.Function,
+		identity:  http.CallerOfContext(ctx).Identity,
+	}
+}
+
+// request builds the fabric request bound by the deadline and cancellation of the call.
+func (s *Service) request(ctx context.Context, client *tc.Client, channel, chaincode, function string, args []string) *tc.Request {
+	return &tc.Request{
+		Contract: client.Contract(channel, chaincode),
+		Context:  ctx,
+		Function: function,
+		Args:     args,
+		Timeouts: s.setup.Timeouts.For(chaincode, function),
+	}
+}
+
+// logger checks the setup and logs the incoming call, the returned function prefixes
+// every line with the address of the caller.
+func (s *Service) logger(ctx context.Context, kind, channel, chaincode, function string, args []string) (func(...interface{}), error) {
+	err := s.setup.validate(nil)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	caller := "-"
+	if p, ok := peer.FromContext(ctx); ok {
+		caller = p.Addr.String()
+	}
+	out := s.setup.Logger.Out
+	logger := func(v ...interface{}) {
+		out(append([]interface{}{v[0], caller}, v[1:]...)...)
+	}
+	logger(log.LOG_INFO, fmt.Sprintf("grpc %s request chaincode -> %s, channel -> %s, function -> %s, args -> %s", kind, chaincode, channel, function, args))
+
+	return logger, nil
+}
+
+// error maps err the same way the http handlers do: the gRPC status reported by the gateway is
+// passed on, the transaction id and validation code go to the trailer, the details of the
+// gateway to the status details.
+func (s *Service) error(ctx context.Context, err error) error {
+	classified := tc.Error(err)
+
+	trailer := metadata.MD{}
+	if len(classified.Txid) > 0 {
+		trailer.Set("tx-id", classified.Txid)
+	}
+	if len(classified.Validation) > 0 {
+		trailer.Set("validation", classified.Validation)
+	}
+	if trailer.Len() > 0 {
+		grpc.SetTrailer(ctx, trailer)
+	}
+
+	code := classified.Status
+	if code == codes.OK {
+		code = codes.Unknown
+	}
+	st := status.New(code, classified.Message)
+	for _, detail := range classified.Details {
+		withDetails, err := st.WithDetails(&gateway.ErrorDetail{
+			Address: detail["address"],
+			MspId:   detail["mspId"],
+			Message: detail["message"],
+		})
+		if err == nil {
+			st = withDetails
+		}
+	}
+
+	s.setup.Logger.Out(log.LOG_ERR, "grpc", classified.Message)
+	return st.Err()
+}
+
+// endregion: helpers
@@ -0,0 +1,113 @@
+// region: packages
+
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/valyala/fasthttp"
+)
+
+// endregion: packages
+
+type messageSimulate struct {
+	message
+	Endorsers []tc.Endorser `json:"endorsers"`
+	RWSet     []tc.NsRWSet  `json:"rwset"`
+}
+
+//
+// Simulate endorses an invoke request without submitting it to the orderer.
+//
+
+func (setup *OrgSetup) Simulate(ctx *fasthttp.RequestCtx) {
+
+	// region: request and response
+
+	request := &request{
+		response: &http.Response{
+			CTX:    ctx,
+			Logger: setup.Logger,
+		},
+	}
+
+	// endregion: request and response
+	// region: check for gateway and logger
+
+	request.err = setup.validate(request.response)
+	if request.err != nil {
+		return
+	}
+	logger := setup.Logger.Out
+	logger(log.LOG_DEBUG, "received simulate request has .Logger and .gateway")
+
+	// endregion: logger
+	// region: form values
+
+	request.form = &form{
+		Chaincode: string(ctx.FormValue("chaincode")),
+		Channel:   string(ctx.FormValue("channel")),
+		Function:  string(ctx.FormValue("function")),
+		raw:       ctx.PostArgs(),
+	}
+	request.form.raw.VisitAll(func(k, v []byte) {
+		if string(k) == "args" {
+			request.form.Args = append(request.form.Args, string(v))
+		}
+	})
+	logger(log.LOG_INFO, ctx.ID(), fmt.Sprintf("simulate request chaincode -> %s, channel -> %s, function -> %s, args -> %s", request.form.Chaincode, request.form.Channel, request.form.Function, request.form.Args))
+	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("simulate request raw args %#v\n", request.form))
+
+	// endregion: form values
+	// region: authorize
+
+	if !setup.authorize(request) {
+		return
+	}
+
+	// endregion: authorize
+	// region: endorse
+
+	simulation, responseErr := tc.Simulate(request.fabricRequest(request.client))
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+	logger(log.LOG_INFO, ctx.ID(), "simulate request proposal endorsed, not submitting")
+	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("endorsed: request -> %#v", request))
+
+	// endregion: endorse
+	// region: closing
+
+	request.audit(simulation.Txid)
+
+	out := messageSimulate{
+		message: message{
+			ID:     simulation.Txid,
+			Form:   request.form,
+			Status: "SIMULATED",
+		},
+		Endorsers: simulation.Endorsers,
+		RWSet:     simulation.RWSet,
+	}
+
+	var rawData json.RawMessage
+	err := json.Unmarshal(simulation.Result, &rawData)
+	if err != nil {
+		logger(log.LOG_ERR, fmt.Sprintf("error processing json.RawMessage in Simulate() request -> %s -> %s", simulation.Result, err))
+		out.Result = nil
+	} else {
+		out.Result = rawData
+	}
+	logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("result -> %s", rawData))
+
+	request.response.Message = out
+	request.response.SendJSON(nil)
+
+	// endregion: closing
+
+}
@@ -0,0 +1,96 @@
+// region: packages
+
+package fabric
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+)
+
+// endregion: packages
+// region: types
+
+// Timeouts holds the default timeouts of the fabric calls and their per-chaincode or per-function
+// overrides.
+type Timeouts struct {
+	Defaults  tc.Timeouts `json:"Defaults"`
+	Overrides string      `json:"Overrides"`
+
+	overrides map[string]tc.Timeouts `json:"-"`
+}
+
+// endregion: types
+// region: init
+
+// Init parses the overrides, which are a comma separated list of chaincode[:function][/phase]=timeout
+// entries, phase is one of evaluate, endorse, submit or commit, all of them if omitted, eg.
+// "te-food-bundles/endorse=30s,te-food-bundles:CreateBundle/commit=2m,qscc=20s".
+func (t *Timeouts) Init() (*Timeouts, error) {
+	t.overrides = make(map[string]tc.Timeouts)
+	for _, item := range strings.Split(t.Overrides, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return t, fmt.Errorf("timeout override '%s' must be in chaincode[:function][/phase]=timeout format", item)
+		}
+		timeout, err := time.ParseDuration(kv[1])
+		if err != nil || timeout <= 0 {
+			return t, fmt.Errorf("invalid timeout in override '%s'", item)
+		}
+
+		key, phase := kv[0], ""
+		if i := strings.LastIndex(key, "/"); i >= 0 {
+			key, phase = key[:i], key[i+1:]
+		}
+		if len(key) == 0 || strings.HasPrefix(key, ":") {
+			return t, fmt.Errorf("timeout override '%s' has no chaincode", item)
+		}
+
+		override := t.overrides[key]
+		switch phase {
+		case "":
+			override = tc.Timeouts{CommitStatus: timeout, Endorse: timeout, Evaluate: timeout, Submit: timeout}.Merge(override)
+		case "evaluate":
+			override.Evaluate = timeout
+		case "endorse":
+			override.Endorse = timeout
+		case "submit":
+			override.Submit = timeout
+		case "commit":
+			override.CommitStatus = timeout
+		default:
+			return t, fmt.Errorf("unknown phase '%s' in timeout override '%s', must be evaluate, endorse, submit or commit", phase, item)
+		}
+		t.overrides[key] = override
+	}
+	return t, nil
+}
+
+// endregion: init
+// region: lookup
+
+// For returns the timeouts of chaincode:function, function overrides take precedence over
+// chaincode overrides, which take precedence over the defaults.
+func (t *Timeouts) For(chaincode, function string) tc.Timeouts {
+	timeouts := tc.DefaultTimeouts()
+	if t == nil {
+		return timeouts
+	}
+	timeouts = timeouts.Merge(t.Defaults)
+	if override, ok := t.overrides[chaincode]; ok {
+		timeouts = timeouts.Merge(override)
+	}
+	if override, ok := t.overrides[chaincode+":"+function]; ok {
+		timeouts = timeouts.Merge(override)
+	}
+	return timeouts
+}
+
+// endregion: lookup
@@ -0,0 +1,274 @@
+// region: packages
+
+package fabric
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/grpc/codes"
+)
+
+// endregion: packages
+// region: types
+
+// Transactions keeps the signed transactions submitted through /invoke for TTL, at most Size of
+// them, so that a client whose submit timed out can look up the fate of the very same transaction
+// or submit it again instead of invoking the chaincode a second time.
+type Transactions struct {
+	Logger *log.Logger   `json:"-"`
+	Size   int           `json:"Size"`
+	TTL    time.Duration `json:"TTL"`
+
+	items map[string]*list.Element `json:"-"`
+	lru   *list.List               `json:"-"`
+	mutex sync.Mutex               `json:"-"`
+}
+
+type signedTransaction struct {
+	bytes     []byte
+	caller    string
+	chaincode string
+	channel   string
+	expires   time.Time
+	function  string
+	identity  string
+	txid      string
+}
+
+type commitStatus struct {
+	BlockNumber uint64 `json:"block_number"`
+	Successful  bool   `json:"successful"`
+	Validation  string `json:"validation"`
+}
+
+var errUnknownTransaction = errors.New("no such transaction, it was not submitted here or it has expired")
+
+// endregion: types
+// region: init
+
+func (t *Transactions) Init() (*Transactions, error) {
+	if t.Logger == nil {
+		return t, errors.New("Transactions.Init() needs a logger")
+	}
+	if t.Size <= 0 {
+		return t, fmt.Errorf("size of kept transactions must be positive, got %d", t.Size)
+	}
+	if t.TTL <= 0 {
+		return t, fmt.Errorf("ttl of kept transactions must be positive, got %s", t.TTL)
+	}
+
+	t.items = make(map[string]*list.Element)
+	t.lru = list.New()
+
+	return t, nil
+}
+
+// endregion: init
+// region: keep, get
+
+// keep stores the transaction the caller submitted with form, id prefixes the log lines, it is a
+// no-op if t is nil.
+func (t *Transactions) keep(id interface{}, caller string, form *form, transaction *client.Transaction) {
+	if t == nil {
+		return
+	}
+	raw, err := transaction.Bytes()
+	if err != nil {
+		t.Logger.Out(log.LOG_ERR, id, fmt.Sprintf("unable to keep transaction %s", transaction.TransactionID()), err)
+		return
+	}
+	entry := &signedTransaction{
+		bytes:     raw,
+		caller:    caller,
+		chaincode: form.Chaincode,
+		channel:   form.Channel,
+		expires:   time.Now().Add(t.TTL),
+		function:  form.Function,
+		identity:  form.identity,
+		txid:      transaction.TransactionID(),
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if element, ok := t.items[entry.txid]; ok {
+		element.Value = entry
+		t.lru.MoveToFront(element)
+		return
+	}
+	t.items[entry.txid] = t.lru.PushFront(entry)
+	for t.lru.Len() > t.Size {
+		t.remove(t.lru.Back())
+	}
+}
+
+func (t *Transactions) get(txid string) (*signedTransaction, bool) {
+	if t == nil {
+		return nil, false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	element, ok := t.items[txid]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*signedTransaction)
+	if time.Now().After(entry.expires) {
+		t.remove(element)
+		return nil, false
+	}
+	return entry, true
+}
+
+// remove expects t.mutex to be held.
+func (t *Transactions) remove(element *list.Element) {
+	delete(t.items, element.Value.(*signedTransaction).txid)
+	t.lru.Remove(element)
+}
+
+// endregion: keep, get
+// region: handlers
+
+//
+// TransactionStatus handles GET /transactions/{tx_id}/status, which waits for the commit status of
+// a transaction submitted through /invoke, it responds with 202 and PENDING if the transaction is
+// not committed within the commit status timeout.
+//
+
+func (setup *OrgSetup) TransactionStatus(ctx *fasthttp.RequestCtx) {
+	request, entry, ok := setup.transactionRequest(ctx, "status")
+	if !ok {
+		return
+	}
+
+	wait, cancel := context.WithTimeout(http.ContextOf(ctx), tc.DefaultTimeouts().Merge(request.timeouts).CommitStatus)
+	defer cancel()
+	status, responseErr := request.client.CommitStatus(wait, entry.channel, entry.txid)
+	if responseErr != nil {
+		if responseErr.Status == codes.DeadlineExceeded {
+			request.response.Status = fasthttp.StatusAccepted
+			request.response.Message = message{ID: entry.txid, Status: "PENDING"}
+			request.response.SendJSON(nil)
+			return
+		}
+		responseErr.Txid = entry.txid
+		request.error(responseErr)
+		return
+	}
+	setup.Logger.Out(log.LOG_INFO, ctx.ID(), fmt.Sprintf("commit status of %s: %s in block %d", entry.txid, status.Code, status.BlockNumber))
+
+	request.response.Message = message{
+		ID:     entry.txid,
+		Status: status.Code.String(),
+		Result: commitStatus{BlockNumber: status.BlockNumber, Successful: status.Successful, Validation: status.Code.String()},
+	}
+	request.response.SendJSON(nil)
+}
+
+//
+// TransactionResubmit handles POST /transactions/{tx_id}/resubmit, which sends the very same
+// signed transaction to the orderer again, it can not be committed twice, so it is the safe way
+// to retry an invoke whose submit or commit status timed out.
+//
+
+func (setup *OrgSetup) TransactionResubmit(ctx *fasthttp.RequestCtx) {
+	request, entry, ok := setup.transactionRequest(ctx, "resubmit")
+	if !ok {
+		return
+	}
+
+	transaction, err := request.client.SignedTransaction(entry.bytes)
+	if err != nil {
+		request.error(err)
+		return
+	}
+	response, responseErr := tc.Submit(request.fabricRequest(request.client), transaction)
+	if responseErr != nil {
+		request.error(responseErr)
+		return
+	}
+	setup.Logger.Out(log.LOG_NOTICE, ctx.ID(), fmt.Sprintf("transaction %s resubmitted by %s", entry.txid, http.CallerOf(ctx).Name))
+
+	request.response.Message = message{ID: response.Txid, Status: "OK", Result: rawResult(response.Result)}
+	request.response.SendJSON(nil)
+}
+
+// endregion: handlers
+// region: helpers
+
+// transactionRequest looks up the kept transaction, which is visible to the caller who submitted
+// it and to admins, checks the permissions of the caller against it, and picks the client of the
+// identity it was signed with.
+func (setup *OrgSetup) transactionRequest(ctx *fasthttp.RequestCtx, kind string) (*request, *signedTransaction, bool) {
+	request := &request{
+		response: &http.Response{
+			CTX:    ctx,
+			Logger: setup.Logger,
+		},
+	}
+	request.err = setup.validate(request.response)
+	if request.err != nil {
+		return nil, nil, false
+	}
+
+	txid := fmt.Sprint(ctx.UserValue("tx_id"))
+	setup.Logger.Out(log.LOG_INFO, ctx.ID(), fmt.Sprintf("transaction %s request of %s", kind, txid))
+
+	caller := http.CallerOf(ctx)
+	entry, ok := setup.Transactions.get(txid)
+	if !ok || (entry.caller != caller.Name && !caller.Permissions.Admin()) {
+		request.response.Status = fasthttp.StatusNotFound
+		request.response.Message = errUnknownTransaction
+		request.response.Send(nil)
+		return nil, nil, false
+	}
+
+	request.form = &form{
+		Args:      []string{txid},
+		Chaincode: entry.chaincode,
+		Channel:   entry.channel,
+		Function:  entry.function,
+	}
+	if !setup.authorize(request) {
+		return nil, nil, false
+	}
+	request.audit(txid)
+
+	client, err := setup.clientFor(entry.identity)
+	if err != nil {
+		request.error(&tc.ResponseError{
+			Details: make([]map[string]string, 0),
+			Message: fmt.Sprintf("identity of transaction %s is not available", txid),
+			Status:  codes.PermissionDenied,
+			Type:    "auth",
+		})
+		return nil, nil, false
+	}
+	request.client = client
+
+	return request, entry, true
+}
+
+// rawResult passes the chaincode result on as json if it is json, and drops it otherwise.
+func rawResult(result []byte) interface{} {
+	var raw json.RawMessage
+	if json.Unmarshal(result, &raw) != nil {
+		return nil
+	}
+	return raw
+}
+
+// endregion: helpers
@@ -0,0 +1,135 @@
+// region: packages
+
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/SandorMiskey/TrustChain/rawapi/webhook"
+	"github.com/valyala/fasthttp"
+)
+
+// endregion: packages
+// region: worker
+
+// WebhooksRun delivers the chaincode events of the webhook subscriptions with the gateway
+// identity until ctx is done, it is a no-op without webhooks.
+func (setup *OrgSetup) WebhooksRun(ctx context.Context) {
+	if setup.Webhooks == nil {
+		return
+	}
+	setup.Webhooks.Run(ctx, setup.client)
+}
+
+// endregion: worker
+// region: handlers
+
+//
+// WebhookList handles GET /admin/webhooks with the subscriptions and their delivery status,
+// secrets are never returned.
+//
+
+func (setup *OrgSetup) WebhookList(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	if !setup.webhooksEnabled(response) {
+		return
+	}
+	response.Message = setup.Webhooks.List()
+	response.SendJSON(nil)
+}
+
+//
+// WebhookGet handles GET /admin/webhooks/{webhook_id}.
+//
+
+func (setup *OrgSetup) WebhookGet(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	if !setup.webhooksEnabled(response) {
+		return
+	}
+	status, err := setup.Webhooks.Get(fmt.Sprint(ctx.UserValue("webhook_id")))
+	if err != nil {
+		response.Status = fasthttp.StatusNotFound
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+	response.Message = status
+	response.SendJSON(nil)
+}
+
+//
+// WebhookAdd handles POST /admin/webhooks with a json subscription in the body, eg.
+// {"channel": "...", "chaincode": "...", "events": ["CreateBundle"], "url": "https://...", "secret": "..."},
+// delivery starts with the next block.
+//
+
+func (setup *OrgSetup) WebhookAdd(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	if !setup.webhooksEnabled(response) {
+		return
+	}
+
+	subscription := &webhook.Subscription{}
+	err := json.Unmarshal(ctx.PostBody(), subscription)
+	if err == nil {
+		subscription, err = setup.Webhooks.Add(subscription)
+	}
+	if err != nil {
+		response.Status = fasthttp.StatusBadRequest
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+	setup.Logger.Out(log.LOG_NOTICE, ctx.ID(), fmt.Sprintf("webhook %s for %s events on %s added by %s", subscription.ID, subscription.Chaincode, subscription.Channel, http.CallerOf(ctx).Name))
+
+	status, _ := setup.Webhooks.Get(subscription.ID)
+	response.Status = fasthttp.StatusCreated
+	response.Message = status
+	response.SendJSON(nil)
+}
+
+//
+// WebhookRemove handles DELETE /admin/webhooks/{webhook_id}, which stops the delivery and drops
+// the checkpoint of the subscription.
+//
+
+func (setup *OrgSetup) WebhookRemove(ctx *fasthttp.RequestCtx) {
+	response := &http.Response{CTX: ctx, Logger: setup.Logger}
+	if !setup.webhooksEnabled(response) {
+		return
+	}
+	id := fmt.Sprint(ctx.UserValue("webhook_id"))
+	if err := setup.Webhooks.Remove(id); err != nil {
+		response.Status = fasthttp.StatusInternalServerError
+		if errors.Is(err, webhook.ErrNotFound) {
+			response.Status = fasthttp.StatusNotFound
+		}
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+	setup.Logger.Out(log.LOG_NOTICE, ctx.ID(), fmt.Sprintf("webhook %s removed by %s", id, http.CallerOf(ctx).Name))
+	response.Message = message{ID: "-", Status: "OK", Result: id}
+	response.SendJSON(nil)
+}
+
+// endregion: handlers
+// region: helpers
+
+func (setup *OrgSetup) webhooksEnabled(response *http.Response) bool {
+	if setup.Webhooks != nil {
+		return true
+	}
+	response.Status = fasthttp.StatusNotFound
+	response.Message = errors.New("webhooks are not enabled")
+	response.Send(nil)
+	return false
+}
+
+// endregion: helpers
@@ -0,0 +1,291 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/SandorMiskey/TrustChain/rawapi/audit"
+	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/SandorMiskey/TrustChain/rawapi/pb"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type ServerSetup struct {
+	Audit        *audit.Log                 `json:"Audit"`
+	Auth         *http.Authenticator        `json:"Auth"`
+	Enabled      bool                       `json:"Enabled"`
+	Logger       *log.Logger                `json:"-"`
+	NetworkProto string                     `json:"NetworkProto"`
+	Port         int                        `json:"Port"`
+	Service      pb.TrustChainServiceServer `json:"-"`
+	Socket       string                     `json:"Socket"`
+	SocketMode   string                     `json:"SocketMode"`
+	SocketOwner  string                     `json:"SocketOwner"`
+	TLSCert      string                     `json:"-"`
+	TLSEnabled   bool                       `json:"TLSEnabled"`
+	TLSKey       string                     `json:"-"`
+	WaitGroup    *sync.WaitGroup            `json:"-"`
+
+	// TLSConfig, if set, is used instead of TLSCert and TLSKey, eg. the config of the https
+	// listeners, to pick up reloaded certificates and verify client certificates.
+	TLSConfig *tls.Config `json:"-"`
+
+	address  string            `json:"-"`
+	listener *http.ServerSetup `json:"-"`
+	server   *grpc.Server      `json:"-"`
+}
+
+// KeyHeader is the metadata key carrying the api key, the same value the http api expects in X-API-Key.
+const KeyHeader = "x-api-key"
+
+func (setup *ServerSetup) ServerLaunch() (*ServerSetup, error) {
+
+	// region: check
+
+	if setup.Logger == nil {
+		return setup, errors.New("grpc.ServerLaunch() needs a logger")
+	}
+	if setup.Service == nil {
+		return setup, errors.New("grpc.ServerLaunch() needs a service")
+	}
+	logger := setup.Logger.Out
+
+	if !setup.Enabled {
+		logger(log.LOG_DEBUG, "grpc api disabled")
+		return setup, nil
+	}
+
+	// endregion: check
+	// region: server
+
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(setup.unaryAuth),
+		grpc.StreamInterceptor(setup.streamAuth),
+	}
+	if setup.TLSEnabled && setup.TLSConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(h2(setup.TLSConfig))))
+	} else if setup.TLSEnabled {
+		cert, err := tls.X509KeyPair([]byte(setup.TLSCert), []byte(setup.TLSKey))
+		if err != nil {
+			logger(log.LOG_ERR, "error while loading grpc tls certificate", err)
+			return setup, err
+		}
+		options = append(options, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	}
+	setup.server = grpc.NewServer(options...)
+	pb.RegisterTrustChainServiceServer(setup.server, setup.Service)
+
+	// endregion: server
+	// region: listen
+
+	// the listeners of the http api know how to open, clean up and chmod unix domain sockets
+	setup.listener = &http.ServerSetup{Logger: setup.Logger, NetworkProto: setup.NetworkProto, SocketMode: setup.SocketMode, SocketOwner: setup.SocketOwner}
+	ln, proto, err := setup.listener.Listen(setup.Port, setup.Socket)
+	if err != nil {
+		logger(log.LOG_ERR, "error while opening grpc listener", err)
+		return setup, err
+	}
+	setup.address = ln.Addr().String()
+	if setup.WaitGroup != nil {
+		setup.WaitGroup.Add(1)
+	}
+	go func() {
+		if setup.WaitGroup != nil {
+			defer setup.WaitGroup.Done()
+		}
+		logger(log.LOG_INFO, "listening for gRPC requests", proto, ln.Addr(), "tls", setup.TLSEnabled)
+		err := setup.server.Serve(ln)
+		if err != nil {
+			logger(log.LOG_ERR, "grpc server stopped", err)
+		}
+	}()
+
+	// endregion: listen
+
+	return setup, nil
+
+}
+
+// Address returns the address the server listens on, it is empty if the server is disabled.
+func (setup *ServerSetup) Address() string {
+	return setup.address
+}
+
+// Stop waits for the pending calls to finish and removes the unix domain socket the server
+// listened on.
+func (setup *ServerSetup) Stop() {
+	if setup.server != nil {
+		setup.server.GracefulStop()
+	}
+	if setup.listener != nil {
+		setup.listener.Shutdown()
+	}
+}
+
+// region: auth
+
+// authenticate identifies the caller by the api key and the bearer token in the metadata and by
+// the verified client certificate of the connection, the same way the http api does, and returns
+// the context carrying it for the service to check its permissions.
+func (setup *ServerSetup) authenticate(ctx context.Context, method string, entry *audit.Entry) (context.Context, error) {
+	addr := remoteAddr(ctx)
+	setup.Logger.Out(log.LOG_DEBUG, addr, "grpc call", method)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	presented := http.Credentials{}
+	if keys := md.Get(KeyHeader); len(keys) > 0 {
+		presented.APIKey = []byte(keys[0])
+	}
+	if authorization := md.Get("authorization"); len(authorization) > 0 {
+		presented.Authorization = authorization[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 && len(info.State.VerifiedChains[0]) > 0 {
+			presented.Certificate = info.State.VerifiedChains[0][0]
+		}
+	}
+
+	caller, err := setup.Auth.Authenticate(presented)
+	if err != nil {
+		authErr := err.(*http.AuthError)
+		setup.Logger.Out(log.LOG_WARNING, addr, authErr.Err.Error())
+		if authErr.Status == fasthttp.StatusUnauthorized {
+			return ctx, status.Error(codes.Unauthenticated, "Authentication required!")
+		}
+		return ctx, status.Error(codes.PermissionDenied, "Access denied!")
+	}
+	if caller == nil {
+		return ctx, nil
+	}
+	entry.Caller, entry.CallerType = caller.Name, caller.Type
+	return http.ContextWithCaller(ctx, caller), nil
+}
+
+func (setup *ServerSetup) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	entry := setup.auditEntry(ctx, info.FullMethod, req)
+	defer func() { setup.audit(entry, resp, err) }()
+
+	ctx, err = setup.authenticate(ctx, info.FullMethod, entry)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (setup *ServerSetup) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	entry := setup.auditEntry(ss.Context(), info.FullMethod, nil)
+	defer func() { setup.audit(entry, nil, err) }()
+
+	ctx, err := setup.authenticate(ss.Context(), info.FullMethod, entry)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// serverStream passes the context carrying the caller on to the stream handler.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// h2 returns config with h2 negotiated, which grpc requires, for the configs returned by
+// GetConfigForClient as well.
+func h2(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	config.NextProtos = []string{"h2"}
+	if get := config.GetConfigForClient; get != nil {
+		config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := get(hello)
+			if err != nil || c == nil {
+				return c, err
+			}
+			c = c.Clone()
+			c.NextProtos = []string{"h2"}
+			return c, nil
+		}
+	}
+	return config
+}
+
+// endregion: auth
+// region: audit
+
+func (setup *ServerSetup) auditEntry(ctx context.Context, method string, req interface{}) *audit.Entry {
+	entry := &audit.Entry{
+		Caller:     "anonymous",
+		CallerType: "none",
+		RemoteAddr: remoteAddr(ctx),
+		Route:      method,
+		Time:       time.Now(),
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if org := md.Get(http.OrgHeader); len(org) > 0 {
+			entry.Org = org[0]
+		}
+	}
+
+	if r, ok := req.(interface {
+		GetChaincode() string
+		GetChannel() string
+		GetFunction() string
+		GetArgs() []string
+	}); ok {
+		entry.ArgsHash = audit.HashArgs(r.GetArgs())
+		entry.Chaincode = r.GetChaincode()
+		entry.Channel = r.GetChannel()
+		entry.Function = r.GetFunction()
+	}
+	if r, ok := req.(interface{ GetChannel() string }); ok {
+		entry.Channel = r.GetChannel()
+	}
+	if r, ok := req.(interface{ GetTxId() string }); ok {
+		entry.Txid = r.GetTxId()
+	}
+	return entry
+}
+
+func (setup *ServerSetup) audit(entry *audit.Entry, resp interface{}, err error) {
+	if setup.Audit == nil {
+		return
+	}
+	if r, ok := resp.(interface{ GetTxId() string }); ok && len(r.GetTxId()) > 0 {
+		entry.Txid = r.GetTxId()
+	}
+
+	code := status.Code(err)
+	entry.Latency = audit.Latency(time.Since(entry.Time))
+	entry.Status = int(code)
+	switch code {
+	case codes.OK:
+		entry.Outcome = audit.OutcomeOK
+	case codes.PermissionDenied, codes.Unauthenticated:
+		entry.Outcome = audit.OutcomeDenied
+	default:
+		entry.Outcome = audit.OutcomeError
+	}
+	setup.Audit.Write(entry)
+}
+
+func remoteAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "-"
+}
+
+// endregion: audit
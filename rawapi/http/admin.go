@@ -0,0 +1,264 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/cfg"
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/SandorMiskey/TrustChain/rawapi/audit"
+	"github.com/valyala/fasthttp"
+)
+
+// region: admin
+
+// AdminOnly wraps handler so that only authenticated callers with the admin permission reach it,
+// or, on the separate admin listener (see AdminListener), callers of a listener without
+// authentication, access to which is up to its address or socket.
+func (setup *RouterSetup) AdminOnly(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		caller, authenticated := ctx.UserValue(callerUserValue).(*Caller)
+		if !authenticated && !setup.AdminListener {
+			setup.Logger.Out(log.LOG_WARNING, ctx.ID(), "unauthenticated caller on the api listener, the admin api needs an admin caller or the admin listener")
+			ctx.SetStatusCode(fasthttp.StatusForbidden)
+			ctx.SetBodyString("Access denied!")
+			return
+		}
+		if authenticated && !caller.Permissions.Admin() {
+			setup.Logger.Out(log.LOG_WARNING, ctx.ID(), fmt.Sprintf("%s caller %s is not an admin", caller.Type, caller.Name))
+			ctx.SetStatusCode(fasthttp.StatusForbidden)
+			ctx.SetBodyString("Access denied!")
+			return
+		}
+		handler(ctx)
+	}
+}
+
+// endregion: admin
+// region: audit search
+
+//
+// AuditSearch handles GET /admin/audit?tx_id=&caller=&from=&to=&limit= where from and to are
+// RFC 3339 timestamps, newest entries first.
+//
+
+func (setup *RouterSetup) AuditSearch(ctx *fasthttp.RequestCtx) {
+	response := &Response{
+		CTX:    ctx,
+		Logger: setup.Logger,
+	}
+
+	q := audit.Query{
+		Caller: string(ctx.QueryArgs().Peek("caller")),
+		Limit:  ctx.QueryArgs().GetUintOrZero("limit"),
+		Txid:   string(ctx.QueryArgs().Peek("tx_id")),
+	}
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		raw := string(ctx.QueryArgs().Peek(bound.name))
+		if len(raw) == 0 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			response.Status = fasthttp.StatusBadRequest
+			response.Message = fmt.Errorf("invalid '%s' timestamp, RFC 3339 expected: %s", bound.name, raw)
+			response.Send(nil)
+			return
+		}
+		*bound.t = t
+	}
+
+	entries, err := setup.Audit.Search(q)
+	if err != nil {
+		response.Status = fasthttp.StatusServiceUnavailable
+		response.Message = err
+		response.Send(nil)
+		return
+	}
+
+	response.Message = entries
+	response.SendJSON(nil)
+}
+
+// endregion: audit search
+// region: runtime
+
+// AdminSetup serves the runtime administration endpoints, they are meant to be wrapped by
+// AdminOnly, but Health. Severity is the one the log channels were opened with, changing it
+// takes effect on the log lines that follow, unsynchronized, see AdminLogLevel. Status collects
+// the state of the components by name, Metrics write theirs in the Prometheus text format and
+// Ready a summary fit for unauthenticated callers and whether the component is ready.
+type AdminSetup struct {
+	Config   *cfg.Config
+	Logger   *log.Logger
+	Metrics  []func(io.Writer)
+	Ready    map[string]func() (interface{}, bool)
+	Severity *syslog.Priority
+	Status   map[string]func() interface{}
+
+	mutex sync.Mutex
+}
+
+// ConfigEntry is a configuration entry as the admin api shows it.
+type ConfigEntry struct {
+	Default interface{} `json:"default"`
+	Desc    string      `json:"desc"`
+	Value   interface{} `json:"value"`
+}
+
+// Redacted is the value secrets are replaced with.
+const Redacted = "[REDACTED]"
+
+var severities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// secret tells whether the configuration entry holds a credential, like api and private keys,
+// secrets, passwords, passphrases and tokens, the paths of files holding them are not secrets.
+func secret(name string) bool {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, "_key") {
+		return true
+	}
+	for _, word := range []string{"passphrase", "passwd", "password", "secret", "token"} {
+		if strings.Contains(name, word) && !strings.HasSuffix(name, "_file") {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactConfig returns the entries of config with the non-empty values and defaults of secrets
+// replaced by Redacted.
+func RedactConfig(config *cfg.Config) map[string]ConfigEntry {
+	entries := make(map[string]ConfigEntry, len(config.Entries))
+	for name, entry := range config.Entries {
+		e := ConfigEntry{Default: entry.Def, Desc: entry.Desc, Value: entry.Value}
+		if secret(name) {
+			if fmt.Sprint(e.Value) != "" {
+				e.Value = Redacted
+			}
+			if fmt.Sprint(e.Default) != "" {
+				e.Default = Redacted
+			}
+		}
+		entries[name] = e
+	}
+	return entries
+}
+
+//
+// AdminConfig handles GET /admin/config with the effective configuration, secrets redacted.
+//
+
+func (setup *AdminSetup) AdminConfig(ctx *fasthttp.RequestCtx) {
+	response := &Response{CTX: ctx, Logger: setup.Logger}
+	response.Message = RedactConfig(setup.Config)
+	response.SendJSON(nil)
+}
+
+//
+// AdminLogLevel handles GET /admin/loglevel with the current severity, and PUT or POST
+// /admin/loglevel?level= which sets it, level is 0-7 or a syslog severity name, eg. info.
+//
+
+func (setup *AdminSetup) AdminLogLevel(ctx *fasthttp.RequestCtx) {
+	response := &Response{CTX: ctx, Logger: setup.Logger}
+
+	setup.mutex.Lock()
+	defer setup.mutex.Unlock()
+
+	if !ctx.IsGet() {
+		raw := string(ctx.FormValue("level"))
+		level, err := parseSeverity(raw)
+		if err != nil {
+			response.Status = fasthttp.StatusBadRequest
+			response.Message = err
+			response.Send(nil)
+			return
+		}
+		// the log channels read the severity on every line without any synchronization, the
+		// logger has no api to change it, so this write is a data race with whatever is logging
+		// right now, a line may still be filtered by the previous level, the mutex only keeps
+		// changes in order
+		previous := *setup.Severity
+		*setup.Severity = level
+		setup.Logger.Out(log.LOG_NOTICE, ctx.ID(), fmt.Sprintf("log level changed from %s to %s by %s", severities[previous], severities[level], CallerOf(ctx).Name))
+	}
+
+	level := *setup.Severity
+	response.Message = map[string]interface{}{"level": int(level), "name": severities[level]}
+	response.SendJSON(nil)
+}
+
+func parseSeverity(raw string) (syslog.Priority, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if n, err := strconv.Atoi(raw); err == nil && n >= 0 && n < len(severities) {
+		return syslog.Priority(n), nil
+	}
+	for n, name := range severities {
+		if raw == name || raw == "log_"+name {
+			return syslog.Priority(n), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level '%s', must be 0-7 or one of %s", raw, strings.Join(severities, ", "))
+}
+
+//
+// AdminStatus handles GET /admin/status with the state of every registered component.
+//
+
+func (setup *AdminSetup) AdminStatus(ctx *fasthttp.RequestCtx) {
+	response := &Response{CTX: ctx, Logger: setup.Logger}
+
+	status := make(map[string]interface{}, len(setup.Status))
+	for name, fn := range setup.Status {
+		status[name] = fn()
+	}
+
+	response.Message = status
+	response.SendJSON(nil)
+}
+
+//
+// Health handles GET /health, see RouterSetup.Health, with the summary of every component of
+// Ready, 200 if all of them are ready and 503 otherwise.
+//
+
+func (setup *AdminSetup) Health(ctx *fasthttp.RequestCtx) {
+	response := &Response{CTX: ctx, Logger: setup.Logger}
+
+	ready := true
+	health := make(map[string]interface{}, len(setup.Ready)+1)
+	for name, fn := range setup.Ready {
+		summary, ok := fn()
+		health[name] = summary
+		ready = ready && ok
+	}
+	health["ready"] = ready
+
+	if !ready {
+		response.Status = fasthttp.StatusServiceUnavailable
+	}
+	response.Message = health
+	response.SendJSON(nil)
+}
+
+//
+// AdminMetrics handles GET /admin/metrics with the metrics of the components for Prometheus.
+//
+
+func (setup *AdminSetup) AdminMetrics(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("text/plain; version=0.0.4; charset=utf-8")
+	for _, metrics := range setup.Metrics {
+		metrics(ctx)
+	}
+}
+
+// endregion: runtime
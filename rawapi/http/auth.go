@@ -0,0 +1,354 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// region: types
+
+// Permissions is a list of channel:chaincode:function patterns, each segment may be "*",
+// missing trailing segments mean "*", eg. "*" or "trustchain-test:te-food-bundles" or
+// "trustchain-test:qscc:GetBlockByNumber", and "admin" for the admin api.
+type Permissions []string
+
+// APIKey is a named api key, restricted to Orgs, if any, on instances serving more than one org.
+type APIKey struct {
+	Identity    string      `json:"identity"`
+	Key         string      `json:"key"`
+	Orgs        []string    `json:"orgs"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// ClientCert maps the subject of a verified client certificate, its full distinguished name,
+// eg. "CN=erp.example.com,O=TE-FOOD", or just its common name, to an identity, orgs and
+// permissions.
+type ClientCert struct {
+	Identity    string      `json:"identity"`
+	Orgs        []string    `json:"orgs"`
+	Permissions Permissions `json:"permissions"`
+	Subject     string      `json:"subject"`
+}
+
+type Caller struct {
+	Identity    string      `json:"identity,omitempty"`
+	Name        string      `json:"name"`
+	Orgs        []string    `json:"orgs,omitempty"`
+	Permissions Permissions `json:"permissions"`
+	Type        string      `json:"type"`
+}
+
+const (
+	AuthKey  = "key"
+	AuthJWT  = "jwt"
+	AuthAny  = "any"
+	AuthCert = "cert"
+
+	PermissionAdmin = "admin"
+
+	CallerAnonymous = "anonymous"
+	CallerDefault   = "default"
+
+	callerUserValue = "caller"
+)
+
+var (
+	errAuthMissing = errors.New("missing credentials")
+	errAuthKey     = errors.New("missing or mismatched X-API-Key")
+	errAuthCert    = errors.New("missing or unknown client certificate")
+)
+
+// endregion: types
+// region: permissions
+
+func (p Permissions) Allow(channel, chaincode, function string) bool {
+	for _, pattern := range p {
+		if pattern == PermissionAdmin {
+			continue
+		}
+		segments := strings.SplitN(pattern, ":", 3)
+		if segmentMatch(segments, 0, channel) && segmentMatch(segments, 1, chaincode) && segmentMatch(segments, 2, function) {
+			return true
+		}
+	}
+	return false
+}
+
+// Admin tells whether the permissions include the admin api, which is granted by "admin" only,
+// channel and chaincode wildcards, "*" included, never imply it.
+func (p Permissions) Admin() bool {
+	for _, pattern := range p {
+		if pattern == PermissionAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func segmentMatch(segments []string, i int, value string) bool {
+	if i >= len(segments) {
+		return true
+	}
+	return segments[i] == "*" || segments[i] == value
+}
+
+// UnmarshalJSON accepts a list as well as a space or comma separated string, the way
+// OAuth scopes are usually put in tokens.
+func (p *Permissions) UnmarshalJSON(raw []byte) error {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		*p = list
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return fmt.Errorf("permissions must be a list or a string: %w", err)
+	}
+	*p = strings.FieldsFunc(str, func(r rune) bool { return r == ' ' || r == ',' })
+	return nil
+}
+
+// endregion: permissions
+// region: caller
+
+// CallerOf returns the authenticated caller of the request, or an anonymous caller with
+// every permission if authentication is not configured.
+func CallerOf(ctx *fasthttp.RequestCtx) *Caller {
+	if caller, ok := ctx.UserValue(callerUserValue).(*Caller); ok {
+		return caller
+	}
+	return anonymous()
+}
+
+func anonymous() *Caller {
+	return &Caller{Name: CallerAnonymous, Permissions: Permissions{"*"}, Type: "none"}
+}
+
+type callerContextKey struct{}
+
+// ContextWithCaller returns a context carrying the authenticated caller, for the apis that are
+// not served over fasthttp, see CallerOfContext.
+func ContextWithCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// CallerOfContext returns the caller ContextWithCaller put in the context, or the same anonymous
+// caller as CallerOf if there is none.
+func CallerOfContext(ctx context.Context) *Caller {
+	if caller, ok := ctx.Value(callerContextKey{}).(*Caller); ok {
+		return caller
+	}
+	return anonymous()
+}
+
+// LoadKeys reads a json object of named api keys, eg. {"erp": {"key": "...", "permissions":
+// ["*:te-food-bundles"], "orgs": ["org1"]}}.
+func LoadKeys(file string) (map[string]APIKey, error) {
+	keys := make(map[string]APIKey)
+	if len(file) == 0 {
+		return keys, nil
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read api keys: %w", err)
+	}
+	err = json.Unmarshal(raw, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse api keys in %s: %w", file, err)
+	}
+	for name, key := range keys {
+		if len(key.Key) == 0 {
+			return nil, fmt.Errorf("api key %s has no key", name)
+		}
+	}
+	return keys, nil
+}
+
+// LoadClientCerts reads a json object of named client certificate subjects, eg.
+// {"erp": {"subject": "CN=erp.example.com,O=TE-FOOD", "permissions": ["*:te-food-bundles"]}}.
+func LoadClientCerts(file string) (map[string]ClientCert, error) {
+	certs := make(map[string]ClientCert)
+	if len(file) == 0 {
+		return certs, nil
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate subjects: %w", err)
+	}
+	err = json.Unmarshal(raw, &certs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate subjects in %s: %w", file, err)
+	}
+	for name, cert := range certs {
+		if len(cert.Subject) == 0 {
+			return nil, fmt.Errorf("client certificate %s has no subject", name)
+		}
+	}
+	return certs, nil
+}
+
+// endregion: caller
+// region: authenticate
+
+// Authenticator identifies the callers of the http and the grpc api alike, by a mapped client
+// certificate first, then by bearer token or api key depending on Mode.
+type Authenticator struct {
+	ClientCerts map[string]ClientCert `json:"-"`
+	JWT         *JWTSetup             `json:"JWT"`
+	Key         string                `json:"-"`
+	Keys        map[string]APIKey     `json:"-"`
+	Mode        string                `json:"Mode"`
+}
+
+// Credentials are what a request presents, the value of its Authorization header, its api key
+// and the verified leaf of its client certificate, if any.
+type Credentials struct {
+	APIKey        []byte
+	Authorization string
+	Certificate   *x509.Certificate
+}
+
+// AuthError is a failed authentication, Status is the http status it maps to, Challenge the
+// WWW-Authenticate header to send along, if any.
+type AuthError struct {
+	Challenge string
+	Err       error
+	Status    int
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// Check validates the mode against the methods configured for it.
+func (a *Authenticator) Check() error {
+	if a == nil {
+		return nil
+	}
+	switch a.Mode {
+	case "", AuthKey:
+	case AuthCert:
+		if len(a.ClientCerts) == 0 {
+			return fmt.Errorf("auth mode %s needs client certificate subjects", a.Mode)
+		}
+	case AuthJWT, AuthAny:
+		if a.JWT == nil {
+			return fmt.Errorf("auth mode %s needs a JWT setup", a.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown auth mode '%s', must be %s, %s, %s or %s", a.Mode, AuthKey, AuthJWT, AuthAny, AuthCert)
+	}
+	return nil
+}
+
+// Authenticate returns the caller of the credentials, or nil if authentication is disabled,
+// that is, neither client certificates, keys nor a JWKS is configured, the error is an
+// *AuthError.
+func (a *Authenticator) Authenticate(credentials Credentials) (*Caller, error) {
+	if a == nil {
+		return nil, nil
+	}
+	mode := a.Mode
+	if len(mode) == 0 {
+		mode = AuthKey
+	}
+
+	// region: client certificate
+
+	if caller := a.clientCert(credentials.Certificate); caller != nil {
+		return caller, nil
+	}
+	if mode == AuthCert {
+		return nil, &AuthError{Err: errAuthCert, Status: fasthttp.StatusForbidden}
+	}
+
+	// endregion: client certificate
+	// region: bearer
+
+	if strings.HasPrefix(credentials.Authorization, "Bearer ") && mode != AuthKey {
+		caller, err := a.JWT.Verify(strings.TrimPrefix(credentials.Authorization, "Bearer "))
+		if err != nil {
+			return nil, &AuthError{Challenge: `Bearer error="invalid_token"`, Err: err, Status: fasthttp.StatusUnauthorized}
+		}
+		return caller, nil
+	}
+	if mode == AuthJWT {
+		return nil, &AuthError{Challenge: "Bearer", Err: errAuthMissing, Status: fasthttp.StatusUnauthorized}
+	}
+
+	// endregion: bearer
+	// region: key
+
+	if a.Key == "" && len(a.Keys) == 0 {
+		if mode == AuthAny {
+			return nil, &AuthError{Challenge: "Bearer", Err: errAuthMissing, Status: fasthttp.StatusUnauthorized}
+		}
+		if len(a.ClientCerts) > 0 {
+			return nil, &AuthError{Err: errAuthCert, Status: fasthttp.StatusForbidden}
+		}
+		return nil, nil
+	}
+
+	supplied := credentials.APIKey
+	if a.Key != "" && subtle.ConstantTimeCompare(supplied, []byte(a.Key)) == 1 {
+		return &Caller{Name: CallerDefault, Permissions: Permissions{"*", PermissionAdmin}, Type: AuthKey}, nil
+	}
+	for name, key := range a.Keys {
+		if subtle.ConstantTimeCompare(supplied, []byte(key.Key)) == 1 {
+			return &Caller{Identity: key.Identity, Name: name, Orgs: key.Orgs, Permissions: key.Permissions, Type: AuthKey}, nil
+		}
+	}
+	return nil, &AuthError{Err: errAuthKey, Status: fasthttp.StatusForbidden}
+
+	// endregion: key
+
+}
+
+// clientCert returns the caller of the verified client certificate, or nil if there is none or
+// its subject is not mapped. An unmapped certificate falls through to the other methods, since
+// the CA bundle may well be broader than the callers of the api.
+func (a *Authenticator) clientCert(certificate *x509.Certificate) *Caller {
+	if len(a.ClientCerts) == 0 || certificate == nil {
+		return nil
+	}
+	subject := certificate.Subject
+	for name, cert := range a.ClientCerts {
+		if cert.Subject == subject.String() || cert.Subject == subject.CommonName {
+			return &Caller{Identity: cert.Identity, Name: name, Orgs: cert.Orgs, Permissions: cert.Permissions, Type: AuthCert}
+		}
+	}
+	return nil
+}
+
+// authenticate identifies the caller of the request with the authenticator of the setup, see
+// Authenticator.Authenticate.
+func (setup *RouterSetup) authenticate(ctx *fasthttp.RequestCtx) (*Caller, int, error) {
+	credentials := Credentials{
+		APIKey:        ctx.Request.Header.Peek("X-API-Key"),
+		Authorization: string(ctx.Request.Header.Peek("Authorization")),
+	}
+	if ctx.IsTLS() {
+		if state := ctx.TLSConnectionState(); state != nil && len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+			credentials.Certificate = state.VerifiedChains[0][0]
+		}
+	}
+
+	caller, err := setup.Auth.Authenticate(credentials)
+	if err != nil {
+		authErr := err.(*AuthError)
+		if len(authErr.Challenge) > 0 {
+			ctx.Response.Header.Set("WWW-Authenticate", authErr.Challenge)
+		}
+		return nil, authErr.Status, authErr.Err
+	}
+	return caller, 0, nil
+}
+
+// endregion: authenticate
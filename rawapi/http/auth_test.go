@@ -0,0 +1,27 @@
+package http
+
+import "testing"
+
+func TestPermissions(t *testing.T) {
+	for _, tc := range []struct {
+		permissions Permissions
+		allow       bool
+		admin       bool
+	}{
+		{Permissions{"*"}, true, false},
+		{Permissions{"*:*:*"}, true, false},
+		{Permissions{"trustchain-test:basic"}, true, false},
+		{Permissions{"trustchain-test:basic:Get"}, false, false},
+		{Permissions{"other:*"}, false, false},
+		{Permissions{PermissionAdmin}, false, true},
+		{Permissions{"*", PermissionAdmin}, true, true},
+		{Permissions{}, false, false},
+	} {
+		if allow := tc.permissions.Allow("trustchain-test", "basic", "Put"); allow != tc.allow {
+			t.Errorf("%v: Allow is %t, want %t", tc.permissions, allow, tc.allow)
+		}
+		if admin := tc.permissions.Admin(); admin != tc.admin {
+			t.Errorf("%v: Admin is %t, want %t", tc.permissions, admin, tc.admin)
+		}
+	}
+}
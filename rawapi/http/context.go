@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// region: types
+
+const (
+	// TimeoutHeader lets clients shorten the deadline of a request, it takes a duration ("2.5s",
+	// "800ms") or a number of seconds, and can never extend the configured timeouts.
+	TimeoutHeader = "X-Request-Timeout"
+
+	contextUserValue = "context"
+)
+
+// DisconnectPoll is how often the connection of a pending request is checked for the client
+// having gone away.
+var DisconnectPoll = 250 * time.Millisecond
+
+// endregion: types
+// region: context
+
+// ContextOf returns the context of the request for the handlers to pass on to fabric calls, it
+// is done when the deadline of TimeoutHeader passes, the client disconnects or the handler
+// returns.
+func ContextOf(ctx *fasthttp.RequestCtx) context.Context {
+	if c, ok := ctx.UserValue(contextUserValue).(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
+
+// requestContext derives the context of the request and starts watching its connection, the
+// returned function releases both and must be called once the handler returns.
+func requestContext(ctx *fasthttp.RequestCtx) (context.Context, context.CancelFunc, error) {
+	c, cancel := context.WithCancel(context.Background())
+
+	if raw := strings.TrimSpace(string(ctx.Request.Header.Peek(TimeoutHeader))); len(raw) > 0 {
+		timeout, err := parseTimeout(raw)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		c, cancel = context.WithTimeout(c, timeout)
+	}
+
+	conn := ctx.Conn()
+	if conn != nil && canDetectDisconnect(conn) {
+		go func() {
+			ticker := time.NewTicker(DisconnectPoll)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-c.Done():
+					return
+				case <-ticker.C:
+					if disconnected(conn) {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	return c, cancel, nil
+}
+
+func parseTimeout(raw string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, nerr := strconv.ParseFloat(raw, 64)
+		if nerr != nil {
+			return 0, fmt.Errorf("invalid %s '%s', must be a duration or a number of seconds", TimeoutHeader, raw)
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s '%s', must be positive", TimeoutHeader, raw)
+	}
+	return timeout, nil
+}
+
+// endregion: context
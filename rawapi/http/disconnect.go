@@ -0,0 +1,55 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package http
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// canDetectDisconnect tells whether disconnected works on the connection, which needs access to
+// the underlying socket.
+func canDetectDisconnect(conn net.Conn) bool {
+	_, ok := rawConn(conn)
+	return ok
+}
+
+// disconnected peeks at the socket without consuming anything from it, an orderly shutdown or a
+// reset by the peer means the client is gone, pending bytes (eg. a pipelined request) do not.
+func disconnected(conn net.Conn) bool {
+	raw, ok := rawConn(conn)
+	if !ok {
+		return false
+	}
+
+	gone := false
+	buf := make([]byte, 1)
+	err := raw.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == nil && n == 0:
+			gone = true
+		case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ENOTCONN), errors.Is(err, syscall.EPIPE):
+			gone = true
+		}
+		return true
+	})
+	return gone || err != nil
+}
+
+func rawConn(conn net.Conn) (syscall.RawConn, bool) {
+	if t, ok := conn.(*tls.Conn); ok {
+		conn = t.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+	return raw, true
+}
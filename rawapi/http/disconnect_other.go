@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package http
+
+import "net"
+
+// canDetectDisconnect is false where peeking at the socket is not supported, requests run until
+// their deadline there.
+func canDetectDisconnect(conn net.Conn) bool {
+	return false
+}
+
+func disconnected(conn net.Conn) bool {
+	return false
+}
@@ -0,0 +1,374 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/valyala/fasthttp"
+)
+
+// region: types
+
+// JWTSetup verifies RS256 and ES256 signed bearer tokens against a JWKS read from a file or
+// fetched from an http(s) url, and turns their claims into a Caller.
+type JWTSetup struct {
+	Audience         string        `json:"Audience"`
+	IdentityClaim    string        `json:"IdentityClaim"`
+	Issuer           string        `json:"Issuer"`
+	JWKS             string        `json:"JWKS"`
+	Leeway           time.Duration `json:"Leeway"`
+	Logger           *log.Logger   `json:"-"`
+	OrgsClaim        string        `json:"OrgsClaim"`
+	PermissionsClaim string        `json:"PermissionsClaim"`
+	Refresh          time.Duration `json:"Refresh"`
+
+	attempted time.Time                   `json:"-"`
+	keys      map[string]crypto.PublicKey `json:"-"`
+	mutex     sync.RWMutex                `json:"-"`
+	refresh   sync.Mutex                  `json:"-"`
+	stop      chan struct{}               `json:"-"`
+}
+
+type jwk struct {
+	Crv string `json:"crv"`
+	E   string `json:"e"`
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwksRetry is the minimum time between a load of the JWKS, failed or not, and a reload
+// triggered by an unknown key id, so that tokens with made up key ids can not make us hammer
+// the JWKS url.
+const jwksRetry = time.Minute
+
+// endregion: types
+// region: jwks
+
+func (j *JWTSetup) Init() (*JWTSetup, error) {
+	if j.Logger == nil {
+		return j, errors.New("JWTSetup.Init() needs a logger")
+	}
+	if len(j.JWKS) == 0 {
+		return j, errors.New("JWTSetup.Init() needs a JWKS file or url")
+	}
+	if len(j.PermissionsClaim) == 0 {
+		j.PermissionsClaim = "permissions"
+	}
+
+	err := j.load()
+	if err != nil {
+		return j, err
+	}
+
+	if j.Refresh > 0 {
+		stop := make(chan struct{})
+		j.stop = stop
+		go func() {
+			ticker := time.NewTicker(j.Refresh)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+				if err := j.load(); err != nil {
+					j.Logger.Out(log.LOG_ERR, "error while refreshing JWKS, keeping the previous keys", err)
+				}
+			}
+		}()
+	}
+
+	return j, nil
+}
+
+// Close stops refreshing the JWKS.
+func (j *JWTSetup) Close() {
+	if j != nil && j.stop != nil {
+		close(j.stop)
+		j.stop = nil
+	}
+}
+
+func (j *JWTSetup) load() error {
+	j.refresh.Lock()
+	defer j.refresh.Unlock()
+	j.mutex.Lock()
+	j.attempted = time.Now()
+	j.mutex.Unlock()
+
+	var raw []byte
+	var err error
+	if strings.HasPrefix(j.JWKS, "http://") || strings.HasPrefix(j.JWKS, "https://") {
+		status := 0
+		status, raw, err = fasthttp.GetTimeout(nil, j.JWKS, 10*time.Second)
+		if err == nil && status != fasthttp.StatusOK {
+			err = fmt.Errorf("unexpected status %d", status)
+		}
+	} else {
+		raw, err = os.ReadFile(j.JWKS)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load JWKS from %s: %w", j.JWKS, err)
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err = json.Unmarshal(raw, &set)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWKS from %s: %w", j.JWKS, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			j.Logger.Out(log.LOG_WARNING, fmt.Sprintf("skipping JWKS key '%s': %s", k.Kid, err))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no usable key in JWKS from %s", j.JWKS)
+	}
+
+	j.mutex.Lock()
+	j.keys = keys
+	j.mutex.Unlock()
+	j.Logger.Out(log.LOG_INFO, fmt.Sprintf("loaded %d keys from JWKS %s", len(keys), j.JWKS))
+
+	return nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// key looks kid up, reloading the JWKS once in a while if it is unknown, since that is how a
+// key rotation looks like from here.
+func (j *JWTSetup) key(kid string) (crypto.PublicKey, bool) {
+	j.mutex.RLock()
+	key, ok := j.keys[kid]
+	if !ok && kid == "" && len(j.keys) == 1 {
+		for _, key = range j.keys {
+			ok = true
+		}
+	}
+	j.mutex.RUnlock()
+	if ok {
+		return key, ok
+	}
+
+	// only the first of the callers with unknown key ids after jwksRetry gets to reload
+	j.mutex.Lock()
+	stale := time.Since(j.attempted) > jwksRetry
+	if stale {
+		j.attempted = time.Now()
+	}
+	j.mutex.Unlock()
+	if !stale {
+		return nil, false
+	}
+	if err := j.load(); err != nil {
+		j.Logger.Out(log.LOG_ERR, "error while reloading JWKS", err)
+		return nil, false
+	}
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+	key, ok = j.keys[kid]
+	return key, ok
+}
+
+// endregion: jwks
+// region: verify
+
+// Verify checks the signature, expiry, issuer and audience of the token and returns the caller
+// it represents.
+func (j *JWTSetup) Verify(token string) (*Caller, error) {
+	if j == nil {
+		return nil, errors.New("bearer authentication is not configured")
+	}
+
+	// region: signature
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	header := jwtHeader{}
+	err = json.Unmarshal(rawHeader, &header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	key, ok := j.key(header.Kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key id '%s'", header.Kid)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errors.New("invalid signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return nil, errors.New("invalid signature")
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return nil, errors.New("invalid signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm '%s'", header.Alg)
+	}
+
+	// endregion: signature
+	// region: claims
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	claims := map[string]json.RawMessage{}
+	err = json.Unmarshal(rawClaims, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	now := time.Now()
+	var exp, nbf float64
+	if json.Unmarshal(claims["exp"], &exp) != nil {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(j.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if json.Unmarshal(claims["nbf"], &nbf) == nil && now.Add(j.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+
+	if len(j.Issuer) > 0 {
+		var iss string
+		if json.Unmarshal(claims["iss"], &iss) != nil || iss != j.Issuer {
+			return nil, fmt.Errorf("unexpected issuer '%s'", iss)
+		}
+	}
+	if len(j.Audience) > 0 && !audienceMatch(claims["aud"], j.Audience) {
+		return nil, errors.New("token is not issued for this audience")
+	}
+
+	// endregion: claims
+	// region: caller
+
+	caller := &Caller{Permissions: Permissions{}, Type: AuthJWT}
+	json.Unmarshal(claims["sub"], &caller.Name)
+	if len(caller.Name) == 0 {
+		return nil, errors.New("token has no subject")
+	}
+	if raw, ok := claims[j.PermissionsClaim]; ok {
+		err = json.Unmarshal(raw, &caller.Permissions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s claim: %w", j.PermissionsClaim, err)
+		}
+	}
+	if len(j.IdentityClaim) > 0 {
+		json.Unmarshal(claims[j.IdentityClaim], &caller.Identity)
+	}
+	if len(j.OrgsClaim) > 0 {
+		raw, ok := claims[j.OrgsClaim]
+		if !ok {
+			return nil, fmt.Errorf("token has no %s claim", j.OrgsClaim)
+		}
+		var orgs Permissions
+		err = json.Unmarshal(raw, &orgs)
+		if err != nil || len(orgs) == 0 {
+			return nil, fmt.Errorf("invalid %s claim, a list of orgs or \"*\" expected", j.OrgsClaim)
+		}
+		caller.Orgs = orgs
+	}
+
+	return caller, nil
+
+	// endregion: caller
+
+}
+
+func audienceMatch(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// endregion: verify
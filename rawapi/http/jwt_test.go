@@ -0,0 +1,218 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+)
+
+// jwksServer serves the public keys of its signers as a JWKS and counts the requests, it fails
+// them while failing is set.
+type jwksServer struct {
+	ec      *ecdsa.PrivateKey
+	failing bool
+	keys    []map[string]string
+	mutex   sync.Mutex
+	rsa     *rsa.PrivateKey
+	served  int
+}
+
+func newJWKSServer(t *testing.T) (*jwksServer, string) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &jwksServer{ec: ecKey, rsa: rsaKey}
+	s.add("rsa", &rsaKey.PublicKey)
+	s.add("ec", &ecKey.PublicKey)
+
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.served++
+		if s.failing {
+			w.WriteHeader(nethttp.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	}))
+	t.Cleanup(server.Close)
+	return s, server.URL
+}
+
+func (s *jwksServer) add(kid string, key crypto.PublicKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		s.keys = append(s.keys, map[string]string{"kty": "RSA", "kid": kid, "n": encode(key.N.Bytes()), "e": encode(big.NewInt(int64(key.E)).Bytes())})
+	case *ecdsa.PublicKey:
+		s.keys = append(s.keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(key.X.FillBytes(make([]byte, 32))), "y": encode(key.Y.FillBytes(make([]byte, 32)))})
+	}
+}
+
+func (s *jwksServer) requests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.served
+}
+
+// token signs the claims with the alg and kid of the header, ES256 signatures are r||s unless
+// der is set.
+func (s *jwksServer) token(t *testing.T, alg, kid string, claims map[string]interface{}, der bool) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch {
+	case alg == "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.rsa, crypto.SHA256, digest[:])
+	case alg == "ES256" && der:
+		signature, err = ecdsa.SignASN1(rand.Reader, s.ec, digest[:])
+	case alg == "ES256":
+		var r, ss *big.Int
+		r, ss, err = ecdsa.Sign(rand.Reader, s.ec, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), ss.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerify(t *testing.T) {
+	logger := log.NewLogger()
+	defer logger.Close()
+	signers, url := newJWKSServer(t)
+
+	j := &JWTSetup{Audience: "rawapi", Issuer: "https://idp.example.com", JWKS: url, Logger: logger}
+	if _, err := j.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	claims := func(exp time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"aud":         []string{"other", "rawapi"},
+			"exp":         time.Now().Add(exp).Unix(),
+			"iss":         "https://idp.example.com",
+			"permissions": "trustchain-test:basic",
+			"sub":         "erp",
+		}
+	}
+	valid := signers.token(t, "RS256", "rsa", claims(time.Hour), false)
+	tampered := strings.Split(valid, ".")
+	tampered[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999,"iss":"https://idp.example.com","aud":"rawapi","permissions":"*"}`))
+	es256 := signers.token(t, "ES256", "ec", claims(time.Hour), false)
+	truncated := strings.Split(es256, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(truncated[2])
+	truncated[2] = base64.RawURLEncoding.EncodeToString(signature[:63])
+	none := strings.Split(valid, ".")
+	none[0], none[2] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`)), ""
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"RS256", valid, ""},
+		{"ES256 r||s", es256, ""},
+		{"expired", signers.token(t, "RS256", "rsa", claims(-time.Hour), false), "token expired"},
+		{"alg none", strings.Join(none, "."), "unsupported algorithm 'none'"},
+		{"wrong alg for the key", signers.token(t, "ES256", "rsa", claims(time.Hour), false), "invalid signature"},
+		{"unknown kid", signers.token(t, "RS256", "unknown", claims(time.Hour), false), "unknown key id 'unknown'"},
+		{"bad signature", strings.Join(tampered, "."), "invalid signature"},
+		{"ES256 DER", signers.token(t, "ES256", "ec", claims(time.Hour), true), "invalid signature"},
+		{"ES256 short", strings.Join(truncated, "."), "invalid signature"},
+		{"malformed", "a.b", "malformed token"},
+	} {
+		caller, err := j.Verify(tc.token)
+		switch {
+		case len(tc.err) == 0 && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case len(tc.err) == 0 && (caller.Name != "erp" || caller.Type != AuthJWT || !caller.Permissions.Allow("trustchain-test", "basic", "Put")):
+			t.Errorf("%s: unexpected caller %+v", tc.name, caller)
+		case len(tc.err) > 0 && (err == nil || err.Error() != tc.err):
+			t.Errorf("%s: got %v, want %s", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestJWKSReloadLimit(t *testing.T) {
+	logger := log.NewLogger()
+	defer logger.Close()
+	signers, url := newJWKSServer(t)
+
+	j := &JWTSetup{JWKS: url, Logger: logger}
+	if _, err := j.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	claims := map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix(), "sub": "erp"}
+	rotated := signers.token(t, "RS256", "rotated", claims, false)
+	expire := func() {
+		j.mutex.Lock()
+		j.attempted = time.Now().Add(-2 * jwksRetry)
+		j.mutex.Unlock()
+	}
+
+	// unknown key ids right after a load do not reload
+	for i := 0; i < 3; i++ {
+		if _, err := j.Verify(rotated); err == nil {
+			t.Fatal("token of an unknown key was accepted")
+		}
+	}
+	if n := signers.requests(); n != 1 {
+		t.Errorf("%d JWKS requests after unknown key ids, want 1", n)
+	}
+
+	// a rotated key is picked up once jwksRetry has passed
+	signers.add("rotated", &signers.rsa.PublicKey)
+	expire()
+	if _, err := j.Verify(rotated); err != nil {
+		t.Errorf("token of the rotated key: %v", err)
+	}
+	if n := signers.requests(); n != 2 {
+		t.Errorf("%d JWKS requests after rotation, want 2", n)
+	}
+
+	// a failed reload counts as well
+	signers.mutex.Lock()
+	signers.failing = true
+	signers.mutex.Unlock()
+	expire()
+	unknown := signers.token(t, "RS256", "unknown", claims, false)
+	for i := 0; i < 3; i++ {
+		j.Verify(unknown)
+	}
+	if n := signers.requests(); n != 3 {
+		t.Errorf("%d JWKS requests after a failed reload, want 3", n)
+	}
+	if _, err := j.Verify(rotated); err != nil {
+		t.Errorf("keys were dropped by a failed reload: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// region: types
+
+const (
+	// OrgHeader names the org a request is meant for, instead of the /orgs/{org} prefix of its path.
+	OrgHeader = "X-Org"
+
+	// OrgAll in the orgs of a caller grants every org.
+	OrgAll = "*"
+
+	orgPrefix    = "/orgs/"
+	orgUserValue = "org"
+)
+
+// endregion: types
+// region: org
+
+// OrgOf returns the org the request names by the /orgs/{org} prefix of its path or by
+// OrgHeader, empty if it names none, which is up to the handlers to default.
+func OrgOf(ctx *fasthttp.RequestCtx) string {
+	org, _ := ctx.UserValue(orgUserValue).(string)
+	return org
+}
+
+// AllowOrg tells whether the caller may act on behalf of the org, callers without orgs may act
+// on behalf of any.
+func (c *Caller) AllowOrg(org string) bool {
+	if len(c.Orgs) == 0 {
+		return true
+	}
+	for _, allowed := range c.Orgs {
+		if allowed == OrgAll || allowed == org {
+			return true
+		}
+	}
+	return false
+}
+
+// requestOrg takes the org off the /orgs/{org} prefix of the path, which is then routed as the
+// rest of it, eg. /orgs/org2/invoke as /invoke, or from OrgHeader. A request naming two different
+// orgs is an error.
+func requestOrg(ctx *fasthttp.RequestCtx) error {
+	org := strings.TrimSpace(string(ctx.Request.Header.Peek(OrgHeader)))
+	if path := string(ctx.Path()); strings.HasPrefix(path, orgPrefix) {
+		name, rest, _ := strings.Cut(strings.TrimPrefix(path, orgPrefix), "/")
+		if len(name) == 0 {
+			return fmt.Errorf("missing org in %s", path)
+		}
+		if len(org) > 0 && org != name {
+			return fmt.Errorf("the path names org '%s', %s names '%s'", name, OrgHeader, org)
+		}
+		org = name
+		ctx.URI().SetPath("/" + rest)
+	}
+	if len(org) > 0 {
+		ctx.SetUserValue(orgUserValue, org)
+	}
+	return nil
+}
+
+// endregion: org
@@ -3,23 +3,33 @@ package http
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/SandorMiskey/TrustChain/rawapi/audit"
 	"github.com/buaazp/fasthttprouter"
 	"github.com/valyala/fasthttp"
 )
 
+// RouterSetup routes the api, AdminListener tells that it routes the separate admin listener,
+// whose unauthenticated callers AdminOnly lets through. Health, if set, serves GET HealthPath
+// without authentication, for load balancers and orchestrators, see AdminSetup.Health.
 type RouterSetup struct {
-	Key           string                 `json:"-"`
-	Logger        *log.Logger            `json:"-"`
-	Router        *fasthttprouter.Router `json:"-"`
-	Routes        *fasthttprouter.Router `json:"-"`
-	StaticEnabled bool                   `json:"StaticEnabled"`
-	StaticRoot    string                 `json:"StaticRoot"`
-	StaticIndex   string                 `json:"StaticIndex"`
-	StaticError   string                 `json:"StaticError"`
+	AdminListener bool                    `json:"AdminListener"`
+	Audit         *audit.Log              `json:"Audit"`
+	Auth          *Authenticator          `json:"Auth"`
+	Health        fasthttp.RequestHandler `json:"-"`
+	Logger        *log.Logger             `json:"-"`
+	Router        *fasthttprouter.Router  `json:"-"`
+	Routes        *fasthttprouter.Router  `json:"-"`
+	StaticEnabled bool                    `json:"StaticEnabled"`
+	StaticRoot    string                  `json:"StaticRoot"`
+	StaticIndex   string                  `json:"StaticIndex"`
+	StaticError   string                  `json:"StaticError"`
 }
 
+const HealthPath = "/health"
+
 func (setup *RouterSetup) RouterInit() (*RouterSetup, error) {
 
 	// region: check for logger
@@ -30,6 +40,13 @@ func (setup *RouterSetup) RouterInit() (*RouterSetup, error) {
 	logger := setup.Logger.Out
 
 	// endregion: logger
+	// region: auth
+
+	if err := setup.Auth.Check(); err != nil {
+		return setup, err
+	}
+
+	// endregion: auth
 
 	httpRouterActual := fasthttprouter.New()
 	if setup.StaticEnabled {
@@ -60,13 +77,47 @@ func (setup *RouterSetup) RouterInit() (*RouterSetup, error) {
 		logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("%s request on %s from %s with content type '%s' and body '%s' (%s)", ctx.Method(), ctx.Path(), ctx.RemoteAddr(), ctx.Request.Header.Peek("Content-Type"), ctx.PostBody(), ctx))
 		logger(log.LOG_INFO, ctx.ID(), ctx)
 
-		logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("supplied X-API-Key: %s", ctx.Request.Header.Peek("X-API-Key")))
-		if setup.Key != "" && (string(ctx.Request.Header.Peek("X-API-Key")) != setup.Key) {
-			logger(log.LOG_WARNING, ctx.ID(), "missing or mismatched X-API-Key")
-			ctx.SetStatusCode(403)
+		if setup.Health != nil && ctx.IsGet() && string(ctx.Path()) == HealthPath {
+			setup.Health(ctx)
+			return
+		}
+
+		entry := &audit.Entry{
+			RemoteAddr: ctx.RemoteAddr().String(),
+			Route:      string(ctx.Method()) + " " + string(ctx.Path()),
+			Time:       time.Now(),
+		}
+		ctx.SetUserValue(auditUserValue, entry)
+		defer setup.audit(ctx, entry)
+
+		if err := requestOrg(ctx); err != nil {
+			logger(log.LOG_WARNING, ctx.ID(), err)
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.SetBodyString(err.Error())
+			return
+		}
+
+		caller, status, err := setup.authenticate(ctx)
+		if err != nil {
+			logger(log.LOG_WARNING, ctx.ID(), fmt.Sprintf("authentication failed from %s: %s", ctx.RemoteAddr(), err))
+			ctx.SetStatusCode(status)
 			ctx.SetBodyString("Access denied!")
 			return
 		}
+		if caller != nil {
+			logger(log.LOG_DEBUG, ctx.ID(), fmt.Sprintf("authenticated %s caller %s", caller.Type, caller.Name))
+			ctx.SetUserValue(callerUserValue, caller)
+		}
+
+		requestCtx, cancel, err := requestContext(ctx)
+		if err != nil {
+			logger(log.LOG_WARNING, ctx.ID(), err)
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.SetBodyString(err.Error())
+			return
+		}
+		defer cancel()
+		ctx.SetUserValue(contextUserValue, requestCtx)
 
 		httpRouterActual.Handler(ctx)
 	}
@@ -76,3 +127,35 @@ func (setup *RouterSetup) RouterInit() (*RouterSetup, error) {
 	setup.Router = httpRouterPre
 	return setup, nil
 }
+
+// region: audit
+
+const auditUserValue = "audit"
+
+// AuditOf returns the audit entry of the request for the handlers to fill in, it is never nil.
+func AuditOf(ctx *fasthttp.RequestCtx) *audit.Entry {
+	if entry, ok := ctx.UserValue(auditUserValue).(*audit.Entry); ok {
+		return entry
+	}
+	return &audit.Entry{}
+}
+
+// audit completes and writes the entry of chaincode calls, admin calls and refused requests,
+// static files and other unauthenticated routes are not audited.
+func (setup *RouterSetup) audit(ctx *fasthttp.RequestCtx, entry *audit.Entry) {
+	if setup.Audit == nil {
+		return
+	}
+
+	caller := CallerOf(ctx)
+	entry.Caller, entry.CallerType = caller.Name, caller.Type
+	entry.Latency = audit.Latency(time.Since(entry.Time))
+	entry.Status = ctx.Response.StatusCode()
+	entry.Outcome = audit.Outcome(entry.Status)
+
+	if len(entry.Channel) > 0 || entry.Outcome == audit.OutcomeDenied || audit.IsAdminRoute(string(ctx.Path())) {
+		setup.Audit.Write(entry)
+	}
+}
+
+// endregion: audit
@@ -1,9 +1,9 @@
 package http
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
-	"strconv"
 	"sync"
 
 	"github.com/SandorMiskey/TEx-kit/log"
@@ -18,8 +18,10 @@ import (
 type ServerSetup struct {
 	HttpEnabled        bool                   `json:"HttpEnabled"`
 	HttpPort           int                    `json:"HttpPort"`
+	HttpSocket         string                 `json:"HttpSocket"`
 	HttpsEnabled       bool                   `json:"HttpsEnabled"`
 	HttpsPort          int                    `json:"HttpsPort"`
+	HttpsSocket        string                 `json:"HttpsSocket"`
 	HttpsCert          string                 `json:"HttpsCert"`
 	HttpsKey           string                 `json:"HttpsKey"`
 	LogAllErrors       bool                   `json:"LogAllErrors"`
@@ -28,7 +30,22 @@ type ServerSetup struct {
 	Name               string                 `json:"Name"`
 	NetworkProto       string                 `json:"NetworkProto"`
 	Router             *fasthttprouter.Router `json:"-"`
+	SocketMode         string                 `json:"SocketMode"`
+	SocketOwner        string                 `json:"SocketOwner"`
+	TLS                *TLSSetup              `json:"TLS"`
 	WaitGroup          *sync.WaitGroup        `json:"-"`
+
+	listeners []Listener         `json:"-"`
+	lns       []net.Listener     `json:"-"`
+	servers   []*fasthttp.Server `json:"-"`
+	sockets   []string           `json:"-"`
+}
+
+// Listener is an address the server listens on.
+type Listener struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	Network string `json:"network"`
 }
 
 func (setup *ServerSetup) ServerLaunch() (*ServerSetup, error) {
@@ -52,7 +69,7 @@ func (setup *ServerSetup) ServerLaunch() (*ServerSetup, error) {
 			MaxRequestBodySize: setup.MaxRequestBodySize,
 			Name:               setup.Name,
 		}
-		ln, err := net.Listen(setup.NetworkProto, ":"+strconv.Itoa(setup.HttpPort))
+		ln, proto, err := setup.Listen(setup.HttpPort, setup.HttpSocket)
 		if err != nil {
 			logger(log.LOG_ERR, "error while opening http listener", err)
 			return nil, err
@@ -60,8 +77,14 @@ func (setup *ServerSetup) ServerLaunch() (*ServerSetup, error) {
 			if setup.WaitGroup != nil {
 				setup.WaitGroup.Add(1)
 			}
+			setup.listeners = append(setup.listeners, Listener{Address: ln.Addr().String(), Name: "http", Network: proto})
+			setup.lns = append(setup.lns, ln)
+			setup.servers = append(setup.servers, http)
 			go func() {
-				logger(log.LOG_INFO, "listening for HTTP requests", setup.NetworkProto, setup.HttpPort)
+				if setup.WaitGroup != nil {
+					defer setup.WaitGroup.Done()
+				}
+				logger(log.LOG_INFO, "listening for HTTP requests", proto, ln.Addr())
 				http.Serve(ln)
 			}()
 		}
@@ -78,7 +101,7 @@ func (setup *ServerSetup) ServerLaunch() (*ServerSetup, error) {
 			MaxRequestBodySize: setup.MaxRequestBodySize,
 			Name:               setup.Name,
 		}
-		ln, err := net.Listen(setup.NetworkProto, ":"+strconv.Itoa(setup.HttpsPort))
+		ln, proto, err := setup.Listen(setup.HttpsPort, setup.HttpsSocket)
 		if err != nil {
 			logger(log.LOG_ERR, "error while opening https listener", err)
 			return setup, err
@@ -86,8 +109,18 @@ func (setup *ServerSetup) ServerLaunch() (*ServerSetup, error) {
 			if setup.WaitGroup != nil {
 				setup.WaitGroup.Add(1)
 			}
+			setup.listeners = append(setup.listeners, Listener{Address: ln.Addr().String(), Name: "https", Network: proto})
+			setup.lns = append(setup.lns, ln)
+			setup.servers = append(setup.servers, https)
 			go func() {
-				logger(log.LOG_INFO, "listening for HTTPS requests", setup.NetworkProto, setup.HttpsPort)
+				if setup.WaitGroup != nil {
+					defer setup.WaitGroup.Done()
+				}
+				logger(log.LOG_INFO, "listening for HTTPS requests", proto, ln.Addr())
+				if setup.TLS != nil {
+					https.Serve(tls.NewListener(ln, setup.TLS.Config()))
+					return
+				}
 				https.ServeTLSEmbed(ln, []byte(setup.HttpsCert), []byte(setup.HttpsKey))
 			}()
 		}
@@ -97,3 +130,25 @@ func (setup *ServerSetup) ServerLaunch() (*ServerSetup, error) {
 
 	return setup, nil
 }
+
+// Shutdown stops the servers, waiting for the open connections to finish, and removes the unix
+// domain sockets they listened on.
+func (setup *ServerSetup) Shutdown() {
+	for _, server := range setup.servers {
+		if err := server.Shutdown(); err != nil && setup.Logger != nil {
+			setup.Logger.Out(log.LOG_ERR, "error while shutting down server", err)
+		}
+	}
+
+	// a server which has not started serving yet returns as soon as it does
+	for _, ln := range setup.lns {
+		ln.Close()
+	}
+	setup.lns, setup.servers = nil, nil
+	setup.unlink()
+}
+
+// Listeners returns the addresses the server has been listening on since ServerLaunch().
+func (setup *ServerSetup) Listeners() []Listener {
+	return setup.listeners
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+)
+
+// Listen opens a unix domain socket listener at socket if it is set, or a tcp listener on port
+// otherwise, with the network protocol and the socket mode and owner of the setup.
+func (setup *ServerSetup) Listen(port int, socket string) (net.Listener, string, error) {
+
+	// region: tcp
+
+	proto := setup.NetworkProto
+	unix := proto == "unix" || proto == "unixpacket"
+	if len(socket) == 0 {
+		if unix {
+			return nil, proto, fmt.Errorf("network protocol '%s' needs a socket path", proto)
+		}
+		ln, err := net.Listen(proto, ":"+strconv.Itoa(port))
+		return ln, proto, err
+	}
+
+	// endregion: tcp
+	// region: unix
+
+	if !unix {
+		proto = "unix"
+	}
+	err := socketCleanup(proto, socket)
+	if err != nil {
+		return nil, proto, err
+	}
+	ln, err := net.Listen(proto, socket)
+	if err != nil {
+		return nil, proto, err
+	}
+	err = setup.socketPermissions(socket)
+	if err != nil {
+		ln.Close()
+		return nil, proto, err
+	}
+	setup.sockets = append(setup.sockets, socket)
+	return ln, proto, nil
+
+	// endregion: unix
+
+}
+
+// socketCleanup removes a socket left behind by a previous instance, but refuses to touch
+// anything which is not a socket or which still has someone listening on it.
+func socketCleanup(proto, socket string) error {
+	info, err := os.Lstat(socket)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and it is not a socket", socket)
+	}
+
+	conn, err := net.DialTimeout(proto, socket, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", socket)
+	}
+	return os.Remove(socket)
+}
+
+// unlink removes the sockets Listen opened, closed listeners remove theirs already, it takes
+// care of those which are not closed, eg. because their server failed to shut down.
+func (setup *ServerSetup) unlink() {
+	for _, socket := range setup.sockets {
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) && setup.Logger != nil {
+			setup.Logger.Out(log.LOG_ERR, "error while removing socket", socket, err)
+		}
+	}
+	setup.sockets = nil
+}
+
+// socketPermissions applies SocketMode and SocketOwner ("user:group", names or numeric ids, either part may be omitted).
+func (setup *ServerSetup) socketPermissions(socket string) error {
+	if len(setup.SocketMode) > 0 {
+		mode, err := strconv.ParseUint(setup.SocketMode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid socket mode '%s': %w", setup.SocketMode, err)
+		}
+		err = os.Chmod(socket, os.FileMode(mode))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(setup.SocketOwner) > 0 {
+		uid, gid := -1, -1
+		owner := strings.SplitN(setup.SocketOwner, ":", 2)
+		if len(owner[0]) > 0 {
+			id, err := strconv.Atoi(owner[0])
+			if err != nil {
+				u, err := user.Lookup(owner[0])
+				if err != nil {
+					return err
+				}
+				id, _ = strconv.Atoi(u.Uid)
+			}
+			uid = id
+		}
+		if len(owner) == 2 && len(owner[1]) > 0 {
+			id, err := strconv.Atoi(owner[1])
+			if err != nil {
+				g, err := user.LookupGroup(owner[1])
+				if err != nil {
+					return err
+				}
+				id, _ = strconv.Atoi(g.Gid)
+			}
+			gid = id
+		}
+		err := os.Chown(socket, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
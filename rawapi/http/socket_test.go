@@ -0,0 +1,148 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package http
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/buaazp/fasthttprouter"
+)
+
+func TestSocketModeAndOwner(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, owner := range []string{"", current.Uid + ":" + current.Gid, current.Username + ":" + group.Name, current.Username, ":" + group.Name} {
+		socket := filepath.Join(t.TempDir(), "rawapi.sock")
+		setup := &ServerSetup{NetworkProto: "tcp", SocketMode: "0640", SocketOwner: owner}
+		ln, proto, err := setup.Listen(0, socket)
+		if err != nil {
+			t.Fatalf("owner %q: %s", owner, err)
+		}
+		info, err := os.Stat(socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		if proto != "unix" || info.Mode().Perm() != 0640 || strconv.Itoa(int(stat.Uid)) != current.Uid || strconv.Itoa(int(stat.Gid)) != current.Gid {
+			t.Errorf("owner %q: %s socket with mode %s owned by %d:%d", owner, proto, info.Mode().Perm(), stat.Uid, stat.Gid)
+		}
+		ln.Close()
+	}
+
+	for _, setup := range []*ServerSetup{
+		{NetworkProto: "unix", SocketMode: "0999"},
+		{NetworkProto: "unix", SocketOwner: "no-such-user-of-rawapi"},
+		{NetworkProto: "unix", SocketOwner: ":no-such-group-of-rawapi"},
+	} {
+		socket := filepath.Join(t.TempDir(), "rawapi.sock")
+		if _, _, err := setup.Listen(0, socket); err == nil {
+			t.Errorf("mode %q and owner %q are accepted", setup.SocketMode, setup.SocketOwner)
+		}
+		if _, err := os.Lstat(socket); !os.IsNotExist(err) {
+			t.Errorf("mode %q and owner %q left the socket behind", setup.SocketMode, setup.SocketOwner)
+		}
+	}
+
+	if _, _, err := (&ServerSetup{NetworkProto: "unix"}).Listen(8080, ""); err == nil {
+		t.Error("unix listener without a socket path")
+	}
+}
+
+func TestStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+	setup := &ServerSetup{NetworkProto: "unix"}
+
+	// a socket of a previous instance which did not clean up after itself is replaced
+	stale := filepath.Join(dir, "stale.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, _, err = setup.Listen(0, stale)
+	if err != nil {
+		t.Fatalf("stale socket: %s", err)
+	}
+	defer ln.Close()
+
+	// a socket somebody listens on and anything that is not a socket is left alone
+	if _, _, err := setup.Listen(0, stale); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("socket in use: %v", err)
+	}
+	file := filepath.Join(dir, "rawapi.sock")
+	if err := os.WriteFile(file, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := setup.Listen(0, file); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Errorf("regular file: %v", err)
+	}
+	if raw, err := os.ReadFile(file); err != nil || string(raw) != "keep" {
+		t.Errorf("regular file is touched: %q, %v", raw, err)
+	}
+}
+
+func TestShutdownRemovesSockets(t *testing.T) {
+	logger := log.NewLogger()
+	t.Cleanup(func() { logger.Close() })
+
+	socket := filepath.Join(t.TempDir(), "rawapi.sock")
+	var wg sync.WaitGroup
+	setup := &ServerSetup{
+		HttpEnabled:  true,
+		HttpSocket:   socket,
+		Logger:       logger,
+		NetworkProto: "unix",
+		Router:       fasthttprouter.New(),
+		WaitGroup:    &wg,
+	}
+	if _, err := setup.ServerLaunch(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(socket); err != nil {
+		t.Fatal(err)
+	}
+
+	setup.Shutdown()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server is still running after shutdown")
+	}
+	if _, err := os.Lstat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket is left behind: %v", err)
+	}
+
+	// a socket the server failed to close is removed as well
+	ln, _, err := setup.Listen(0, socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	setup.Shutdown()
+	if _, err := os.Lstat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket is left behind: %v", err)
+	}
+}
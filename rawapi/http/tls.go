@@ -0,0 +1,198 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+)
+
+// region: types
+
+// TLSSetup is the server certificate of the https listeners and, optionally, the CA bundle
+// client certificates are verified against. Certificates given as files are checked for
+// changes every Reload and swapped in for new handshakes, established connections are kept.
+type TLSSetup struct {
+	Cert         string        `json:"-"`
+	CertFile     string        `json:"CertFile"`
+	ClientAuth   string        `json:"ClientAuth"`
+	ClientCAFile string        `json:"ClientCAFile"`
+	Key          string        `json:"-"`
+	KeyFile      string        `json:"KeyFile"`
+	Logger       *log.Logger   `json:"-"`
+	Reload       time.Duration `json:"Reload"`
+
+	certificate *tls.Certificate   `json:"-"`
+	clientAuth  tls.ClientAuthType `json:"-"`
+	clientCAs   *x509.CertPool     `json:"-"`
+	loaded      [3][]byte          `json:"-"`
+	mutex       sync.RWMutex       `json:"-"`
+	stop        chan struct{}      `json:"-"`
+}
+
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// endregion: types
+// region: init
+
+func (t *TLSSetup) Init() (*TLSSetup, error) {
+	if t.Logger == nil {
+		return t, errors.New("TLSSetup.Init() needs a logger")
+	}
+
+	switch t.ClientAuth {
+	case "":
+		t.clientAuth = tls.NoClientCert
+		if len(t.ClientCAFile) > 0 {
+			t.clientAuth = tls.VerifyClientCertIfGiven
+		}
+	case ClientAuthNone:
+		t.clientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		t.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		t.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return t, fmt.Errorf("unknown client auth '%s', must be %s, %s or %s", t.ClientAuth, ClientAuthNone, ClientAuthRequest, ClientAuthRequire)
+	}
+	if t.clientAuth != tls.NoClientCert && len(t.ClientCAFile) == 0 {
+		return t, fmt.Errorf("client auth %s needs a client CA bundle", t.ClientAuth)
+	}
+
+	if _, err := t.load(); err != nil {
+		return t, err
+	}
+
+	if t.Reload > 0 && (len(t.CertFile) > 0 || len(t.ClientCAFile) > 0) {
+		stop := make(chan struct{})
+		t.stop = stop
+		go func() {
+			ticker := time.NewTicker(t.Reload)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+				changed, err := t.load()
+				if err != nil {
+					t.Logger.Out(log.LOG_ERR, "error while reloading tls certificates, keeping the previous ones", err)
+					continue
+				}
+				if changed {
+					t.Logger.Out(log.LOG_NOTICE, fmt.Sprintf("reloaded tls certificate %s and client CA bundle %s", t.CertFile, t.ClientCAFile))
+				}
+			}
+		}()
+	}
+
+	return t, nil
+}
+
+// Close stops reloading the certificates.
+func (t *TLSSetup) Close() {
+	if t != nil && t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// endregion: init
+// region: config
+
+// Config returns the tls.Config of a listener, which picks up the current certificate and
+// client CA bundle on every handshake.
+func (t *TLSSetup) Config() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.mutex.RLock()
+			defer t.mutex.RUnlock()
+			return &tls.Config{
+				Certificates: []tls.Certificate{*t.certificate},
+				ClientAuth:   t.clientAuth,
+				ClientCAs:    t.clientCAs,
+				MinVersion:   tls.VersionTLS12,
+			}, nil
+		},
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// GetCertificate returns the current certificate, for listeners that do not verify clients.
+func (t *TLSSetup) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.certificate, nil
+}
+
+// Certificates returns the certificate in use and the client CA bundle, if any, to watch for
+// expiry, see certs.Source.
+func (t *TLSSetup) Certificates() map[string][]byte {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	certificates := map[string][]byte{"https certificate": t.loaded[0]}
+	if len(t.ClientCAFile) > 0 {
+		certificates["https client CA"] = t.loaded[2]
+	}
+	return certificates
+}
+
+// endregion: config
+// region: load
+
+// load reads the certificate, key and client CA bundle, and replaces the current ones if any of
+// them changed. A certificate that does not match its key, eg. one caught in the middle of a
+// rotation, is an error and the previous pair stays in use.
+func (t *TLSSetup) load() (bool, error) {
+	var err error
+	current := [3][]byte{[]byte(t.Cert), []byte(t.Key), nil}
+	for i, file := range []string{t.CertFile, t.KeyFile, t.ClientCAFile} {
+		if len(file) == 0 {
+			continue
+		}
+		current[i], err = os.ReadFile(file)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+	}
+
+	t.mutex.RLock()
+	unchanged := t.certificate != nil && bytes.Equal(current[0], t.loaded[0]) && bytes.Equal(current[1], t.loaded[1]) && bytes.Equal(current[2], t.loaded[2])
+	t.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	certificate, err := tls.X509KeyPair(current[0], current[1])
+	if err != nil {
+		return false, fmt.Errorf("invalid tls certificate or key: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if len(t.ClientCAFile) > 0 {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(current[2]) {
+			return false, fmt.Errorf("no certificate in client CA bundle %s", t.ClientCAFile)
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.certificate = &certificate
+	t.clientCAs = clientCAs
+	t.loaded = current
+
+	return true, nil
+}
+
+// endregion: load
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	nethttp "net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/valyala/fasthttp"
+)
+
+// testCert is a certificate signed by parent, or self-signed if parent is nil.
+type testCert struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, subject pkix.Name, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	template := &x509.Certificate{
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Minute),
+		SerialNumber: serial,
+		Subject:      subject,
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.BasicConstraintsValid, template.IsCA = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	}
+}
+
+func TestMutualTLSAndReload(t *testing.T) {
+	logger := log.NewLogger()
+	defer logger.Close()
+	dir := t.TempDir()
+
+	ca := newTestCert(t, pkix.Name{CommonName: "test CA"}, nil)
+	server := newTestCert(t, pkix.Name{CommonName: "localhost"}, ca)
+	erp := newTestCert(t, pkix.Name{CommonName: "erp.example.com", Organization: []string{"TE-FOOD"}}, ca)
+	stranger := newTestCert(t, pkix.Name{CommonName: "stranger"}, ca)
+
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	write := func(file string, data []byte) {
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(certFile, server.certPEM)
+	write(keyFile, server.keyPEM)
+	write(caFile, ca.certPEM)
+
+	setup := &TLSSetup{CertFile: certFile, ClientCAFile: caFile, KeyFile: keyFile, Logger: logger}
+	if _, err := setup.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	router := &RouterSetup{
+		Auth:   &Authenticator{ClientCerts: map[string]ClientCert{"erp": {Subject: "CN=erp.example.com,O=TE-FOOD", Permissions: Permissions{"*:te-food-bundles"}}}},
+		Logger: logger,
+	}
+	if _, err := router.RouterInit(); err != nil {
+		t.Fatal(err)
+	}
+	router.Routes.GET("/whoami", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(CallerOf(ctx).Type + ":" + CallerOf(ctx).Name)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpsServer := &fasthttp.Server{Handler: router.Router.Handler}
+	go httpsServer.Serve(tls.NewListener(ln, setup.Config()))
+	defer httpsServer.Shutdown()
+
+	get := func(client *testCert, roots *testCert) (int, string, *x509.Certificate) {
+		t.Helper()
+		config := &tls.Config{RootCAs: x509.NewCertPool()}
+		config.RootCAs.AddCert(roots.cert)
+		if client != nil {
+			config.Certificates = []tls.Certificate{{Certificate: [][]byte{client.cert.Raw}, PrivateKey: client.key}}
+		}
+		c := &nethttp.Client{Transport: &nethttp.Transport{TLSClientConfig: config}}
+		defer c.CloseIdleConnections()
+		response, err := c.Get("https://" + ln.Addr().String() + "/whoami")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body := make([]byte, 64)
+		n, _ := response.Body.Read(body)
+		return response.StatusCode, string(body[:n]), response.TLS.PeerCertificates[0]
+	}
+
+	// region: subjects
+
+	if status, body, _ := get(erp, ca); status != fasthttp.StatusOK || body != "cert:erp" {
+		t.Errorf("mapped certificate: got %d %q", status, body)
+	}
+	if status, _, _ := get(stranger, ca); status != fasthttp.StatusForbidden {
+		t.Errorf("unmapped certificate: got %d, want 403", status)
+	}
+	if status, _, _ := get(nil, ca); status != fasthttp.StatusForbidden {
+		t.Errorf("no certificate: got %d, want 403", status)
+	}
+
+	// endregion: subjects
+	// region: reload
+
+	rotated := newTestCert(t, pkix.Name{CommonName: "localhost"}, ca)
+	write(certFile, rotated.certPEM)
+	if _, err := setup.load(); err == nil {
+		t.Error("certificate not matching the key is loaded")
+	}
+	if _, _, peer := get(erp, ca); !peer.Equal(server.cert) {
+		t.Error("previous certificate is not kept after a failed reload")
+	}
+
+	write(keyFile, rotated.keyPEM)
+	if changed, err := setup.load(); err != nil || !changed {
+		t.Fatalf("reload: changed %t, %v", changed, err)
+	}
+	if _, _, peer := get(erp, ca); !peer.Equal(rotated.cert) {
+		t.Error("rotated certificate is not served")
+	}
+
+	// endregion: reload
+}
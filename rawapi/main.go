@@ -3,15 +3,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/syslog"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/SandorMiskey/TEx-kit/cfg"
 	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/audit"
+	"github.com/SandorMiskey/TrustChain/rawapi/certs"
 	"github.com/SandorMiskey/TrustChain/rawapi/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/grpc"
 	"github.com/SandorMiskey/TrustChain/rawapi/http"
+	"github.com/SandorMiskey/TrustChain/rawapi/queue"
+	"github.com/SandorMiskey/TrustChain/rawapi/settings"
+	"github.com/SandorMiskey/TrustChain/rawapi/webhook"
 
 	// "github.com/davecgh/go-spew/spew"
 
@@ -25,9 +37,10 @@ var (
 	// Db     *db.Db
 	config cfg.Config
 	logger log.Logger
-	org    fabric.OrgSetup
+	orgs   fabric.Orgs
 	server http.ServerSetup
 	router http.RouterSetup
+	rpc    grpc.ServerSetup
 )
 
 const (
@@ -54,12 +67,44 @@ func main() {
 		// "dbType":        {Desc: "db type as in TEx-kit/db/db.go", Type: "int", Def: 4},
 		// "dbUser":        {Desc: "database user", Type: "string", Def: "mgmt"},
 
+		"tc_rawapi_config": {Desc: "YAML or JSON config file with server, tls, keys, orgs, lator, routes, certs, audit and log sections, its settings are overridden by environment variables and flags, those of the first org only if it lists more than one, see doc/rawapi.example.yaml", Type: "string", Def: ""},
+		"print-config":     {Desc: "print the effective configuration with secrets redacted, and exit", Type: "bool", Def: false},
+
+		"tc_rawapi_cache_enabled":    {Desc: "enable caching of allowlisted query responses", Type: "bool", Def: false},
+		"tc_rawapi_cache_functions":  {Desc: "comma separated list of cacheable chaincode:function[=ttl] pairs", Type: "string", Def: "te-food-bundles:BundleGet,qscc:GetBlockByNumber=1h,qscc:GetBlockByTxID=1h,qscc:GetTransactionByID=1h,qscc:GetChainInfo=2s"},
+		"tc_rawapi_cache_invalidate": {Desc: "purge cached qscc responses and those of the chaincodes a new block writes to", Type: "bool", Def: true},
+		"tc_rawapi_cache_size":       {Desc: "maximum number of cached responses", Type: "int", Def: 1024},
+		"tc_rawapi_cache_ttl":        {Desc: "default time to live of cached responses", Type: "time.Duration", Def: 10 * time.Second},
+
 		"tc_rawapi_key":      {Desc: "api key, skip if not set", Type: "string", Def: ""},
 		"tc_rawapi_key_file": {Desc: "api key from file", Type: "string", Def: ""},
+		"tc_rawapi_keys":     {Desc: "json file of named api keys with permissions, optional wallet identity and orgs they are restricted to, eg. {\"erp\": {\"key\": \"...\", \"permissions\": [\"trustchain-test:te-food-bundles:*\"], \"identity\": \"erp\", \"orgs\": [\"te-food-endorsers\"]}}, \"admin\" grants the /admin api, wildcards do not", Type: "string", Def: ""},
+
+		"tc_rawapi_admin_port":   {Desc: "port of a separate listener for the /admin api, which is served along with the rest of the api to admin callers only if both this and tc_rawapi_admin_socket are empty, the separate listener serves unauthenticated callers as well if no authentication is configured", Type: "int", Def: 0},
+		"tc_rawapi_admin_socket": {Desc: "unix domain socket path of the separate /admin listener, tc_rawapi_admin_port is ignored if set", Type: "string", Def: ""},
+		"tc_rawapi_admin_tls":    {Desc: "serve the separate /admin listener over TLS with the https certificate and key", Type: "bool", Def: true},
+
+		"tc_rawapi_audit_dir":      {Desc: "directory of the append-only audit log, auditing is disabled if empty", Type: "string", Def: ""},
+		"tc_rawapi_audit_maxFiles": {Desc: "number of rotated audit files to keep, 0 keeps all of them", Type: "int", Def: 0},
+		"tc_rawapi_audit_maxSize":  {Desc: "size in bytes above which the audit file is rotated, 0 disables rotation", Type: "int", Def: 64 * 1024 * 1024},
+
+		"tc_rawapi_auth_mode":                  {Desc: "accepted credentials: 'key' (X-API-Key), 'jwt' (Authorization: Bearer), 'any' or 'cert' (client certificates only), mapped client certificates are accepted in every mode", Type: "string", Def: "key"},
+		"tc_rawapi_auth_jwt_audience":          {Desc: "required aud claim, not checked if empty", Type: "string", Def: ""},
+		"tc_rawapi_auth_jwt_identityClaim":     {Desc: "claim holding the label of the wallet identity to transact with, the gateway identity is used if empty", Type: "string", Def: ""},
+		"tc_rawapi_auth_jwt_issuer":            {Desc: "required iss claim, not checked if empty", Type: "string", Def: ""},
+		"tc_rawapi_auth_jwt_jwks":              {Desc: "JWKS file or http(s) url with the RS256/ES256 token signing keys", Type: "string", Def: ""},
+		"tc_rawapi_auth_jwt_leeway":            {Desc: "allowed clock skew when checking exp and nbf", Type: "time.Duration", Def: 30 * time.Second},
+		"tc_rawapi_auth_jwt_orgsClaim":         {Desc: "claim holding the orgs the caller is restricted to as a list or a space separated string, \"*\" for all, tokens without it are rejected, not checked if empty", Type: "string", Def: ""},
+		"tc_rawapi_auth_jwt_permissionsClaim":  {Desc: "claim holding channel:chaincode:function permissions as a list or a space separated string", Type: "string", Def: "permissions"},
+		"tc_rawapi_auth_jwt_refresh":           {Desc: "JWKS reload interval, 0 disables periodic reload", Type: "time.Duration", Def: time.Hour},
+		"tc_rawapi_auth_wallet":                {Desc: "directory of wallet identities (<label>.id) api keys and tokens may be mapped to", Type: "string", Def: ""},
+		"tc_rawapi_auth_walletPassphrase":      {Desc: "passphrase the private keys in the wallet are encrypted with, they are stored in plain text if empty", Type: "string", Def: ""},
+		"tc_rawapi_auth_walletPassphrase_file": {Desc: "passphrase of the wallet from file", Type: "string", Def: ""},
 
 		"tc_rawapi_http_enabled":        {Desc: "enable http", Type: "bool", Def: true},
 		"tc_rawapi_http_name":           {Desc: "server name in response header", Type: "string", Def: "TrustChain backend"},
 		"tc_rawapi_http_port":           {Desc: "http port", Type: "int", Def: 5998},
+		"tc_rawapi_http_socket":         {Desc: "unix domain socket path for http, tc_rawapi_http_port is ignored if set", Type: "string", Def: ""},
 		"tc_rawapi_http_static_enabled": {Desc: "enable serving static files", Type: "bool", Def: false},
 		"tc_rawapi_http_static_root":    {Desc: "path to static files", Type: "string", Def: "/tmp"},
 		"tc_rawapi_http_static_index":   {Desc: "index file to serve during directory access", Type: "string", Def: "index.html"},
@@ -67,14 +112,52 @@ func main() {
 
 		"tc_rawapi_https_enabled":   {Desc: "enable https", Type: "bool", Def: true},
 		"tc_rawapi_https_port":      {Desc: "https port", Type: "int", Def: 5999},
+		"tc_rawapi_https_socket":    {Desc: "unix domain socket path for https, tc_rawapi_https_port is ignored if set", Type: "string", Def: ""},
 		"tc_rawapi_https_cert":      {Desc: "https certificate", Type: "string", Def: ""},
 		"tc_rawapi_https_cert_file": {Desc: "https certificate file", Type: "string", Def: ""},
 		"tc_rawapi_https_key":       {Desc: "private key for HTTPS certificate", Type: "string", Def: ""},
 		"tc_rawapi_https_key_file":  {Desc: "httpTLSKey file", Type: "string", Def: ""},
 
+		"tc_rawapi_https_clientAuth":  {Desc: "client certificates requested on https: 'none', 'request' (verified if presented) or 'require', 'request' if empty and tc_rawapi_https_clientCA is set", Type: "string", Def: ""},
+		"tc_rawapi_https_clientCA":    {Desc: "PEM bundle of the CAs client certificates are verified against, mutual TLS is disabled if empty", Type: "string", Def: ""},
+		"tc_rawapi_https_clientCerts": {Desc: "json file of named client certificate subjects (full DN or CN) with permissions, optional wallet identity and orgs, eg. {\"erp\": {\"subject\": \"CN=erp.example.com,O=TE-FOOD\", \"permissions\": [\"*:te-food-bundles\"]}}", Type: "string", Def: ""},
+		"tc_rawapi_https_reload":      {Desc: "how often tc_rawapi_https_cert_file, tc_rawapi_https_key_file and tc_rawapi_https_clientCA are checked for changes, 0 disables reloading", Type: "time.Duration", Def: time.Minute},
+
 		"tc_rawapi_http_logAllErrors":       {Desc: "enable http", Type: "bool", Def: true},
 		"tc_rawapi_http_maxRequestBodySize": {Desc: "http max request body size ", Type: "int", Def: 4 * 1024 * 1024},
-		"tc_rawapi_http_networkProto":       {Desc: "network protocol must be 'tcp', 'tcp4', 'tcp6', 'unix' or 'unixpacket'", Type: "string", Def: "tcp"},
+		"tc_rawapi_http_networkProto":       {Desc: "network protocol must be 'tcp', 'tcp4', 'tcp6', 'unix' or 'unixpacket', the latter two need socket paths", Type: "string", Def: "tcp"},
+		"tc_rawapi_http_socketMode":         {Desc: "octal file mode of unix domain sockets, eg. 0660, empty means umask", Type: "string", Def: ""},
+		"tc_rawapi_http_socketOwner":        {Desc: "owner of unix domain sockets as user:group, names or numeric ids", Type: "string", Def: ""},
+
+		"tc_rawapi_grpc_enabled":      {Desc: "enable the gRPC api (TrustChainService, see pb/trustchain.proto), calls are routed to the org of their x-org metadata, the first one if they have none", Type: "bool", Def: false},
+		"tc_rawapi_grpc_networkProto": {Desc: "gRPC network protocol, 'tcp', 'tcp4', 'tcp6' or 'unix', the latter needs tc_rawapi_grpc_socket", Type: "string", Def: "tcp"},
+		"tc_rawapi_grpc_port":         {Desc: "gRPC port", Type: "int", Def: 5997},
+		"tc_rawapi_grpc_socket":       {Desc: "unix domain socket path for gRPC, tc_rawapi_grpc_port is ignored if set, mode and owner as of tc_rawapi_http_socketMode and tc_rawapi_http_socketOwner", Type: "string", Def: ""},
+		"tc_rawapi_grpc_tls":          {Desc: "serve gRPC over TLS with the https certificate and key, which must be set unless this is disabled", Type: "bool", Def: true},
+
+		"tc_rawapi_queue_backoff":     {Desc: "delay before the first retry of a queued invocation, doubled on every further attempt", Type: "time.Duration", Def: time.Second},
+		"tc_rawapi_queue_backoffMax":  {Desc: "maximum delay between two attempts of a queued invocation", Type: "time.Duration", Def: 5 * time.Minute},
+		"tc_rawapi_queue_maxAttempts": {Desc: "attempts after which a queued invocation is dead-lettered, 0 retries forever", Type: "int", Def: 20},
+		"tc_rawapi_queue_path":        {Desc: "bbolt file of the durable invoke queue, /invoke answers 202 with a queue id if set, and submits directly if empty, further orgs have a queue only with a file of their own", Type: "string", Def: ""},
+		"tc_rawapi_queue_poll":        {Desc: "how often the queue worker looks for due items", Type: "time.Duration", Def: time.Second},
+		"tc_rawapi_queue_retention":   {Desc: "time after which committed queue items are removed, 0 keeps them forever, dead letters are kept", Type: "time.Duration", Def: 7 * 24 * time.Hour},
+
+		"tc_rawapi_transactions_size": {Desc: "maximum number of signed transactions kept for /transactions/{tx_id}/status and /resubmit, 0 disables keeping them", Type: "int", Def: 4096},
+		"tc_rawapi_transactions_ttl":  {Desc: "how long signed transactions are kept after submission", Type: "time.Duration", Def: time.Hour},
+
+		"tc_rawapi_webhook_backoff":     {Desc: "delay before the first retry of a failed webhook delivery, doubled on every further attempt", Type: "time.Duration", Def: time.Second},
+		"tc_rawapi_webhook_backoffMax":  {Desc: "maximum delay between two attempts of a webhook delivery", Type: "time.Duration", Def: 5 * time.Minute},
+		"tc_rawapi_webhook_checkpoints": {Desc: "directory of the per subscription event checkpoints, the directory of tc_rawapi_webhook_path if empty", Type: "string", Def: ""},
+		"tc_rawapi_webhook_maxAge":      {Desc: "time after the first attempt of a webhook delivery when it is dead-lettered, 0 retries forever", Type: "time.Duration", Def: 24 * time.Hour},
+		"tc_rawapi_webhook_maxAttempts": {Desc: "attempts after which a webhook delivery is dead-lettered, 0 retries forever", Type: "int", Def: 20},
+		"tc_rawapi_webhook_path":        {Desc: "json file of the webhook subscriptions, also updated through /admin/webhooks, webhooks are disabled if empty, further orgs have webhooks only with a file of their own", Type: "string", Def: ""},
+		"tc_rawapi_webhook_timeout":     {Desc: "timeout of a single webhook delivery", Type: "time.Duration", Def: 10 * time.Second},
+
+		"tc_rawapi_timeout_commitStatus": {Desc: "default time to wait for the commit status of a transaction", Type: "time.Duration", Def: time.Minute},
+		"tc_rawapi_timeout_endorse":      {Desc: "default timeout of endorsements", Type: "time.Duration", Def: 15 * time.Second},
+		"tc_rawapi_timeout_evaluate":     {Desc: "default timeout of queries", Type: "time.Duration", Def: 5 * time.Second},
+		"tc_rawapi_timeout_overrides":    {Desc: "comma separated list of chaincode[:function][/phase]=timeout overrides, phase is evaluate, endorse, submit or commit, eg. te-food-bundles:CreateBundle/endorse=30s,qscc=20s", Type: "string", Def: ""},
+		"tc_rawapi_timeout_submit":       {Desc: "default timeout of submitting endorsed transactions to the orderer", Type: "time.Duration", Def: 5 * time.Second},
 
 		"tc_rawapi_lator_which": {Desc: "path to configtxlator (if empty, will dump protobuf as base64 encoded string)", Type: "string", Def: "/usr/local/bin/configtxlator"},
 		"tc_rawapi_lator_bind":  {Desc: "address to bind configtxlator's rest api to", Type: "string", Def: "127.0.0.1"},
@@ -85,10 +168,34 @@ func main() {
 		"tc_rawapi_orgName":      {Desc: "TC_RAWAPI_ORGNAME", Type: "string", Def: "te-food-endorsers"},
 		"tc_rawapi_MSPID":        {Desc: "TC_RAWAPI_MSPID", Type: "string", Def: "te-food_endorsersMSP"},
 		"tc_rawapi_certPath":     {Desc: "TC_RAWAPI_CERTPATH", Type: "string", Def: "/users/User1@org1.example.com/msp/signcerts/cert.pem"},
-		"tc_rawapi_keyPath":      {Desc: "TC_RAWAPI_KEYPATH", Type: "string", Def: "/users/User1@org1.example.com/msp/keystore/"},
+		"tc_rawapi_keyPath":      {Desc: "TC_RAWAPI_KEYPATH, the key of tc_rawapi_certPath is looked up in tc_rawapi_auth_wallet if empty", Type: "string", Def: "/users/User1@org1.example.com/msp/keystore/"},
+		"tc_rawapi_identity":     {Desc: "label of the wallet identity in tc_rawapi_auth_wallet the gateway transacts with, instead of tc_rawapi_certPath and tc_rawapi_keyPath", Type: "string", Def: ""},
 		"tc_rawapi_TLSCertPath":  {Desc: "TC_RAWAPI_TLSCERTPATH", Type: "string", Def: "/peers/peer0.org1.example.com/tls/ca.crt"},
 		"tc_rawapi_peerEndpoint": {Desc: "TC_RAWAPI_PEERENDPOINT", Type: "string", Def: "localhost:7051"},
 		"tc_rawapi_gatewayPeer":  {Desc: "TC_RAWAPI_GATEWAYPEER", Type: "string", Def: "peer0.org1.example.com"},
+		"tc_rawapi_profile":      {Desc: "Fabric connection profile (YAML or JSON), if set, the organization (tc_rawapi_orgName if the profile has it, its client.organization otherwise), its MSP ID, client identity, gateway peer, endpoint and TLS root are taken from it instead of the settings above", Type: "string", Def: ""},
+		"tc_rawapi_profile_peer": {Desc: "peer of the connection profile to connect to, the first peer of the organization if empty", Type: "string", Def: ""},
+		"tc_rawapi_ca_url":       {Desc: "Fabric CA of the organization, eg. https://ca1.endorsers.example.com:8001, the gateway and wallet identities are reenrolled with it before their certificates expire, the CA of the organization in tc_rawapi_profile if empty", Type: "string", Def: ""},
+		"tc_rawapi_ca_name":      {Desc: "name of the CA in a Fabric CA server hosting more than one, empty means the default CA", Type: "string", Def: ""},
+		"tc_rawapi_ca_tlsCert":   {Desc: "TLS root certificate of the CA", Type: "string", Def: ""},
+		"tc_rawapi_ca_renewDays": {Desc: "identities are reenrolled when their certificate expires within this many days, 0 disables reenrollment", Type: "int", Def: 30},
+		"tc_rawapi_ca_check":     {Desc: "how often certificates are checked for reenrollment", Type: "time.Duration", Def: time.Hour},
+		"tc_rawapi_reload":       {Desc: "how often the certificate, private key and TLS root of the gateway identity are checked for changes, 0 disables reloading", Type: "time.Duration", Def: time.Minute},
+
+		"tc_rawapi_consistency_peers": {Desc: ", separated peers /admin/consistency compares unless the request names them, peers of tc_rawapi_profile by name or gateway peers as name=host:port verified against the TLS root of the org, every peer of the profile if empty", Type: "string", Def: ""},
+
+		"tc_rawapi_certs_check":    {Desc: "how often the certificates of the gateway and wallet identities, the TLS roots of the peer and the CA, the https certificate and the client CA bundle are checked for expiry, 0 checks them at startup only", Type: "time.Duration", Def: time.Hour},
+		"tc_rawapi_certs_warnDays": {Desc: ", separated thresholds in days, a certificate getting within one is logged once, at a higher severity for every lower threshold, eg. 30,14,7,1", Type: "string", Def: "30,14,7,1"},
+	}
+
+	var further []settings.Org
+	if file := settings.Locate("tc_rawapi_config", os.Args[1:]); len(file) > 0 {
+		var err error
+		further, err = settings.Load(file, flagSet.Entries)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 	}
 
 	err := flagSet.ParseCopy()
@@ -96,6 +203,34 @@ func main() {
 		panic(err)
 	}
 
+	orgEntries := []map[string]cfg.Entry{config.Entries}
+	for _, org := range further {
+		orgEntries = append(orgEntries, org.Entries(config.Entries))
+	}
+
+	if config.Entries["print-config"].Value.(bool) {
+		redacted := make([]map[string]interface{}, 0, len(orgEntries))
+		for _, entries := range orgEntries {
+			values := make(map[string]interface{})
+			for name, entry := range http.RedactConfig(&cfg.Config{Entries: entries}) {
+				values[name] = entry.Value
+			}
+			redacted = append(redacted, values)
+		}
+		out, err := settings.Render(redacted[0], redacted[1:]...)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Print(string(out))
+	}
+	if err = settings.Validate(config.Entries, orgEntries[1:]...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if config.Entries["print-config"].Value.(bool) {
+		os.Exit(0)
+	}
+
 	// endregion: cli flags
 	// region: logger
 
@@ -135,49 +270,301 @@ func main() {
 	// endregion: db
 	// region: configtxlator
 
-	lator := fabric.Lator{
+	lator := tc.Lator{
 		Bind:  config.Entries["tc_rawapi_lator_bind"].Value.(string),
 		Port:  config.Entries["tc_rawapi_lator_port"].Value.(int),
 		Which: config.Entries["tc_rawapi_lator_which"].Value.(string),
 	}
-	_, err = lator.Init()
+	err = lator.Init()
 	if err != nil {
 		logger.Out(LOG_EMERG, "error initializing configtxlator instance", err, lator)
 		panic(err)
 	}
+	defer lator.Close()
 	logger.Out(LOG_DEBUG, "configtxlator instance", lator)
 
 	// endregion: configtxlator
-	// region: fabric gw
+	// region: cache
 
-	org = fabric.OrgSetup{
-		CertPath:     config.Entries["tc_rawapi_certPath"].Value.(string),
-		GatewayPeer:  config.Entries["tc_rawapi_gatewayPeer"].Value.(string),
-		KeyPath:      config.Entries["tc_rawapi_keyPath"].Value.(string),
-		Logger:       &logger,
-		Lator:        &lator,
-		MSPID:        config.Entries["tc_rawapi_MSPID"].Value.(string),
-		OrgName:      config.Entries["tc_rawapi_orgName"].Value.(string),
-		PeerEndpoint: config.Entries["tc_rawapi_peerEndpoint"].Value.(string),
-		TLSCertPath:  config.Entries["tc_rawapi_TLSCertPath"].Value.(string),
+	// every org has a cache of its own, query results may depend on the identity
+	newCache := func(logger *log.Logger) *fabric.Cache {
+		if !config.Entries["tc_rawapi_cache_enabled"].Value.(bool) {
+			return nil
+		}
+		cache := &fabric.Cache{
+			Functions:  config.Entries["tc_rawapi_cache_functions"].Value.(string),
+			Invalidate: config.Entries["tc_rawapi_cache_invalidate"].Value.(bool),
+			Logger:     logger,
+			Size:       config.Entries["tc_rawapi_cache_size"].Value.(int),
+			TTL:        config.Entries["tc_rawapi_cache_ttl"].Value.(time.Duration),
+		}
+		_, err := cache.Init()
+		if err != nil {
+			logger.Out(LOG_EMERG, "error initializing query cache", err, cache)
+			panic(err)
+		}
+		logger.Out(LOG_DEBUG, "query cache", cache)
+		return cache
 	}
-	logger.Out(LOG_DEBUG, "OrgSetup", org)
 
-	_, err = org.Init()
+	// endregion: cache
+	// region: timeouts
+
+	timeouts := &fabric.Timeouts{
+		Defaults: tc.Timeouts{
+			CommitStatus: config.Entries["tc_rawapi_timeout_commitStatus"].Value.(time.Duration),
+			Endorse:      config.Entries["tc_rawapi_timeout_endorse"].Value.(time.Duration),
+			Evaluate:     config.Entries["tc_rawapi_timeout_evaluate"].Value.(time.Duration),
+			Submit:       config.Entries["tc_rawapi_timeout_submit"].Value.(time.Duration),
+		},
+		Overrides: config.Entries["tc_rawapi_timeout_overrides"].Value.(string),
+	}
+	_, err = timeouts.Init()
 	if err != nil {
-		logger.Out(LOG_EMERG, fmt.Sprintf("error initializing setup for %s: %s", org.OrgName, err))
+		logger.Out(LOG_EMERG, "error parsing timeout overrides", err)
 		panic(err)
 	}
-	logger.Out(LOG_DEBUG, fmt.Sprintf("OrgInstance: %+v\n", org))
+	logger.Out(LOG_DEBUG, "timeouts", timeouts)
+
+	// endregion: timeouts
+	// region: queue
+
+	newQueue := func(logger *log.Logger, path string) *queue.Queue {
+		invokeQueue := &queue.Queue{
+			Backoff:     config.Entries["tc_rawapi_queue_backoff"].Value.(time.Duration),
+			BackoffMax:  config.Entries["tc_rawapi_queue_backoffMax"].Value.(time.Duration),
+			Logger:      logger,
+			MaxAttempts: config.Entries["tc_rawapi_queue_maxAttempts"].Value.(int),
+			Path:        path,
+			Poll:        config.Entries["tc_rawapi_queue_poll"].Value.(time.Duration),
+			Retention:   config.Entries["tc_rawapi_queue_retention"].Value.(time.Duration),
+		}
+		_, err := invokeQueue.Init()
+		if err != nil {
+			logger.Out(LOG_EMERG, "error opening invoke queue", err)
+			panic(err)
+		}
+		return invokeQueue
+	}
+
+	// endregion: queue
+	// region: transactions
+
+	newTransactions := func(logger *log.Logger) *fabric.Transactions {
+		size := config.Entries["tc_rawapi_transactions_size"].Value.(int)
+		if size <= 0 {
+			return nil
+		}
+		transactions := &fabric.Transactions{
+			Logger: logger,
+			Size:   size,
+			TTL:    config.Entries["tc_rawapi_transactions_ttl"].Value.(time.Duration),
+		}
+		_, err := transactions.Init()
+		if err != nil {
+			logger.Out(LOG_EMERG, "error initializing kept transactions", err)
+			panic(err)
+		}
+		return transactions
+	}
+
+	// endregion: transactions
+	// region: webhooks
+
+	newWebhooks := func(logger *log.Logger, path, checkpoints string) *webhook.Webhooks {
+		webhooks := &webhook.Webhooks{
+			Backoff:     config.Entries["tc_rawapi_webhook_backoff"].Value.(time.Duration),
+			BackoffMax:  config.Entries["tc_rawapi_webhook_backoffMax"].Value.(time.Duration),
+			Checkpoints: checkpoints,
+			Logger:      logger,
+			MaxAge:      config.Entries["tc_rawapi_webhook_maxAge"].Value.(time.Duration),
+			MaxAttempts: config.Entries["tc_rawapi_webhook_maxAttempts"].Value.(int),
+			Path:        path,
+			Timeout:     config.Entries["tc_rawapi_webhook_timeout"].Value.(time.Duration),
+		}
+		_, err := webhooks.Init()
+		if err != nil {
+			logger.Out(LOG_EMERG, "error loading webhook subscriptions", err)
+			panic(err)
+		}
+		return webhooks
+	}
+
+	// endregion: webhooks
+	// region: fabric gw
+
+	// further orgs have a queue and webhooks only with files of their own, they inherit the
+	// settings of the first org otherwise, and submit directly and notify no one
+	orgs = fabric.Orgs{Logger: &logger}
+	for i, entries := range orgEntries {
+		orgLogger := fabric.LabelLogger(&logger, entries["tc_rawapi_orgName"].Value.(string))
+
+		ownLator := false
+		for _, name := range settings.Shared {
+			if i > 0 {
+				_, overridden := further[i-1][name]
+				ownLator = ownLator || overridden
+			}
+		}
+		orgLator := &lator
+		if ownLator {
+			orgLator = &tc.Lator{
+				Bind:  entries["tc_rawapi_lator_bind"].Value.(string),
+				Port:  entries["tc_rawapi_lator_port"].Value.(int),
+				Which: entries["tc_rawapi_lator_which"].Value.(string),
+			}
+			err = orgLator.Init()
+			if err != nil {
+				orgLogger.Out(LOG_EMERG, "error initializing configtxlator instance", err, orgLator)
+				panic(err)
+			}
+			defer orgLator.Close()
+			orgLogger.Out(LOG_DEBUG, "configtxlator instance", orgLator)
+		}
+
+		var wallet *tc.Wallet
+		if path := entries["tc_rawapi_auth_wallet"].Value.(string); len(path) > 0 {
+			wallet = &tc.Wallet{
+				Passphrase: []byte(entries["tc_rawapi_auth_walletPassphrase"].Value.(string)),
+				Path:       path,
+			}
+		}
+
+		var ca *tc.CA
+		if entries["tc_rawapi_ca_renewDays"].Value.(int) > 0 && (len(entries["tc_rawapi_ca_url"].Value.(string)) > 0 || len(entries["tc_rawapi_profile"].Value.(string)) > 0) {
+			ca = &tc.CA{
+				CAName:      entries["tc_rawapi_ca_name"].Value.(string),
+				TLSCertPath: entries["tc_rawapi_ca_tlsCert"].Value.(string),
+				URL:         entries["tc_rawapi_ca_url"].Value.(string),
+			}
+		}
+
+		setup := &fabric.OrgSetup{
+			CA:               ca,
+			Cache:            newCache(orgLogger),
+			CertPath:         entries["tc_rawapi_certPath"].Value.(string),
+			ConsistencyPeers: entries["tc_rawapi_consistency_peers"].Value.(string),
+			GatewayPeer:      entries["tc_rawapi_gatewayPeer"].Value.(string),
+			Identity:         entries["tc_rawapi_identity"].Value.(string),
+			KeyPath:          entries["tc_rawapi_keyPath"].Value.(string),
+			Logger:           orgLogger,
+			Lator:            orgLator,
+			MSPID:            entries["tc_rawapi_MSPID"].Value.(string),
+			OrgName:          entries["tc_rawapi_orgName"].Value.(string),
+			Peer:             entries["tc_rawapi_profile_peer"].Value.(string),
+			PeerEndpoint:     entries["tc_rawapi_peerEndpoint"].Value.(string),
+			Profile:          entries["tc_rawapi_profile"].Value.(string),
+			Reload:           entries["tc_rawapi_reload"].Value.(time.Duration),
+			RenewBefore:      time.Duration(entries["tc_rawapi_ca_renewDays"].Value.(int)) * 24 * time.Hour,
+			RenewCheck:       entries["tc_rawapi_ca_check"].Value.(time.Duration),
+			TLSCertPath:      entries["tc_rawapi_TLSCertPath"].Value.(string),
+			Timeouts:         timeouts,
+			Transactions:     newTransactions(orgLogger),
+			Wallet:           wallet,
+		}
+		if path := entries["tc_rawapi_queue_path"].Value.(string); len(path) > 0 && (i == 0 || path != config.Entries["tc_rawapi_queue_path"].Value.(string)) {
+			setup.Queue = newQueue(orgLogger, path)
+			defer setup.Queue.Close()
+		}
+		if path := entries["tc_rawapi_webhook_path"].Value.(string); len(path) > 0 && (i == 0 || path != config.Entries["tc_rawapi_webhook_path"].Value.(string)) {
+			setup.Webhooks = newWebhooks(orgLogger, path, entries["tc_rawapi_webhook_checkpoints"].Value.(string))
+		}
+		orgLogger.Out(LOG_DEBUG, "OrgSetup", setup)
+
+		_, err = setup.Init()
+		if err != nil {
+			orgLogger.Out(LOG_EMERG, fmt.Sprintf("error initializing setup for %s: %s", setup.OrgName, err))
+			panic(err)
+		}
+		defer setup.Close()
+		orgLogger.Out(LOG_DEBUG, fmt.Sprintf("OrgInstance: %+v\n", setup))
+		orgs.Setups = append(orgs.Setups, setup)
+	}
+	_, err = orgs.Init()
+	if err != nil {
+		logger.Out(LOG_EMERG, "error initializing orgs", err)
+		panic(err)
+	}
+
+	worker, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	for _, setup := range orgs.Setups {
+		go setup.QueueRun(worker)
+		go setup.WebhooksRun(worker)
+	}
 
 	// endregion: fabric gw
 	// region: http routing
 
+	// region: auth
+
+	keys, err := http.LoadKeys(config.Entries["tc_rawapi_keys"].Value.(string))
+	if err != nil {
+		logger.Out(LOG_EMERG, "error loading api keys", err)
+		panic(err)
+	}
+
+	clientCerts, err := http.LoadClientCerts(config.Entries["tc_rawapi_https_clientCerts"].Value.(string))
+	if err != nil {
+		logger.Out(LOG_EMERG, "error loading client certificate subjects", err)
+		panic(err)
+	}
+
+	var jwt *http.JWTSetup
+	if jwks := config.Entries["tc_rawapi_auth_jwt_jwks"].Value.(string); len(jwks) > 0 {
+		jwt = &http.JWTSetup{
+			Audience:         config.Entries["tc_rawapi_auth_jwt_audience"].Value.(string),
+			IdentityClaim:    config.Entries["tc_rawapi_auth_jwt_identityClaim"].Value.(string),
+			Issuer:           config.Entries["tc_rawapi_auth_jwt_issuer"].Value.(string),
+			JWKS:             jwks,
+			Leeway:           config.Entries["tc_rawapi_auth_jwt_leeway"].Value.(time.Duration),
+			Logger:           &logger,
+			OrgsClaim:        config.Entries["tc_rawapi_auth_jwt_orgsClaim"].Value.(string),
+			PermissionsClaim: config.Entries["tc_rawapi_auth_jwt_permissionsClaim"].Value.(string),
+			Refresh:          config.Entries["tc_rawapi_auth_jwt_refresh"].Value.(time.Duration),
+		}
+		_, err = jwt.Init()
+		if err != nil {
+			logger.Out(LOG_EMERG, "error initializing JWT authentication", err)
+			panic(err)
+		}
+		defer jwt.Close()
+	}
+
+	auth := &http.Authenticator{
+		ClientCerts: clientCerts,
+		JWT:         jwt,
+		Key:         config.Entries["tc_rawapi_key"].Value.(string),
+		Keys:        keys,
+		Mode:        config.Entries["tc_rawapi_auth_mode"].Value.(string),
+	}
+
+	// endregion: auth
+	// region: audit
+
+	var auditLog *audit.Log
+	if dir := config.Entries["tc_rawapi_audit_dir"].Value.(string); len(dir) > 0 {
+		auditLog = &audit.Log{
+			Dir:      dir,
+			Logger:   &logger,
+			MaxFiles: config.Entries["tc_rawapi_audit_maxFiles"].Value.(int),
+			MaxSize:  int64(config.Entries["tc_rawapi_audit_maxSize"].Value.(int)),
+		}
+		_, err = auditLog.Init()
+		if err != nil {
+			logger.Out(LOG_EMERG, "error opening audit log", err)
+			panic(err)
+		}
+		defer auditLog.Close()
+	}
+
+	// endregion: audit
 	// region: router
 
 	router = http.RouterSetup{
+		Audit:         auditLog,
+		Auth:          auth,
 		Logger:        &logger,
-		Key:           config.Entries["tc_rawapi_key"].Value.(string),
 		StaticEnabled: config.Entries["tc_rawapi_http_static_enabled"].Value.(bool),
 		StaticRoot:    config.Entries["tc_rawapi_http_static_root"].Value.(string),
 		StaticIndex:   config.Entries["tc_rawapi_http_static_index"].Value.(string),
@@ -197,9 +584,20 @@ func main() {
 
 	Routes := router.Routes
 
-	Routes.POST("/invoke", org.Invoke)
-	Routes.GET("/query", org.Query)
-	Routes.GET("/debug", debugSupersetGET)
+	// every route is served for the org of the request, see fabric.Orgs
+	Routes.POST("/invoke", orgs.Route((*fabric.OrgSetup).Invoke))
+	Routes.POST("/simulate", orgs.Route((*fabric.OrgSetup).Simulate))
+	Routes.GET("/query", orgs.Route((*fabric.OrgSetup).Query))
+	Routes.GET("/channels/:channel/info", orgs.Route((*fabric.OrgSetup).Info))
+	Routes.GET("/channels/:channel/blocks", orgs.Route((*fabric.OrgSetup).Blocks))
+	Routes.GET("/channels/:channel/blocks/:number", orgs.Route((*fabric.OrgSetup).Block))
+	Routes.GET("/channels/:channel/tx/:tx_id", orgs.Route((*fabric.OrgSetup).Transaction))
+	Routes.GET("/channels/:channel/chaincodes", orgs.Route((*fabric.OrgSetup).ChaincodeDefinitions))
+	Routes.GET("/channels/:channel/chaincodes/:name", orgs.Route((*fabric.OrgSetup).ChaincodeDefinition))
+	Routes.GET("/channels/:channel/chaincodes/:name/approved", orgs.Route((*fabric.OrgSetup).ApprovedChaincodeDefinition))
+	Routes.GET("/transactions/:tx_id/status", orgs.Route((*fabric.OrgSetup).TransactionStatus))
+	Routes.POST("/transactions/:tx_id/resubmit", orgs.Route((*fabric.OrgSetup).TransactionResubmit))
+	Routes.GET("/queue/:queue_id", orgs.Route((*fabric.OrgSetup).QueueItem))
 	Routes.GET("/dummy", func(ctx *fasthttp.RequestCtx) {
 		r := &http.Response{
 			CTX:     ctx,
@@ -211,17 +609,120 @@ func main() {
 	})
 
 	// endregion: routes
+	// region: admin routes
+
+	adminRouter := &router
+	adminServer := &http.ServerSetup{}
+	adminPort, adminSocket := config.Entries["tc_rawapi_admin_port"].Value.(int), config.Entries["tc_rawapi_admin_socket"].Value.(string)
+	if adminPort > 0 || len(adminSocket) > 0 {
+		adminRouter = &http.RouterSetup{
+			AdminListener: true,
+			Audit:         router.Audit,
+			Auth:          router.Auth,
+			Logger:        &logger,
+		}
+		_, err = adminRouter.RouterInit()
+		if err != nil {
+			logger.Out(LOG_EMERG, fmt.Sprintf("error in http:RouterInit() of the admin api: %s", err))
+			panic(err)
+		}
+	}
+
+	warnDays, _ := certs.ParseWarnDays(config.Entries["tc_rawapi_certs_warnDays"].Value.(string))
+	monitor := &certs.Monitor{
+		Check:    config.Entries["tc_rawapi_certs_check"].Value.(time.Duration),
+		Logger:   &logger,
+		Sources:  make([]certs.Source, 0, len(orgs.Setups)+1),
+		WarnDays: warnDays,
+	}
+
+	for _, setup := range orgs.Setups {
+		monitor.Sources = append(monitor.Sources, certs.Source{Certificates: setup.Certificates, Org: setup.OrgName})
+	}
+
+	adminSetup := &http.AdminSetup{
+		Config:  &config,
+		Logger:  &logger,
+		Metrics: []func(io.Writer){monitor.Metrics, orgs.Metrics},
+		Ready: map[string]func() (interface{}, bool){
+			"certificates": monitor.Ready,
+			"gateways": func() (interface{}, bool) {
+				states, ready := make(map[string]string, len(orgs.Setups)), true
+				for org, status := range orgs.Status() {
+					states[org] = status.State
+					ready = ready && status.State != "SHUTDOWN" && status.State != "TRANSIENT_FAILURE"
+				}
+				return states, ready
+			},
+		},
+		Severity: &logLevel,
+		Status: map[string]func() interface{}{
+			"certificates": func() interface{} { return monitor.Status() },
+			"gateway":      func() interface{} { return orgs.Default().GatewayStatus() },
+			"lator":        func() interface{} { return lator.Status() },
+			"listeners": func() interface{} {
+				return map[string]interface{}{"admin": adminServer.Listeners(), "grpc": rpc.Address(), "http": server.Listeners()}
+			},
+			"orgs": func() interface{} { return orgs.Status() },
+		},
+	}
+
+	// the health check is served on both listeners, unauthenticated
+	router.Health = adminSetup.Health
+	adminRouter.Health = adminSetup.Health
+
+	Admin := adminRouter.Routes
+
+	Admin.GET("/admin/audit", adminRouter.AdminOnly(adminRouter.AuditSearch))
+	Admin.GET("/admin/queue", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).QueueList)))
+	Admin.POST("/admin/queue/:queue_id/replay", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).QueueReplay)))
+	Admin.DELETE("/admin/queue/:queue_id", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).QueueDrop)))
+	Admin.GET("/admin/webhooks", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).WebhookList)))
+	Admin.POST("/admin/webhooks", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).WebhookAdd)))
+	Admin.GET("/admin/webhooks/:webhook_id", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).WebhookGet)))
+	Admin.DELETE("/admin/webhooks/:webhook_id", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).WebhookRemove)))
+	Admin.GET("/admin/consistency", adminRouter.AdminOnly(orgs.Route((*fabric.OrgSetup).Consistency)))
+	Admin.GET("/admin/config", adminRouter.AdminOnly(adminSetup.AdminConfig))
+	Admin.GET("/admin/loglevel", adminRouter.AdminOnly(adminSetup.AdminLogLevel))
+	Admin.PUT("/admin/loglevel", adminRouter.AdminOnly(adminSetup.AdminLogLevel))
+	Admin.POST("/admin/loglevel", adminRouter.AdminOnly(adminSetup.AdminLogLevel))
+	Admin.GET("/admin/status", adminRouter.AdminOnly(adminSetup.AdminStatus))
+	Admin.GET("/admin/metrics", adminRouter.AdminOnly(adminSetup.AdminMetrics))
+
+	// endregion: admin routes
 
 	// endregion: http routing
 	// region: http and https
 
 	var wg sync.WaitGroup
 
+	var serverTLS *http.TLSSetup
+	if config.Entries["tc_rawapi_https_enabled"].Value.(bool) || (adminRouter != &router && config.Entries["tc_rawapi_admin_tls"].Value.(bool)) {
+		serverTLS = &http.TLSSetup{
+			Cert:         config.Entries["tc_rawapi_https_cert"].Value.(string),
+			CertFile:     config.Entries["tc_rawapi_https_cert_file"].Value.(string),
+			ClientAuth:   config.Entries["tc_rawapi_https_clientAuth"].Value.(string),
+			ClientCAFile: config.Entries["tc_rawapi_https_clientCA"].Value.(string),
+			Key:          config.Entries["tc_rawapi_https_key"].Value.(string),
+			KeyFile:      config.Entries["tc_rawapi_https_key_file"].Value.(string),
+			Logger:       &logger,
+			Reload:       config.Entries["tc_rawapi_https_reload"].Value.(time.Duration),
+		}
+		_, err = serverTLS.Init()
+		if err != nil {
+			logger.Out(LOG_EMERG, "error loading https certificates", err)
+			panic(err)
+		}
+		defer serverTLS.Close()
+	}
+
 	server = http.ServerSetup{
 		HttpEnabled:        config.Entries["tc_rawapi_http_enabled"].Value.(bool),
 		HttpPort:           config.Entries["tc_rawapi_http_port"].Value.(int),
+		HttpSocket:         config.Entries["tc_rawapi_http_socket"].Value.(string),
 		HttpsEnabled:       config.Entries["tc_rawapi_https_enabled"].Value.(bool),
 		HttpsPort:          config.Entries["tc_rawapi_https_port"].Value.(int),
+		HttpsSocket:        config.Entries["tc_rawapi_https_socket"].Value.(string),
 		HttpsCert:          config.Entries["tc_rawapi_https_cert"].Value.(string),
 		HttpsKey:           config.Entries["tc_rawapi_https_key"].Value.(string),
 		LogAllErrors:       config.Entries["tc_rawapi_http_logAllErrors"].Value.(bool),
@@ -230,6 +731,9 @@ func main() {
 		Name:               config.Entries["tc_rawapi_http_name"].Value.(string),
 		NetworkProto:       config.Entries["tc_rawapi_http_networkProto"].Value.(string),
 		Router:             router.Router,
+		SocketMode:         config.Entries["tc_rawapi_http_socketMode"].Value.(string),
+		SocketOwner:        config.Entries["tc_rawapi_http_socketOwner"].Value.(string),
+		TLS:                serverTLS,
 		WaitGroup:          &wg,
 	}
 	logger.Out(LOG_DEBUG, fmt.Sprintf("ServerSetup: %+v\n", server))
@@ -241,32 +745,98 @@ func main() {
 	}
 	logger.Out(LOG_DEBUG, fmt.Sprintf("ServerInstance: %+v\n", server))
 
-	wg.Wait()
+	if adminRouter != &router {
+		adminTLS := config.Entries["tc_rawapi_admin_tls"].Value.(bool)
+		*adminServer = http.ServerSetup{
+			HttpEnabled:        !adminTLS,
+			HttpPort:           adminPort,
+			HttpSocket:         adminSocket,
+			HttpsEnabled:       adminTLS,
+			HttpsPort:          adminPort,
+			HttpsSocket:        adminSocket,
+			HttpsCert:          server.HttpsCert,
+			HttpsKey:           server.HttpsKey,
+			LogAllErrors:       server.LogAllErrors,
+			Logger:             &logger,
+			MaxRequestBodySize: server.MaxRequestBodySize,
+			Name:               server.Name,
+			NetworkProto:       server.NetworkProto,
+			Router:             adminRouter.Router,
+			SocketMode:         server.SocketMode,
+			SocketOwner:        server.SocketOwner,
+			TLS:                serverTLS,
+			WaitGroup:          &wg,
+		}
+		_, err = adminServer.ServerLaunch()
+		if err != nil {
+			logger.Out(LOG_EMERG, fmt.Sprintf("error initializing admin server: %s", err))
+			panic(err)
+		}
+	}
 
 	// endregion: http and https
+	// region: certificates
+
+	if serverTLS != nil {
+		monitor.Sources = append(monitor.Sources, certs.Source{Certificates: serverTLS.Certificates})
+	} else if config.Entries["tc_rawapi_grpc_enabled"].Value.(bool) && config.Entries["tc_rawapi_grpc_tls"].Value.(bool) {
+		grpcCert := []byte(config.Entries["tc_rawapi_https_cert"].Value.(string))
+		monitor.Sources = append(monitor.Sources, certs.Source{Certificates: func() map[string][]byte {
+			return map[string][]byte{"grpc certificate": grpcCert}
+		}})
+	}
+	_, err = monitor.Init()
+	if err != nil {
+		logger.Out(LOG_EMERG, "error initializing certificate monitor", err)
+		panic(err)
+	}
+	defer monitor.Close()
 
-}
+	// endregion: certificates
+	// region: grpc
 
-// region: debug endpoint
-
-func debugSupersetGET(ctx *fasthttp.RequestCtx) {
-	type superset struct {
-		Config *cfg.Config
-		Org    *fabric.OrgSetup
-		Server *http.ServerSetup
-		Router *http.RouterSetup
-	}
-	response := &http.Response{
-		Message: &superset{
-			Config: &config,
-			Org:    &org,
-			Server: &server,
-			Router: &router,
-		},
-		Logger: &logger,
-		CTX:    ctx,
+	rpc = grpc.ServerSetup{
+		Audit:        auditLog,
+		Auth:         auth,
+		Enabled:      config.Entries["tc_rawapi_grpc_enabled"].Value.(bool),
+		Logger:       &logger,
+		NetworkProto: config.Entries["tc_rawapi_grpc_networkProto"].Value.(string),
+		Port:         config.Entries["tc_rawapi_grpc_port"].Value.(int),
+		Service:      orgs.Service(),
+		Socket:       config.Entries["tc_rawapi_grpc_socket"].Value.(string),
+		SocketMode:   config.Entries["tc_rawapi_http_socketMode"].Value.(string),
+		SocketOwner:  config.Entries["tc_rawapi_http_socketOwner"].Value.(string),
+		TLSCert:      config.Entries["tc_rawapi_https_cert"].Value.(string),
+		TLSEnabled:   config.Entries["tc_rawapi_grpc_tls"].Value.(bool),
+		TLSKey:       config.Entries["tc_rawapi_https_key"].Value.(string),
+		WaitGroup:    &wg,
 	}
-	response.SendJSON(nil)
-}
+	if serverTLS != nil {
+		rpc.TLSConfig = serverTLS.Config()
+	}
+	_, err = rpc.ServerLaunch()
+	if err != nil {
+		logger.Out(LOG_EMERG, fmt.Sprintf("error initializing grpc server: %s", err))
+		panic(err)
+	}
+	defer rpc.Stop()
+
+	// endregion: grpc
+	// region: shutdown
+
+	// the servers return once they are shut down, which removes their unix domain sockets too
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-interruptCh
+		logger.Out(LOG_NOTICE, "shutting down on", sig)
+		server.Shutdown()
+		adminServer.Shutdown()
+		rpc.Stop()
+	}()
 
-// endregion: debug endpoint
+	// endregion: shutdown
+
+	wg.Wait()
+
+}
@@ -0,0 +1,297 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: trustchain.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	TrustChainService_Invoke_FullMethodName          = "/trustchain.rawapi.v1.TrustChainService/Invoke"
+	TrustChainService_SubmitAsync_FullMethodName     = "/trustchain.rawapi.v1.TrustChainService/SubmitAsync"
+	TrustChainService_Query_FullMethodName           = "/trustchain.rawapi.v1.TrustChainService/Query"
+	TrustChainService_CommitStatus_FullMethodName    = "/trustchain.rawapi.v1.TrustChainService/CommitStatus"
+	TrustChainService_ChaincodeEvents_FullMethodName = "/trustchain.rawapi.v1.TrustChainService/ChaincodeEvents"
+)
+
+// TrustChainServiceClient is the client API for TrustChainService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TrustChainServiceClient interface {
+	// Invoke endorses and submits a transaction, then waits until it is committed.
+	Invoke(ctx context.Context, in *TransactionRequest, opts ...grpc.CallOption) (*TransactionResponse, error)
+	// SubmitAsync endorses and submits a transaction without waiting for the commit,
+	// use CommitStatus to learn the outcome.
+	SubmitAsync(ctx context.Context, in *TransactionRequest, opts ...grpc.CallOption) (*TransactionResponse, error)
+	// Query evaluates a transaction on the gateway peer.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	// CommitStatus waits for and reports the validation result of a transaction.
+	CommitStatus(ctx context.Context, in *CommitStatusRequest, opts ...grpc.CallOption) (*CommitStatusResponse, error)
+	// ChaincodeEvents streams the events emitted by a chaincode until the client cancels.
+	ChaincodeEvents(ctx context.Context, in *ChaincodeEventsRequest, opts ...grpc.CallOption) (TrustChainService_ChaincodeEventsClient, error)
+}
+
+type trustChainServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrustChainServiceClient(cc grpc.ClientConnInterface) TrustChainServiceClient {
+	return &trustChainServiceClient{cc}
+}
+
+func (c *trustChainServiceClient) Invoke(ctx context.Context, in *TransactionRequest, opts ...grpc.CallOption) (*TransactionResponse, error) {
+	out := new(TransactionResponse)
+	err := c.cc.Invoke(ctx, TrustChainService_Invoke_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trustChainServiceClient) SubmitAsync(ctx context.Context, in *TransactionRequest, opts ...grpc.CallOption) (*TransactionResponse, error) {
+	out := new(TransactionResponse)
+	err := c.cc.Invoke(ctx, TrustChainService_SubmitAsync_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trustChainServiceClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	out := new(QueryResponse)
+	err := c.cc.Invoke(ctx, TrustChainService_Query_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trustChainServiceClient) CommitStatus(ctx context.Context, in *CommitStatusRequest, opts ...grpc.CallOption) (*CommitStatusResponse, error) {
+	out := new(CommitStatusResponse)
+	err := c.cc.Invoke(ctx, TrustChainService_CommitStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trustChainServiceClient) ChaincodeEvents(ctx context.Context, in *ChaincodeEventsRequest, opts ...grpc.CallOption) (TrustChainService_ChaincodeEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TrustChainService_ServiceDesc.Streams[0], TrustChainService_ChaincodeEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trustChainServiceChaincodeEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TrustChainService_ChaincodeEventsClient interface {
+	Recv() (*ChaincodeEvent, error)
+	grpc.ClientStream
+}
+
+type trustChainServiceChaincodeEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *trustChainServiceChaincodeEventsClient) Recv() (*ChaincodeEvent, error) {
+	m := new(ChaincodeEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TrustChainServiceServer is the server API for TrustChainService service.
+// All implementations must embed UnimplementedTrustChainServiceServer
+// for forward compatibility
+type TrustChainServiceServer interface {
+	// Invoke endorses and submits a transaction, then waits until it is committed.
+	Invoke(context.Context, *TransactionRequest) (*TransactionResponse, error)
+	// SubmitAsync endorses and submits a transaction without waiting for the commit,
+	// use CommitStatus to learn the outcome.
+	SubmitAsync(context.Context, *TransactionRequest) (*TransactionResponse, error)
+	// Query evaluates a transaction on the gateway peer.
+	Query(context.Context, *QueryRequest) (*QueryResponse, error)
+	// CommitStatus waits for and reports the validation result of a transaction.
+	CommitStatus(context.Context, *CommitStatusRequest) (*CommitStatusResponse, error)
+	// ChaincodeEvents streams the events emitted by a chaincode until the client cancels.
+	ChaincodeEvents(*ChaincodeEventsRequest, TrustChainService_ChaincodeEventsServer) error
+	mustEmbedUnimplementedTrustChainServiceServer()
+}
+
+// UnimplementedTrustChainServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedTrustChainServiceServer struct {
+}
+
+func (UnimplementedTrustChainServiceServer) Invoke(context.Context, *TransactionRequest) (*TransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Invoke not implemented")
+}
+func (UnimplementedTrustChainServiceServer) SubmitAsync(context.Context, *TransactionRequest) (*TransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitAsync not implemented")
+}
+func (UnimplementedTrustChainServiceServer) Query(context.Context, *QueryRequest) (*QueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedTrustChainServiceServer) CommitStatus(context.Context, *CommitStatusRequest) (*CommitStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommitStatus not implemented")
+}
+func (UnimplementedTrustChainServiceServer) ChaincodeEvents(*ChaincodeEventsRequest, TrustChainService_ChaincodeEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ChaincodeEvents not implemented")
+}
+func (UnimplementedTrustChainServiceServer) mustEmbedUnimplementedTrustChainServiceServer() {}
+
+// UnsafeTrustChainServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrustChainServiceServer will
+// result in compilation errors.
+type UnsafeTrustChainServiceServer interface {
+	mustEmbedUnimplementedTrustChainServiceServer()
+}
+
+func RegisterTrustChainServiceServer(s grpc.ServiceRegistrar, srv TrustChainServiceServer) {
+	s.RegisterService(&TrustChainService_ServiceDesc, srv)
+}
+
+func _TrustChainService_Invoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrustChainServiceServer).Invoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrustChainService_Invoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrustChainServiceServer).Invoke(ctx, req.(*TransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrustChainService_SubmitAsync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrustChainServiceServer).SubmitAsync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrustChainService_SubmitAsync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrustChainServiceServer).SubmitAsync(ctx, req.(*TransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrustChainService_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrustChainServiceServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrustChainService_Query_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrustChainServiceServer).Query(ctx, req.(*QueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrustChainService_CommitStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrustChainServiceServer).CommitStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrustChainService_CommitStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrustChainServiceServer).CommitStatus(ctx, req.(*CommitStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrustChainService_ChaincodeEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChaincodeEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrustChainServiceServer).ChaincodeEvents(m, &trustChainServiceChaincodeEventsServer{stream})
+}
+
+type TrustChainService_ChaincodeEventsServer interface {
+	Send(*ChaincodeEvent) error
+	grpc.ServerStream
+}
+
+type trustChainServiceChaincodeEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *trustChainServiceChaincodeEventsServer) Send(m *ChaincodeEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// TrustChainService_ServiceDesc is the grpc.ServiceDesc for TrustChainService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TrustChainService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "trustchain.rawapi.v1.TrustChainService",
+	HandlerType: (*TrustChainServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Invoke",
+			Handler:    _TrustChainService_Invoke_Handler,
+		},
+		{
+			MethodName: "SubmitAsync",
+			Handler:    _TrustChainService_SubmitAsync_Handler,
+		},
+		{
+			MethodName: "Query",
+			Handler:    _TrustChainService_Query_Handler,
+		},
+		{
+			MethodName: "CommitStatus",
+			Handler:    _TrustChainService_CommitStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ChaincodeEvents",
+			Handler:       _TrustChainService_ChaincodeEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "trustchain.proto",
+}
@@ -0,0 +1,482 @@
+// Package queue is a durable store-and-forward queue of chaincode invocations, kept in a bbolt
+// file and worked off in order by a single background worker.
+package queue
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/SandorMiskey/TrustChain/rawapi/retry"
+	bolt "go.etcd.io/bbolt"
+)
+
+// region: types
+
+// Queue persists the items and retries them with exponential backoff, from Backoff up to
+// BackoffMax, until they are done or MaxAttempts is reached, when they become dead letters.
+// Committed items are removed Retention after their commit, 0 keeps them forever, dead letters
+// are kept until they are replayed or deleted.
+type Queue struct {
+	Backoff     time.Duration `json:"Backoff"`
+	BackoffMax  time.Duration `json:"BackoffMax"`
+	Logger      *log.Logger   `json:"-"`
+	MaxAttempts int           `json:"MaxAttempts"`
+	Path        string        `json:"Path"`
+	Poll        time.Duration `json:"Poll"`
+	Retention   time.Duration `json:"Retention"`
+
+	db     *bolt.DB      `json:"-"`
+	notify chan struct{} `json:"-"`
+}
+
+type Item struct {
+	Args        []string        `json:"args"`
+	Attempts    int             `json:"attempts"`
+	BlockNumber uint64          `json:"block_number,omitempty"`
+	Caller      string          `json:"caller"`
+	Chaincode   string          `json:"chaincode"`
+	Channel     string          `json:"channel"`
+	Created     time.Time       `json:"created"`
+	Error       string          `json:"error,omitempty"`
+	Function    string          `json:"function"`
+	ID          string          `json:"queue_id"`
+	Identity    string          `json:"identity,omitempty"`
+	Next        time.Time       `json:"next_attempt,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	State       string          `json:"state"`
+	Transaction []byte          `json:"transaction,omitempty"`
+	Txid        string          `json:"tx_id,omitempty"`
+	Updated     time.Time       `json:"updated"`
+	Validation  string          `json:"validation,omitempty"`
+}
+
+// Processor submits the item and waits for its commit, it records the signed transaction, its tx
+// id and the state of the item as it goes, and calls checkpoint to persist them before anything
+// irreversible, so that a restarted worker can submit the very same transaction again instead of
+// a new one. A nil error means the item is done, errors are retried unless wrapped by Permanent.
+type Processor func(ctx context.Context, item *Item, checkpoint func() error) error
+
+const (
+	StateQueued     = "queued"
+	StateSubmitting = "submitting"
+	StateSubmitted  = "submitted"
+	StateCommitted  = "committed"
+	StateDead       = "dead"
+
+	indexStamp = 8
+)
+
+var (
+	ErrNotFound = errors.New("no such queue item")
+
+	// the items by id, and indexes of them by the time of their next attempt while they are
+	// pending and by the time of their commit once committed, the keys of the indexes are the
+	// big endian unix nanoseconds followed by the id
+	bucket    = []byte("items")
+	dueIndex  = []byte("due")
+	doneIndex = []byte("done")
+)
+
+type permanent struct {
+	err error
+}
+
+func (p *permanent) Error() string { return p.err.Error() }
+func (p *permanent) Unwrap() error { return p.err }
+
+// Permanent marks err as not worth retrying, the item is dead-lettered right away.
+func Permanent(err error) error {
+	return &permanent{err: err}
+}
+
+// endregion: types
+// region: init, close
+
+func (q *Queue) Init() (*Queue, error) {
+	if q.Logger == nil {
+		return q, errors.New("queue.Queue.Init() needs a logger")
+	}
+	if len(q.Path) == 0 {
+		return q, errors.New("queue.Queue.Init() needs a path")
+	}
+	if q.Backoff <= 0 {
+		q.Backoff = time.Second
+	}
+	if q.BackoffMax < q.Backoff {
+		q.BackoffMax = q.Backoff
+	}
+	if q.Poll <= 0 {
+		q.Poll = time.Second
+	}
+
+	db, err := bolt.Open(q.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return q, fmt.Errorf("failed to open queue %s: %w", q.Path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		items, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		if tx.Bucket(dueIndex) != nil {
+			return nil
+		}
+		// queues of earlier versions have no indexes yet
+		for _, name := range [][]byte{dueIndex, doneIndex} {
+			if _, err = tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return items.ForEach(func(k, v []byte) error {
+			item := &Item{}
+			if err := json.Unmarshal(v, item); err != nil {
+				return fmt.Errorf("corrupt queue item %s: %w", k, err)
+			}
+			return index(tx, item, true)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return q, fmt.Errorf("failed to initialize queue %s: %w", q.Path, err)
+	}
+
+	q.db = db
+	q.notify = make(chan struct{}, 1)
+	return q, nil
+}
+
+func (q *Queue) Close() error {
+	if q == nil || q.db == nil {
+		return nil
+	}
+	return q.db.Close()
+}
+
+// endregion: init, close
+// region: items
+
+// Enqueue stores a new item, it is picked up by the worker right away.
+func (q *Queue) Enqueue(item *Item) (*Item, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	item.Attempts = 0
+	item.Created, item.Updated, item.Next = now, now, now
+	item.ID = id
+	item.State = StateQueued
+
+	if err = q.Put(item); err != nil {
+		return nil, err
+	}
+	q.wake()
+	return item, nil
+}
+
+func (q *Queue) Put(item *Item) error {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return store(tx, item, raw)
+	})
+}
+
+func (q *Queue) Get(id string) (*Item, error) {
+	item := &Item{}
+	err := q.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucket).Get([]byte(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (q *Queue) Delete(id string) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, id)
+	})
+}
+
+// List returns the items in state, or all of them if state is empty, oldest first, at most
+// limit of them if limit is positive. It reads the whole queue, the worker uses the indexes.
+func (q *Queue) List(state string, limit int) ([]*Item, error) {
+	items := make([]*Item, 0)
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			if limit > 0 && len(items) >= limit {
+				return nil
+			}
+			item := &Item{}
+			if err := json.Unmarshal(v, item); err != nil {
+				return fmt.Errorf("corrupt queue item %s: %w", k, err)
+			}
+			if len(state) == 0 || item.State == state {
+				items = append(items, item)
+			}
+			return nil
+		})
+	})
+	return items, err
+}
+
+// Replay puts a dead item back to the queue with its attempts reset. The signed transaction of
+// one with unknown fate is kept, so that it is submitted again as is rather than endorsed anew,
+// invalidated transactions start over.
+func (q *Queue) Replay(id string) (*Item, error) {
+	item, err := q.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.State != StateDead {
+		return nil, fmt.Errorf("queue item %s is %s, only %s items can be replayed", id, item.State, StateDead)
+	}
+
+	item.Attempts = 0
+	item.Error = ""
+	item.Next = time.Now().UTC()
+	item.State = StateQueued
+	if len(item.Txid) > 0 && len(item.Validation) == 0 {
+		item.State = StateSubmitting
+	} else {
+		item.BlockNumber, item.Result, item.Transaction, item.Txid, item.Validation = 0, nil, nil, "", ""
+	}
+	item.Updated = item.Next
+	if err = q.Put(item); err != nil {
+		return nil, err
+	}
+	q.wake()
+	return item, nil
+}
+
+// endregion: items
+// region: worker
+
+// Run works off the due items in order until ctx is done.
+func (q *Queue) Run(ctx context.Context, process Processor) {
+	ticker := time.NewTicker(q.Poll)
+	defer ticker.Stop()
+
+	for {
+		if err := q.purge(time.Now()); err != nil {
+			q.Logger.Out(log.LOG_ERR, "error removing committed queue items", err)
+		}
+		due, err := q.due(time.Now())
+		if err != nil {
+			q.Logger.Out(log.LOG_ERR, "error reading queue", err)
+		}
+		for _, item := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			q.process(ctx, item, process)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.notify:
+		}
+	}
+}
+
+func (q *Queue) process(ctx context.Context, item *Item, process Processor) {
+	logger := q.Logger.Out
+	item.Attempts++
+	checkpoint := func() error {
+		item.Updated = time.Now().UTC()
+		return q.update(item)
+	}
+
+	err := process(ctx, item, checkpoint)
+	item.Updated = time.Now().UTC()
+	switch {
+	case err == nil:
+		item.Error = ""
+		logger(log.LOG_INFO, fmt.Sprintf("queue item %s done after %d attempts: %s %s", item.ID, item.Attempts, item.Txid, item.State))
+	case ctx.Err() != nil:
+		item.Attempts--
+		item.Error = err.Error()
+		logger(log.LOG_NOTICE, fmt.Sprintf("queue item %s interrupted: %s", item.ID, err))
+	default:
+		item.Error = err.Error()
+		var p *permanent
+		if errors.As(err, &p) || (q.MaxAttempts > 0 && item.Attempts >= q.MaxAttempts) {
+			item.State = StateDead
+			logger(log.LOG_ERR, fmt.Sprintf("queue item %s is dead after %d attempts: %s", item.ID, item.Attempts, err))
+		} else {
+			item.Next = item.Updated.Add(retry.Backoff(q.Backoff, q.BackoffMax, item.Attempts))
+			logger(log.LOG_WARNING, fmt.Sprintf("queue item %s failed attempt %d, retrying at %s: %s", item.ID, item.Attempts, item.Next.Format(time.RFC3339), err))
+		}
+	}
+
+	if err := q.update(item); err != nil {
+		logger(log.LOG_ERR, fmt.Sprintf("error saving queue item %s", item.ID), err)
+	}
+}
+
+// update saves an item the worker holds, unless it has been dropped in the meantime.
+func (q *Queue) update(item *Item) error {
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucket).Get([]byte(item.ID)) == nil {
+			return ErrNotFound
+		}
+		return store(tx, item, raw)
+	})
+}
+
+// due returns the items waiting to be worked on whose next attempt is not after now, in order.
+func (q *Queue) due(now time.Time) ([]*Item, error) {
+	due := make([]*Item, 0)
+	err := q.db.View(func(tx *bolt.Tx) error {
+		items := tx.Bucket(bucket)
+		until := stamp(now)
+		c := tx.Bucket(dueIndex).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:indexStamp], until) <= 0; k, _ = c.Next() {
+			item := &Item{}
+			if err := json.Unmarshal(items.Get(k[indexStamp:]), item); err != nil {
+				return fmt.Errorf("corrupt queue item %s: %w", k[indexStamp:], err)
+			}
+			due = append(due, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	return due, nil
+}
+
+// purge removes the items committed Retention before now.
+func (q *Queue) purge(now time.Time) error {
+	if q.Retention <= 0 {
+		return nil
+	}
+	purged := 0
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		until := stamp(now.Add(-q.Retention))
+		ids := make([]string, 0)
+		c := tx.Bucket(doneIndex).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:indexStamp], until) <= 0; k, _ = c.Next() {
+			ids = append(ids, string(k[indexStamp:]))
+		}
+		for _, id := range ids {
+			if err := remove(tx, id); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	if err == nil && purged > 0 {
+		q.Logger.Out(log.LOG_DEBUG, fmt.Sprintf("%d committed queue items removed", purged))
+	}
+	return err
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// endregion: worker
+// region: helpers
+
+// store saves the item and moves it in the indexes.
+func store(tx *bolt.Tx, item *Item, raw []byte) error {
+	b := tx.Bucket(bucket)
+	if stored := b.Get([]byte(item.ID)); stored != nil {
+		previous := &Item{}
+		if err := json.Unmarshal(stored, previous); err != nil {
+			return fmt.Errorf("corrupt queue item %s: %w", item.ID, err)
+		}
+		if err := index(tx, previous, false); err != nil {
+			return err
+		}
+	}
+	if err := b.Put([]byte(item.ID), raw); err != nil {
+		return err
+	}
+	return index(tx, item, true)
+}
+
+// remove deletes the item along with its index entry.
+func remove(tx *bolt.Tx, id string) error {
+	b := tx.Bucket(bucket)
+	stored := b.Get([]byte(id))
+	if stored == nil {
+		return ErrNotFound
+	}
+	item := &Item{}
+	if err := json.Unmarshal(stored, item); err == nil {
+		if err = index(tx, item, false); err != nil {
+			return err
+		}
+	}
+	return b.Delete([]byte(id))
+}
+
+// index adds the item to, or removes it from, the index its state belongs to, dead items are in
+// neither.
+func index(tx *bolt.Tx, item *Item, add bool) error {
+	var b *bolt.Bucket
+	var at time.Time
+	switch item.State {
+	case StateQueued, StateSubmitting, StateSubmitted:
+		b, at = tx.Bucket(dueIndex), item.Next
+	case StateCommitted:
+		b, at = tx.Bucket(doneIndex), item.Updated
+	default:
+		return nil
+	}
+	key := append(stamp(at), item.ID...)
+	if add {
+		return b.Put(key, []byte{})
+	}
+	return b.Delete(key)
+}
+
+// stamp returns t as the sortable prefix of the index keys.
+func stamp(t time.Time) []byte {
+	key := make([]byte, indexStamp)
+	if nano := t.UnixNano(); nano > 0 {
+		binary.BigEndian.PutUint64(key, uint64(nano))
+	}
+	return key
+}
+
+// newID returns a unique id that sorts in creation order, which is also the order bbolt
+// iterates the items in.
+func newID() (string, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016x%s", time.Now().UnixNano(), hex.EncodeToString(random)), nil
+}
+
+// endregion: helpers
@@ -0,0 +1,273 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newQueue(t *testing.T, path string) *Queue {
+	t.Helper()
+	logger := log.NewLogger()
+	t.Cleanup(func() { logger.Close() })
+
+	q := &Queue{Backoff: time.Millisecond, BackoffMax: 4 * time.Millisecond, Logger: logger, MaxAttempts: 3, Path: path, Poll: 5 * time.Millisecond}
+	if _, err := q.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// run works off q with process in the background, the returned function stops the worker and
+// waits for it.
+func run(q *Queue, process Processor) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx, process)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, q *Queue, id, state string) *Item {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		item, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.State == state {
+			return item
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queue item %s is %s, want %s: %+v", id, item.State, state, item)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStateTransitions(t *testing.T) {
+	q := newQueue(t, filepath.Join(t.TempDir(), "queue.db"))
+
+	checkpointed := make(map[string][]string)
+	stop := run(q, func(ctx context.Context, item *Item, checkpoint func() error) error {
+		record := func(state string) error {
+			item.State = state
+			if err := checkpoint(); err != nil {
+				return err
+			}
+			stored, err := q.Get(item.ID)
+			if err != nil {
+				return err
+			}
+			checkpointed[item.Args[0]] = append(checkpointed[item.Args[0]], stored.State)
+			return nil
+		}
+
+		switch item.Args[0] {
+		case "retry":
+			if item.Attempts < 2 {
+				return errors.New("orderer is down")
+			}
+		case "permanent":
+			item.Transaction, item.Txid = []byte("signed"), "tx-permanent"
+			if err := record(StateSubmitting); err != nil {
+				return err
+			}
+			return Permanent(errors.New("chaincode error"))
+		case "exhausted":
+			return errors.New("no peers available")
+		}
+		item.Transaction, item.Txid = []byte("signed"), "tx-"+item.Args[0]
+		if err := record(StateSubmitting); err != nil {
+			return err
+		}
+		if err := record(StateSubmitted); err != nil {
+			return err
+		}
+		item.State = StateCommitted
+		return nil
+	})
+
+	ids := make(map[string]string)
+	for _, name := range []string{"ok", "retry", "permanent", "exhausted"} {
+		item, err := q.Enqueue(&Item{Args: []string{name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = item.ID
+	}
+
+	for _, tc := range []struct {
+		name     string
+		state    string
+		attempts int
+	}{
+		{"ok", StateCommitted, 1},
+		{"retry", StateCommitted, 2},
+		{"permanent", StateDead, 1},
+		{"exhausted", StateDead, 3},
+	} {
+		item := waitFor(t, q, ids[tc.name], tc.state)
+		if item.Attempts != tc.attempts {
+			t.Errorf("%s: %d attempts, want %d", tc.name, item.Attempts, tc.attempts)
+		}
+		if tc.state == StateDead && len(item.Error) == 0 {
+			t.Errorf("%s: dead letter without error", tc.name)
+		}
+	}
+	stop()
+
+	if got := checkpointed["ok"]; len(got) != 2 || got[0] != StateSubmitting || got[1] != StateSubmitted {
+		t.Errorf("checkpoints of ok: %v", got)
+	}
+
+	item, err := q.Replay(ids["permanent"])
+	if err != nil || item.State != StateSubmitting || item.Txid != "tx-permanent" || string(item.Transaction) != "signed" || item.Attempts != 0 {
+		t.Errorf("replay of a transaction with unknown fate: %+v, %v", item, err)
+	}
+	item, err = q.Replay(ids["exhausted"])
+	if err != nil || item.State != StateQueued || len(item.Txid) > 0 {
+		t.Errorf("replay of an unsubmitted item: %+v, %v", item, err)
+	}
+	if _, err = q.Replay(ids["ok"]); err == nil {
+		t.Error("committed item was replayed")
+	}
+	if _, err = q.Replay("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("replay of a missing item: %v", err)
+	}
+}
+
+func TestCrashResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	q := newQueue(t, path)
+	item, err := q.Enqueue(&Item{Args: []string{"k1", "v1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the worker is stopped right after the signed transaction has been checkpointed
+	ctx, crash := context.WithCancel(context.Background())
+	q.Run(ctx, func(ctx context.Context, item *Item, checkpoint func() error) error {
+		item.State, item.Transaction, item.Txid = StateSubmitting, []byte("signed"), "tx1"
+		if err := checkpoint(); err != nil {
+			return err
+		}
+		crash()
+		return ctx.Err()
+	})
+	if err = q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q = newQueue(t, path)
+	var resumed Item
+	stop := run(q, func(ctx context.Context, item *Item, checkpoint func() error) error {
+		resumed = *item
+		item.State = StateCommitted
+		return nil
+	})
+	defer stop()
+
+	waitFor(t, q, item.ID, StateCommitted)
+	if resumed.State != StateSubmitting || resumed.Txid != "tx1" || string(resumed.Transaction) != "signed" || resumed.Attempts != 1 {
+		t.Errorf("resumed item %+v", resumed)
+	}
+}
+
+func TestIndexesAndRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	q := newQueue(t, path)
+	q.Retention = time.Hour
+
+	items := make(map[string]*Item)
+	for _, name := range []string{"due", "later", "committed", "recent", "dead"} {
+		item, err := q.Enqueue(&Item{Args: []string{name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		items[name] = item
+	}
+	now := time.Now().UTC()
+	for name, change := range map[string]func(*Item){
+		"later":     func(item *Item) { item.Next = now.Add(time.Minute) },
+		"committed": func(item *Item) { item.State, item.Updated = StateCommitted, now.Add(-2*time.Hour) },
+		"recent":    func(item *Item) { item.State, item.Updated = StateCommitted, now.Add(-time.Minute) },
+		"dead":      func(item *Item) { item.State, item.Updated = StateDead, now.Add(-2*time.Hour) },
+	} {
+		change(items[name])
+		if err := q.Put(items[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dueAt := func(at time.Time) []string {
+		t.Helper()
+		due, err := q.due(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(due))
+		for _, item := range due {
+			names = append(names, item.Args[0])
+		}
+		return names
+	}
+	if got := dueAt(now); len(got) != 1 || got[0] != "due" {
+		t.Errorf("due now: %v", got)
+	}
+	if got := dueAt(now.Add(time.Hour)); len(got) != 2 || got[0] != "due" || got[1] != "later" {
+		t.Errorf("due in an hour: %v", got)
+	}
+
+	if err := q.purge(now); err != nil {
+		t.Fatal(err)
+	}
+	for name, kept := range map[string]bool{"due": true, "later": true, "committed": false, "recent": true, "dead": true} {
+		if _, err := q.Get(items[name].ID); (err == nil) != kept {
+			t.Errorf("%s: kept %t after purge, want %t", name, err == nil, kept)
+		}
+	}
+	if err := q.Delete(items["due"].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := dueAt(now); len(got) != 0 {
+		t.Errorf("deleted item is still due: %v", got)
+	}
+
+	// the indexes of a queue without them are built when it is opened
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(dueIndex); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(doneIndex)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	q = newQueue(t, path)
+	q.Retention = time.Minute
+	if got := dueAt(now.Add(time.Hour)); len(got) != 1 || got[0] != "later" {
+		t.Errorf("due after reindexing: %v", got)
+	}
+	if err = q.purge(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Get(items["recent"].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("committed item kept after reindexing: %v", err)
+	}
+}
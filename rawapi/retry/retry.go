@@ -0,0 +1,32 @@
+// Package retry holds the backoff the queue and the webhooks retry with.
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+// Backoff returns the delay before the next of attempt attempts, base doubled on every attempt
+// after the first, up to max.
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Sleep waits for d, it returns false if ctx is done first.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
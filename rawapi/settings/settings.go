@@ -0,0 +1,399 @@
+// Package settings reads the YAML or JSON config file of rawapi, whose structured sections are
+// mapped to the tc_rawapi_* entries of the cfg flag set. Values of the file become the defaults
+// of the entries, so that environment variables and cli flags still override them.
+package settings
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/cfg"
+	"gopkg.in/yaml.v3"
+)
+
+// region: paths
+
+// Paths maps the dotted path of a setting in the config file to its entry, settings of orgs are
+// relative to the items of the orgs list.
+var Paths = map[string]string{
+	"server.name":               "tc_rawapi_http_name",
+	"server.logAllErrors":       "tc_rawapi_http_logAllErrors",
+	"server.maxRequestBodySize": "tc_rawapi_http_maxRequestBodySize",
+	"server.networkProto":       "tc_rawapi_http_networkProto",
+	"server.socketMode":         "tc_rawapi_http_socketMode",
+	"server.socketOwner":        "tc_rawapi_http_socketOwner",
+	"server.http.enabled":       "tc_rawapi_http_enabled",
+	"server.http.port":          "tc_rawapi_http_port",
+	"server.http.socket":        "tc_rawapi_http_socket",
+	"server.https.enabled":      "tc_rawapi_https_enabled",
+	"server.https.port":         "tc_rawapi_https_port",
+	"server.https.socket":       "tc_rawapi_https_socket",
+	"server.grpc.enabled":       "tc_rawapi_grpc_enabled",
+	"server.grpc.networkProto":  "tc_rawapi_grpc_networkProto",
+	"server.grpc.port":          "tc_rawapi_grpc_port",
+	"server.grpc.socket":        "tc_rawapi_grpc_socket",
+	"server.grpc.tls":           "tc_rawapi_grpc_tls",
+	"server.admin.port":         "tc_rawapi_admin_port",
+	"server.admin.socket":       "tc_rawapi_admin_socket",
+	"server.admin.tls":          "tc_rawapi_admin_tls",
+
+	"tls.cert":        "tc_rawapi_https_cert",
+	"tls.certFile":    "tc_rawapi_https_cert_file",
+	"tls.key":         "tc_rawapi_https_key",
+	"tls.keyFile":     "tc_rawapi_https_key_file",
+	"tls.clientAuth":  "tc_rawapi_https_clientAuth",
+	"tls.clientCA":    "tc_rawapi_https_clientCA",
+	"tls.clientCerts": "tc_rawapi_https_clientCerts",
+	"tls.reload":      "tc_rawapi_https_reload",
+
+	"keys.mode":                 "tc_rawapi_auth_mode",
+	"keys.key":                  "tc_rawapi_key",
+	"keys.keyFile":              "tc_rawapi_key_file",
+	"keys.file":                 "tc_rawapi_keys",
+	"keys.jwt.audience":         "tc_rawapi_auth_jwt_audience",
+	"keys.jwt.identityClaim":    "tc_rawapi_auth_jwt_identityClaim",
+	"keys.jwt.issuer":           "tc_rawapi_auth_jwt_issuer",
+	"keys.jwt.jwks":             "tc_rawapi_auth_jwt_jwks",
+	"keys.jwt.leeway":           "tc_rawapi_auth_jwt_leeway",
+	"keys.jwt.orgsClaim":        "tc_rawapi_auth_jwt_orgsClaim",
+	"keys.jwt.permissionsClaim": "tc_rawapi_auth_jwt_permissionsClaim",
+	"keys.jwt.refresh":          "tc_rawapi_auth_jwt_refresh",
+
+	"orgs.name":                 "tc_rawapi_orgName",
+	"orgs.mspId":                "tc_rawapi_MSPID",
+	"orgs.certPath":             "tc_rawapi_certPath",
+	"orgs.keyPath":              "tc_rawapi_keyPath",
+	"orgs.tlsCertPath":          "tc_rawapi_TLSCertPath",
+	"orgs.peerEndpoint":         "tc_rawapi_peerEndpoint",
+	"orgs.gatewayPeer":          "tc_rawapi_gatewayPeer",
+	"orgs.profile":              "tc_rawapi_profile",
+	"orgs.peer":                 "tc_rawapi_profile_peer",
+	"orgs.consistencyPeers":     "tc_rawapi_consistency_peers",
+	"orgs.reload":               "tc_rawapi_reload",
+	"orgs.identity":             "tc_rawapi_identity",
+	"orgs.wallet":               "tc_rawapi_auth_wallet",
+	"orgs.walletPassphrase":     "tc_rawapi_auth_walletPassphrase",
+	"orgs.walletPassphraseFile": "tc_rawapi_auth_walletPassphrase_file",
+	"orgs.ca.url":               "tc_rawapi_ca_url",
+	"orgs.ca.name":              "tc_rawapi_ca_name",
+	"orgs.ca.tlsCert":           "tc_rawapi_ca_tlsCert",
+	"orgs.ca.renewDays":         "tc_rawapi_ca_renewDays",
+	"orgs.ca.check":             "tc_rawapi_ca_check",
+
+	"lator.which": "tc_rawapi_lator_which",
+	"lator.bind":  "tc_rawapi_lator_bind",
+	"lator.port":  "tc_rawapi_lator_port",
+
+	"routes.static.enabled":        "tc_rawapi_http_static_enabled",
+	"routes.static.root":           "tc_rawapi_http_static_root",
+	"routes.static.index":          "tc_rawapi_http_static_index",
+	"routes.static.error":          "tc_rawapi_http_static_error",
+	"routes.cache.enabled":         "tc_rawapi_cache_enabled",
+	"routes.cache.functions":       "tc_rawapi_cache_functions",
+	"routes.cache.invalidate":      "tc_rawapi_cache_invalidate",
+	"routes.cache.size":            "tc_rawapi_cache_size",
+	"routes.cache.ttl":             "tc_rawapi_cache_ttl",
+	"routes.timeouts.commitStatus": "tc_rawapi_timeout_commitStatus",
+	"routes.timeouts.endorse":      "tc_rawapi_timeout_endorse",
+	"routes.timeouts.evaluate":     "tc_rawapi_timeout_evaluate",
+	"routes.timeouts.submit":       "tc_rawapi_timeout_submit",
+	"routes.timeouts.overrides":    "tc_rawapi_timeout_overrides",
+	"routes.transactions.size":     "tc_rawapi_transactions_size",
+	"routes.transactions.ttl":      "tc_rawapi_transactions_ttl",
+	"routes.queue.path":            "tc_rawapi_queue_path",
+	"routes.queue.backoff":         "tc_rawapi_queue_backoff",
+	"routes.queue.backoffMax":      "tc_rawapi_queue_backoffMax",
+	"routes.queue.maxAttempts":     "tc_rawapi_queue_maxAttempts",
+	"routes.queue.poll":            "tc_rawapi_queue_poll",
+	"routes.webhooks.path":         "tc_rawapi_webhook_path",
+	"routes.webhooks.checkpoints":  "tc_rawapi_webhook_checkpoints",
+	"routes.webhooks.backoff":      "tc_rawapi_webhook_backoff",
+	"routes.webhooks.backoffMax":   "tc_rawapi_webhook_backoffMax",
+	"routes.webhooks.timeout":      "tc_rawapi_webhook_timeout",
+
+	"certs.check":    "tc_rawapi_certs_check",
+	"certs.warnDays": "tc_rawapi_certs_warnDays",
+
+	"audit.dir":      "tc_rawapi_audit_dir",
+	"audit.maxFiles": "tc_rawapi_audit_maxFiles",
+	"audit.maxSize":  "tc_rawapi_audit_maxSize",
+
+	"log.level": "tc_rawapi_LogLevel",
+}
+
+// Shared maps the settings outside of the orgs section an org may override for itself, relative
+// to the org, eg. a configtxlator, an invoke queue or webhook subscriptions of its own.
+var Shared = map[string]string{
+	"lator.which":          "tc_rawapi_lator_which",
+	"lator.bind":           "tc_rawapi_lator_bind",
+	"lator.port":           "tc_rawapi_lator_port",
+	"queue.path":           "tc_rawapi_queue_path",
+	"webhooks.path":        "tc_rawapi_webhook_path",
+	"webhooks.checkpoints": "tc_rawapi_webhook_checkpoints",
+}
+
+const orgs = "orgs"
+
+// endregion: paths
+// region: locate
+
+// Locate returns the config file named by the name flag in args, eg. -tc_rawapi_config=rawapi.yaml
+// or --tc_rawapi_config rawapi.yaml, or by the environment variable of the same name in upper
+// case, the file has to be read before the flag set is parsed.
+func Locate(name string, args []string) string {
+	for i, arg := range args {
+		flag := strings.TrimLeft(arg, "-")
+		if flag == arg || len(arg)-len(flag) > 2 {
+			continue
+		}
+		if flag == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(flag, name+"=") {
+			return strings.TrimPrefix(flag, name+"=")
+		}
+	}
+	return os.Getenv(strings.ToUpper(name))
+}
+
+// endregion: locate
+// region: load
+
+// Org is an org of the config file after the first one, the values of its settings by entry
+// name. Org settings it does not set are the defaults of their entries, not those of the first
+// org, shared settings are there only if it overrides them, files of _file settings are read
+// into their entries, as cfg does. Environment variables and flags apply to the first org only.
+type Org map[string]interface{}
+
+// Entries returns a copy of entries with the values of the org.
+func (org Org) Entries(entries map[string]cfg.Entry) map[string]cfg.Entry {
+	copied := make(map[string]cfg.Entry, len(entries))
+	for name, entry := range entries {
+		copied[name] = entry
+	}
+	for name, value := range org {
+		entry := copied[name]
+		entry.Value = value
+		copied[name] = entry
+	}
+	return copied
+}
+
+// Load reads the config file and sets the defaults of entries to its values, those of the first
+// org included, and returns the further orgs. Unknown settings and values not matching the type
+// of their entry are errors, all of them are reported at once.
+func Load(file string, entries map[string]cfg.Entry) ([]Org, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	document := map[string]interface{}{}
+	if err := yaml.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", file, err)
+	}
+
+	values := make(map[string]interface{})
+	further := make([]map[string]interface{}, 0)
+	problems := make([]string, 0)
+	for section, value := range document {
+		if section != orgs {
+			flatten(section, value, values)
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			problems = append(problems, "orgs: must be a list")
+			continue
+		}
+		for i, org := range list {
+			if i == 0 {
+				flatten(orgs, org, values)
+				continue
+			}
+			item := make(map[string]interface{})
+			flatten(orgs, org, item)
+			further = append(further, item)
+		}
+	}
+
+	defaults := make(map[string]interface{})
+	for path, name := range Paths {
+		if entry, ok := entries[name]; ok && strings.HasPrefix(path, orgs+".") {
+			defaults[name] = entry.Def
+		}
+	}
+
+	for path, value := range values {
+		name, converted, problem := setting(path, value, entries)
+		if len(problem) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s", path, problem))
+			continue
+		}
+		entry := entries[name]
+		entry.Def = converted
+		entries[name] = entry
+	}
+
+	result := make([]Org, 0, len(further))
+	for i, item := range further {
+		org := make(Org, len(defaults))
+		for name, value := range defaults {
+			org[name] = value
+		}
+		for path, value := range item {
+			name, converted, problem := setting(path, value, entries)
+			if len(problem) > 0 {
+				problems = append(problems, fmt.Sprintf("orgs[%d].%s: %s", i+1, strings.TrimPrefix(path, orgs+"."), problem))
+				continue
+			}
+			org[name] = converted
+		}
+		for name, value := range org {
+			if file, ok := value.(string); ok && len(file) > 0 && strings.HasSuffix(name, cfg.FlagSetFileSuffix) {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("orgs[%d]: %s", i+1, err))
+					continue
+				}
+				org[strings.TrimSuffix(name, cfg.FlagSetFileSuffix)] = strings.TrimSuffix(string(data), "\n")
+			}
+		}
+		result = append(result, org)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid config file %s:\n  %s", file, strings.Join(problems, "\n  "))
+	}
+	return result, nil
+}
+
+// setting returns the entry of the setting at path and value converted to its type, or a problem.
+func setting(path string, value interface{}, entries map[string]cfg.Entry) (string, interface{}, string) {
+	name, ok := Paths[path]
+	if !ok && strings.HasPrefix(path, orgs+".") {
+		name, ok = Shared[strings.TrimPrefix(path, orgs+".")]
+	}
+	if !ok {
+		return "", nil, "unknown setting"
+	}
+	entry, ok := entries[name]
+	if !ok {
+		return "", nil, fmt.Sprintf("%s is not a setting of this build", name)
+	}
+	converted, err := convert(value, entry.Type)
+	if err != nil {
+		return "", nil, err.Error()
+	}
+	return name, converted, ""
+}
+
+func flatten(prefix string, value interface{}, values map[string]interface{}) {
+	section, ok := value.(map[string]interface{})
+	if !ok {
+		values[prefix] = value
+		return
+	}
+	for key, value := range section {
+		flatten(prefix+"."+key, value, values)
+	}
+}
+
+// convert checks value against the type of an entry, durations are given as strings, eg. "90s".
+func convert(value interface{}, kind string) (interface{}, error) {
+	switch kind {
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("must be true or false, got %v", value)
+	case "int":
+		if i, ok := value.(int); ok {
+			return i, nil
+		}
+		return nil, fmt.Errorf("must be an integer, got %v", value)
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("must be a string, got %v, quote it", value)
+	case "time.Duration":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a duration like \"30s\" or \"5m\", got %v", value)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("must be a duration like \"30s\" or \"5m\", got %q", s)
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("unsupported setting type %s", kind)
+}
+
+// endregion: load
+// region: render
+
+// Render lays the values of the entries out in the structure of the config file, as YAML, with
+// the values of further orgs, if any, after the first one. Entries the file has no setting for
+// are left out.
+func Render(values map[string]interface{}, further ...map[string]interface{}) ([]byte, error) {
+	document := make(map[string]interface{})
+	org := make(map[string]interface{})
+	for path, name := range Paths {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		segments := strings.Split(path, ".")
+		if segments[0] == orgs {
+			place(org, segments[1:], value)
+			continue
+		}
+		place(document, segments, value)
+	}
+
+	list := make([]interface{}, 0, 1+len(further))
+	if len(org) > 0 {
+		list = append(list, org)
+	}
+	for _, values := range further {
+		org := make(map[string]interface{})
+		for path, name := range Paths {
+			if value, ok := values[name]; ok && strings.HasPrefix(path, orgs+".") {
+				place(org, strings.Split(path, ".")[1:], value)
+			}
+		}
+		for path, name := range Shared {
+			if value, ok := values[name]; ok {
+				place(org, strings.Split(path, "."), value)
+			}
+		}
+		list = append(list, org)
+	}
+	if len(list) > 0 {
+		document[orgs] = list
+	}
+	return yaml.Marshal(document)
+}
+
+// place sets value at the path of segments in section, durations as strings.
+func place(section map[string]interface{}, segments []string, value interface{}) {
+	if d, ok := value.(time.Duration); ok {
+		value = d.String()
+	}
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := section[segment].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			section[segment] = next
+		}
+		section = next
+	}
+	section[segments[len(segments)-1]] = value
+}
+
+// endregion: render
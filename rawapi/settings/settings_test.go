@@ -0,0 +1,209 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/cfg"
+	"gopkg.in/yaml.v3"
+)
+
+func testEntries() map[string]cfg.Entry {
+	return map[string]cfg.Entry{
+		"tc_rawapi_http_port":        {Type: "int", Def: 5998},
+		"tc_rawapi_https_enabled":    {Type: "bool", Def: true},
+		"tc_rawapi_lator_port":       {Type: "int", Def: 1337},
+		"tc_rawapi_MSPID":            {Type: "string", Def: "te-food_endorsersMSP"},
+		"tc_rawapi_orgName":          {Type: "string", Def: "te-food-endorsers"},
+		"tc_rawapi_timeout_evaluate": {Type: "time.Duration", Def: 5 * time.Second},
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	for _, file := range []string{
+		writeFile(t, "rawapi.yaml", "server:\n  http:\n    port: 8080\n  https:\n    enabled: false\norgs:\n  - name: org1\n    mspId: Org1MSP\n  - name: org2\n    lator:\n      port: 1338\nroutes:\n  timeouts:\n    evaluate: 7s\n"),
+		writeFile(t, "rawapi.json", `{"server": {"http": {"port": 8080}, "https": {"enabled": false}}, "orgs": [{"name": "org1", "mspId": "Org1MSP"}, {"name": "org2", "lator": {"port": 1338}}], "routes": {"timeouts": {"evaluate": "7s"}}}`),
+	} {
+		entries := testEntries()
+		further, err := Load(file, entries)
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		for name, want := range map[string]interface{}{
+			"tc_rawapi_http_port":        8080,
+			"tc_rawapi_https_enabled":    false,
+			"tc_rawapi_MSPID":            "Org1MSP",
+			"tc_rawapi_orgName":          "org1",
+			"tc_rawapi_timeout_evaluate": 7 * time.Second,
+		} {
+			if entries[name].Def != want {
+				t.Errorf("%s: %s is %v, want %v", file, name, entries[name].Def, want)
+			}
+		}
+
+		if len(further) != 1 {
+			t.Fatalf("%s: %d further orgs, want 1", file, len(further))
+		}
+		for name, want := range map[string]interface{}{
+			"tc_rawapi_MSPID":      "te-food_endorsersMSP",
+			"tc_rawapi_lator_port": 1338,
+			"tc_rawapi_orgName":    "org2",
+		} {
+			if further[0][name] != want {
+				t.Errorf("%s: %s of org2 is %v, want %v", file, name, further[0][name], want)
+			}
+		}
+		if _, ok := further[0]["tc_rawapi_http_port"]; ok {
+			t.Errorf("%s: org2 has a server setting", file)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	file := writeFile(t, "rawapi.yaml", "server:\n  htp:\n    port: 8080\n  http:\n    port: eighty\norgs:\n  - name: org1\n  - name: org2\n    http:\n      port: 80\nroutes:\n  timeouts:\n    evaluate: 7\n")
+	_, err := Load(file, testEntries())
+	if err == nil {
+		t.Fatal("invalid config file is loaded")
+	}
+	for _, problem := range []string{
+		"server.htp.port: unknown setting",
+		"server.http.port: must be an integer",
+		"orgs[1].http.port: unknown setting",
+		"routes.timeouts.evaluate: must be a duration",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q is not reported in %s", problem, err)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	t.Setenv("TC_RAWAPI_CONFIG", "env.yaml")
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-tc_rawapi_config=a.yaml"}, "a.yaml"},
+		{[]string{"--print-config", "--tc_rawapi_config", "b.yaml"}, "b.yaml"},
+		{[]string{"-tc_rawapi_http_port=80"}, "env.yaml"},
+	} {
+		if got := Locate("tc_rawapi_config", tc.args); got != tc.want {
+			t.Errorf("%v: got %s, want %s", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestRenderAndValidate(t *testing.T) {
+	out, err := Render(map[string]interface{}{
+		"tc_rawapi_http_port":        8080,
+		"tc_rawapi_orgName":          "org1",
+		"tc_rawapi_timeout_evaluate": 7 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := map[string]interface{}{}
+	if err := yaml.Unmarshal(out, &document); err != nil {
+		t.Fatal(err)
+	}
+	if document["orgs"].([]interface{})[0].(map[string]interface{})["name"] != "org1" || !strings.Contains(string(out), "evaluate: 7s") {
+		t.Errorf("unexpected rendering:\n%s", out)
+	}
+
+	err = Validate(map[string]cfg.Entry{
+		"tc_rawapi_http_enabled":   {Value: true},
+		"tc_rawapi_http_port":      {Value: 70000},
+		"tc_rawapi_auth_mode":      {Value: "token"},
+		"tc_rawapi_certs_warnDays": {Value: "30, 7,x"},
+	})
+	for _, problem := range []string{
+		"server.http.port (tc_rawapi_http_port): must be a port between 1 and 65535, got 70000",
+		"keys.mode (tc_rawapi_auth_mode): must be one of",
+		"orgs.mspId (tc_rawapi_MSPID): must not be empty",
+		"certs.warnDays (tc_rawapi_certs_warnDays): invalid threshold 'x'",
+	} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q is not reported in %v", problem, err)
+		}
+	}
+
+	org2 := Org{"tc_rawapi_orgName": "org1", "tc_rawapi_profile": "", "tc_rawapi_lator_port": 0}
+	err = Validate(map[string]cfg.Entry{
+		"tc_rawapi_orgName":     {Value: "org1"},
+		"tc_rawapi_profile":     {Value: "connection.yaml"},
+		"tc_rawapi_lator_bind":  {Value: "127.0.0.1"},
+		"tc_rawapi_lator_port":  {Value: 1337},
+		"tc_rawapi_lator_which": {Value: "configtxlator"},
+	}, org2.Entries(map[string]cfg.Entry{"tc_rawapi_lator_bind": {Value: "127.0.0.1"}, "tc_rawapi_lator_which": {Value: "configtxlator"}}))
+	for _, problem := range []string{
+		"orgs[1].name (tc_rawapi_orgName): org 'org1' is already configured as orgs[0]",
+		"orgs[1].mspId (tc_rawapi_MSPID): must not be empty",
+		"orgs[1].lator.port (tc_rawapi_lator_port): must be a port between 1 and 65535, got 0",
+	} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q is not reported in %v", problem, err)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "\n  orgs.mspId") {
+		t.Errorf("settings of the first org are required next to a connection profile: %v", err)
+	}
+
+	err = Validate(map[string]cfg.Entry{"tc_rawapi_profile": {Value: "connection.yaml"}})
+	if err == nil || strings.Contains(err.Error(), "orgs.mspId") {
+		t.Errorf("org settings are required next to a connection profile: %v", err)
+	}
+
+	err = Validate(map[string]cfg.Entry{"tc_rawapi_identity": {Value: "gateway"}})
+	if err == nil || !strings.Contains(err.Error(), "orgs.identity (tc_rawapi_identity): needs a wallet") || strings.Contains(err.Error(), "orgs.keyPath") {
+		t.Errorf("wallet identity of the gateway: %v", err)
+	}
+
+	err = Validate(map[string]cfg.Entry{
+		"tc_rawapi_grpc_enabled":      {Value: true},
+		"tc_rawapi_grpc_networkProto": {Value: "unix"},
+		"tc_rawapi_grpc_port":         {Value: 5997},
+		"tc_rawapi_grpc_tls":          {Value: true},
+	})
+	for _, problem := range []string{
+		"server.grpc.tls (tc_rawapi_grpc_tls): gRPC is served over TLS by default, which needs the https certificate and key",
+		"server.grpc.socket (tc_rawapi_grpc_socket): network protocol unix needs a socket path",
+	} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q is not reported in %v", problem, err)
+		}
+	}
+	first := map[string]cfg.Entry{
+		"tc_rawapi_orgName":             {Value: "org1"},
+		"tc_rawapi_profile":             {Value: "connection.yaml"},
+		"tc_rawapi_queue_path":          {Value: "org1.db"},
+		"tc_rawapi_webhook_checkpoints": {Value: "checkpoints"},
+		"tc_rawapi_webhook_path":        {Value: "org1.json"},
+	}
+	inheriting := Org{"tc_rawapi_orgName": "org2"}
+	own := Org{"tc_rawapi_orgName": "org3", "tc_rawapi_queue_path": "org3.db", "tc_rawapi_webhook_path": "org3.json", "tc_rawapi_webhook_checkpoints": ""}
+	sharing := Org{"tc_rawapi_orgName": "org4", "tc_rawapi_queue_path": "org3.db", "tc_rawapi_webhook_path": "org4.json"}
+	err = Validate(first, inheriting.Entries(first), own.Entries(first), sharing.Entries(first))
+	for _, problem := range []string{
+		"orgs[3].queue.path (tc_rawapi_queue_path): 'org3.db' is already the queue of orgs[2]",
+		"orgs[3].webhooks.checkpoints (tc_rawapi_webhook_checkpoints): webhook subscriptions of their own need checkpoints of their own",
+	} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q is not reported in %v", problem, err)
+		}
+	}
+	if err != nil && strings.Count(err.Error(), "orgs[") != 3 {
+		t.Errorf("orgs inheriting or owning their queue and webhooks are reported: %v", err)
+	}
+}
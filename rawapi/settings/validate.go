@@ -0,0 +1,269 @@
+package settings
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/cfg"
+)
+
+// region: validate
+
+// Validate checks the merged values of the entries, that is, after the config file, environment
+// and flags have been applied, and those of the further orgs of the config file, see Org.Entries,
+// and reports every problem at once.
+func Validate(entries map[string]cfg.Entry, further ...map[string]cfg.Entry) error {
+	v := &validator{entries: entries, problems: make([]string, 0)}
+
+	// region: server
+
+	v.oneOf("tc_rawapi_http_networkProto", "tcp", "tcp4", "tcp6", "unix", "unixpacket")
+	for _, listener := range []string{"http", "https"} {
+		if v.bool("tc_rawapi_"+listener+"_enabled") && len(v.string("tc_rawapi_"+listener+"_socket")) == 0 {
+			v.port("tc_rawapi_"+listener+"_port", 1)
+		}
+	}
+	if v.bool("tc_rawapi_grpc_enabled") {
+		v.oneOf("tc_rawapi_grpc_networkProto", "tcp", "tcp4", "tcp6", "unix")
+		if len(v.string("tc_rawapi_grpc_socket")) == 0 {
+			v.port("tc_rawapi_grpc_port", 1)
+			if v.string("tc_rawapi_grpc_networkProto") == "unix" {
+				v.problem("tc_rawapi_grpc_socket", "network protocol unix needs a socket path")
+			}
+		}
+	}
+	v.port("tc_rawapi_admin_port", 0)
+	v.atLeast("tc_rawapi_http_maxRequestBodySize", 1)
+
+	// endregion: server
+	// region: tls
+
+	certified := len(v.string("tc_rawapi_https_cert")) > 0 && len(v.string("tc_rawapi_https_key")) > 0
+	if v.bool("tc_rawapi_https_enabled") && !certified {
+		v.problem("tc_rawapi_https_cert", "https needs a certificate and a key, set them or their _file variants")
+	}
+	if v.bool("tc_rawapi_grpc_enabled") && v.bool("tc_rawapi_grpc_tls") && !certified {
+		v.problem("tc_rawapi_grpc_tls", "gRPC is served over TLS by default, which needs the https certificate and key, set them or disable gRPC TLS")
+	}
+	v.oneOf("tc_rawapi_https_clientAuth", "", "none", "request", "require")
+	if auth := v.string("tc_rawapi_https_clientAuth"); (auth == "request" || auth == "require") && len(v.string("tc_rawapi_https_clientCA")) == 0 {
+		v.problem("tc_rawapi_https_clientCA", fmt.Sprintf("client auth %s needs a client CA bundle", auth))
+	}
+	v.duration("tc_rawapi_https_reload")
+
+	// endregion: tls
+	// region: keys
+
+	v.oneOf("tc_rawapi_auth_mode", "key", "jwt", "any", "cert")
+	if mode := v.string("tc_rawapi_auth_mode"); (mode == "jwt" || mode == "any") && len(v.string("tc_rawapi_auth_jwt_jwks")) == 0 {
+		v.problem("tc_rawapi_auth_jwt_jwks", fmt.Sprintf("auth mode %s needs a JWKS", mode))
+	}
+	if v.string("tc_rawapi_auth_mode") == "cert" && len(v.string("tc_rawapi_https_clientCerts")) == 0 {
+		v.problem("tc_rawapi_https_clientCerts", "auth mode cert needs client certificate subjects")
+	}
+	v.duration("tc_rawapi_auth_jwt_leeway")
+	v.duration("tc_rawapi_auth_jwt_refresh")
+
+	// endregion: keys
+	// region: orgs
+
+	v.org()
+	names := map[string]int{v.string("tc_rawapi_orgName"): 0}
+	queues, webhooks := map[string]int{}, map[string]int{}
+	for i, entries := range further {
+		o := &validator{entries: entries, index: i + 1, problems: v.problems}
+		o.org()
+		if len(o.string("tc_rawapi_lator_which")) > 0 && len(o.string("tc_rawapi_lator_bind")) > 0 {
+			o.port("tc_rawapi_lator_port", 1)
+		}
+		if first, ok := names[o.string("tc_rawapi_orgName")]; ok {
+			o.problem("tc_rawapi_orgName", fmt.Sprintf("org '%s' is already configured as orgs[%d]", o.string("tc_rawapi_orgName"), first))
+		}
+		names[o.string("tc_rawapi_orgName")] = i + 1
+
+		// further orgs inherit the queue and the webhooks of the first one as disabled, those of
+		// their own need files of their own
+		if path := o.string("tc_rawapi_queue_path"); len(path) > 0 && path != v.string("tc_rawapi_queue_path") {
+			if other, ok := queues[path]; ok {
+				o.problem("tc_rawapi_queue_path", fmt.Sprintf("'%s' is already the queue of orgs[%d]", path, other))
+			}
+			queues[path] = i + 1
+		}
+		if path := o.string("tc_rawapi_webhook_path"); len(path) > 0 && path != v.string("tc_rawapi_webhook_path") {
+			if other, ok := webhooks[path]; ok {
+				o.problem("tc_rawapi_webhook_path", fmt.Sprintf("'%s' is already the webhook subscriptions of orgs[%d]", path, other))
+			}
+			webhooks[path] = i + 1
+			if checkpoints := o.string("tc_rawapi_webhook_checkpoints"); len(checkpoints) > 0 && checkpoints == v.string("tc_rawapi_webhook_checkpoints") {
+				o.problem("tc_rawapi_webhook_checkpoints", "webhook subscriptions of their own need checkpoints of their own, set it or leave it empty for the directory of the subscriptions")
+			}
+		}
+		v.problems = o.problems
+	}
+
+	// endregion: orgs
+	// region: lator
+
+	if len(v.string("tc_rawapi_lator_which")) > 0 && len(v.string("tc_rawapi_lator_bind")) > 0 {
+		v.port("tc_rawapi_lator_port", 1)
+	}
+
+	// endregion: lator
+	// region: routes
+
+	if v.bool("tc_rawapi_cache_enabled") {
+		v.atLeast("tc_rawapi_cache_size", 1)
+	}
+	for _, name := range []string{"tc_rawapi_cache_ttl", "tc_rawapi_timeout_commitStatus", "tc_rawapi_timeout_endorse", "tc_rawapi_timeout_evaluate", "tc_rawapi_timeout_submit"} {
+		v.duration(name)
+	}
+	v.atLeast("tc_rawapi_transactions_size", 0)
+	if v.int("tc_rawapi_transactions_size") > 0 {
+		v.duration("tc_rawapi_transactions_ttl")
+	}
+	v.atLeast("tc_rawapi_queue_maxAttempts", 0)
+	for _, name := range []string{"tc_rawapi_queue_backoff", "tc_rawapi_queue_backoffMax", "tc_rawapi_queue_poll", "tc_rawapi_webhook_backoff", "tc_rawapi_webhook_backoffMax", "tc_rawapi_webhook_timeout"} {
+		v.duration(name)
+	}
+
+	// endregion: routes
+	// region: audit, log
+
+	v.atLeast("tc_rawapi_audit_maxFiles", 0)
+	v.atLeast("tc_rawapi_audit_maxSize", 0)
+	if level := v.int("tc_rawapi_LogLevel"); level < 0 || level > 7 {
+		v.problem("tc_rawapi_LogLevel", fmt.Sprintf("must be between 0 (emerg) and 7 (debug), got %d", level))
+	}
+
+	// endregion: audit, log
+	// region: certs
+
+	v.duration("tc_rawapi_certs_check")
+	for _, field := range strings.Split(v.string("tc_rawapi_certs_warnDays"), ",") {
+		field = strings.TrimSpace(field)
+		if n, err := strconv.Atoi(field); len(field) > 0 && (err != nil || n <= 0) {
+			v.problem("tc_rawapi_certs_warnDays", fmt.Sprintf("invalid threshold '%s', must be a positive number of days", field))
+		}
+	}
+
+	// endregion: certs
+
+	if len(v.problems) > 0 {
+		sort.Strings(v.problems)
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(v.problems, "\n  "))
+	}
+	return nil
+}
+
+// endregion: validate
+// region: validator
+
+// validator collects the problems of entries, index is that of the org in the orgs list of the
+// config file for the further orgs, and 0 otherwise.
+type validator struct {
+	entries  map[string]cfg.Entry
+	index    int
+	problems []string
+}
+
+// problem records a problem of an entry, named by its setting in the config file as well.
+func (v *validator) problem(name, problem string) {
+	label := name
+	for path, entry := range Paths {
+		if entry == name {
+			label = fmt.Sprintf("%s (%s)", path, name)
+			if v.index > 0 && strings.HasPrefix(path, orgs+".") {
+				label = fmt.Sprintf("orgs[%d].%s (%s)", v.index, strings.TrimPrefix(path, orgs+"."), name)
+			}
+			break
+		}
+	}
+	for path, entry := range Shared {
+		if entry == name && v.index > 0 {
+			label = fmt.Sprintf("orgs[%d].%s (%s)", v.index, path, name)
+		}
+	}
+	v.problems = append(v.problems, fmt.Sprintf("%s: %s", label, problem))
+}
+
+// org checks the settings of an org.
+func (v *validator) org() {
+	if len(v.string("tc_rawapi_profile")) == 0 {
+		required := []string{"tc_rawapi_orgName", "tc_rawapi_MSPID", "tc_rawapi_TLSCertPath", "tc_rawapi_peerEndpoint", "tc_rawapi_gatewayPeer"}
+		switch {
+		case len(v.string("tc_rawapi_identity")) > 0:
+		case len(v.string("tc_rawapi_auth_wallet")) > 0:
+			required = append(required, "tc_rawapi_certPath")
+		default:
+			required = append(required, "tc_rawapi_certPath", "tc_rawapi_keyPath")
+		}
+		for _, name := range required {
+			if len(v.string(name)) == 0 {
+				v.problem(name, "must not be empty, or set a connection profile")
+			}
+		}
+	}
+	if len(v.string("tc_rawapi_auth_wallet")) == 0 {
+		for _, name := range []string{"tc_rawapi_identity", "tc_rawapi_auth_walletPassphrase"} {
+			if len(v.string(name)) > 0 {
+				v.problem(name, "needs a wallet")
+			}
+		}
+	}
+	v.duration("tc_rawapi_reload")
+	v.atLeast("tc_rawapi_ca_renewDays", 0)
+	if v.int("tc_rawapi_ca_renewDays") > 0 && len(v.string("tc_rawapi_ca_url")) > 0 {
+		if strings.HasPrefix(v.string("tc_rawapi_ca_url"), "https://") && len(v.string("tc_rawapi_ca_tlsCert")) == 0 {
+			v.problem("tc_rawapi_ca_tlsCert", "an https CA needs its TLS root certificate")
+		}
+		v.duration("tc_rawapi_ca_check")
+	}
+}
+
+func (v *validator) bool(name string) bool {
+	b, _ := v.entries[name].Value.(bool)
+	return b
+}
+
+func (v *validator) int(name string) int {
+	i, _ := v.entries[name].Value.(int)
+	return i
+}
+
+func (v *validator) string(name string) string {
+	s, _ := v.entries[name].Value.(string)
+	return s
+}
+
+func (v *validator) oneOf(name string, allowed ...string) {
+	value := v.string(name)
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.problem(name, fmt.Sprintf("must be one of '%s', got '%s'", strings.Join(allowed, "', '"), value))
+}
+
+func (v *validator) port(name string, min int) {
+	if port := v.int(name); port < min || port > 65535 {
+		v.problem(name, fmt.Sprintf("must be a port between %d and 65535, got %d", min, port))
+	}
+}
+
+func (v *validator) atLeast(name string, min int) {
+	if i := v.int(name); i < min {
+		v.problem(name, fmt.Sprintf("must be at least %d, got %d", min, i))
+	}
+}
+
+func (v *validator) duration(name string) {
+	if d, _ := v.entries[name].Value.(time.Duration); d < 0 {
+		v.problem(name, fmt.Sprintf("must not be negative, got %s", d))
+	}
+}
+
+// endregion: validator
@@ -0,0 +1,585 @@
+// Package webhook delivers chaincode events to http endpoints. Every subscription listens to the
+// events of a chaincode from its own file checkpoint, and posts the matching ones as HMAC signed
+// json, retrying each event until it is accepted or dead-lettered, so no event is lost or skipped
+// across restarts.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	tc "github.com/SandorMiskey/TrustChain/fabric"
+	"github.com/SandorMiskey/TrustChain/rawapi/retry"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/valyala/fasthttp"
+)
+
+// region: types
+
+// Webhooks keeps the subscriptions in the json file at Path and the checkpoints of them in
+// Checkpoints (the directory of Path by default). Failed deliveries are retried after Backoff,
+// doubled on every attempt up to BackoffMax, each attempt is bound by Timeout. Events that cannot
+// be encoded, are rejected with a 4xx other than 408, 425 and 429, or are still not delivered
+// after MaxAttempts or MaxAge since the first attempt (0 retries forever) are dead-lettered to a
+// json lines file next to the checkpoint.
+type Webhooks struct {
+	Backoff     time.Duration `json:"Backoff"`
+	BackoffMax  time.Duration `json:"BackoffMax"`
+	Checkpoints string        `json:"Checkpoints"`
+	Logger      *log.Logger   `json:"-"`
+	MaxAge      time.Duration `json:"MaxAge"`
+	MaxAttempts int           `json:"MaxAttempts"`
+	Path        string        `json:"Path"`
+	Timeout     time.Duration `json:"Timeout"`
+
+	client        *fasthttp.Client         `json:"-"`
+	ctx           context.Context          `json:"-"`
+	fabric        *tc.Client               `json:"-"`
+	mutex         sync.Mutex               `json:"-"`
+	runners       map[string]*runner       `json:"-"`
+	subscriptions map[string]*Subscription `json:"-"`
+	wg            sync.WaitGroup           `json:"-"`
+}
+
+// Subscription posts the events of Chaincode on Channel whose name matches any of the Events
+// patterns (path.Match syntax, every event if empty) to URL, signed with Secret.
+type Subscription struct {
+	Chaincode string   `json:"chaincode"`
+	Channel   string   `json:"channel"`
+	Events    []string `json:"events,omitempty"`
+	ID        string   `json:"id"`
+	Secret    string   `json:"secret,omitempty"`
+	URL       string   `json:"url"`
+}
+
+// Status is a subscription, without its secret, along with the progress of its delivery.
+type Status struct {
+	Subscription
+	Block       uint64    `json:"block"`
+	DeadLetters int       `json:"dead_letters"`
+	Delivered   int       `json:"delivered"`
+	Error       string    `json:"error,omitempty"`
+	Failures    int       `json:"failures"`
+	Last        time.Time `json:"last_delivery,omitempty"`
+	Txid        string    `json:"tx_id,omitempty"`
+}
+
+// Event is the json body of a delivery.
+type Event struct {
+	BlockNumber  uint64      `json:"block_number"`
+	Chaincode    string      `json:"chaincode"`
+	Channel      string      `json:"channel"`
+	EventName    string      `json:"event_name"`
+	Payload      interface{} `json:"payload"`
+	Subscription string      `json:"subscription"`
+	Txid         string      `json:"tx_id"`
+}
+
+// DeadLetter is an event that could not be delivered, as written to the dead letter file of the
+// subscription, the payload is as the chaincode emitted it.
+type DeadLetter struct {
+	BlockNumber uint64    `json:"block_number"`
+	Error       string    `json:"error"`
+	EventName   string    `json:"event_name"`
+	Payload     []byte    `json:"payload"`
+	Time        time.Time `json:"time"`
+	Txid        string    `json:"tx_id"`
+}
+
+// rejected is the status code of a delivery the endpoint did not accept.
+type rejected struct {
+	code int
+	url  string
+}
+
+func (r *rejected) Error() string { return fmt.Sprintf("%s responded with %d", r.url, r.code) }
+
+// permanent tells whether retrying the delivery is pointless, which is the case for client errors
+// apart from timeouts and rate limits.
+func (r *rejected) permanent() bool {
+	switch r.code {
+	case fasthttp.StatusRequestTimeout, 425, fasthttp.StatusTooManyRequests: // 425 too early
+		return false
+	}
+	return r.code >= 400 && r.code <= 499
+}
+
+type runner struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	mutex  sync.Mutex
+	status Status
+}
+
+const (
+	// SignatureHeader holds sha256=<hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the secret>.
+	SignatureHeader = "X-TrustChain-Signature"
+	// TimestampHeader holds the unix time of the attempt the signature was made for.
+	TimestampHeader = "X-TrustChain-Timestamp"
+	// EventHeader identifies the event, it is the same across retries, so receivers can dedupe.
+	EventHeader = "X-TrustChain-Event"
+)
+
+var (
+	ErrNotFound = errors.New("no such webhook subscription")
+
+	validID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// endregion: types
+// region: init
+
+func (w *Webhooks) Init() (*Webhooks, error) {
+	if w.Logger == nil {
+		return w, errors.New("webhook.Webhooks.Init() needs a logger")
+	}
+	if len(w.Path) == 0 {
+		return w, errors.New("webhook.Webhooks.Init() needs a path")
+	}
+	if w.Backoff <= 0 {
+		w.Backoff = time.Second
+	}
+	if w.BackoffMax < w.Backoff {
+		w.BackoffMax = w.Backoff
+	}
+	if w.Timeout <= 0 {
+		w.Timeout = 10 * time.Second
+	}
+	if len(w.Checkpoints) == 0 {
+		w.Checkpoints = filepath.Dir(w.Path)
+	}
+	if err := os.MkdirAll(w.Checkpoints, 0700); err != nil {
+		return w, fmt.Errorf("unable to create webhook checkpoint directory: %w", err)
+	}
+
+	w.client = &fasthttp.Client{Name: "TrustChain webhook"}
+	w.runners = make(map[string]*runner)
+	w.subscriptions = make(map[string]*Subscription)
+
+	raw, err := os.ReadFile(w.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		return w, fmt.Errorf("unable to read webhook subscriptions: %w", err)
+	}
+	subscriptions := make([]*Subscription, 0)
+	if err = json.Unmarshal(raw, &subscriptions); err != nil {
+		return w, fmt.Errorf("unable to parse webhook subscriptions %s: %w", w.Path, err)
+	}
+	for _, s := range subscriptions {
+		if err = s.validate(); err != nil {
+			return w, err
+		}
+		if _, ok := w.subscriptions[s.ID]; ok {
+			return w, fmt.Errorf("duplicate webhook subscription %s", s.ID)
+		}
+		w.subscriptions[s.ID] = s
+	}
+
+	return w, nil
+}
+
+func (s *Subscription) validate() error {
+	if !validID.MatchString(s.ID) {
+		return fmt.Errorf("invalid webhook subscription id '%s'", s.ID)
+	}
+	if len(s.Channel) == 0 || len(s.Chaincode) == 0 {
+		return fmt.Errorf("webhook subscription %s needs a channel and a chaincode", s.ID)
+	}
+	if len(s.Secret) == 0 {
+		return fmt.Errorf("webhook subscription %s needs a secret", s.ID)
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("webhook subscription %s needs an http(s) url, got '%s'", s.ID, s.URL)
+	}
+	for _, pattern := range s.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid event filter '%s' in webhook subscription %s: %w", pattern, s.ID, err)
+		}
+	}
+	return nil
+}
+
+// endregion: init
+// region: subscriptions
+
+// Add validates, saves and starts the subscription, an id is generated if it has none.
+func (w *Webhooks) Add(s *Subscription) (*Subscription, error) {
+	if len(s.ID) == 0 {
+		random := make([]byte, 8)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		s.ID = hex.EncodeToString(random)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, ok := w.subscriptions[s.ID]; ok {
+		return nil, fmt.Errorf("webhook subscription %s already exists", s.ID)
+	}
+	w.subscriptions[s.ID] = s
+	if err := w.save(); err != nil {
+		delete(w.subscriptions, s.ID)
+		return nil, err
+	}
+	if w.ctx != nil {
+		w.start(s)
+	}
+	return s, nil
+}
+
+// Remove stops and deletes the subscription along with its checkpoint, its dead letters are kept.
+func (w *Webhooks) Remove(id string) error {
+	w.mutex.Lock()
+	s, ok := w.subscriptions[id]
+	if !ok {
+		w.mutex.Unlock()
+		return ErrNotFound
+	}
+	delete(w.subscriptions, id)
+	if err := w.save(); err != nil {
+		w.subscriptions[id] = s
+		w.mutex.Unlock()
+		return err
+	}
+	r := w.runners[id]
+	delete(w.runners, id)
+	w.mutex.Unlock()
+
+	if r != nil {
+		r.cancel()
+		<-r.done
+	}
+	if err := os.Remove(w.checkpoint(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Get returns the status of the subscription.
+func (w *Webhooks) Get(id string) (*Status, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	s, ok := w.subscriptions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return w.status(s), nil
+}
+
+// List returns the status of every subscription, ordered by id.
+func (w *Webhooks) List() []*Status {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	list := make([]*Status, 0, len(w.subscriptions))
+	for _, s := range w.subscriptions {
+		list = append(list, w.status(s))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// status expects w.mutex to be held.
+func (w *Webhooks) status(s *Subscription) *Status {
+	status := &Status{}
+	if r, ok := w.runners[s.ID]; ok {
+		r.mutex.Lock()
+		*status = r.status
+		r.mutex.Unlock()
+	}
+	status.Subscription = *s
+	status.Secret = ""
+	return status
+}
+
+// save writes the subscriptions to Path through a temporary file, it expects w.mutex to be held.
+func (w *Webhooks) save() error {
+	subscriptions := make([]*Subscription, 0, len(w.subscriptions))
+	for _, s := range w.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].ID < subscriptions[j].ID })
+
+	raw, err := json.MarshalIndent(subscriptions, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := w.Path + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("unable to save webhook subscriptions: %w", err)
+	}
+	if err = os.Rename(tmp, w.Path); err != nil {
+		return fmt.Errorf("unable to save webhook subscriptions: %w", err)
+	}
+	return nil
+}
+
+func (w *Webhooks) checkpoint(id string) string {
+	return filepath.Join(w.Checkpoints, id+".checkpoint")
+}
+
+func (w *Webhooks) deadLetters(id string) string {
+	return filepath.Join(w.Checkpoints, id+".dead")
+}
+
+// endregion: subscriptions
+// region: run
+
+// Run listens to the events of every subscription with client until ctx is done, subscriptions
+// added in the meantime are started right away.
+func (w *Webhooks) Run(ctx context.Context, client *tc.Client) {
+	w.mutex.Lock()
+	w.ctx, w.fabric = ctx, client
+	for _, s := range w.subscriptions {
+		w.start(s)
+	}
+	w.mutex.Unlock()
+
+	<-ctx.Done()
+	w.wg.Wait()
+
+	w.mutex.Lock()
+	w.ctx, w.runners = nil, make(map[string]*runner)
+	w.mutex.Unlock()
+}
+
+// start expects w.mutex to be held.
+func (w *Webhooks) start(s *Subscription) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	r := &runner{cancel: cancel, done: make(chan struct{})}
+	w.runners[s.ID] = r
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(r.done)
+		w.listen(ctx, s, r)
+	}()
+}
+
+// listen resumes the event stream of the subscription from its checkpoint, reconnecting with
+// backoff whenever the stream breaks, and moves the checkpoint past each event only once it is
+// delivered, or once it turned out not to match the filter.
+func (w *Webhooks) listen(ctx context.Context, s *Subscription, r *runner) {
+	logger := w.Logger.Out
+
+	checkpointer, err := tc.NewCheckpointer(w.checkpoint(s.ID))
+	if err != nil {
+		logger(log.LOG_ERR, fmt.Sprintf("webhook %s: unable to open checkpoint", s.ID), err)
+		r.failed(err)
+		return
+	}
+	defer checkpointer.Close()
+
+	for attempt := 1; ctx.Err() == nil; attempt++ {
+		events, err := w.fabric.ChaincodeEvents(ctx, s.Channel, s.Chaincode, checkpointer)
+		if err == nil {
+			logger(log.LOG_INFO, fmt.Sprintf("webhook %s: listening to %s events on %s from block %d", s.ID, s.Chaincode, s.Channel, checkpointer.BlockNumber()))
+			for event := range events {
+				attempt = 1
+				if s.match(event.EventName) && !w.deliver(ctx, s, r, event) {
+					return
+				}
+				if err := checkpointer.CheckpointChaincodeEvent(event); err != nil {
+					logger(log.LOG_ERR, fmt.Sprintf("webhook %s: unable to checkpoint %s, it will be delivered again after a restart", s.ID, event.TransactionID), err)
+				}
+				r.checkpoint(event)
+			}
+			err = errors.New("event stream closed")
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := retry.Backoff(w.Backoff, w.BackoffMax, attempt)
+		logger(log.LOG_WARNING, fmt.Sprintf("webhook %s: %s, reconnecting in %s", s.ID, err, delay))
+		r.failed(err)
+		if !retry.Sleep(ctx, delay) {
+			return
+		}
+	}
+}
+
+func (s *Subscription) match(name string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, pattern := range s.Events {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver posts the event until the endpoint accepts it, or dead-letters it if it cannot be
+// posted at all, is rejected for good or runs out of attempts, it returns false if ctx is done
+// first.
+func (w *Webhooks) deliver(ctx context.Context, s *Subscription, r *runner, event *client.ChaincodeEvent) bool {
+	logger := w.Logger.Out
+
+	body, err := json.Marshal(&Event{
+		BlockNumber:  event.BlockNumber,
+		Chaincode:    event.ChaincodeName,
+		Channel:      s.Channel,
+		EventName:    event.EventName,
+		Payload:      payload(event.Payload),
+		Subscription: s.ID,
+		Txid:         event.TransactionID,
+	})
+	if err != nil {
+		logger(log.LOG_ERR, fmt.Sprintf("webhook %s: unable to encode %s of %s, dead-lettering it", s.ID, event.EventName, event.TransactionID), err)
+		w.deadLetter(s, r, event, err)
+		return true
+	}
+
+	first := time.Now()
+	for attempt := 1; ; attempt++ {
+		err = w.post(s, event, body)
+		if err == nil {
+			r.delivered()
+			logger(log.LOG_DEBUG, fmt.Sprintf("webhook %s: %s of %s delivered", s.ID, event.EventName, event.TransactionID))
+			return true
+		}
+
+		r.failed(err)
+		delay := retry.Backoff(w.Backoff, w.BackoffMax, attempt)
+		var rejection *rejected
+		if (errors.As(err, &rejection) && rejection.permanent()) ||
+			(w.MaxAttempts > 0 && attempt >= w.MaxAttempts) ||
+			(w.MaxAge > 0 && time.Since(first)+delay > w.MaxAge) {
+			logger(log.LOG_ERR, fmt.Sprintf("webhook %s: delivery of %s of %s failed (attempt %d), dead-lettering it: %s", s.ID, event.EventName, event.TransactionID, attempt, err))
+			w.deadLetter(s, r, event, err)
+			return true
+		}
+		logger(log.LOG_WARNING, fmt.Sprintf("webhook %s: delivery of %s of %s failed (attempt %d), retrying in %s: %s", s.ID, event.EventName, event.TransactionID, attempt, delay, err))
+		if !retry.Sleep(ctx, delay) {
+			return false
+		}
+	}
+}
+
+// deadLetter appends the event to the dead letter file of the subscription, failing that it is
+// logged only, either way the subscription moves on.
+func (w *Webhooks) deadLetter(s *Subscription, r *runner, event *client.ChaincodeEvent, cause error) {
+	r.deadLetter(cause)
+	raw, _ := json.Marshal(&DeadLetter{
+		BlockNumber: event.BlockNumber,
+		Error:       cause.Error(),
+		EventName:   event.EventName,
+		Payload:     event.Payload,
+		Time:        time.Now().UTC(),
+		Txid:        event.TransactionID,
+	})
+	file, err := os.OpenFile(w.deadLetters(s.ID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = file.Write(append(raw, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		w.Logger.Out(log.LOG_ERR, fmt.Sprintf("webhook %s: unable to dead-letter %s of %s: %s", s.ID, event.EventName, event.TransactionID, raw), err)
+	}
+}
+
+func (w *Webhooks) post(s *Subscription, event *client.ChaincodeEvent, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI(s.URL)
+	req.Header.SetContentType("application/json")
+	req.Header.Set(EventHeader, fmt.Sprintf("%s:%s:%s", s.ID, event.TransactionID, event.EventName))
+	req.Header.Set(SignatureHeader, Sign(s.Secret, timestamp, body))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.SetBody(body)
+
+	if err := w.client.DoTimeout(req, resp, w.Timeout); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code < 200 || code > 299 {
+		return &rejected{code: code, url: s.URL}
+	}
+	return nil
+}
+
+// Sign returns the value of SignatureHeader for the body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// endregion: run
+// region: helpers
+
+func (r *runner) delivered() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.status.Delivered++
+	r.status.Error = ""
+	r.status.Failures = 0
+	r.status.Last = time.Now().UTC()
+}
+
+func (r *runner) failed(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.status.Error = err.Error()
+	r.status.Failures++
+}
+
+func (r *runner) deadLetter(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.status.DeadLetters++
+	r.status.Error = err.Error()
+}
+
+func (r *runner) checkpoint(event *client.ChaincodeEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.status.Block = event.BlockNumber
+	r.status.Txid = event.TransactionID
+}
+
+// payload passes json payloads on as they are, anything else is base64 encoded.
+func payload(raw []byte) interface{} {
+	if json.Valid(raw) {
+		return json.RawMessage(raw)
+	}
+	return raw
+}
+
+// endregion: helpers
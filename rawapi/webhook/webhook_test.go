@@ -0,0 +1,163 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SandorMiskey/TEx-kit/log"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// endpoint answers the deliveries with the codes in turn, the last one over and over, and records
+// the ones that are signed right.
+type endpoint struct {
+	codes  []int
+	events []Event
+	mutex  sync.Mutex
+	posts  int
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	timestamp := r.Header.Get(TimestampHeader)
+	if unix, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(unix, 0)) > time.Minute {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get(SignatureHeader) != Sign("s3cr3t", timestamp, body) || r.Header.Get(EventHeader) != "erp:tx1:BundleCreated" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	code := e.codes[len(e.codes)-1]
+	if e.posts < len(e.codes) {
+		code = e.codes[e.posts]
+	}
+	e.posts++
+	if code == http.StatusOK {
+		var event Event
+		json.Unmarshal(body, &event)
+		e.events = append(e.events, event)
+	}
+	w.WriteHeader(code)
+}
+
+// deliver delivers an event to an endpoint answering with codes, and returns the endpoint along
+// with the status of the subscription and its dead letters.
+func deliver(t *testing.T, hooks *Webhooks, codes ...int) (*endpoint, Status, []DeadLetter) {
+	t.Helper()
+	e := &endpoint{codes: codes}
+	target := httptest.NewServer(e)
+	defer target.Close()
+
+	logger := log.NewLogger()
+	defer logger.Close()
+	hooks.Logger, hooks.Path = logger, filepath.Join(t.TempDir(), "webhooks.json")
+	if _, err := hooks.Init(); err != nil {
+		t.Fatal(err)
+	}
+	s := &Subscription{Chaincode: "bundles", Channel: "trustchain", ID: "erp", Secret: "s3cr3t", URL: target.URL}
+	r := &runner{}
+	event := &client.ChaincodeEvent{BlockNumber: 7, ChaincodeName: "bundles", EventName: "BundleCreated", Payload: []byte(`{"id":1}`), TransactionID: "tx1"}
+	if !hooks.deliver(context.Background(), s, r, event) {
+		t.Fatal("delivery was cancelled")
+	}
+
+	letters := make([]DeadLetter, 0)
+	raw, err := os.ReadFile(hooks.deadLetters(s.ID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	for _, line := range bytes.Split(bytes.TrimSpace(raw), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(line, &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	return e, r.status, letters
+}
+
+func TestDeliverRetries(t *testing.T) {
+	// the signature, the timestamp and the event header are checked by the endpoint
+	e, status, letters := deliver(t, &Webhooks{Backoff: time.Millisecond, MaxAttempts: 5}, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	if e.posts != 3 || len(e.events) != 1 || len(letters) != 0 || status.Delivered != 1 || status.Failures != 0 {
+		t.Fatalf("%d posts, events %+v, status %+v, dead letters %+v", e.posts, e.events, status, letters)
+	}
+	if event := e.events[0]; event.Txid != "tx1" || event.BlockNumber != 7 || event.Subscription != "erp" || event.Channel != "trustchain" {
+		t.Errorf("event %+v", event)
+	}
+}
+
+func TestDeliverDeadLetters(t *testing.T) {
+	// out of attempts
+	e, status, letters := deliver(t, &Webhooks{Backoff: time.Millisecond, MaxAttempts: 3}, http.StatusServiceUnavailable)
+	if e.posts != 3 || len(letters) != 1 || status.DeadLetters != 1 || status.Failures != 3 || status.Delivered != 0 {
+		t.Errorf("max attempts: %d posts, status %+v, dead letters %+v", e.posts, status, letters)
+	}
+	if len(letters) == 1 && (letters[0].Txid != "tx1" || letters[0].BlockNumber != 7 || letters[0].Error == "") {
+		t.Errorf("dead letter %+v", letters[0])
+	}
+
+	// out of time, the fourth attempt would be past the limit
+	e, status, letters = deliver(t, &Webhooks{Backoff: 40 * time.Millisecond, MaxAge: 100 * time.Millisecond}, http.StatusBadGateway)
+	if e.posts != 3 || len(letters) != 1 || status.DeadLetters != 1 {
+		t.Errorf("max age: %d posts, status %+v, dead letters %+v", e.posts, status, letters)
+	}
+
+	// rejected for good, unless the endpoint only asks to come back later
+	e, status, letters = deliver(t, &Webhooks{Backoff: time.Millisecond}, http.StatusRequestTimeout, http.StatusUnprocessableEntity)
+	if e.posts != 2 || len(letters) != 1 || status.DeadLetters != 1 {
+		t.Errorf("client error: %d posts, status %+v, dead letters %+v", e.posts, status, letters)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	logger := log.NewLogger()
+	defer logger.Close()
+	w := &Webhooks{Checkpoints: t.TempDir(), Logger: logger}
+	s := &Subscription{ID: "erp"}
+	r := &runner{}
+
+	for _, txid := range []string{"tx1", "tx2"} {
+		w.deadLetter(s, r, &client.ChaincodeEvent{BlockNumber: 7, EventName: "BundleCreated", Payload: []byte{0xff}, TransactionID: txid}, errors.New("unencodable"))
+	}
+	if r.status.DeadLetters != 2 || r.status.Error != "unencodable" {
+		t.Errorf("status %+v", r.status)
+	}
+
+	file, err := os.Open(w.deadLetters(s.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	letters := make([]DeadLetter, 0)
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) != 2 || letters[1].Txid != "tx2" || letters[1].BlockNumber != 7 || string(letters[1].Payload) != "\xff" || letters[1].Error != "unencodable" {
+		t.Errorf("dead letters %+v", letters)
+	}
+}
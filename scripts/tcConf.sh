@@ -970,20 +970,44 @@ export TC_COMMON1_C1_EXP=876000h
 # endregion: mgmt and metrics
 # region: raw api
 
+# export TC_RAWAPI_CONFIG=${TC_PATH_RAWAPI}/rawapi.yaml
 # export TC_RAWAPI_KEY=$TC_RAWAPI_KEY
+# export TC_RAWAPI_KEYS=${TC_PATH_RAWAPI}/keys.json
+# export TC_RAWAPI_AUTH_MODE=any
+# export TC_RAWAPI_AUDIT_DIR=${TC_PATH_RAWAPI}/audit
+# export TC_RAWAPI_AUDIT_MAXSIZE=67108864
+# export TC_RAWAPI_AUDIT_MAXFILES=0
+# export TC_RAWAPI_AUTH_JWT_JWKS=https://auth.example.com/.well-known/jwks.json
+# export TC_RAWAPI_AUTH_JWT_ISSUER=https://auth.example.com/
+# export TC_RAWAPI_AUTH_JWT_AUDIENCE=trustchain-rawapi
+# export TC_RAWAPI_AUTH_JWT_PERMISSIONSCLAIM=permissions
+# export TC_RAWAPI_AUTH_JWT_IDENTITYCLAIM=fabric_identity
+# export TC_RAWAPI_AUTH_JWT_ORGSCLAIM=orgs
+# export TC_RAWAPI_AUTH_WALLET=${TC_PATH_RAWAPI}/wallet
+# export TC_RAWAPI_AUTH_WALLETPASSPHRASE_FILE=${TC_PATH_RAWAPI}/wallet.pass
+# export TC_RAWAPI_IDENTITY=gateway
 export TC_RAWAPI_HTTP_ENABLED=true
 export TC_RAWAPI_HTTP_NAME="TrustChain backend"
 export TC_RAWAPI_HTTP_PORT=$TC_ORG1_GW1_PORT1
+# export TC_RAWAPI_HTTP_SOCKET=${TC_PATH_RAWAPI}/http.sock
 export TC_RAWAPI_HTTP_STATIC_ENABLED=true
 export TC_RAWAPI_HTTP_STATIC_ROOT=$TC_ORG1_GW1_ASSETS_STATIC
 export TC_RAWAPI_HTTP_STATIC_INDEX="index.html"
 export TC_RAWAPI_HTTP_STATIC_ERROR="index.html"
 export TC_RAWAPI_HTTPS_ENABLED=true
 export TC_RAWAPI_HTTPS_PORT=$TC_ORG1_GW1_PORT2
+# export TC_RAWAPI_HTTPS_SOCKET=${TC_PATH_RAWAPI}/https.sock
 # export TC_RAWAPI_HTTPS_CERT=""
 # export TC_RAWAPI_HTTPS_CERT_FILE=""
 # export TC_RAWAPI_HTTPS_KEY=""
 # export TC_RAWAPI_HTTPS_KEY_FILE=""
+# export TC_RAWAPI_HTTPS_CLIENTCA=${TC_PATH_RAWAPI}/clients-ca.pem
+# export TC_RAWAPI_HTTPS_CLIENTAUTH=request
+# export TC_RAWAPI_HTTPS_CLIENTCERTS=${TC_PATH_RAWAPI}/clients.json
+# export TC_RAWAPI_HTTPS_RELOAD=1m
+# export TC_RAWAPI_GRPC_ENABLED=true
+# export TC_RAWAPI_GRPC_PORT=5997
+# export TC_RAWAPI_GRPC_TLS=true
 export TC_RAWAPI_LATOR_WHICH=/usr/local/bin/configtxlator
 export TC_RAWAPI_LATOR_BIND=127.0.0.1
 export TC_RAWAPI_LATOR_PORT=1337
@@ -991,6 +1015,8 @@ export TC_RAWAPI_LATOR_PORT=1337
 export TC_RAWAPI_LOGALLERRORS=true
 export TC_RAWAPI_MAXREQUESTBODYSIZE=4194304
 export TC_RAWAPI_NETWORKPROTO="tcp"
+# export TC_RAWAPI_HTTP_SOCKETMODE=0660
+# export TC_RAWAPI_HTTP_SOCKETOWNER="${TC_RAWAPI_USER:-root}:${TC_RAWAPI_GROUP:-root}"
 export TC_RAWAPI_LOGLEVEL=6
 export TC_RAWAPI_ORGNAME=$TC_ORG1_STACK
 export TC_RAWAPI_MSPID=${TC_ORG1_STACK}MSP
@@ -999,24 +1025,75 @@ export TC_RAWAPI_KEYPATH="${TC_ORG1_CLIENTMSP}/keystore/"
 export TC_RAWAPI_TLSCERTPATH=${TC_ORG1_GW1_TLSMSP}/tlscacerts/tls-0-0-0-0-${TC_COMMON1_C1_PORT}.pem
 export TC_RAWAPI_PEERENDPOINT=${TC_ORG1_P1_FQDN}:${TC_ORG1_P1_PORT}
 export TC_RAWAPI_GATEWAYPEER=${TC_ORG1_P1_FQDN}
+# export TC_RAWAPI_PROFILE=${TC_PATH_RAWAPI}/connection.yaml
+# export TC_RAWAPI_PROFILE_PEER=${TC_ORG1_P1_FQDN}
+# export TC_RAWAPI_CONSISTENCY_PEERS="${TC_ORG1_P1_FQDN},${TC_ORG1_P2_FQDN}"
+# export TC_RAWAPI_CA_URL=https://${TC_ORG1_C1_FQDN}:${TC_ORG1_C1_PORT}
+# export TC_RAWAPI_CA_NAME=${TC_ORG1_C1_NAME}
+# export TC_RAWAPI_CA_TLSCERT=$TC_RAWAPI_TLSCERTPATH
+# export TC_RAWAPI_CA_RENEWDAYS=30
+# export TC_RAWAPI_CA_CHECK=1h
+# export TC_RAWAPI_RELOAD=1m
+# export TC_RAWAPI_CERTS_CHECK=1h
+# export TC_RAWAPI_CERTS_WARNDAYS="30,14,7,1"
+# export TC_RAWAPI_CACHE_ENABLED=true
+# export TC_RAWAPI_CACHE_FUNCTIONS="te-food-bundles:BundleGet,qscc:GetChainInfo=2s"
+# export TC_RAWAPI_CACHE_INVALIDATE=true
+# export TC_RAWAPI_CACHE_SIZE=1024
+# export TC_RAWAPI_CACHE_TTL=10s
+# export TC_RAWAPI_TIMEOUT_EVALUATE=5s
+# export TC_RAWAPI_TIMEOUT_ENDORSE=15s
+# export TC_RAWAPI_TIMEOUT_SUBMIT=5s
+# export TC_RAWAPI_TIMEOUT_COMMITSTATUS=1m
+# export TC_RAWAPI_TIMEOUT_OVERRIDES="te-food-bundles:CreateBundle/endorse=30s,qscc=20s"
+# export TC_RAWAPI_QUEUE_PATH=${TC_PATH_RAWAPI}/queue.db
+# export TC_RAWAPI_QUEUE_BACKOFF=1s
+# export TC_RAWAPI_QUEUE_BACKOFFMAX=5m
+# export TC_RAWAPI_QUEUE_MAXATTEMPTS=20
+# export TC_RAWAPI_QUEUE_POLL=1s
+# export TC_RAWAPI_TRANSACTIONS_SIZE=4096
+# export TC_RAWAPI_TRANSACTIONS_TTL=1h
+# export TC_RAWAPI_WEBHOOK_PATH=${TC_PATH_RAWAPI}/webhooks.json
+# export TC_RAWAPI_WEBHOOK_CHECKPOINTS=${TC_PATH_RAWAPI}/webhooks
+# export TC_RAWAPI_WEBHOOK_BACKOFF=1s
+# export TC_RAWAPI_WEBHOOK_BACKOFFMAX=5m
+# export TC_RAWAPI_WEBHOOK_TIMEOUT=10s
+# export TC_RAWAPI_ADMIN_PORT=5996
+# export TC_RAWAPI_ADMIN_SOCKET=${TC_PATH_RAWAPI}/admin.sock
+# export TC_RAWAPI_ADMIN_TLS=true
 
 # endregion: raw api
 # region: migration
 
+# export TC_MIG_CA_NAME=$TC_RAWAPI_CA_NAME
+# export TC_MIG_CA_TLSCERT=$TC_RAWAPI_CA_TLSCERT
+# export TC_MIG_CA_URL=$TC_RAWAPI_CA_URL
+# export TC_MIG_CERTS_PATH=$TC_ORG1_DATA
+# export TC_MIG_CERTS_WARNDAYS=30
+# export TC_MIG_CONSISTENCY_PEERS=$TC_RAWAPI_CONSISTENCY_PEERS
 export TC_MIG_FAB_CH=$TC_CHANNEL2_NAME
 export TC_MIG_FAB_ENDPOINT=$TC_RAWAPI_PEERENDPOINT
 export TC_MIG_FAB_GW=$TC_RAWAPI_GATEWAYPEER
 export TC_MIG_FAB_MSPID=$TC_RAWAPI_MSPID
+# export TC_MIG_FAB_PROFILE=$TC_RAWAPI_PROFILE
 export TC_MIG_HTTP_APIKEY=$TC_HTTP_API_KEY
 export TC_MIG_HTTP_PORT=$TC_RAWAPI_HTTP_PORT
 export TC_MIG_LATOR_EXE=$TC_PATH_BIN/configtxlator
 export TC_MIG_LATOR_BIND=$TC_RAWAPI_LATOR_BIND
 export TC_MIG_LATOR_PORT=0
 export TC_MIG_LOGLEVEL=$TC_RAWAPI_LOGLEVEL
+# export TC_MIG_MONITOR_ALERT_CMD='logger -t tc-monitor "$TC_MIG_ALERT_STATE $TC_MIG_ALERT_KIND $TC_MIG_ALERT_CHANNEL $TC_MIG_ALERT_PEER $TC_MIG_ALERT_MESSAGE"'
+# export TC_MIG_MONITOR_LAG=10
+# export TC_MIG_MONITOR_PEERS=$TC_MIG_CONSISTENCY_PEERS
+# export TC_MIG_MONITOR_PORT=9188
+# export TC_MIG_MONITOR_STALL=5m
+# export TC_MIG_MONITOR_WEBHOOK=http://localhost:9093/tc-monitor
 export TC_MIG_PATH_CERT=$TC_RAWAPI_CERTPATH
 export TC_MIG_PATH_KEYSTORE=$TC_RAWAPI_KEYPATH
 export TC_MIG_PATH_RC=$TC_PATH_RC
 export TC_MIG_PATH_TLSCERT=$TC_RAWAPI_TLSCERTPATH
+# export TC_MIG_WALLET=$TC_RAWAPI_AUTH_WALLET
+# export TC_MIG_WALLET_PASSPHRASE_FILE=$TC_RAWAPI_AUTH_WALLETPASSPHRASE_FILE
 
 # endregion: migration
 # region: common funcs